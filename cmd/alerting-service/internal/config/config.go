@@ -0,0 +1,26 @@
+package config
+
+import (
+	"os"
+)
+
+type Config struct {
+	Port         string
+	KafkaBrokers []string
+	KafkaTopic   string
+}
+
+func Load() *Config {
+	return &Config{
+		Port:         getEnv("SERVICE_PORT", "8080"),
+		KafkaBrokers: []string{getEnv("KAFKA_BROKER", "kafka:9092")},
+		KafkaTopic:   getEnv("KAFKA_TOPIC_ALERTS", "alerts"),
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
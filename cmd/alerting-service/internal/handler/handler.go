@@ -1 +1,141 @@
-package handler
\ No newline at end of file
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/cmd/alerting-service/internal/service"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+type Handler struct {
+	svc *service.Service
+}
+
+func NewHandler(svc *service.Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+type acknowledgeRequest struct {
+	AssignedTo string `json:"assigned_to"`
+}
+
+type resolveRequest struct {
+	ResolvedBy      string `json:"resolved_by"`
+	ResolutionNotes string `json:"resolution_notes"`
+}
+
+func (h *Handler) ListAlerts(c *gin.Context) {
+	h.listAlerts(c, c.Query("location_id"))
+}
+
+func (h *Handler) ListAlertsByLocation(c *gin.Context) {
+	h.listAlerts(c, c.Param("locationId"))
+}
+
+func (h *Handler) listAlerts(c *gin.Context, locationID string) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad request",
+			Message: "limit must be a positive integer",
+		})
+		return
+	}
+
+	alerts, err := h.svc.ListAlerts(c.Request.Context(), postgres.AlertFilter{
+		Status:     c.Query("status"),
+		Severity:   c.Query("severity"),
+		AlertType:  c.Query("alert_type"),
+		LocationID: locationID,
+		Limit:      limit,
+	})
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: alerts})
+}
+
+func (h *Handler) AcknowledgeAlert(c *gin.Context) {
+	id, ok := h.alertID(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional
+	var req acknowledgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Bad request", Message: err.Error()})
+		return
+	}
+
+	// Default to the caller authenticated by the api-gateway
+	if req.AssignedTo == "" {
+		req.AssignedTo = c.GetHeader(shared.HeaderUserID)
+	}
+
+	alert, err := h.svc.Acknowledge(c.Request.Context(), id, req.AssignedTo)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: alert})
+}
+
+func (h *Handler) ResolveAlert(c *gin.Context) {
+	id, ok := h.alertID(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional
+	var req resolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Bad request", Message: err.Error()})
+		return
+	}
+
+	if req.ResolvedBy == "" {
+		req.ResolvedBy = c.GetHeader(shared.HeaderUserID)
+	}
+
+	alert, err := h.svc.Resolve(c.Request.Context(), id, req.ResolvedBy, req.ResolutionNotes)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: alert})
+}
+
+func (h *Handler) alertID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad request",
+			Message: "alert id must be numeric",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, postgres.ErrNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Not found", Code: http.StatusNotFound, Message: err.Error()})
+	case errors.Is(err, service.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, models.ErrorResponse{Error: "Conflict", Code: http.StatusConflict, Message: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Internal server error", Code: http.StatusInternalServerError, Message: err.Error()})
+	}
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/internal/pkg/health"
+)
+
+// NewRouter registers the alerting routes and the health endpoints of
+// checker on a new Gin engine
+func NewRouter(h *Handler, checker *health.Checker) *gin.Engine {
+	router := gin.Default()
+	checker.Register(router)
+	router.GET("/alerts", h.ListAlerts)
+	router.GET("/alerts/:locationId", h.ListAlertsByLocation)
+	router.POST("/alerts/:id/acknowledge", h.AcknowledgeAlert)
+	router.POST("/alerts/:id/resolve", h.ResolveAlert)
+	return router
+}
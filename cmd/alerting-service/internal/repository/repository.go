@@ -1 +1,29 @@
-package repository
\ No newline at end of file
+package repository
+
+import (
+	"context"
+
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+type Repository struct {
+	db interfaces.AlertRepository
+}
+
+func NewRepository(db interfaces.AlertRepository) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) ListAlerts(ctx context.Context, filter postgres.AlertFilter) ([]*models.Alert, error) {
+	return r.db.List(ctx, filter)
+}
+
+func (r *Repository) GetAlert(ctx context.Context, id int64) (*models.Alert, error) {
+	return r.db.GetByID(ctx, id)
+}
+
+func (r *Repository) TransitionAlert(ctx context.Context, id int64, apply func(alert *models.Alert) error) (*models.Alert, string, error) {
+	return r.db.Transition(ctx, id, apply)
+}
@@ -1 +1,120 @@
 package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"api-traffic-analytics/cmd/alerting-service/internal/repository"
+	"api-traffic-analytics/internal/interfaces"
+	kafkaPkg "api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// ErrInvalidTransition is returned when an alert cannot move to the requested status
+var ErrInvalidTransition = errors.New("invalid alert status transition")
+
+// Status changes that fail to publish are retried in the background, waiting
+// publishRetryBackoff before the first retry and twice as long before each
+// of the next ones
+const (
+	publishAttempts     = 6
+	publishRetryBackoff = 500 * time.Millisecond
+)
+
+// allowedTransitions lists the statuses an alert may move to from each status
+var allowedTransitions = map[string][]string{
+	models.AlertStatusActive:       {models.AlertStatusAcknowledged, models.AlertStatusResolved},
+	models.AlertStatusAcknowledged: {models.AlertStatusResolved},
+}
+
+type Service struct {
+	repo     *repository.Repository
+	producer interfaces.EventProducer
+}
+
+func NewService(repo *repository.Repository, producer interfaces.EventProducer) *Service {
+	return &Service{repo: repo, producer: producer}
+}
+
+func (s *Service) ListAlerts(ctx context.Context, filter postgres.AlertFilter) ([]*models.Alert, error) {
+	return s.repo.ListAlerts(ctx, filter)
+}
+
+func (s *Service) GetAlert(ctx context.Context, id int64) (*models.Alert, error) {
+	return s.repo.GetAlert(ctx, id)
+}
+
+// Acknowledge marks an active alert as acknowledged by assignedTo
+func (s *Service) Acknowledge(ctx context.Context, id int64, assignedTo string) (*models.Alert, error) {
+	return s.transition(ctx, id, models.AlertStatusAcknowledged, func(alert *models.Alert) {
+		alert.AssignedTo = assignedTo
+	})
+}
+
+// Resolve closes an active or acknowledged alert
+func (s *Service) Resolve(ctx context.Context, id int64, resolvedBy, notes string) (*models.Alert, error) {
+	return s.transition(ctx, id, models.AlertStatusResolved, func(alert *models.Alert) {
+		now := time.Now().UTC()
+		alert.ResolvedAt = &now
+		alert.ResolvedBy = resolvedBy
+		alert.ResolutionNotes = notes
+	})
+}
+
+// transition validates and applies a status change, then publishes it. The
+// change is committed once saved, so a failed publish does not fail it: the
+// event is published again in the background.
+func (s *Service) transition(ctx context.Context, id int64, status string, mutate func(alert *models.Alert)) (*models.Alert, error) {
+	alert, previous, err := s.repo.TransitionAlert(ctx, id, func(alert *models.Alert) error {
+		if !canTransition(alert.Status, status) {
+			return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, alert.Status, status)
+		}
+		alert.Status = status
+		mutate(alert)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	event := kafkaPkg.NewAlertEvent(alert, previous)
+	if err := s.publish(ctx, event); err != nil {
+		log.Printf("failed to publish alert %d status change, retrying: %v", alert.ID, err)
+		go s.retryPublish(context.WithoutCancel(ctx), event)
+	}
+
+	return alert, nil
+}
+
+func (s *Service) publish(ctx context.Context, event kafkaPkg.AlertEvent) error {
+	return s.producer.PublishEvent(ctx, event.Key(),
+		kafkaPkg.EventTypeAlertStatusChanged, kafkaPkg.AlertSchemaVersion, event)
+}
+
+// retryPublish publishes event with exponential backoff until it succeeds or
+// the attempts run out
+func (s *Service) retryPublish(ctx context.Context, event kafkaPkg.AlertEvent) {
+	backoff := publishRetryBackoff
+	var err error
+	for attempt := 1; attempt < publishAttempts; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		if err = s.publish(ctx, event); err == nil {
+			return
+		}
+	}
+	log.Printf("giving up publishing alert %d status change %s -> %s: %v", event.ID, event.PreviousStatus, event.Status, err)
+}
+
+func canTransition(from, to string) bool {
+	for _, allowed := range allowedTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
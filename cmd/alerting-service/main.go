@@ -1 +1,85 @@
-package alertingservice
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"api-traffic-analytics/cmd/alerting-service/internal/config"
+	"api-traffic-analytics/cmd/alerting-service/internal/handler"
+	"api-traffic-analytics/cmd/alerting-service/internal/repository"
+	"api-traffic-analytics/cmd/alerting-service/internal/service"
+	"api-traffic-analytics/internal/pkg/health"
+	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/migrate"
+	"api-traffic-analytics/internal/pkg/postgres"
+)
+
+func main() {
+	cfg := config.Load()
+
+	// Initialize PostgreSQL
+	db, err := postgres.ConnectDB()
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v\n", err)
+	}
+
+	// "migrate" manages the schema and exits; otherwise apply pending
+	// migrations when DB_AUTO_MIGRATE is set
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(context.Background(), db, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("migrate failed: %v", err)
+		}
+		return
+	}
+	if err := migrate.AutoMigrate(context.Background(), db); err != nil {
+		log.Fatalf("Unable to migrate database: %v\n", err)
+	}
+
+	// Initialize Kafka Producer for alert state changes
+	producer := kafka.CreateProducer(cfg.KafkaBrokers, cfg.KafkaTopic, "alerting-service")
+	defer producer.Close()
+
+	// Create repository, service, and handler
+	repo := repository.NewRepository(postgres.NewAlertRepository(db))
+	svc := service.NewService(repo, producer)
+	h := handler.NewHandler(svc)
+
+	// Readiness depends on the database and Kafka
+	checker := health.NewChecker("alerting-service", health.DefaultTimeout).
+		Add("postgres", func(ctx context.Context) error { return postgres.Ping(ctx, db) }).
+		Add("kafka", func(ctx context.Context) error { return kafka.Ping(ctx, cfg.KafkaBrokers) })
+
+	router := handler.NewRouter(h, checker)
+
+	// Create HTTP server
+	srv := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: router,
+	}
+
+	// Start server in a goroutine
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("listen: %s\n", err)
+		}
+	}()
+
+	// Wait for interrupt signal to gracefully shut down the server
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Fatal("Server forced to shutdown:", err)
+	}
+
+	log.Println("Server exiting")
+}
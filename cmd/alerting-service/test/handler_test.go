@@ -1 +1,119 @@
-package test
\ No newline at end of file
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/cmd/alerting-service/internal/handler"
+	"api-traffic-analytics/internal/pkg/health"
+	"api-traffic-analytics/internal/shared"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+func newRouter(t *testing.T) (*gin.Engine, *alerting) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	a := newAlerting(t)
+	return handler.NewRouter(handler.NewHandler(a.svc), health.NewChecker("alerting-service", time.Second)), a
+}
+
+func serve(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestListAlerts(t *testing.T) {
+	router, _ := newRouter(t)
+
+	rec := serve(router, http.MethodGet, "/alerts/LOC001?status=active", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /alerts/LOC001 = %d: %s", rec.Code, rec.Body)
+	}
+	var page struct {
+		Data []models.Alert `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding alerts: %v", err)
+	}
+	if len(page.Data) != 1 || page.Data[0].AlertType != models.AlertTypeCongestion {
+		t.Errorf("alerts = %+v", page.Data)
+	}
+}
+
+func TestAcknowledgeAndResolveEndpoints(t *testing.T) {
+	router, a := newRouter(t)
+
+	rec := serve(router, http.MethodPost, fmt.Sprintf("/alerts/%d/acknowledge", a.alertID), `{"assigned_to":"operator"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("acknowledge = %d: %s", rec.Code, rec.Body)
+	}
+
+	// Acknowledging twice is not a valid transition
+	if rec := serve(router, http.MethodPost, fmt.Sprintf("/alerts/%d/acknowledge", a.alertID), ""); rec.Code != http.StatusConflict {
+		t.Errorf("second acknowledge = %d, want 409", rec.Code)
+	}
+
+	rec = serve(router, http.MethodPost, fmt.Sprintf("/alerts/%d/resolve", a.alertID), `{"resolved_by":"operator","resolution_notes":"cleared"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("resolve = %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := serve(router, http.MethodPost, "/alerts/999/resolve", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("resolving a missing alert = %d, want 404", rec.Code)
+	}
+	if rec := serve(router, http.MethodPost, "/alerts/abc/resolve", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("non-numeric id = %d, want 400", rec.Code)
+	}
+
+	if msgs := a.broker.Messages(alertsTopic); len(msgs) != 2 {
+		t.Errorf("published %d changes, want 2", len(msgs))
+	}
+}
+
+func TestResolveDefaultsToGatewayIdentity(t *testing.T) {
+	router, a := newRouter(t)
+
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/alerts/%d/resolve", a.alertID), nil)
+	req.Header.Set(shared.HeaderUserID, "luis")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("resolve = %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp struct {
+		Data models.Alert `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding alert: %v", err)
+	}
+	if resp.Data.ResolvedBy != "luis" {
+		t.Errorf("resolved_by = %q, want the caller authenticated by the gateway", resp.Data.ResolvedBy)
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	router, _ := newRouter(t)
+
+	for _, path := range []string{"/health/live", "/health/ready"} {
+		rec := serve(router, http.MethodGet, path, "")
+		var response models.HealthCheckResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decoding %s: %v", path, err)
+		}
+		if rec.Code != http.StatusOK || response.Status != health.StatusHealthy || response.Version != shared.Version {
+			t.Errorf("GET %s = %d %+v", path, rec.Code, response)
+		}
+	}
+}
@@ -1 +1,166 @@
-package test
\ No newline at end of file
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/cmd/alerting-service/internal/repository"
+	"api-traffic-analytics/cmd/alerting-service/internal/service"
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/memory"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+const alertsTopic = "alerts"
+
+// alerting is an alerting-service wired to the in-memory fakes, with one
+// active congestion alert
+type alerting struct {
+	svc     *service.Service
+	broker  *memory.Broker
+	alertID int64
+}
+
+func newAlerting(t *testing.T) *alerting {
+	t.Helper()
+	ctx := context.Background()
+
+	store := memory.NewStore()
+	if err := memory.NewLocationRepository(store).Create(ctx, &models.Location{ID: "LOC001", Name: "Gran Via", City: "Madrid", IsActive: true}); err != nil {
+		t.Fatalf("creating location: %v", err)
+	}
+	alerts := memory.NewAlertRepository(store)
+	alert := &models.Alert{
+		LocationID: shared.StringPtr("LOC001"),
+		AlertType:  models.AlertTypeCongestion,
+		Severity:   models.SeverityHigh,
+		Message:    "Congestion index 0.90 at location LOC001",
+	}
+	if err := alerts.Create(ctx, alert); err != nil {
+		t.Fatalf("creating alert: %v", err)
+	}
+
+	broker := memory.NewBroker()
+	return &alerting{
+		svc:     service.NewService(repository.NewRepository(alerts), broker.Producer(alertsTopic, "alerting-service")),
+		broker:  broker,
+		alertID: int64(alert.ID),
+	}
+}
+
+func TestAcknowledgeThenResolvePublishesChanges(t *testing.T) {
+	a := newAlerting(t)
+	ctx := context.Background()
+
+	if _, err := a.svc.Acknowledge(ctx, a.alertID, "operator"); err != nil {
+		t.Fatalf("Acknowledge: %v", err)
+	}
+	alert, err := a.svc.Resolve(ctx, a.alertID, "operator", "cleared")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if alert.Status != models.AlertStatusResolved || alert.ResolvedAt == nil || alert.AssignedTo != "operator" {
+		t.Errorf("resolved alert = %+v", alert)
+	}
+
+	msgs := a.broker.Messages(alertsTopic)
+	if len(msgs) != 2 {
+		t.Fatalf("published %d changes, want 2", len(msgs))
+	}
+	want := [][2]string{
+		{models.AlertStatusActive, models.AlertStatusAcknowledged},
+		{models.AlertStatusAcknowledged, models.AlertStatusResolved},
+	}
+	for i, msg := range msgs {
+		event, env, err := kafka.DecodeAlertEvent(msg)
+		if err != nil {
+			t.Fatalf("decoding change %d: %v", i, err)
+		}
+		if event.PreviousStatus != want[i][0] || event.Status != want[i][1] {
+			t.Errorf("change %d: %s -> %s, want %s -> %s", i, event.PreviousStatus, event.Status, want[i][0], want[i][1])
+		}
+		if event.City != "Madrid" || env.Source != "alerting-service" {
+			t.Errorf("change %d: city %q, source %q", i, event.City, env.Source)
+		}
+	}
+}
+
+func TestInvalidTransitionsAreRejected(t *testing.T) {
+	a := newAlerting(t)
+	ctx := context.Background()
+
+	if _, err := a.svc.Resolve(ctx, a.alertID, "operator", ""); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if _, err := a.svc.Acknowledge(ctx, a.alertID, "operator"); !errors.Is(err, service.ErrInvalidTransition) {
+		t.Errorf("acknowledging a resolved alert: got %v, want ErrInvalidTransition", err)
+	}
+	if _, err := a.svc.Acknowledge(ctx, 999, "operator"); !errors.Is(err, postgres.ErrNotFound) {
+		t.Errorf("acknowledging a missing alert: got %v, want ErrNotFound", err)
+	}
+	if msgs := a.broker.Messages(alertsTopic); len(msgs) != 1 {
+		t.Errorf("published %d changes, want 1", len(msgs))
+	}
+}
+
+// flakyProducer fails its first publications, as many as failures
+type flakyProducer struct {
+	interfaces.EventProducer
+	failures int32
+}
+
+func (p *flakyProducer) PublishEvent(ctx context.Context, key, eventType string, schemaVersion int, payload interface{}) error {
+	if atomic.AddInt32(&p.failures, -1) >= 0 {
+		return errors.New("kafka unavailable")
+	}
+	return p.EventProducer.PublishEvent(ctx, key, eventType, schemaVersion, payload)
+}
+
+func TestTransitionSucceedsWhenPublishingFails(t *testing.T) {
+	ctx := context.Background()
+
+	store := memory.NewStore()
+	alerts := memory.NewAlertRepository(store)
+	alert := &models.Alert{LocationID: shared.StringPtr("LOC001"), AlertType: models.AlertTypeCongestion, Severity: models.SeverityHigh}
+	if err := alerts.Create(ctx, alert); err != nil {
+		t.Fatalf("creating alert: %v", err)
+	}
+	broker := memory.NewBroker()
+	producer := &flakyProducer{EventProducer: broker.Producer(alertsTopic, "alerting-service"), failures: 2}
+	svc := service.NewService(repository.NewRepository(alerts), producer)
+
+	acknowledged, err := svc.Acknowledge(ctx, int64(alert.ID), "operator")
+	if err != nil {
+		t.Fatalf("Acknowledge with Kafka down: %v", err)
+	}
+	if acknowledged.Status != models.AlertStatusAcknowledged {
+		t.Errorf("acknowledged alert = %+v", acknowledged)
+	}
+
+	// The change is committed: retrying it is an invalid transition
+	if _, err := svc.Acknowledge(ctx, int64(alert.ID), "operator"); !errors.Is(err, service.ErrInvalidTransition) {
+		t.Errorf("acknowledging again: got %v, want ErrInvalidTransition", err)
+	}
+
+	// and its event is published once Kafka is back
+	deadline := time.Now().Add(5 * time.Second)
+	for len(broker.Messages(alertsTopic)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the status change was never published")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	event, _, err := kafka.DecodeAlertEvent(broker.Messages(alertsTopic)[0])
+	if err != nil {
+		t.Fatalf("decoding change: %v", err)
+	}
+	if event.ID != alert.ID || event.PreviousStatus != models.AlertStatusActive || event.Status != models.AlertStatusAcknowledged {
+		t.Errorf("published change = %+v", event)
+	}
+}
@@ -6,22 +6,41 @@ import (
 )
 
 type Config struct {
-	KafkaBrokers      []string
-	KafkaTopic        string
-	KafkaGroupID      string
-	MetricsPort       string
-	ProcessingTimeout int
-	BatchSize         int
+	KafkaBrokers        []string
+	KafkaTopic          string
+	KafkaTopicAnalytics string
+	KafkaTopicAlerts    string
+	KafkaGroupID        string
+	Port                string
+	MetricsPort         string
+	ProcessingTimeout   int
+	BatchSize           int
+	CongestionThreshold float64
+	RollupInterval      int
+	RollupLag           int
+	BackfillBatchSize   int
+	BackfillRate        float64
+	// Readiness fails while more readings than this are pending
+	HealthMaxLag int64
 }
 
 func Load() *Config {
 	return &Config{
-		KafkaBrokers:      []string{getEnv("KAFKA_BROKER", "kafka:9092")},
-		KafkaTopic:        getEnv("KAFKA_TOPIC_TRAFFIC", "traffic-data"),
-		KafkaGroupID:      getEnv("KAFKA_CONSUMER_GROUP", "analytics-processor"),
-		MetricsPort:       getEnv("METRICS_PORT", "8080"),
-		ProcessingTimeout: getIntEnv("PROCESSING_TIMEOUT", 30),
-		BatchSize:         getIntEnv("BATCH_SIZE", 1),
+		KafkaBrokers:        []string{getEnv("KAFKA_BROKER", "kafka:9092")},
+		KafkaTopic:          getEnv("KAFKA_TOPIC_TRAFFIC", "traffic-data"),
+		KafkaTopicAnalytics: getEnv("KAFKA_TOPIC_ANALYTICS", "analytics-results"),
+		KafkaTopicAlerts:    getEnv("KAFKA_TOPIC_ALERTS", "alerts"),
+		KafkaGroupID:        getEnv("KAFKA_CONSUMER_GROUP", "analytics-processor"),
+		Port:                getEnv("SERVICE_PORT", "8080"),
+		MetricsPort:         getEnv("METRICS_PORT", "8080"),
+		ProcessingTimeout:   getIntEnv("PROCESSING_TIMEOUT", 30),
+		BatchSize:           getIntEnv("BATCH_SIZE", 1),
+		CongestionThreshold: getFloatEnv("ALERT_CONGESTION_THRESHOLD", 0.7),
+		RollupInterval:      getIntEnv("ROLLUP_INTERVAL_SECONDS", 60),
+		RollupLag:           getIntEnv("ROLLUP_LAG_SECONDS", 120),
+		BackfillBatchSize:   getIntEnv("BACKFILL_BATCH_SIZE", 500),
+		BackfillRate:        getFloatEnv("BACKFILL_RATE", 1000),
+		HealthMaxLag:        int64(getIntEnv("HEALTH_MAX_CONSUMER_LAG", 10000)),
 	}
 }
 
@@ -39,3 +58,13 @@ func getIntEnv(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		res, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			return res
+		}
+	}
+	return defaultValue
+}
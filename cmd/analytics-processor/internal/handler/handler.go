@@ -2,12 +2,14 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/segmentio/kafka-go"
+
 	"api-traffic-analytics/internal/interfaces"
+	kafkaPkg "api-traffic-analytics/internal/pkg/kafka"
 	"api-traffic-analytics/internal/shared/models"
 )
 
@@ -29,11 +31,11 @@ func NewMessageHandler(analyticsService interfaces.AnalyticsProcessor, logger *l
 }
 
 // HandleMessage procesa un mensaje individual de Kafka
-func (h *MessageHandler) HandleMessage(ctx context.Context, msgValue []byte) error {
+func (h *MessageHandler) HandleMessage(ctx context.Context, msg kafka.Message) error {
 	startTime := time.Now()
 
 	// Parsear datos de tráfico
-	trafficData, err := h.parseTrafficData(msgValue)
+	trafficData, err := h.parseTrafficData(msg)
 	if err != nil {
 		return fmt.Errorf("failed to parse traffic data: %w", err)
 	}
@@ -57,20 +59,20 @@ func (h *MessageHandler) HandleMessage(ctx context.Context, msgValue []byte) err
 	return nil
 }
 
-// parseTrafficData convierte bytes a modelo de TrafficData
-func (h *MessageHandler) parseTrafficData(data []byte) (*models.TrafficData, error) {
-	var trafficData models.TrafficData
-
-	if err := json.Unmarshal(data, &trafficData); err != nil {
-		return nil, fmt.Errorf("JSON unmarshal failed: %w", err)
+// parseTrafficData decodifica el mensaje (actualizando versiones antiguas del
+// esquema) a modelo de TrafficData
+func (h *MessageHandler) parseTrafficData(msg kafka.Message) (*models.TrafficData, error) {
+	trafficData, env, err := kafkaPkg.DecodeTrafficData(msg)
+	if err != nil {
+		return nil, fmt.Errorf("decode failed (schema v%d): %w", env.SchemaVersion, err)
 	}
 
 	// Validaciones adicionales
-	if err := h.validateTrafficData(&trafficData); err != nil {
+	if err := h.validateTrafficData(trafficData); err != nil {
 		return nil, fmt.Errorf("data validation failed: %w", err)
 	}
 
-	return &trafficData, nil
+	return trafficData, nil
 }
 
 // validateTrafficData valida los datos de tráfico
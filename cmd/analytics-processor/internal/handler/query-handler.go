@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// Límites del parámetro limit
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// AnalyticsQuerier define las consultas que necesita QueryHandler
+type AnalyticsQuerier interface {
+	QueryResults(ctx context.Context, filter postgres.AnalyticsFilter) ([]*models.AnalyticsResult, string, error)
+	Aggregate(ctx context.Context, spec postgres.AggregateSpec) ([]*postgres.AnalyticsAggregate, error)
+	Summary(ctx context.Context, locationID, metricType string) ([]*models.AnalyticsSummary, error)
+}
+
+// QueryHandler atiende la API HTTP de consulta de resultados de análisis
+type QueryHandler struct {
+	svc AnalyticsQuerier
+}
+
+// NewQueryHandler crea una nueva instancia de QueryHandler
+func NewQueryHandler(svc AnalyticsQuerier) *QueryHandler {
+	return &QueryHandler{svc: svc}
+}
+
+// ListResults atiende GET /analytics
+func (h *QueryHandler) ListResults(c *gin.Context) {
+	h.listResults(c, c.Query("location_id"))
+}
+
+// ListResultsByLocation atiende GET /analytics/:locationId
+func (h *QueryHandler) ListResultsByLocation(c *gin.Context) {
+	h.listResults(c, c.Param("locationId"))
+}
+
+func (h *QueryHandler) listResults(c *gin.Context, locationID string) {
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	filter.LocationID = locationID
+	filter.Cursor = c.Query("cursor")
+
+	filter.Limit = defaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxLimit {
+			badRequest(c, fmt.Sprintf("limit must be between 1 and %d", maxLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	results, next, err := h.svc.QueryResults(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, postgres.ErrInvalidCursor) {
+			badRequest(c, err.Error())
+			return
+		}
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PageResponse{Data: results, Count: len(results), NextCursor: next})
+}
+
+// Aggregate atiende GET /analytics/aggregate
+//
+// Parámetros: metric_type (obligatorio), group_by (hour|day|location,
+// combinables con coma), func (avg|min|max|sum|count|percentile), p (0-1,
+// para percentile) y los filtros de ListResults.
+func (h *QueryHandler) Aggregate(c *gin.Context) {
+	filter, err := parseAnalyticsFilter(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	filter.LocationID = c.Query("location_id")
+	if filter.MetricType == "" {
+		badRequest(c, "metric_type is required")
+		return
+	}
+
+	spec := postgres.AggregateSpec{
+		Filter:   filter,
+		Function: c.DefaultQuery("func", postgres.AggregateAvg),
+	}
+	switch spec.Function {
+	case postgres.AggregateAvg, postgres.AggregateMin, postgres.AggregateMax,
+		postgres.AggregateSum, postgres.AggregateCount, postgres.AggregatePercentile:
+	default:
+		badRequest(c, fmt.Sprintf("unsupported func %q", spec.Function))
+		return
+	}
+
+	hasTimeBucket := false
+	if raw := c.Query("group_by"); raw != "" {
+		for _, dim := range strings.Split(raw, ",") {
+			dim = strings.TrimSpace(dim)
+			switch dim {
+			case postgres.GroupByHour, postgres.GroupByDay:
+				if hasTimeBucket {
+					badRequest(c, "group_by accepts a single time bucket (hour or day)")
+					return
+				}
+				hasTimeBucket = true
+			case postgres.GroupByLocation:
+			default:
+				badRequest(c, fmt.Sprintf("unsupported group_by %q", dim))
+				return
+			}
+			spec.GroupBy = append(spec.GroupBy, dim)
+		}
+	}
+
+	if spec.Function == postgres.AggregatePercentile {
+		p, err := strconv.ParseFloat(c.Query("p"), 64)
+		if err != nil || p < 0 || p > 1 {
+			badRequest(c, "p must be a number between 0 and 1")
+			return
+		}
+		spec.Percentile = p
+	}
+
+	aggregates, err := h.svc.Aggregate(c.Request.Context(), spec)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: aggregates})
+}
+
+// Summary atiende GET /analytics/summary
+func (h *QueryHandler) Summary(c *gin.Context) {
+	summary, err := h.svc.Summary(c.Request.Context(), c.Query("location_id"), c.Query("metric_type"))
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: summary})
+}
+
+// parseAnalyticsFilter lee metric_type, from, to e is_anomaly
+func parseAnalyticsFilter(c *gin.Context) (postgres.AnalyticsFilter, error) {
+	filter := postgres.AnalyticsFilter{MetricType: c.Query("metric_type")}
+
+	var err error
+	if filter.From, err = parseTime(c.Query("from")); err != nil {
+		return filter, fmt.Errorf("from: %w", err)
+	}
+	if filter.To, err = parseTime(c.Query("to")); err != nil {
+		return filter, fmt.Errorf("to: %w", err)
+	}
+
+	if raw := c.Query("is_anomaly"); raw != "" {
+		anomaly, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, fmt.Errorf("is_anomaly must be true or false")
+		}
+		filter.IsAnomaly = &anomaly
+	}
+
+	return filter, nil
+}
+
+// parseTime interpreta un timestamp RFC3339 opcional
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC3339 timestamp, got %q", value)
+	}
+	return t.UTC(), nil
+}
+
+func badRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Bad request", Code: http.StatusBadRequest, Message: message})
+}
+
+func internalError(c *gin.Context, err error) {
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Internal server error", Code: http.StatusInternalServerError, Message: err.Error()})
+}
@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"api-traffic-analytics/internal/pkg/health"
+)
+
+// NewQueryRouter registra la API de consulta, /metrics y los endpoints de
+// salud de checker en un nuevo motor Gin
+func NewQueryRouter(h *QueryHandler, checker *health.Checker) *gin.Engine {
+	router := gin.Default()
+	checker.Register(router)
+	router.GET("/analytics", h.ListResults)
+	router.GET("/analytics/summary", h.Summary)
+	router.GET("/analytics/aggregate", h.Aggregate)
+	router.GET("/analytics/:locationId", h.ListResultsByLocation)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	return router
+}
@@ -2,19 +2,85 @@ package repository
 
 import (
 	"context"
+	"time"
 
+	"api-traffic-analytics/internal/interfaces"
 	"api-traffic-analytics/internal/pkg/postgres"
 	"api-traffic-analytics/internal/shared/models"
 )
 
 type Repository struct {
-	postgresRepo *postgres.TrafficDataRepository
+	alertRepo      interfaces.AlertRepository
+	analyticsRepo  interfaces.AnalyticsResultRepository
+	rollupRepo     interfaces.RollupRepository
+	trafficRepo    interfaces.TrafficDataRepository
+	checkpointRepo interfaces.BackfillCheckpointRepository
 }
 
-func NewRepository(postgresRepo *postgres.TrafficDataRepository) *Repository {
-	return &Repository{postgresRepo: postgresRepo}
+func NewRepository(
+	alertRepo interfaces.AlertRepository,
+	analyticsRepo interfaces.AnalyticsResultRepository,
+	rollupRepo interfaces.RollupRepository,
+	trafficRepo interfaces.TrafficDataRepository,
+	checkpointRepo interfaces.BackfillCheckpointRepository,
+) *Repository {
+	return &Repository{
+		alertRepo:      alertRepo,
+		analyticsRepo:  analyticsRepo,
+		rollupRepo:     rollupRepo,
+		trafficRepo:    trafficRepo,
+		checkpointRepo: checkpointRepo,
+	}
 }
 
-func (r *Repository) StoreAnalyticsResult(ctx context.Context, result *models.AnalyticsResult) error {
-	return r.postgresRepo.CreateAnalyticsResult(ctx, result)
+// StoreAnalyticsResults guarda los resultados en una sola escritura,
+// sobrescribiendo los de un periodo ya procesado
+func (r *Repository) StoreAnalyticsResults(ctx context.Context, results []*models.AnalyticsResult) error {
+	return r.analyticsRepo.Upsert(ctx, results)
+}
+
+func (r *Repository) QueryAnalyticsResults(ctx context.Context, filter postgres.AnalyticsFilter) ([]*models.AnalyticsResult, string, error) {
+	return r.analyticsRepo.Query(ctx, filter)
+}
+
+func (r *Repository) AggregateAnalyticsResults(ctx context.Context, spec postgres.AggregateSpec) ([]*postgres.AnalyticsAggregate, error) {
+	return r.analyticsRepo.Aggregate(ctx, spec)
+}
+
+func (r *Repository) AnalyticsSummary(ctx context.Context, locationID, metricType string) ([]*models.AnalyticsSummary, error) {
+	return r.analyticsRepo.Summary(ctx, locationID, metricType)
+}
+
+func (r *Repository) FindOpenAlert(ctx context.Context, locationID, alertType string) (*models.Alert, error) {
+	return r.alertRepo.FindOpen(ctx, locationID, alertType)
+}
+
+func (r *Repository) CreateAlert(ctx context.Context, alert *models.Alert) error {
+	return r.alertRepo.Create(ctx, alert)
+}
+
+func (r *Repository) TransitionAlert(ctx context.Context, id int64, apply func(alert *models.Alert) error) (*models.Alert, string, error) {
+	return r.alertRepo.Transition(ctx, id, apply)
+}
+
+func (r *Repository) RefreshRollups(ctx context.Context, until time.Time) (int64, error) {
+	return r.rollupRepo.Refresh(ctx, until)
+}
+
+// ListTrafficRange devuelve la siguiente página de lecturas históricas en
+// orden (timestamp, id)
+func (r *Repository) ListTrafficRange(ctx context.Context, rng postgres.TrafficRange) ([]*models.TrafficData, error) {
+	return r.trafficRepo.ListRange(ctx, rng)
+}
+
+func (r *Repository) GetBackfillCheckpoint(ctx context.Context, name string) (*models.BackfillCheckpoint, error) {
+	return r.checkpointRepo.Get(ctx, name)
+}
+
+func (r *Repository) SaveBackfillCheckpoint(ctx context.Context, checkpoint *models.BackfillCheckpoint) error {
+	return r.checkpointRepo.Save(ctx, checkpoint)
+}
+
+func (r *Repository) DeleteBackfillCheckpoint(ctx context.Context, name string) error {
+	return r.checkpointRepo.Delete(ctx, name)
 }
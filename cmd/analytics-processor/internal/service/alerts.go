@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"api-traffic-analytics/cmd/analytics-processor/internal/repository"
+	"api-traffic-analytics/internal/shared"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// alertResolver es el valor de resolved_by para alertas cerradas automáticamente
+const alertResolver = "analytics-processor"
+
+// Los cambios de estado que no se pudieron publicar se reintentan en segundo
+// plano, esperando publishRetryBackoff antes del primer reintento y el doble
+// antes de cada uno de los siguientes
+const (
+	publishAttempts     = 6
+	publishRetryBackoff = 500 * time.Millisecond
+)
+
+// alertEvaluator levanta y resuelve alertas de congestión según el umbral
+// configurado (ALERT_CONGESTION_THRESHOLD)
+type alertEvaluator struct {
+	repo                *repository.Repository
+	publisher           *EventPublisher
+	congestionThreshold float64
+}
+
+// evaluate compara los resultados de la lectura con el umbral de congestión
+func (e *alertEvaluator) evaluate(ctx context.Context, data *models.TrafficData, results []*models.AnalyticsResult) error {
+	for _, result := range results {
+		if result.MetricType != models.MetricCongestionIndex {
+			continue
+		}
+		if result.Value >= e.congestionThreshold {
+			alert := &models.Alert{
+				AlertType: models.AlertTypeCongestion,
+				Severity:  congestionSeverity(result.Value),
+				Message:   fmt.Sprintf("Congestion index %.2f at location %s", result.Value, data.LocationID),
+				Value:     shared.Float64Ptr(result.Value),
+				Threshold: shared.Float64Ptr(e.congestionThreshold),
+			}
+			if err := e.raise(ctx, data, alert); err != nil {
+				return err
+			}
+		} else if err := e.resolve(ctx, data.LocationID, models.AlertTypeCongestion, "Congestion index back under threshold"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// raise crea la alerta si no hay otra abierta del mismo tipo para la ubicación
+func (e *alertEvaluator) raise(ctx context.Context, data *models.TrafficData, alert *models.Alert) error {
+	open, err := e.repo.FindOpenAlert(ctx, data.LocationID, alert.AlertType)
+	if err != nil {
+		return err
+	}
+	if open != nil {
+		return nil
+	}
+
+	alert.LocationID = shared.StringPtr(data.LocationID)
+	alert.Status = models.AlertStatusActive
+	alert.Category = "traffic"
+	alert.Priority = severityPriority(alert.Severity)
+	if err := e.repo.CreateAlert(ctx, alert); err != nil {
+		return err
+	}
+	alert.Location = &data.Location
+
+	e.publish(ctx, alert, "")
+	return nil
+}
+
+// resolve cierra la alerta abierta del tipo indicado, si existe
+func (e *alertEvaluator) resolve(ctx context.Context, locationID, alertType, notes string) error {
+	open, err := e.repo.FindOpenAlert(ctx, locationID, alertType)
+	if err != nil || open == nil {
+		return err
+	}
+
+	alert, previous, err := e.repo.TransitionAlert(ctx, int64(open.ID), func(alert *models.Alert) error {
+		now := time.Now().UTC()
+		alert.Status = models.AlertStatusResolved
+		alert.ResolvedAt = &now
+		alert.ResolvedBy = alertResolver
+		alert.ResolutionNotes = notes
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	e.publish(ctx, alert, previous)
+	return nil
+}
+
+// publish publica el cambio de estado de la alerta. El cambio ya está guardado
+// y una redelivery no lo volvería a publicar, así que un fallo no se devuelve:
+// el evento se reintenta en segundo plano
+func (e *alertEvaluator) publish(ctx context.Context, alert *models.Alert, previousStatus string) {
+	if err := e.publisher.PublishAlertChange(ctx, alert, previousStatus); err != nil {
+		log.Printf("failed to publish alert %d status change, retrying: %v", alert.ID, err)
+		snapshot := *alert
+		go e.retryPublish(context.WithoutCancel(ctx), &snapshot, previousStatus)
+	}
+}
+
+// retryPublish publica el cambio con backoff exponencial hasta que lo logra o
+// se agotan los intentos
+func (e *alertEvaluator) retryPublish(ctx context.Context, alert *models.Alert, previousStatus string) {
+	backoff := publishRetryBackoff
+	var err error
+	for attempt := 1; attempt < publishAttempts; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		if err = e.publisher.PublishAlertChange(ctx, alert, previousStatus); err == nil {
+			return
+		}
+	}
+	log.Printf("giving up publishing alert %d status change %s -> %s: %v", alert.ID, previousStatus, alert.Status, err)
+}
+
+// congestionSeverity traduce el índice de congestión a una severidad
+func congestionSeverity(index float64) string {
+	switch {
+	case index >= 0.9:
+		return models.SeverityCritical
+	case index >= 0.8:
+		return models.SeverityHigh
+	default:
+		return models.SeverityMedium
+	}
+}
+
+// severityPriority traduce la severidad a la prioridad numérica de la alerta
+func severityPriority(severity string) int {
+	switch severity {
+	case models.SeverityCritical:
+		return 4
+	case models.SeverityHigh:
+		return 3
+	case models.SeverityMedium:
+		return 2
+	default:
+		return 1
+	}
+}
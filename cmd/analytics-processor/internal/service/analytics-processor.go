@@ -2,43 +2,89 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"api-traffic-analytics/cmd/analytics-processor/internal/config"
 	"api-traffic-analytics/cmd/analytics-processor/internal/repository"
 	"api-traffic-analytics/internal/interfaces"
 	"api-traffic-analytics/internal/shared"
 	"api-traffic-analytics/internal/shared/models"
 )
 
+// ProcessorVersion identifica la versión de los cálculos de performAnalysis.
+// Se guarda en el metadata de cada resultado: increméntala al cambiarlos y
+// reprocesa los periodos afectados con un backfill.
+const ProcessorVersion = "1.1.0"
+
 type analyticsProcessor struct {
-	repo *repository.Repository
+	repo      *repository.Repository
+	publisher *EventPublisher
+	alerts    *alertEvaluator
 }
 
-func NewAnalyticsProcessor(repo *repository.Repository) interfaces.AnalyticsProcessor {
-	return &analyticsProcessor{repo: repo}
+func NewAnalyticsProcessor(repo *repository.Repository, publisher *EventPublisher, cfg *config.Config) interfaces.AnalyticsProcessor {
+	return &analyticsProcessor{
+		repo:      repo,
+		publisher: publisher,
+		alerts: &alertEvaluator{
+			repo:                repo,
+			publisher:           publisher,
+			congestionThreshold: cfg.CongestionThreshold,
+		},
+	}
 }
 
 // ProcessTrafficData procesa datos de tráfico individuales y genera análisis
 func (p *analyticsProcessor) ProcessTrafficData(ctx context.Context, data *models.TrafficData) error {
-	// Validar datos de entrada
-	if err := p.validateTrafficData(data); err != nil {
-		return fmt.Errorf("invalid traffic data: %w", err)
+	// Validar y analizar la lectura
+	analyticsResults, err := p.analyze(data, nil)
+	if err != nil {
+		return err
+	}
+
+	// Almacenar resultados; reprocesar una lectura los sobrescribe
+	if err := p.repo.StoreAnalyticsResults(ctx, analyticsResults); err != nil {
+		return fmt.Errorf("failed to store analytics results: %w", err)
 	}
 
-	// Realizar análisis
-	analyticsResults := p.performAnalysis(data)
+	// Publicar resultados para consumidores downstream
+	if err := p.publisher.PublishAnalyticsResults(ctx, analyticsResults); err != nil {
+		return err
+	}
 
-	// Almacenar resultados
-	for _, result := range analyticsResults {
-		if err := p.repo.StoreAnalyticsResult(ctx, result); err != nil {
-			return fmt.Errorf("failed to store analytics result: %w", err)
-		}
+	// Levantar o resolver alertas
+	if err := p.alerts.evaluate(ctx, data, analyticsResults); err != nil {
+		return fmt.Errorf("failed to evaluate alerts: %w", err)
 	}
 
 	return nil
 }
 
+// analyze valida una lectura y calcula sus resultados, etiquetados con la
+// versión del procesador y los campos de metadata adicionales
+func (p *analyticsProcessor) analyze(data *models.TrafficData, metadata map[string]string) ([]*models.AnalyticsResult, error) {
+	if err := p.validateTrafficData(data); err != nil {
+		return nil, fmt.Errorf("invalid traffic data: %w", err)
+	}
+
+	tags := map[string]string{"processor_version": ProcessorVersion}
+	for key, value := range metadata {
+		tags[key] = value
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode result metadata: %w", err)
+	}
+
+	results := p.performAnalysis(data)
+	for _, result := range results {
+		result.Metadata = encoded
+	}
+	return results, nil
+}
+
 // validateTrafficData valida los datos de tráfico antes del procesamiento
 func (p *analyticsProcessor) validateTrafficData(data *models.TrafficData) error {
 	if data == nil {
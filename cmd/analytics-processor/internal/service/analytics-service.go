@@ -8,11 +8,10 @@ import (
 	"api-traffic-analytics/cmd/analytics-processor/internal/config"
 	handler "api-traffic-analytics/cmd/analytics-processor/internal/handler"
 	"api-traffic-analytics/internal/interfaces"
-	"api-traffic-analytics/internal/pkg/kafka"
 )
 
 type AnalyticsService struct {
-	consumer       *kafka.Consumer
+	consumer       interfaces.MessageConsumer
 	processor      interfaces.AnalyticsProcessor // Cambiado a la interfaz
 	messageHandler *handler.MessageHandler
 	config         *config.Config
@@ -21,7 +20,7 @@ type AnalyticsService struct {
 }
 
 func NewAnalyticsService(
-	consumer *kafka.Consumer,
+	consumer interfaces.MessageConsumer,
 	processor interfaces.AnalyticsProcessor, // Cambiado a la interfaz
 	config *config.Config,
 ) *AnalyticsService {
@@ -66,7 +65,7 @@ func (s *AnalyticsService) processNextMessage(ctx context.Context) error {
 
 	// Process message using handler
 	startTime := time.Now()
-	err = s.messageHandler.HandleMessage(msgCtx, msg.Value)
+	err = s.messageHandler.HandleMessage(msgCtx, msg)
 
 	// Create and log metadata
 	processingTime := time.Since(startTime)
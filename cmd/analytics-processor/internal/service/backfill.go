@@ -0,0 +1,448 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/time/rate"
+
+	"api-traffic-analytics/cmd/analytics-processor/internal/repository"
+	"api-traffic-analytics/internal/interfaces"
+	kafkaPkg "api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+var (
+	// ErrBackfillSpecMismatch se devuelve al reanudar un backfill con parámetros distintos
+	ErrBackfillSpecMismatch = errors.New("backfill checkpoint was saved with different parameters")
+	// ErrBackfillVersionMismatch se devuelve al reanudar un backfill empezado con otra versión del procesador
+	ErrBackfillVersionMismatch = errors.New("backfill checkpoint was saved by another processor version")
+)
+
+// defaultBackfillBatchSize es el tamaño de lote si la especificación no indica otro
+const defaultBackfillBatchSize = 500
+
+// BackfillSpec describe un reprocesamiento histórico. Los campos con tag json
+// identifican la ejecución: reanudarla exige los mismos valores.
+type BackfillSpec struct {
+	// Name identifica el checkpoint de la ejecución
+	Name string `json:"-"`
+	// Source es models.BackfillSourceDatabase o models.BackfillSourceKafka
+	Source string `json:"source"`
+	// From y To acotan el timestamp de las lecturas a [From, To). En Kafka
+	// pueden ser cero para no acotar.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// LocationIDs limita el backfill a esas ubicaciones; vacío son todas
+	LocationIDs []string `json:"location_ids,omitempty"`
+	// StartOffset es, en Kafka, el offset inicial de cada partición; si es
+	// negativo se empieza en el primer mensaje escrito desde StartTime (o
+	// From, si StartTime es cero)
+	StartOffset int64     `json:"start_offset"`
+	StartTime   time.Time `json:"start_time"`
+
+	// BatchSize es el número de lecturas (o mensajes) entre checkpoints
+	BatchSize int `json:"-"`
+	// Rate limita las lecturas procesadas por segundo; 0 no limita
+	Rate float64 `json:"-"`
+}
+
+// Backfiller reprocesa lecturas históricas con la versión actual del
+// procesador y sobrescribe sus resultados. No publica eventos ni evalúa
+// alertas: solo corrige los resultados almacenados. Guarda un checkpoint
+// tras cada lote, así que una ejecución interrumpida se reanuda donde quedó.
+type Backfiller struct {
+	repo     *repository.Repository
+	replayer interfaces.MessageReplayer
+	analyzer *analyticsProcessor
+	logger   *log.Logger
+}
+
+// NewBackfiller crea un Backfiller; replayer puede ser nil si no se va a
+// reprocesar desde Kafka
+func NewBackfiller(repo *repository.Repository, replayer interfaces.MessageReplayer) *Backfiller {
+	return &Backfiller{
+		repo:     repo,
+		replayer: replayer,
+		analyzer: &analyticsProcessor{},
+		logger:   log.Default(),
+	}
+}
+
+// databasePosition es la clave (timestamp, id) de la última lectura procesada
+type databasePosition struct {
+	Timestamp time.Time `json:"timestamp"`
+	ID        int64     `json:"id"`
+}
+
+// partitionPosition es el siguiente offset a leer de una partición y el
+// final fijado al empezar la ejecución
+type partitionPosition struct {
+	Next int64 `json:"next"`
+	End  int64 `json:"end"`
+}
+
+// kafkaPosition es el progreso de cada partición del tópico
+type kafkaPosition struct {
+	Partitions map[int]*partitionPosition `json:"partitions"`
+}
+
+// Run ejecuta (o reanuda) el backfill de spec y devuelve su checkpoint final.
+// Con restart descarta el checkpoint anterior y empieza de cero. Una
+// ejecución ya completada no vuelve a procesar nada.
+func (b *Backfiller) Run(ctx context.Context, spec BackfillSpec, restart bool) (*models.BackfillCheckpoint, error) {
+	if err := b.validate(&spec); err != nil {
+		return nil, err
+	}
+
+	if restart {
+		if err := b.repo.DeleteBackfillCheckpoint(ctx, spec.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	checkpoint, err := b.loadCheckpoint(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.CompletedAt != nil {
+		b.logger.Printf("Backfill %s already completed at %v", spec.Name, checkpoint.CompletedAt)
+		return checkpoint, nil
+	}
+
+	var limiter *rate.Limiter
+	if spec.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(spec.Rate), spec.BatchSize)
+	}
+
+	start := time.Now()
+	switch spec.Source {
+	case models.BackfillSourceDatabase:
+		err = b.runDatabase(ctx, spec, checkpoint, limiter)
+	case models.BackfillSourceKafka:
+		err = b.runKafka(ctx, spec, checkpoint, limiter)
+	}
+	if err != nil {
+		return checkpoint, err
+	}
+
+	now := time.Now().UTC()
+	checkpoint.CompletedAt = &now
+	if err := b.repo.SaveBackfillCheckpoint(ctx, checkpoint); err != nil {
+		return checkpoint, err
+	}
+
+	b.logger.Printf("Backfill %s completed in %v: %d readings, %d results",
+		spec.Name, time.Since(start), checkpoint.ReadingsProcessed, checkpoint.ResultsWritten)
+	return checkpoint, nil
+}
+
+// validate comprueba la especificación y rellena los valores por defecto
+func (b *Backfiller) validate(spec *BackfillSpec) error {
+	if spec.Name == "" {
+		return fmt.Errorf("backfill name is required")
+	}
+	if spec.BatchSize <= 0 {
+		spec.BatchSize = defaultBackfillBatchSize
+	}
+	if spec.Rate < 0 {
+		return fmt.Errorf("backfill rate must be non-negative, got %.2f", spec.Rate)
+	}
+	if !spec.From.IsZero() && !spec.To.IsZero() && !spec.From.Before(spec.To) {
+		return fmt.Errorf("backfill range is empty: from %v is not before to %v", spec.From, spec.To)
+	}
+
+	// Normalizar para comparar con el checkpoint guardado
+	spec.From, spec.To, spec.StartTime = spec.From.UTC(), spec.To.UTC(), spec.StartTime.UTC()
+	sort.Strings(spec.LocationIDs)
+
+	switch spec.Source {
+	case models.BackfillSourceDatabase:
+		if spec.From.IsZero() || spec.To.IsZero() {
+			return fmt.Errorf("backfill from the database needs both from and to")
+		}
+	case models.BackfillSourceKafka:
+		if b.replayer == nil {
+			return fmt.Errorf("backfill from kafka is not configured")
+		}
+	default:
+		return fmt.Errorf("unknown backfill source %q", spec.Source)
+	}
+	return nil
+}
+
+// loadCheckpoint devuelve el checkpoint de la ejecución, o uno nuevo si no
+// existe. Se niega a reanudar con otros parámetros u otra versión.
+func (b *Backfiller) loadCheckpoint(ctx context.Context, spec BackfillSpec) (*models.BackfillCheckpoint, error) {
+	checkpoint, err := b.repo.GetBackfillCheckpoint(ctx, spec.Name)
+	if errors.Is(err, postgres.ErrNotFound) {
+		encoded, err := json.Marshal(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode backfill spec: %w", err)
+		}
+		return &models.BackfillCheckpoint{
+			Name:             spec.Name,
+			Source:           spec.Source,
+			Spec:             encoded,
+			Position:         []byte("{}"),
+			ProcessorVersion: ProcessorVersion,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved BackfillSpec
+	if err := json.Unmarshal(checkpoint.Spec, &saved); err != nil {
+		return nil, fmt.Errorf("failed to decode backfill spec: %w", err)
+	}
+	if !sameBackfill(saved, spec) {
+		return nil, fmt.Errorf("%w: %s", ErrBackfillSpecMismatch, spec.Name)
+	}
+	if checkpoint.CompletedAt == nil && checkpoint.ProcessorVersion != ProcessorVersion {
+		return nil, fmt.Errorf("%w: %s was started by %s, this is %s",
+			ErrBackfillVersionMismatch, spec.Name, checkpoint.ProcessorVersion, ProcessorVersion)
+	}
+
+	b.logger.Printf("Resuming backfill %s after %d readings", spec.Name, checkpoint.ReadingsProcessed)
+	return checkpoint, nil
+}
+
+// sameBackfill compara los campos que identifican una ejecución
+func sameBackfill(a, b BackfillSpec) bool {
+	if a.Source != b.Source || !a.From.Equal(b.From) || !a.To.Equal(b.To) ||
+		a.StartOffset != b.StartOffset || !a.StartTime.Equal(b.StartTime) ||
+		len(a.LocationIDs) != len(b.LocationIDs) {
+		return false
+	}
+	for i := range a.LocationIDs {
+		if a.LocationIDs[i] != b.LocationIDs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// runDatabase recorre traffic_data en orden (timestamp, id) por lotes
+func (b *Backfiller) runDatabase(ctx context.Context, spec BackfillSpec, checkpoint *models.BackfillCheckpoint, limiter *rate.Limiter) error {
+	var position databasePosition
+	if err := json.Unmarshal(checkpoint.Position, &position); err != nil {
+		return fmt.Errorf("failed to decode backfill position: %w", err)
+	}
+
+	for {
+		readings, err := b.repo.ListTrafficRange(ctx, postgres.TrafficRange{
+			LocationIDs:    spec.LocationIDs,
+			From:           spec.From,
+			To:             spec.To,
+			AfterTimestamp: position.Timestamp,
+			AfterID:        position.ID,
+			Limit:          spec.BatchSize,
+		})
+		if err != nil {
+			return err
+		}
+		if len(readings) == 0 {
+			return nil
+		}
+
+		if err := b.processBatch(ctx, spec, checkpoint, readings, limiter); err != nil {
+			return err
+		}
+
+		last := readings[len(readings)-1]
+		position = databasePosition{Timestamp: last.Timestamp, ID: last.ID}
+		if err := b.saveProgress(ctx, checkpoint, position); err != nil {
+			return err
+		}
+
+		if len(readings) < spec.BatchSize {
+			return nil
+		}
+	}
+}
+
+// runKafka repite el tópico partición a partición hasta el final que tenía
+// cada una al empezar la ejecución
+func (b *Backfiller) runKafka(ctx context.Context, spec BackfillSpec, checkpoint *models.BackfillCheckpoint, limiter *rate.Limiter) error {
+	var position kafkaPosition
+	if err := json.Unmarshal(checkpoint.Position, &position); err != nil {
+		return fmt.Errorf("failed to decode backfill position: %w", err)
+	}
+	if position.Partitions == nil {
+		if err := b.startKafka(ctx, spec, &position); err != nil {
+			return err
+		}
+		if err := b.saveProgress(ctx, checkpoint, position); err != nil {
+			return err
+		}
+	}
+
+	partitions := make([]int, 0, len(position.Partitions))
+	for partition := range position.Partitions {
+		partitions = append(partitions, partition)
+	}
+	sort.Ints(partitions)
+
+	for _, partition := range partitions {
+		progress := position.Partitions[partition]
+		var pending []kafka.Message
+
+		flush := func() error {
+			if len(pending) == 0 {
+				return nil
+			}
+			readings := b.decodeMessages(spec, pending)
+			if err := b.processBatch(ctx, spec, checkpoint, readings, limiter); err != nil {
+				return err
+			}
+			progress.Next = pending[len(pending)-1].Offset + 1
+			pending = pending[:0]
+			return b.saveProgress(ctx, checkpoint, position)
+		}
+
+		err := b.replayer.ReadPartition(ctx, partition, progress.Next, progress.End, func(msg kafka.Message) error {
+			pending = append(pending, msg)
+			if len(pending) < spec.BatchSize {
+				return nil
+			}
+			return flush()
+		})
+		if err != nil {
+			return err
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		// Los offsets finales pueden faltar en tópicos compactados
+		if progress.Next < progress.End {
+			progress.Next = progress.End
+			if err := b.saveProgress(ctx, checkpoint, position); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// startKafka fija el offset inicial y final de cada partición
+func (b *Backfiller) startKafka(ctx context.Context, spec BackfillSpec, position *kafkaPosition) error {
+	partitions, err := b.replayer.Partitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	startTime := spec.StartTime
+	if startTime.IsZero() {
+		startTime = spec.From
+	}
+
+	position.Partitions = make(map[int]*partitionPosition, len(partitions))
+	for _, partition := range partitions {
+		first, last, err := b.replayer.Offsets(ctx, partition)
+		if err != nil {
+			return err
+		}
+
+		next := first
+		switch {
+		case spec.StartOffset >= 0:
+			next = spec.StartOffset
+		case !startTime.IsZero():
+			if next, err = b.replayer.OffsetAt(ctx, partition, startTime); err != nil {
+				return err
+			}
+		}
+		if next < first {
+			next = first
+		}
+		if next > last {
+			next = last
+		}
+		position.Partitions[partition] = &partitionPosition{Next: next, End: last}
+	}
+	return nil
+}
+
+// decodeMessages devuelve las lecturas de los mensajes dentro del rango y
+// las ubicaciones del backfill. Los mensajes que no se pueden decodificar se
+// registran y se saltan.
+func (b *Backfiller) decodeMessages(spec BackfillSpec, msgs []kafka.Message) []*models.TrafficData {
+	locations := make(map[string]bool, len(spec.LocationIDs))
+	for _, id := range spec.LocationIDs {
+		locations[id] = true
+	}
+
+	readings := make([]*models.TrafficData, 0, len(msgs))
+	for _, msg := range msgs {
+		data, env, err := kafkaPkg.DecodeTrafficData(msg)
+		if err != nil {
+			b.logger.Printf("Backfill %s: skipping message %d/%d (schema v%d): %v",
+				spec.Name, msg.Partition, msg.Offset, env.SchemaVersion, err)
+			continue
+		}
+		if len(locations) > 0 && !locations[data.LocationID] {
+			continue
+		}
+		if (!spec.From.IsZero() && data.Timestamp.Before(spec.From)) ||
+			(!spec.To.IsZero() && !data.Timestamp.Before(spec.To)) {
+			continue
+		}
+		readings = append(readings, data)
+	}
+	return readings
+}
+
+// processBatch analiza las lecturas y sobrescribe sus resultados en una sola
+// escritura. Las lecturas inválidas se registran y se saltan.
+func (b *Backfiller) processBatch(ctx context.Context, spec BackfillSpec, checkpoint *models.BackfillCheckpoint, readings []*models.TrafficData, limiter *rate.Limiter) error {
+	if limiter != nil && len(readings) > 0 {
+		if err := limiter.WaitN(ctx, len(readings)); err != nil {
+			return err
+		}
+	}
+
+	metadata := map[string]string{"backfill": spec.Name}
+	var results []*models.AnalyticsResult
+	for _, data := range readings {
+		analyzed, err := b.analyzer.analyze(data, metadata)
+		if err != nil {
+			b.logger.Printf("Backfill %s: skipping reading %d of %s: %v", spec.Name, data.ID, data.LocationID, err)
+			continue
+		}
+		results = append(results, analyzed...)
+	}
+
+	if len(results) > 0 {
+		if err := b.repo.StoreAnalyticsResults(ctx, results); err != nil {
+			return fmt.Errorf("failed to store analytics results: %w", err)
+		}
+	}
+
+	checkpoint.ReadingsProcessed += int64(len(readings))
+	checkpoint.ResultsWritten += int64(len(results))
+	return nil
+}
+
+// saveProgress guarda la posición alcanzada en el checkpoint
+func (b *Backfiller) saveProgress(ctx context.Context, checkpoint *models.BackfillCheckpoint, position interface{}) error {
+	encoded, err := json.Marshal(position)
+	if err != nil {
+		return fmt.Errorf("failed to encode backfill position: %w", err)
+	}
+	checkpoint.Position = encoded
+	if err := b.repo.SaveBackfillCheckpoint(ctx, checkpoint); err != nil {
+		return err
+	}
+
+	b.logger.Printf("Backfill %s: %d readings, %d results", checkpoint.Name, checkpoint.ReadingsProcessed, checkpoint.ResultsWritten)
+	return nil
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -13,7 +14,19 @@ type Metrics struct {
 	processingTime    prometheus.Histogram
 }
 
+var (
+	metricsOnce sync.Once
+	metrics     *Metrics
+)
+
+// NewMetrics devuelve las métricas del procesador, registrándolas una sola
+// vez en el registro por defecto de Prometheus
 func NewMetrics() *Metrics {
+	metricsOnce.Do(func() { metrics = newMetrics() })
+	return metrics
+}
+
+func newMetrics() *Metrics {
 	return &Metrics{
 		messagesProcessed: promauto.NewCounter(prometheus.CounterOpts{
 			Name: "analytics_processor_messages_processed_total",
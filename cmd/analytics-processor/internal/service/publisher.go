@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	segkafka "github.com/segmentio/kafka-go"
+
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// EventPublisher publica los resultados almacenados y los cambios de estado
+// de alertas en sus propios tópicos de Kafka
+type EventPublisher struct {
+	results interfaces.EventProducer
+	alerts  interfaces.EventProducer
+}
+
+func NewEventPublisher(results, alerts interfaces.EventProducer) *EventPublisher {
+	return &EventPublisher{results: results, alerts: alerts}
+}
+
+// PublishAnalyticsResults publica todos los resultados en un único batch
+func (p *EventPublisher) PublishAnalyticsResults(ctx context.Context, results []*models.AnalyticsResult) error {
+	msgs := make([]segkafka.Message, 0, len(results))
+	for _, result := range results {
+		event := kafka.NewAnalyticsResultEvent(result)
+		msg, err := p.results.NewEventMessage(event.LocationID,
+			kafka.EventTypeAnalyticsResultStored, kafka.AnalyticsResultSchemaVersion, event)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	if err := p.results.WriteMessages(ctx, msgs...); err != nil {
+		return fmt.Errorf("failed to publish analytics results: %w", err)
+	}
+	return nil
+}
+
+// PublishAlertChange publica la transición de una alerta desde previousStatus
+func (p *EventPublisher) PublishAlertChange(ctx context.Context, alert *models.Alert, previousStatus string) error {
+	event := kafka.NewAlertEvent(alert, previousStatus)
+	if err := p.alerts.PublishEvent(ctx, event.Key(),
+		kafka.EventTypeAlertStatusChanged, kafka.AlertSchemaVersion, event); err != nil {
+		return fmt.Errorf("failed to publish alert change: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+
+	"api-traffic-analytics/cmd/analytics-processor/internal/repository"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// QueryService expone los resultados de análisis almacenados para la API HTTP
+type QueryService struct {
+	repo *repository.Repository
+}
+
+func NewQueryService(repo *repository.Repository) *QueryService {
+	return &QueryService{repo: repo}
+}
+
+func (s *QueryService) QueryResults(ctx context.Context, filter postgres.AnalyticsFilter) ([]*models.AnalyticsResult, string, error) {
+	return s.repo.QueryAnalyticsResults(ctx, filter)
+}
+
+func (s *QueryService) Aggregate(ctx context.Context, spec postgres.AggregateSpec) ([]*postgres.AnalyticsAggregate, error) {
+	return s.repo.AggregateAnalyticsResults(ctx, spec)
+}
+
+func (s *QueryService) Summary(ctx context.Context, locationID, metricType string) ([]*models.AnalyticsSummary, error) {
+	return s.repo.AnalyticsSummary(ctx, locationID, metricType)
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"api-traffic-analytics/cmd/analytics-processor/internal/config"
+	"api-traffic-analytics/cmd/analytics-processor/internal/repository"
+)
+
+// RollupJob mantiene actualizados los rollups horarios y diarios de
+// traffic_data. Cada ejecución procesa las lecturas insertadas desde la
+// anterior; el lag deja margen a las transacciones que todavía no confirmaron.
+type RollupJob struct {
+	repo     *repository.Repository
+	interval time.Duration
+	lag      time.Duration
+}
+
+func NewRollupJob(repo *repository.Repository, cfg *config.Config) *RollupJob {
+	return &RollupJob{
+		repo:     repo,
+		interval: time.Duration(cfg.RollupInterval) * time.Second,
+		lag:      time.Duration(cfg.RollupLag) * time.Second,
+	}
+}
+
+// Start ejecuta el job cada intervalo hasta que se cancele ctx
+func (j *RollupJob) Start(ctx context.Context) {
+	if j.interval <= 0 {
+		log.Println("Rollup job disabled")
+		return
+	}
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *RollupJob) refresh(ctx context.Context) {
+	start := time.Now()
+	buckets, err := j.repo.RefreshRollups(ctx, start.UTC().Add(-j.lag))
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error refreshing traffic rollups: %v", err)
+		}
+		return
+	}
+	if buckets > 0 {
+		log.Printf("Refreshed %d hourly rollup buckets in %v", buckets, time.Since(start))
+	}
+}
@@ -3,19 +3,38 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
 
 	"api-traffic-analytics/cmd/analytics-processor/internal/config"
+	"api-traffic-analytics/cmd/analytics-processor/internal/handler"
 	"api-traffic-analytics/cmd/analytics-processor/internal/repository"
 	"api-traffic-analytics/cmd/analytics-processor/internal/service"
 	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/health"
 	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/migrate"
 	"api-traffic-analytics/internal/pkg/postgres"
 )
 
 func main() {
+	// "migrate" gestiona el esquema de la base de datos y termina
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	// "backfill" reprocesa lecturas históricas y termina
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		runBackfill(os.Args[2:])
+		return
+	}
+
 	// Load configuration
 	cfg := config.Load()
 
@@ -39,6 +58,13 @@ func main() {
 
 	setupSignalHandler(cancel)
 
+	// Keep the traffic rollups up to date in the background
+	go deps.RollupJob.Start(ctx)
+
+	// Start HTTP query API, metrics and health
+	servers := startHTTPServers(cfg, deps.QueryService, newHealthChecker(cfg, deps))
+	defer shutdownHTTPServers(servers)
+
 	// Start processing
 	log.Println("Analytics Processor starting...")
 	if err := analyticsService.Start(ctx); err != nil {
@@ -46,15 +72,37 @@ func main() {
 	}
 }
 
+// runMigrate ejecuta un subcomando de migración (up, down, status, baseline)
+func runMigrate(args []string) {
+	db, err := postgres.ConnectDB()
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v", err)
+	}
+	if err := migrate.Command(context.Background(), db, args, os.Stdout); err != nil {
+		log.Fatalf("migrate failed: %v", err)
+	}
+}
+
 type Dependencies struct {
+	DB                 *gorm.DB
 	KafkaConsumer      *kafka.Consumer
+	ResultsProducer    *kafka.Producer
+	AlertsProducer     *kafka.Producer
 	AnalyticsProcessor interfaces.AnalyticsProcessor
+	QueryService       *service.QueryService
+	RollupJob          *service.RollupJob
 }
 
 func (d *Dependencies) Cleanup() {
 	if d.KafkaConsumer != nil {
 		d.KafkaConsumer.Close()
 	}
+	if d.ResultsProducer != nil {
+		d.ResultsProducer.Close()
+	}
+	if d.AlertsProducer != nil {
+		d.AlertsProducer.Close()
+	}
 	// Cleanup other resources
 }
 
@@ -67,20 +115,79 @@ func initializeDependencies(cfg *config.Config) (*Dependencies, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := migrate.AutoMigrate(context.Background(), db); err != nil {
+		return nil, err
+	}
+
+	// Initialize Kafka Producers for downstream topics
+	resultsProducer := kafka.CreateProducer(cfg.KafkaBrokers, cfg.KafkaTopicAnalytics, "analytics-processor")
+	alertsProducer := kafka.CreateProducer(cfg.KafkaBrokers, cfg.KafkaTopicAlerts, "analytics-processor")
 
 	// Initialize repositories
-	postgresRepo := postgres.NewTrafficDataRepository(db)
-	repo := repository.NewRepository(postgresRepo)
+	alertRepo := postgres.NewAlertRepository(db)
+	analyticsRepo := postgres.NewAnalyticsResultRepository(db)
+	rollupRepo := postgres.NewRollupRepository(db)
+	trafficRepo := postgres.NewTrafficDataRepository(db)
+	checkpointRepo := postgres.NewBackfillCheckpointRepository(db)
+	repo := repository.NewRepository(alertRepo, analyticsRepo, rollupRepo, trafficRepo, checkpointRepo)
 
 	// Initialize processors
-	analyticsProcessor := service.NewAnalyticsProcessor(repo)
+	publisher := service.NewEventPublisher(resultsProducer, alertsProducer)
+	analyticsProcessor := service.NewAnalyticsProcessor(repo, publisher, cfg)
 
 	return &Dependencies{
+		DB:                 db,
 		KafkaConsumer:      consumer,
+		ResultsProducer:    resultsProducer,
+		AlertsProducer:     alertsProducer,
 		AnalyticsProcessor: analyticsProcessor,
+		QueryService:       service.NewQueryService(repo),
+		RollupJob:          service.NewRollupJob(repo, cfg),
 	}, nil
 }
 
+// newHealthChecker comprueba la base de datos, Kafka y que el consumidor no
+// acumule más de cfg.HealthMaxLag lecturas pendientes
+func newHealthChecker(cfg *config.Config, deps *Dependencies) *health.Checker {
+	return health.NewChecker("analytics-processor", health.DefaultTimeout).
+		Add("postgres", func(ctx context.Context) error { return postgres.Ping(ctx, deps.DB) }).
+		Add("kafka", func(ctx context.Context) error { return kafka.Ping(ctx, cfg.KafkaBrokers) }).
+		Add("consumer_lag", health.MaxLag(deps.KafkaConsumer.Lag, cfg.HealthMaxLag))
+}
+
+// startHTTPServers sirve la API de consulta, /metrics y la salud en cfg.Port,
+// y también /metrics en cfg.MetricsPort cuando es un puerto distinto
+func startHTTPServers(cfg *config.Config, queryService *service.QueryService, checker *health.Checker) []*http.Server {
+	router := handler.NewQueryRouter(handler.NewQueryHandler(queryService), checker)
+
+	servers := []*http.Server{{Addr: ":" + cfg.Port, Handler: router}}
+	if cfg.MetricsPort != cfg.Port {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		servers = append(servers, &http.Server{Addr: ":" + cfg.MetricsPort, Handler: mux})
+	}
+
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("listen: %s\n", err)
+			}
+		}(srv)
+	}
+
+	return servers
+}
+
+func shutdownHTTPServers(servers []*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("HTTP server forced to shutdown: %v", err)
+		}
+	}
+}
+
 func setupSignalHandler(cancel context.CancelFunc) {
 	sigterm := make(chan os.Signal, 1)
 	signal.Notify(sigterm, syscall.SIGINT, syscall.SIGTERM)
@@ -1 +1,123 @@
-package test
\ No newline at end of file
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/cmd/analytics-processor/internal/handler"
+	"api-traffic-analytics/cmd/analytics-processor/internal/service"
+	"api-traffic-analytics/internal/pkg/health"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+func newQueryRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	p := newProcessor(t)
+	if err := p.processor.ProcessTrafficData(context.Background(), congestedReading()); err != nil {
+		t.Fatalf("processing reading: %v", err)
+	}
+	return handler.NewQueryRouter(handler.NewQueryHandler(service.NewQueryService(p.repo)), health.NewChecker("analytics-processor", time.Second))
+}
+
+func get(router http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestListResultsByLocation(t *testing.T) {
+	router := newQueryRouter(t)
+
+	rec := get(router, "/analytics/LOC001?metric_type="+models.MetricCongestionIndex)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /analytics/LOC001 = %d: %s", rec.Code, rec.Body)
+	}
+	var page struct {
+		Data  []models.AnalyticsResult `json:"data"`
+		Count int                      `json:"count"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding page: %v", err)
+	}
+	if page.Count != 1 || page.Data[0].MetricType != models.MetricCongestionIndex {
+		t.Errorf("page = %+v", page)
+	}
+}
+
+func TestSummaryAndAggregate(t *testing.T) {
+	router := newQueryRouter(t)
+
+	rec := get(router, "/analytics/summary?location_id=LOC001")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /analytics/summary = %d: %s", rec.Code, rec.Body)
+	}
+	var summary struct {
+		Data []models.AnalyticsSummary `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("decoding summary: %v", err)
+	}
+	if len(summary.Data) != 5 || summary.Data[0].LocationName != "Gran Via" {
+		t.Errorf("summary = %+v", summary.Data)
+	}
+
+	rec = get(router, "/analytics/aggregate?metric_type="+models.MetricCongestionIndex+"&func=count&group_by=location")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /analytics/aggregate = %d: %s", rec.Code, rec.Body)
+	}
+	var aggregate struct {
+		Data []struct {
+			LocationID string  `json:"location_id"`
+			Value      float64 `json:"value"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &aggregate); err != nil {
+		t.Fatalf("decoding aggregate: %v", err)
+	}
+	if len(aggregate.Data) != 1 || aggregate.Data[0].LocationID != "LOC001" || aggregate.Data[0].Value != 1 {
+		t.Errorf("aggregate = %+v", aggregate.Data)
+	}
+
+	if rec := get(router, "/analytics/aggregate?func=max"); rec.Code != http.StatusBadRequest {
+		t.Errorf("aggregate without metric_type = %d, want 400", rec.Code)
+	}
+}
+
+func TestAggregateRejectsInvalidParameters(t *testing.T) {
+	router := newQueryRouter(t)
+	metric := "/analytics/aggregate?metric_type=" + models.MetricCongestionIndex
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"missing metric_type", "/analytics/aggregate?func=max"},
+		{"unsupported func", metric + "&func=median"},
+		{"empty func", metric + "&func="},
+		{"unsupported group_by", metric + "&group_by=week"},
+		{"two time buckets", metric + "&group_by=hour,day"},
+		{"percentile without p", metric + "&func=percentile"},
+		{"p out of range", metric + "&func=percentile&p=1.5"},
+		{"invalid from", metric + "&from=yesterday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(router, tt.query)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("GET %s = %d, want 400: %s", tt.query, rec.Code, rec.Body)
+			}
+		})
+	}
+
+	if rec := get(router, metric+"&func=percentile&p=0.95&group_by=location,day"); rec.Code != http.StatusOK {
+		t.Errorf("valid percentile aggregate = %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -1 +1,423 @@
-package test
\ No newline at end of file
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/cmd/analytics-processor/internal/config"
+	"api-traffic-analytics/cmd/analytics-processor/internal/repository"
+	"api-traffic-analytics/cmd/analytics-processor/internal/service"
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/memory"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+const (
+	trafficTopic   = "traffic-data"
+	analyticsTopic = "analytics-results"
+	alertsTopic    = "alerts"
+)
+
+// processor es un analytics-processor conectado a las implementaciones en memoria
+type processor struct {
+	cfg       *config.Config
+	repo      *repository.Repository
+	processor interfaces.AnalyticsProcessor
+	store     *memory.Store
+	broker    *memory.Broker
+}
+
+func newProcessor(t *testing.T) *processor {
+	t.Helper()
+
+	cfg := &config.Config{
+		KafkaTopic:          trafficTopic,
+		KafkaTopicAnalytics: analyticsTopic,
+		KafkaTopicAlerts:    alertsTopic,
+		ProcessingTimeout:   5,
+		CongestionThreshold: 0.7,
+	}
+
+	store := memory.NewStore()
+	broker := memory.NewBroker()
+	repo := repository.NewRepository(
+		memory.NewAlertRepository(store),
+		memory.NewAnalyticsResultRepository(store),
+		memory.NewRollupRepository(store),
+		memory.NewTrafficDataRepository(store),
+		memory.NewBackfillCheckpointRepository(store),
+	)
+	publisher := service.NewEventPublisher(
+		broker.Producer(analyticsTopic, "analytics-processor"),
+		broker.Producer(alertsTopic, "analytics-processor"),
+	)
+
+	location := &models.Location{ID: "LOC001", Name: "Gran Via", City: "Madrid", IsActive: true}
+	if err := memory.NewLocationRepository(store).Create(context.Background(), location); err != nil {
+		t.Fatalf("creating location: %v", err)
+	}
+
+	return &processor{
+		cfg:       cfg,
+		repo:      repo,
+		processor: service.NewAnalyticsProcessor(repo, publisher, cfg),
+		store:     store,
+		broker:    broker,
+	}
+}
+
+// congestedReading supera el umbral de congestión
+func congestedReading() *models.TrafficData {
+	return &models.TrafficData{
+		ID:              1,
+		UUID:            "5f0c2f7e-8f43-4c38-9a44-2a4b7f1f0001",
+		Timestamp:       time.Now().UTC().Truncate(time.Second),
+		LocationID:      "LOC001",
+		VehicleCount:    190,
+		AverageSpeed:    10,
+		CongestionLevel: models.CongestionSevere,
+		Location:        models.Location{ID: "LOC001", City: "Madrid"},
+	}
+}
+
+func TestAnalyticsServiceConsumesTrafficEvents(t *testing.T) {
+	p := newProcessor(t)
+	consumer := p.broker.Consumer(trafficTopic)
+	analytics := service.NewAnalyticsService(consumer, p.processor, p.cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- analytics.Start(ctx) }()
+
+	data := congestedReading()
+	producer := p.broker.Producer(trafficTopic, "traffic-ingestor")
+	if err := producer.PublishEvent(ctx, data.LocationID, kafka.EventTypeTrafficRecorded,
+		kafka.TrafficDataSchemaVersion, kafka.NewTrafficDataEvent(data)); err != nil {
+		t.Fatalf("publishing reading: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for consumer.Committed() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("message was never committed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	results, _, err := p.repo.QueryAnalyticsResults(context.Background(), postgres.AnalyticsFilter{LocationID: "LOC001"})
+	if err != nil {
+		t.Fatalf("querying results: %v", err)
+	}
+	if len(results) != 5 {
+		t.Errorf("stored %d results, want 5", len(results))
+	}
+	if msgs := p.broker.Messages(analyticsTopic); len(msgs) != len(results) {
+		t.Errorf("published %d results, want %d", len(msgs), len(results))
+	}
+
+	alerts := p.broker.Messages(alertsTopic)
+	if len(alerts) != 1 {
+		t.Fatalf("published %d alert changes, want the congestion alert", len(alerts))
+	}
+	for _, msg := range alerts {
+		event, _, err := kafka.DecodeAlertEvent(msg)
+		if err != nil {
+			t.Fatalf("decoding alert event: %v", err)
+		}
+		if event.Status != models.AlertStatusActive || event.PreviousStatus != "" || event.City != "Madrid" {
+			t.Errorf("alert event = %+v", event)
+		}
+	}
+}
+
+func TestProcessorResolvesAlertsWhenTrafficClears(t *testing.T) {
+	p := newProcessor(t)
+	ctx := context.Background()
+
+	if err := p.processor.ProcessTrafficData(ctx, congestedReading()); err != nil {
+		t.Fatalf("processing congested reading: %v", err)
+	}
+	// Una segunda lectura congestionada no duplica las alertas abiertas
+	if err := p.processor.ProcessTrafficData(ctx, congestedReading()); err != nil {
+		t.Fatalf("processing congested reading again: %v", err)
+	}
+	if msgs := p.broker.Messages(alertsTopic); len(msgs) != 1 {
+		t.Fatalf("published %d alert changes after repeated congestion, want 1", len(msgs))
+	}
+
+	clear := congestedReading()
+	clear.VehicleCount = 10
+	clear.AverageSpeed = 75
+	clear.CongestionLevel = models.CongestionLow
+	if err := p.processor.ProcessTrafficData(ctx, clear); err != nil {
+		t.Fatalf("processing clear reading: %v", err)
+	}
+
+	alerts, err := memory.NewAlertRepository(p.store).List(ctx, postgres.AlertFilter{Status: models.AlertStatusResolved})
+	if err != nil {
+		t.Fatalf("listing alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].AlertType != models.AlertTypeCongestion {
+		t.Errorf("resolved alerts = %+v, want the congestion alert", alerts)
+	}
+	if msgs := p.broker.Messages(alertsTopic); len(msgs) != 2 {
+		t.Errorf("published %d alert changes, want 2", len(msgs))
+	}
+}
+
+// flakyProducer falla sus primeras publicaciones, tantas como failures
+type flakyProducer struct {
+	interfaces.EventProducer
+	failures int32
+}
+
+func (p *flakyProducer) PublishEvent(ctx context.Context, key, eventType string, schemaVersion int, payload interface{}) error {
+	if atomic.AddInt32(&p.failures, -1) >= 0 {
+		return errors.New("kafka unavailable")
+	}
+	return p.EventProducer.PublishEvent(ctx, key, eventType, schemaVersion, payload)
+}
+
+func TestAlertIsPublishedWhenKafkaRecovers(t *testing.T) {
+	p := newProcessor(t)
+	ctx := context.Background()
+
+	publisher := service.NewEventPublisher(
+		p.broker.Producer(analyticsTopic, "analytics-processor"),
+		&flakyProducer{EventProducer: p.broker.Producer(alertsTopic, "analytics-processor"), failures: 1},
+	)
+	processor := service.NewAnalyticsProcessor(p.repo, publisher, p.cfg)
+
+	if err := processor.ProcessTrafficData(ctx, congestedReading()); err != nil {
+		t.Fatalf("processing congested reading with Kafka down: %v", err)
+	}
+	// La redelivery encuentra la alerta ya abierta y no la vuelve a levantar
+	if err := processor.ProcessTrafficData(ctx, congestedReading()); err != nil {
+		t.Fatalf("processing the reading again: %v", err)
+	}
+
+	// pero el evento se publica cuando Kafka vuelve
+	deadline := time.Now().Add(5 * time.Second)
+	for len(p.broker.Messages(alertsTopic)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the raised alert was never published")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	msgs := p.broker.Messages(alertsTopic)
+	if len(msgs) != 1 {
+		t.Fatalf("published %d alert changes, want 1", len(msgs))
+	}
+	event, _, err := kafka.DecodeAlertEvent(msgs[0])
+	if err != nil {
+		t.Fatalf("decoding alert event: %v", err)
+	}
+	if event.Status != models.AlertStatusActive || event.LocationID != "LOC001" {
+		t.Errorf("alert event = %+v", event)
+	}
+}
+
+func TestReprocessingOverwritesResults(t *testing.T) {
+	p := newProcessor(t)
+	ctx := context.Background()
+
+	data := congestedReading()
+	if err := p.processor.ProcessTrafficData(ctx, data); err != nil {
+		t.Fatalf("processing reading: %v", err)
+	}
+	first, _, err := p.repo.QueryAnalyticsResults(ctx, postgres.AnalyticsFilter{LocationID: "LOC001", MetricType: models.MetricCongestionIndex})
+	if err != nil || len(first) != 1 {
+		t.Fatalf("first pass: %d results, err %v", len(first), err)
+	}
+
+	// La misma lectura con otros valores sobrescribe sus resultados
+	data.VehicleCount = 20
+	data.AverageSpeed = 70
+	if err := p.processor.ProcessTrafficData(ctx, data); err != nil {
+		t.Fatalf("reprocessing reading: %v", err)
+	}
+
+	all, _, err := p.repo.QueryAnalyticsResults(ctx, postgres.AnalyticsFilter{LocationID: "LOC001"})
+	if err != nil {
+		t.Fatalf("querying results: %v", err)
+	}
+	if len(all) != 5 {
+		t.Errorf("%d results after reprocessing, want 5", len(all))
+	}
+
+	second, _, _ := p.repo.QueryAnalyticsResults(ctx, postgres.AnalyticsFilter{LocationID: "LOC001", MetricType: models.MetricCongestionIndex})
+	if second[0].ID != first[0].ID || second[0].Value >= first[0].Value {
+		t.Errorf("congestion index: got id %d value %.3f, want id %d with a value below %.3f",
+			second[0].ID, second[0].Value, first[0].ID, first[0].Value)
+	}
+}
+
+// seedReadings guarda una lectura por hora de LOC001 empezando en start
+func seedReadings(t *testing.T, p *processor, start time.Time, n int) {
+	t.Helper()
+
+	traffic := memory.NewTrafficDataRepository(p.store)
+	for i := 0; i < n; i++ {
+		data := congestedReading()
+		data.ID = 0
+		data.UUID = ""
+		data.Timestamp = start.Add(time.Duration(i) * time.Hour)
+		if _, err := traffic.Create(context.Background(), data); err != nil {
+			t.Fatalf("seeding reading: %v", err)
+		}
+	}
+}
+
+func TestBackfillFromDatabase(t *testing.T) {
+	p := newProcessor(t)
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	seedReadings(t, p, start, 5)
+
+	backfiller := service.NewBackfiller(p.repo, nil)
+	spec := service.BackfillSpec{
+		Name:      "march",
+		Source:    models.BackfillSourceDatabase,
+		From:      start,
+		To:        start.Add(4 * time.Hour),
+		BatchSize: 2,
+	}
+	checkpoint, err := backfiller.Run(ctx, spec, false)
+	if err != nil {
+		t.Fatalf("running backfill: %v", err)
+	}
+	if checkpoint.ReadingsProcessed != 4 || checkpoint.ResultsWritten != 20 || checkpoint.CompletedAt == nil {
+		t.Errorf("checkpoint = %+v, want 4 readings and 20 results completed", checkpoint)
+	}
+
+	results, _, err := p.repo.QueryAnalyticsResults(ctx, postgres.AnalyticsFilter{LocationID: "LOC001", Limit: 100})
+	if err != nil {
+		t.Fatalf("querying results: %v", err)
+	}
+	if len(results) != 20 {
+		t.Fatalf("stored %d results, want 20", len(results))
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal(results[0].Metadata, &metadata); err != nil {
+		t.Fatalf("decoding metadata: %v", err)
+	}
+	if metadata["processor_version"] != service.ProcessorVersion || metadata["backfill"] != "march" {
+		t.Errorf("metadata = %v", metadata)
+	}
+
+	// El backfill no publica resultados ni levanta alertas
+	if n := len(p.broker.Messages(analyticsTopic)) + len(p.broker.Messages(alertsTopic)); n != 0 {
+		t.Errorf("backfill published %d messages", n)
+	}
+
+	// Repetir una ejecución completada no procesa nada más
+	again, err := backfiller.Run(ctx, spec, false)
+	if err != nil || again.ReadingsProcessed != 4 {
+		t.Errorf("rerun: %d readings, err %v", again.ReadingsProcessed, err)
+	}
+
+	// Reanudar con otros parámetros se rechaza, salvo que se reinicie
+	spec.To = start.Add(5 * time.Hour)
+	if _, err := backfiller.Run(ctx, spec, false); !errors.Is(err, service.ErrBackfillSpecMismatch) {
+		t.Errorf("resuming with another range: err = %v, want ErrBackfillSpecMismatch", err)
+	}
+	restarted, err := backfiller.Run(ctx, spec, true)
+	if err != nil || restarted.ReadingsProcessed != 5 {
+		t.Errorf("restart: %d readings, err %v", restarted.ReadingsProcessed, err)
+	}
+}
+
+func TestBackfillResumesFromCheckpoint(t *testing.T) {
+	p := newProcessor(t)
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	seedReadings(t, p, start, 5)
+
+	spec := service.BackfillSpec{
+		Name:      "interrupted",
+		Source:    models.BackfillSourceDatabase,
+		From:      start,
+		To:        start.Add(24 * time.Hour),
+		BatchSize: 2,
+	}
+	encoded, _ := json.Marshal(spec)
+	position, _ := json.Marshal(map[string]interface{}{"timestamp": start.Add(2 * time.Hour), "id": 3})
+
+	// Checkpoint de una ejecución que se detuvo tras las tres primeras lecturas
+	err := p.repo.SaveBackfillCheckpoint(ctx, &models.BackfillCheckpoint{
+		Name:              spec.Name,
+		Source:            spec.Source,
+		Spec:              encoded,
+		Position:          position,
+		ProcessorVersion:  service.ProcessorVersion,
+		ReadingsProcessed: 3,
+		ResultsWritten:    15,
+	})
+	if err != nil {
+		t.Fatalf("saving checkpoint: %v", err)
+	}
+
+	checkpoint, err := service.NewBackfiller(p.repo, nil).Run(ctx, spec, false)
+	if err != nil {
+		t.Fatalf("resuming backfill: %v", err)
+	}
+	if checkpoint.ReadingsProcessed != 5 || checkpoint.ResultsWritten != 25 {
+		t.Errorf("checkpoint = %+v, want 5 readings and 25 results", checkpoint)
+	}
+
+	results, _, _ := p.repo.QueryAnalyticsResults(ctx, postgres.AnalyticsFilter{LocationID: "LOC001", Limit: 100})
+	if len(results) != 10 {
+		t.Errorf("stored %d results, want only the 10 of the remaining readings", len(results))
+	}
+}
+
+func TestBackfillReplaysKafka(t *testing.T) {
+	p := newProcessor(t)
+	ctx := context.Background()
+
+	producer := p.broker.Producer(trafficTopic, "traffic-ingestor")
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, locationID := range []string{"LOC001", "LOC002", "LOC001"} {
+		data := congestedReading()
+		data.LocationID = locationID
+		data.Timestamp = start.Add(time.Duration(i) * time.Hour)
+		if err := producer.PublishEvent(ctx, locationID, kafka.EventTypeTrafficRecorded,
+			kafka.TrafficDataSchemaVersion, kafka.NewTrafficDataEvent(data)); err != nil {
+			t.Fatalf("publishing reading: %v", err)
+		}
+	}
+
+	backfiller := service.NewBackfiller(p.repo, p.broker.Replayer(trafficTopic))
+	checkpoint, err := backfiller.Run(ctx, service.BackfillSpec{
+		Name:        "replay",
+		Source:      models.BackfillSourceKafka,
+		LocationIDs: []string{"LOC001"},
+		StartOffset: -1,
+		BatchSize:   2,
+		Rate:        1000,
+	}, false)
+	if err != nil {
+		t.Fatalf("replaying kafka: %v", err)
+	}
+	if checkpoint.ReadingsProcessed != 2 || checkpoint.ResultsWritten != 10 {
+		t.Errorf("checkpoint = %+v, want 2 readings and 10 results", checkpoint)
+	}
+
+	var position struct {
+		Partitions map[int]struct{ Next, End int64 } `json:"partitions"`
+	}
+	if err := json.Unmarshal(checkpoint.Position, &position); err != nil {
+		t.Fatalf("decoding position: %v", err)
+	}
+	if got := position.Partitions[0]; got.Next != 3 || got.End != 3 {
+		t.Errorf("partition 0 position = %+v, want next 3 of 3", got)
+	}
+}
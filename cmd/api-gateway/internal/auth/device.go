@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"api-traffic-analytics/internal/interfaces"
+)
+
+// Headers of a signed device request
+const (
+	HeaderDeviceID  = "X-Device-ID"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// MethodDevice is a sensor that signed its request with its device secret
+const MethodDevice = "device"
+
+// ErrInvalidSignature is returned for signed requests that are malformed,
+// badly signed, out of the time window or replayed
+var ErrInvalidSignature = errors.New("invalid signature")
+
+const nonceCachePrefix = "ingest-nonce:"
+
+// DeviceOptions configures a DeviceVerifier
+type DeviceOptions struct {
+	// KeysFile is a JSON file with the device secrets:
+	// {"devices": [{"id": "sensor-001", "secret": "..."}]}
+	KeysFile string
+	// MaxSkew is how far the X-Timestamp of a request may be from now
+	MaxSkew time.Duration
+	// Nonces remembers the nonces seen within the time window, shared by
+	// every gateway replica
+	Nonces interfaces.CacheRepository
+	// LegacyAllowedIPs are IPs or CIDRs that may still send readings
+	// without credentials
+	LegacyAllowedIPs []string
+}
+
+// DeviceVerifier authenticates sensors sending traffic readings. A device
+// signs each request with HMAC-SHA256 over
+//
+//	<timestamp>\n<nonce>\n<method>\n<path>\n<hex sha256 of the body>
+//
+// keyed with its secret, and sends the hex signature in X-Signature along
+// with X-Device-ID, X-Timestamp (Unix seconds) and X-Nonce. A request is
+// accepted once: its nonce is remembered until the timestamp leaves the
+// window.
+type DeviceVerifier struct {
+	secrets map[string][]byte
+	maxSkew time.Duration
+	nonces  interfaces.CacheRepository
+	legacy  []*net.IPNet
+	now     func() time.Time
+}
+
+type deviceKeys struct {
+	Devices []struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	} `json:"devices"`
+}
+
+// NewDeviceVerifier creates a DeviceVerifier, loading the device secrets if
+// there is a keys file
+func NewDeviceVerifier(opts DeviceOptions) (*DeviceVerifier, error) {
+	v := &DeviceVerifier{
+		secrets: make(map[string][]byte),
+		maxSkew: opts.MaxSkew,
+		nonces:  opts.Nonces,
+		now:     time.Now,
+	}
+
+	if opts.KeysFile != "" {
+		data, err := os.ReadFile(opts.KeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read device keys: %w", err)
+		}
+		var keys deviceKeys
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, fmt.Errorf("failed to parse device keys: %w", err)
+		}
+		for _, device := range keys.Devices {
+			if device.ID == "" || len(device.Secret) < 16 {
+				return nil, fmt.Errorf("device key %q needs an id and a secret of at least 16 characters", device.ID)
+			}
+			v.secrets[device.ID] = []byte(device.Secret)
+		}
+	}
+
+	for _, entry := range opts.LegacyAllowedIPs {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid legacy ingestion address %q", entry)
+		}
+		v.legacy = append(v.legacy, network)
+	}
+	return v, nil
+}
+
+// Signed reports whether the request carries a device signature
+func Signed(h http.Header) bool {
+	return h.Get(HeaderSignature) != ""
+}
+
+// Verify checks the signature of a device request and returns the device
+// identity, which is granted the traffic:write scope
+func (v *DeviceVerifier) Verify(ctx context.Context, r *http.Request, body []byte) (*Identity, error) {
+	deviceID := r.Header.Get(HeaderDeviceID)
+	nonce := r.Header.Get(HeaderNonce)
+	if deviceID == "" || nonce == "" || len(nonce) > 128 {
+		return nil, fmt.Errorf("%w: %s and %s are required", ErrInvalidSignature, HeaderDeviceID, HeaderNonce)
+	}
+	seconds, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed %s", ErrInvalidSignature, HeaderTimestamp)
+	}
+	signature, err := hex.DecodeString(r.Header.Get(HeaderSignature))
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed %s", ErrInvalidSignature, HeaderSignature)
+	}
+
+	secret, ok := v.secrets[deviceID]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown device %q", ErrInvalidSignature, deviceID)
+	}
+	expected := SignDeviceRequest(secret, r.Header.Get(HeaderTimestamp), nonce, r.Method, r.URL.Path, body)
+	if !hmac.Equal(signature, expected) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidSignature)
+	}
+
+	skew := v.now().Sub(time.Unix(seconds, 0))
+	if skew > v.maxSkew || skew < -v.maxSkew {
+		return nil, fmt.Errorf("%w: timestamp outside the allowed window", ErrInvalidSignature)
+	}
+
+	// The nonce must outlive the window in which the timestamp is accepted
+	fresh, err := v.nonces.SetCacheIfAbsent(ctx, nonceCachePrefix+deviceID+":"+nonce, "1", 2*v.maxSkew)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check nonce: %w", err)
+	}
+	if !fresh {
+		return nil, fmt.Errorf("%w: replayed request", ErrInvalidSignature)
+	}
+
+	return &Identity{Subject: deviceID, Scopes: []string{ScopeTrafficWrite}, Method: MethodDevice}, nil
+}
+
+// LegacyAllowed reports whether ip may send readings without credentials
+func (v *DeviceVerifier) LegacyAllowed(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range v.legacy {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignDeviceRequest returns the HMAC-SHA256 signature of a device request
+func SignDeviceRequest(secret []byte, timestamp, nonce, method, path string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + method + "\n" + path + "\n" + hex.EncodeToString(digest[:])))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"api-traffic-analytics/internal/shared"
+)
+
+// Roles, from least to most privileged. Each role includes the permissions
+// of the ones below it.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	return roleRank[role] > 0
+}
+
+// Scopes granted to managed API keys. Keys carry scopes instead of roles, so
+// a partner or sensor fleet gets only the endpoints it needs.
+const (
+	ScopeTrafficRead     = "traffic:read"
+	ScopeTrafficWrite    = "traffic:write"
+	ScopeAnalyticsRead   = "analytics:read"
+	ScopeAlertsRead      = "alerts:read"
+	ScopeAlertsManage    = "alerts:manage"
+	ScopeLocationsManage = "locations:manage"
+)
+
+var scopes = map[string]bool{
+	ScopeTrafficRead:     true,
+	ScopeTrafficWrite:    true,
+	ScopeAnalyticsRead:   true,
+	ScopeAlertsRead:      true,
+	ScopeAlertsManage:    true,
+	ScopeLocationsManage: true,
+}
+
+// ValidScope reports whether scope is one of the known scopes
+func ValidScope(scope string) bool {
+	return scopes[scope]
+}
+
+// How a caller authenticated
+const (
+	MethodJWT = "jwt"
+	// MethodAPIKey is a managed API key, limited by its scopes
+	MethodAPIKey = "api_key"
+	// MethodSharedKey is the legacy shared API key, which has a role
+	MethodSharedKey = "shared_key"
+)
+
+// Identity is an authenticated caller
+type Identity struct {
+	Subject string
+	Roles   []string
+	Scopes  []string
+	Method  string
+	// KeyID identifies the managed API key the caller used, if any
+	KeyID string
+	// RateLimit is the caller's own quota, zero to use the route limits
+	RateLimit int
+}
+
+// HasRole reports whether the identity holds role or a more privileged one
+func (id *Identity) HasRole(role string) bool {
+	for _, held := range id.Roles {
+		if roleRank[held] >= roleRank[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the identity was granted scope
+func (id *Identity) HasScope(scope string) bool {
+	for _, granted := range id.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the identity may call a route open to users with
+// role and to API keys and devices with scope. Routes without a scope are
+// closed to managed API keys and devices.
+func (id *Identity) Allows(role, scope string) bool {
+	if id.Method == MethodAPIKey || id.Method == MethodDevice {
+		return scope != "" && id.HasScope(scope)
+	}
+	return id.HasRole(role)
+}
+
+// SetHeaders replaces the identity headers of h with the ones of id
+func (id *Identity) SetHeaders(h http.Header) {
+	StripHeaders(h)
+	h.Set(shared.HeaderUserID, id.Subject)
+	h.Set(shared.HeaderUserRoles, strings.Join(id.Roles, ","))
+	if len(id.Scopes) > 0 {
+		h.Set(shared.HeaderUserScopes, strings.Join(id.Scopes, ","))
+	}
+	h.Set(shared.HeaderAuthMethod, id.Method)
+}
+
+// StripHeaders removes the identity headers from h
+func StripHeaders(h http.Header) {
+	h.Del(shared.HeaderUserID)
+	h.Del(shared.HeaderUserRoles)
+	h.Del(shared.HeaderUserScopes)
+	h.Del(shared.HeaderAuthMethod)
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying id
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity stored in ctx, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
@@ -0,0 +1,285 @@
+// Package auth authenticates api-gateway callers: it verifies JWT bearer
+// tokens and maps their role claims to an Identity that is forwarded to the
+// internal services.
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, badly signed,
+// expired or issued for someone else
+var ErrInvalidToken = errors.New("invalid token")
+
+// Options configures a Verifier. HS256 tokens are accepted when HMACSecret
+// is set and RS256 tokens when JWKSFile holds at least one RSA key.
+type Options struct {
+	HMACSecret string
+	// JWKSFile is a local JSON Web Key Set ({"keys": [...]})
+	JWKSFile string
+	// Issuer and Audience, when set, must match the iss and aud claims
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew when checking exp and nbf
+	Leeway time.Duration
+}
+
+// Verifier checks JWT signatures and claims
+type Verifier struct {
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	now        func() time.Time
+}
+
+// NewVerifier creates a Verifier, loading the JWKS file if there is one
+func NewVerifier(opts Options) (*Verifier, error) {
+	v := &Verifier{
+		hmacSecret: []byte(opts.HMACSecret),
+		rsaKeys:    make(map[string]*rsa.PublicKey),
+		issuer:     opts.Issuer,
+		audience:   opts.Audience,
+		leeway:     opts.Leeway,
+		now:        time.Now,
+	}
+	if opts.JWKSFile != "" {
+		data, err := os.ReadFile(opts.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS: %w", err)
+		}
+		if v.rsaKeys, err = parseJWKS(data); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Enabled reports whether the verifier has any key to check tokens with
+func (v *Verifier) Enabled() bool {
+	return v != nil && (len(v.hmacSecret) > 0 || len(v.rsaKeys) > 0)
+}
+
+// LooksLikeJWT reports whether a credential has the three dot-separated
+// segments of a compact JWT, to tell tokens from opaque API keys
+func LooksLikeJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	Roles     []string `json:"roles"`
+	Role      string   `json:"role"`
+}
+
+// audience is the aud claim, either a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Verify checks the signature and claims of a compact JWT and returns the
+// identity it carries. Unknown roles are dropped.
+func (v *Verifier) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if err := v.validateClaims(c); err != nil {
+		return nil, err
+	}
+
+	id := &Identity{Subject: c.Subject, Method: MethodJWT}
+	if c.Role != "" {
+		c.Roles = append(c.Roles, c.Role)
+	}
+	for _, role := range c.Roles {
+		if ValidRole(role) {
+			id.Roles = append(id.Roles, role)
+		}
+	}
+	return id, nil
+}
+
+func (v *Verifier) verifySignature(h header, signingInput string, signature []byte) error {
+	switch h.Algorithm {
+	case "HS256":
+		if len(v.hmacSecret) == 0 {
+			return fmt.Errorf("%w: HS256 tokens are not accepted", ErrInvalidToken)
+		}
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+
+	case "RS256":
+		key, err := v.rsaKey(h.KeyID)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, h.Algorithm)
+	}
+}
+
+// rsaKey returns the JWKS key with the given id. Tokens without kid are
+// accepted only when the set has a single key.
+func (v *Verifier) rsaKey(kid string) (*rsa.PublicKey, error) {
+	if key, ok := v.rsaKeys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(v.rsaKeys) == 1 {
+		for _, key := range v.rsaKeys {
+			return key, nil
+		}
+	}
+	if len(v.rsaKeys) == 0 {
+		return nil, fmt.Errorf("%w: RS256 tokens are not accepted", ErrInvalidToken)
+	}
+	return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+}
+
+func (v *Verifier) validateClaims(c claims) error {
+	now := v.now()
+	if c.ExpiresAt == nil {
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if now.After(numericDate(*c.ExpiresAt).Add(v.leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if c.NotBefore != nil && now.Add(v.leeway).Before(numericDate(*c.NotBefore)) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if c.Subject == "" {
+		return fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, c.Issuer)
+	}
+	if v.audience != "" {
+		found := false
+		for _, aud := range c.Audience {
+			if aud == v.audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: token not issued for %q", ErrInvalidToken, v.audience)
+		}
+	}
+	return nil
+}
+
+func numericDate(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+type jwks struct {
+	Keys []struct {
+		KeyType   string `json:"kty"`
+		KeyID     string `json:"kid"`
+		Use       string `json:"use"`
+		Algorithm string `json:"alg"`
+		N         string `json:"n"`
+		E         string `json:"e"`
+	} `json:"keys"`
+}
+
+// parseJWKS returns the RSA signing keys of a JWK Set by key id. Keys of
+// other types or meant for encryption are skipped.
+func parseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") ||
+			(jwk.Algorithm != "" && jwk.Algorithm != "RS256") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWKS key %q: bad modulus", jwk.KeyID)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("failed to parse JWKS key %q: bad exponent", jwk.KeyID)
+		}
+		keys[jwk.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS has no RSA signing keys")
+	}
+	return keys, nil
+}
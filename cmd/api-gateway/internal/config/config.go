@@ -1,34 +1,198 @@
 package config
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/redis"
 )
 
 type Config struct {
 	Port                string
 	Environment         string
 	APIKey              string
+	APIKeyRole          string
 	RateLimitRequests   int
 	RateLimitDuration   int
 	TrafficIngestorURL  string
 	AnalyticsServiceURL string
 	AlertingServiceURL  string
+
+	// Upstream calls: default timeout, per-route timeouts by path prefix
+	// (PROXY_ROUTE_TIMEOUTS="/analytics=5,/locations/import=120"), retries
+	// of idempotent GETs and circuit breakers per upstream
+	ProxyTimeoutSeconds          int
+	ProxyRouteTimeouts           map[string]int
+	ProxyRetries                 int
+	ProxyRetryBackoffMillis      int
+	ProxyBreakerFailureThreshold int
+	ProxyBreakerOpenSeconds      int
+
+	// Timeout of each readiness check, including the upstreams' in /health
+	HealthTimeoutSeconds int
+
+	// Validation of requests and responses against the OpenAPI contract,
+	// enabled by default in the development and test environments, and the
+	// largest request body it reads
+	OpenAPIValidation   bool
+	OpenAPIMaxBodyBytes int64
+
+	// JWT authentication (HS256 with JWTSecret, RS256 with the keys of JWTJWKSFile)
+	JWTSecret        string
+	JWTJWKSFile      string
+	JWTIssuer        string
+	JWTAudience      string
+	JWTLeewaySeconds int
+
+	// Rate limits per route class, in requests per RateLimitDuration seconds.
+	// RateLimitRequests applies to reads.
+	RateLimitWriteRequests  int
+	RateLimitIngestRequests int
+	RateLimitStreamRequests int
+
+	// Traffic ingestion: device secrets for signed readings, the accepted
+	// clock skew of their timestamps, the legacy IPs or CIDRs that may
+	// still send readings without credentials and the largest accepted body
+	DeviceKeysFile                string
+	IngestSignatureMaxSkewSeconds int
+	IngestLegacyAllowedIPs        []string
+	IngestMaxBodyBytes            int64
+
+	// Proxies whose X-Forwarded-For is trusted to find the client IP
+	TrustedProxies []string
+
+	// CORS policy. CORSRoutes is a JSON array of per-route overrides. The
+	// cors.* keys of the configurations table take precedence.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSExposedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAgeSeconds    int
+	CORSRoutes           string
+
+	// Response cache for GET queries. CacheRouteTTLs maps path prefixes to
+	// "short", "default", "long" or a number of seconds; the cache.ttl_default
+	// key of the configurations table overrides CacheTTLDefault. Expired
+	// entries are still served for CacheStaleSeconds while they are refreshed.
+	CacheTTLDefault   int
+	CacheTTLShort     int
+	CacheTTLLong      int
+	CacheStaleSeconds int
+	CacheRouteTTLs    map[string]string
+
+	// Managed API keys
+	APIKeyCacheTTLSeconds      int
+	APIKeyRotationGraceSeconds int
+
+	// Streaming
+	KafkaBrokers           []string
+	KafkaTopicTraffic      string
+	KafkaTopicAlerts       string
+	KafkaTopicAnalytics    string
+	StreamHeartbeatSeconds int
+	StreamReplaySize       int
+	StreamConnectionBuffer int
 }
 
 func Load() *Config {
 	rateLimitRequests, _ := strconv.Atoi(getEnv("RATE_LIMIT_REQUESTS", "100"))
 	rateLimitDuration, _ := strconv.Atoi(getEnv("RATE_LIMIT_DURATION", "60"))
+	rateLimitWrite, _ := strconv.Atoi(getEnv("RATE_LIMIT_WRITE_REQUESTS", "30"))
+	rateLimitIngest, _ := strconv.Atoi(getEnv("RATE_LIMIT_INGEST_REQUESTS", "1200"))
+	rateLimitStream, _ := strconv.Atoi(getEnv("RATE_LIMIT_STREAM_REQUESTS", "10"))
+	streamHeartbeat, _ := strconv.Atoi(getEnv("STREAM_HEARTBEAT_SECONDS", "15"))
+	streamReplaySize, _ := strconv.Atoi(getEnv("STREAM_REPLAY_SIZE", "1000"))
+	streamConnectionBuffer, _ := strconv.Atoi(getEnv("STREAM_CONNECTION_BUFFER", "256"))
+	proxyTimeout, _ := strconv.Atoi(getEnv("PROXY_TIMEOUT_SECONDS", "10"))
+	proxyRetries, _ := strconv.Atoi(getEnv("PROXY_RETRIES", "2"))
+	proxyRetryBackoff, _ := strconv.Atoi(getEnv("PROXY_RETRY_BACKOFF_MILLIS", "100"))
+	proxyBreakerThreshold, _ := strconv.Atoi(getEnv("PROXY_BREAKER_FAILURE_THRESHOLD", "5"))
+	proxyBreakerOpen, _ := strconv.Atoi(getEnv("PROXY_BREAKER_OPEN_SECONDS", "30"))
+	healthTimeout, _ := strconv.Atoi(getEnv("HEALTH_TIMEOUT_SECONDS", "2"))
+	environment := getEnv("ENVIRONMENT", "development")
+	openAPIValidation, _ := strconv.ParseBool(getEnv("OPENAPI_VALIDATION", strconv.FormatBool(environment == "development" || environment == "test")))
+	openAPIMaxBody, _ := strconv.ParseInt(getEnv("OPENAPI_MAX_BODY_BYTES", "10485760"), 10, 64)
+	jwtLeeway, _ := strconv.Atoi(getEnv("JWT_LEEWAY_SECONDS", "30"))
+	ingestMaxSkew, _ := strconv.Atoi(getEnv("INGEST_SIGNATURE_MAX_SKEW_SECONDS", "300"))
+	ingestMaxBody, _ := strconv.ParseInt(getEnv("INGEST_MAX_BODY_BYTES", "1048576"), 10, 64)
+	corsAllowCredentials, _ := strconv.ParseBool(getEnv("CORS_ALLOW_CREDENTIALS", "false"))
+	corsMaxAge, _ := strconv.Atoi(getEnv("CORS_MAX_AGE_SECONDS", "86400"))
+	apiKeyCacheTTL, _ := strconv.Atoi(getEnv("API_KEY_CACHE_TTL_SECONDS", "300"))
+	apiKeyRotationGrace, _ := strconv.Atoi(getEnv("API_KEY_ROTATION_GRACE_SECONDS", "86400"))
+	cacheTTLDefault, _ := strconv.Atoi(getEnv("CACHE_TTL_DEFAULT", "300"))
+	cacheTTLShort, _ := strconv.Atoi(getEnv("CACHE_TTL_SHORT", "60"))
+	cacheTTLLong, _ := strconv.Atoi(getEnv("CACHE_TTL_LONG", "3600"))
+	cacheStale, _ := strconv.Atoi(getEnv("CACHE_STALE_SECONDS", "60"))
 
 	return &Config{
 		Port:                getEnv("PORT", "8080"),
-		Environment:         getEnv("ENVIRONMENT", "development"),
-		APIKey:              getEnv("API_KEY", "default-api-key-change-in-production"),
+		Environment:         environment,
+		APIKey:              getEnv("API_KEY", ""),
+		APIKeyRole:          getEnv("API_KEY_ROLE", "viewer"),
 		RateLimitRequests:   rateLimitRequests,
 		RateLimitDuration:   rateLimitDuration,
 		TrafficIngestorURL:  getEnv("TRAFFIC_INGESTOR_URL", "http://traffic-ingestor:8081"),
 		AnalyticsServiceURL: getEnv("ANALYTICS_SERVICE_URL", "http://analytics-processor:8082"),
 		AlertingServiceURL:  getEnv("ALERTING_SERVICE_URL", "http://alerting-service:8083"),
+
+		ProxyTimeoutSeconds:          proxyTimeout,
+		ProxyRouteTimeouts:           parseRouteTimeouts(getEnv("PROXY_ROUTE_TIMEOUTS", "")),
+		ProxyRetries:                 proxyRetries,
+		ProxyRetryBackoffMillis:      proxyRetryBackoff,
+		ProxyBreakerFailureThreshold: proxyBreakerThreshold,
+		ProxyBreakerOpenSeconds:      proxyBreakerOpen,
+
+		HealthTimeoutSeconds: healthTimeout,
+
+		OpenAPIValidation:   openAPIValidation,
+		OpenAPIMaxBodyBytes: openAPIMaxBody,
+
+		JWTSecret:        getEnv("JWT_SECRET", ""),
+		JWTJWKSFile:      getEnv("JWT_JWKS_FILE", ""),
+		JWTIssuer:        getEnv("JWT_ISSUER", ""),
+		JWTAudience:      getEnv("JWT_AUDIENCE", ""),
+		JWTLeewaySeconds: jwtLeeway,
+
+		RateLimitWriteRequests:  rateLimitWrite,
+		RateLimitIngestRequests: rateLimitIngest,
+		RateLimitStreamRequests: rateLimitStream,
+
+		DeviceKeysFile:                getEnv("DEVICE_KEYS_FILE", ""),
+		IngestSignatureMaxSkewSeconds: ingestMaxSkew,
+		IngestLegacyAllowedIPs:        getEnvList("INGEST_LEGACY_ALLOWED_IPS"),
+		IngestMaxBodyBytes:            ingestMaxBody,
+		TrustedProxies:                getEnvList("TRUSTED_PROXIES"),
+
+		CORSAllowedOrigins:   splitList(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:8080,http://127.0.0.1:3000,http://127.0.0.1:8080")),
+		CORSAllowedMethods:   splitList(getEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE,OPTIONS")),
+		CORSAllowedHeaders:   splitList(getEnv("CORS_ALLOWED_HEADERS", "Origin,Content-Type,Accept,Authorization,X-Requested-With,X-API-Key,X-Request-ID,If-None-Match")),
+		CORSExposedHeaders:   splitList(getEnv("CORS_EXPOSED_HEADERS", "X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,Retry-After,X-Request-ID,ETag,X-Cache")),
+		CORSAllowCredentials: corsAllowCredentials,
+		CORSMaxAgeSeconds:    corsMaxAge,
+		CORSRoutes:           getEnv("CORS_ROUTES", ""),
+
+		CacheTTLDefault:   cacheTTLDefault,
+		CacheTTLShort:     cacheTTLShort,
+		CacheTTLLong:      cacheTTLLong,
+		CacheStaleSeconds: cacheStale,
+		CacheRouteTTLs:    parseCacheRoutes(getEnv("CACHE_ROUTE_TTLS", "/analytics=default,/series=default,/alerts=short,/traffic=short")),
+
+		APIKeyCacheTTLSeconds:      apiKeyCacheTTL,
+		APIKeyRotationGraceSeconds: apiKeyRotationGrace,
+
+		KafkaBrokers:           []string{getEnv("KAFKA_BROKER", "kafka:9092")},
+		KafkaTopicTraffic:      getEnv("KAFKA_TOPIC_TRAFFIC", "traffic-data"),
+		KafkaTopicAlerts:       getEnv("KAFKA_TOPIC_ALERTS", "alerts"),
+		KafkaTopicAnalytics:    getEnv("KAFKA_TOPIC_ANALYTICS", "analytics-results"),
+		StreamHeartbeatSeconds: streamHeartbeat,
+		StreamReplaySize:       streamReplaySize,
+		StreamConnectionBuffer: streamConnectionBuffer,
 	}
 }
 
@@ -37,4 +201,141 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// getEnvList splits a comma-separated variable, skipping empty entries
+func getEnvList(key string) []string {
+	return splitList(os.Getenv(key))
+}
+
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// RateLimit returns the limit of requests requests per RateLimitDuration
+func (c *Config) RateLimit(requests int) redis.RateLimit {
+	return redis.RateLimit{Requests: requests, Period: time.Duration(c.RateLimitDuration) * time.Second}
+}
+
+// parseRouteTimeouts parses "prefix=seconds" pairs, skipping invalid ones
+func parseRouteTimeouts(list string) map[string]int {
+	timeouts := make(map[string]int)
+	for _, entry := range splitList(list) {
+		prefix, value, _ := strings.Cut(entry, "=")
+		seconds, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || seconds <= 0 || !strings.HasPrefix(strings.TrimSpace(prefix), "/") {
+			log.Printf("Ignoring invalid PROXY_ROUTE_TIMEOUTS entry %q", entry)
+			continue
+		}
+		timeouts[strings.TrimSpace(prefix)] = seconds
+	}
+	return timeouts
+}
+
+// parseCacheRoutes parses "prefix=ttl" pairs, skipping invalid ones
+func parseCacheRoutes(list string) map[string]string {
+	routes := make(map[string]string)
+	for _, entry := range splitList(list) {
+		prefix, value, _ := strings.Cut(entry, "=")
+		prefix, value = strings.TrimSpace(prefix), strings.TrimSpace(value)
+		if !strings.HasPrefix(prefix, "/") || !validCacheTTL(value) {
+			log.Printf("Ignoring invalid CACHE_ROUTE_TTLS entry %q", entry)
+			continue
+		}
+		routes[prefix] = value
+	}
+	return routes
+}
+
+func validCacheTTL(value string) bool {
+	switch value {
+	case "short", "default", "long":
+		return true
+	}
+	seconds, err := strconv.Atoi(value)
+	return err == nil && seconds > 0
+}
+
+// CacheTTL resolves a CacheRouteTTLs value
+func (c *Config) CacheTTL(value string) time.Duration {
+	var seconds int
+	switch value {
+	case "short":
+		seconds = c.CacheTTLShort
+	case "default":
+		seconds = c.CacheTTLDefault
+	case "long":
+		seconds = c.CacheTTLLong
+	default:
+		seconds, _ = strconv.Atoi(value)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// SettingsReader reads settings from the configurations table
+type SettingsReader interface {
+	GetString(ctx context.Context, key, defaultValue string) (string, error)
+}
+
+// LoadStoredSettings overrides the settings that can also be kept in the
+// configurations table (cors.*, cache.ttl_default) with their stored values
+func (c *Config) LoadStoredSettings(ctx context.Context, settings SettingsReader) error {
+	lists := map[string]*[]string{
+		"cors.allowed_origins": &c.CORSAllowedOrigins,
+		"cors.allowed_methods": &c.CORSAllowedMethods,
+		"cors.allowed_headers": &c.CORSAllowedHeaders,
+		"cors.exposed_headers": &c.CORSExposedHeaders,
+	}
+	for key, field := range lists {
+		value, err := settings.GetString(ctx, key, "")
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			*field = splitList(value)
+		}
+	}
+
+	credentials, err := settings.GetString(ctx, "cors.allow_credentials", "")
+	if err != nil {
+		return err
+	}
+	if credentials != "" {
+		if c.CORSAllowCredentials, err = strconv.ParseBool(credentials); err != nil {
+			return fmt.Errorf("configuration cors.allow_credentials: %q is not a boolean", credentials)
+		}
+	}
+
+	maxAge, err := settings.GetString(ctx, "cors.max_age_seconds", "")
+	if err != nil {
+		return err
+	}
+	if maxAge != "" {
+		if c.CORSMaxAgeSeconds, err = strconv.Atoi(maxAge); err != nil {
+			return fmt.Errorf("configuration cors.max_age_seconds: %q is not an integer", maxAge)
+		}
+	}
+
+	ttl, err := settings.GetString(ctx, "cache.ttl_default", "")
+	if err != nil {
+		return err
+	}
+	if ttl != "" {
+		if c.CacheTTLDefault, err = strconv.Atoi(ttl); err != nil {
+			return fmt.Errorf("configuration cache.ttl_default: %q is not an integer", ttl)
+		}
+	}
+
+	routes, err := settings.GetString(ctx, "cors.routes", c.CORSRoutes)
+	if err != nil {
+		return err
+	}
+	c.CORSRoutes = routes
+	return nil
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
+	"api-traffic-analytics/cmd/api-gateway/internal/middleware"
+	"api-traffic-analytics/cmd/api-gateway/internal/service"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// CreateAPIKey issues a managed API key. The plaintext key is only returned
+// in this response.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var req service.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad request",
+			Message: fmt.Sprintf("Invalid request body: %v", err),
+		})
+		return
+	}
+
+	issued, err := h.apiKeyService.Create(c.Request.Context(), req, subject(c))
+	if err != nil {
+		apiKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, issued)
+}
+
+// ListAPIKeys lists the managed API keys, optionally by owner. Revoked keys
+// are included with include_revoked=true.
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	includeRevoked, _ := strconv.ParseBool(c.Query("include_revoked"))
+	keys, err := h.apiKeyService.List(c.Request.Context(), postgres.APIKeyFilter{
+		Owner:          c.Query("owner"),
+		IncludeRevoked: includeRevoked,
+	})
+	if err != nil {
+		apiKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": keys, "count": len(keys)})
+}
+
+// RevokeAPIKey revokes a managed API key
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	id, ok := apiKeyID(c)
+	if !ok {
+		return
+	}
+
+	key, err := h.apiKeyService.Revoke(c.Request.Context(), id)
+	if err != nil {
+		apiKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// RotateAPIKey issues a replacement for a managed API key. The old key keeps
+// working until the grace period ends.
+func (h *Handler) RotateAPIKey(c *gin.Context) {
+	id, ok := apiKeyID(c)
+	if !ok {
+		return
+	}
+
+	var req service.RotateAPIKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			middleware.RespondError(c, http.StatusBadRequest, models.ErrorResponse{
+				Error:   "Bad request",
+				Message: fmt.Sprintf("Invalid request body: %v", err),
+			})
+			return
+		}
+	}
+
+	issued, err := h.apiKeyService.Rotate(c.Request.Context(), id, req, subject(c))
+	if err != nil {
+		apiKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, issued)
+}
+
+func apiKeyID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		middleware.RespondError(c, http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad request",
+			Message: "Invalid API key id",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func apiKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAPIKeyRequest):
+		middleware.RespondError(c, http.StatusBadRequest, models.ErrorResponse{Error: "Bad request", Message: err.Error()})
+	case errors.Is(err, postgres.ErrNotFound):
+		middleware.RespondError(c, http.StatusNotFound, models.ErrorResponse{Error: "Not found", Message: "API key not found or revoked"})
+	default:
+		middleware.RespondError(c, http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Message: fmt.Sprintf("Failed to manage API key: %v", err),
+		})
+	}
+}
+
+// subject returns the authenticated caller, recorded as created_by
+func subject(c *gin.Context) string {
+	if identity, ok := auth.FromContext(c.Request.Context()); ok {
+		return identity.Subject
+	}
+	return ""
+}
@@ -1,170 +1,291 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
 	"api-traffic-analytics/cmd/api-gateway/internal/config"
+	"api-traffic-analytics/cmd/api-gateway/internal/middleware"
 	"api-traffic-analytics/cmd/api-gateway/internal/service"
+	"api-traffic-analytics/internal/pkg/health"
 	"api-traffic-analytics/internal/shared/models"
 )
 
 type Handler struct {
-	proxyService *service.ProxyService
-	cfg          *config.Config
+	proxyService  *service.ProxyService
+	streamService *service.StreamService
+	apiKeyService *service.APIKeyService
+	responseCache *service.ResponseCache
+	checker       *health.Checker
+	upgrader      *websocket.Upgrader
+	cfg           *config.Config
 }
 
-func NewHandler(proxyService *service.ProxyService, cfg *config.Config) *Handler {
+func NewHandler(proxyService *service.ProxyService, streamService *service.StreamService, apiKeyService *service.APIKeyService, responseCache *service.ResponseCache, checker *health.Checker, cfg *config.Config) *Handler {
 	return &Handler{
-		proxyService: proxyService,
-		cfg:          cfg,
+		proxyService:  proxyService,
+		streamService: streamService,
+		apiKeyService: apiKeyService,
+		responseCache: responseCache,
+		checker:       checker,
+		upgrader:      newUpgrader(nil),
+		cfg:           cfg,
 	}
 }
 
+// HealthCheck reports the readiness of the gateway's own dependencies and,
+// checked concurrently, of each upstream with its latency and circuit state.
+// The gateway is unhealthy when its dependencies fail and degraded when an
+// upstream does.
 func (h *Handler) HealthCheck(c *gin.Context) {
-	response := models.HealthCheckResponse{
-		Status:    "healthy",
-		Timestamp: models.TimeNow(),
-		Version:   "1.0.0",
-		Services: map[string]string{
-			"api-gateway": "healthy",
-		},
+	ctx := c.Request.Context()
+	timeout := time.Duration(h.cfg.HealthTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = health.DefaultTimeout
+	}
+
+	var upstreams map[string]service.UpstreamHealth
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		upstreams = h.proxyService.CheckUpstreams(ctx, timeout)
+	}()
+	response, ready := h.checker.Ready(ctx)
+	<-done
+
+	for name, upstream := range upstreams {
+		response.Services[name] = upstream.String()
+		if response.Status == health.StatusHealthy && (upstream.Status != health.StatusHealthy || upstream.Circuit == service.CircuitOpen) {
+			response.Status = health.StatusDegraded
+		}
 	}
 
-	c.JSON(http.StatusOK, response)
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
 }
 
 func (h *Handler) GetAnalytics(c *gin.Context) {
-	ctx := c.Request.Context()
+	h.cachedGet(c, "analytics", c.Query("location_id"), "Failed to get analytics", h.proxyService.GetAnalytics)
+}
 
-	path := c.Request.URL.Path
-	if c.Request.URL.RawQuery != "" {
-		path = path + "?" + c.Request.URL.RawQuery
-	}
+// GetAnalyticsAggregates serves the summary and the aggregates. They are
+// computed over many results, so they are cached unscoped and every new
+// result invalidates them.
+func (h *Handler) GetAnalyticsAggregates(c *gin.Context) {
+	h.cachedGet(c, "analytics", "", "Failed to get analytics", h.proxyService.GetAnalytics)
+}
 
-	data, err := h.proxyService.GetAnalytics(ctx, path)
-	if err != nil {
-		errorResponse := models.ErrorResponse{
-			Error:   "Internal server error",
-			Message: fmt.Sprintf("Failed to get analytics: %v", err),
-		}
-		c.JSON(http.StatusInternalServerError, errorResponse)
-		return
-	}
+func (h *Handler) GetAlerts(c *gin.Context) {
+	h.cachedGet(c, "alerts", c.Query("location_id"), "Failed to get alerts", h.proxyService.GetAlerts)
+}
 
-	c.Data(http.StatusOK, "application/json", data)
+func (h *Handler) GetTrafficData(c *gin.Context) {
+	h.cachedGet(c, "traffic", c.Query("location_id"), "Failed to get traffic data", h.proxyService.GetTrafficData)
 }
 
-func (h *Handler) GetAlerts(c *gin.Context) {
+// cachedGet answers a GET query through the response cache when its route
+// has a TTL, with an ETag that lets clients revalidate with If-None-Match.
+// location scopes the cached response for invalidation, empty when it is
+// about every location.
+func (h *Handler) cachedGet(c *gin.Context, upstream, location, action string, get func(context.Context, string) ([]byte, error)) {
 	ctx := c.Request.Context()
 
 	path := c.Request.URL.Path
 	if c.Request.URL.RawQuery != "" {
 		path = path + "?" + c.Request.URL.RawQuery
 	}
+	fetch := func(ctx context.Context) ([]byte, error) {
+		return get(ctx, path)
+	}
 
-	data, err := h.proxyService.GetAlerts(ctx, path)
-	if err != nil {
-		errorResponse := models.ErrorResponse{
-			Error:   "Internal server error",
-			Message: fmt.Sprintf("Failed to get alerts: %v", err),
+	if h.responseCache.TTL(c.Request.URL.Path) == 0 {
+		data, err := fetch(ctx)
+		if err != nil {
+			h.upstreamError(c, action, err)
+			return
 		}
-		c.JSON(http.StatusInternalServerError, errorResponse)
+		c.Data(http.StatusOK, "application/json", data)
 		return
 	}
 
-	c.Data(http.StatusOK, "application/json", data)
-}
-
-func (h *Handler) GetTrafficData(c *gin.Context) {
-	ctx := c.Request.Context()
-
-	path := c.Request.URL.Path
-	if c.Request.URL.RawQuery != "" {
-		path = path + "?" + c.Request.URL.RawQuery
-	}
-
-	data, err := h.proxyService.GetTrafficData(ctx, path)
+	response, cacheStatus, err := h.responseCache.Get(ctx, upstream, location, c.Request.URL.Path, c.Request.URL.RawQuery, fetch)
 	if err != nil {
-		errorResponse := models.ErrorResponse{
-			Error:   "Internal server error",
-			Message: fmt.Sprintf("Failed to get traffic data: %v", err),
-		}
-		c.JSON(http.StatusInternalServerError, errorResponse)
+		h.upstreamError(c, action, err)
 		return
 	}
 
-	c.Data(http.StatusOK, "application/json", data)
+	c.Header("ETag", response.ETag)
+	c.Header("X-Cache", cacheStatus)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(response.MaxAge(time.Now()).Seconds())))
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" && service.ETagMatches(ifNoneMatch, response.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", response.Body)
 }
 
 func (h *Handler) GetAnalyticsByLocation(c *gin.Context) {
 	// Forward to analytics service with location parameter
-	h.GetAnalytics(c)
+	h.cachedGet(c, "analytics", c.Param("locationId"), "Failed to get analytics", h.proxyService.GetAnalytics)
 }
 
 func (h *Handler) GetAlertsByLocation(c *gin.Context) {
 	// Forward to alerts service with location parameter
-	h.GetAlerts(c)
+	h.cachedGet(c, "alerts", c.Param("locationId"), "Failed to get alerts", h.proxyService.GetAlerts)
 }
 
 func (h *Handler) GetTrafficDataByLocation(c *gin.Context) {
 	// Forward to traffic service with location parameter
-	h.GetTrafficData(c)
+	h.cachedGet(c, "traffic", c.Param("locationId"), "Failed to get traffic data", h.proxyService.GetTrafficData)
 }
 
 func (h *Handler) ReceiveTrafficData(c *gin.Context) {
 	// Proxy POST /traffic to traffic-ingestor service
 	ctx := c.Request.Context()
 
+	// IngestAuth already limited the size of the body
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		errorResponse := models.ErrorResponse{
-			Error:   "Bad request",
-			Message: fmt.Sprintf("Failed to read request body: %v", err),
-		}
-		c.JSON(http.StatusBadRequest, errorResponse)
+		middleware.RespondBodyError(c, err)
 		return
 	}
 
 	resp, err := h.proxyService.ProxyToService(ctx, "traffic", "POST", "/traffic", body)
 	if err != nil {
-		errorResponse := models.ErrorResponse{
-			Error:   "Internal server error",
-			Message: fmt.Sprintf("Failed to proxy traffic data: %v", err),
-		}
-		c.JSON(http.StatusInternalServerError, errorResponse)
+		h.upstreamError(c, "Failed to proxy traffic data", err)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Copy response from traffic-ingestor
-	responseData, _ := io.ReadAll(resp.Body)
+	// Cached traffic of the location no longer includes the new reading. An
+	// unreadable location_id leaves it empty, which invalidates every location.
+	if resp.StatusCode < http.StatusBadRequest {
+		var reading struct {
+			LocationID string `json:"location_id"`
+		}
+		if err := json.Unmarshal(body, &reading); err != nil {
+			reading.LocationID = ""
+		}
+		if err := h.responseCache.Invalidate(ctx, "traffic", reading.LocationID); err != nil {
+			log.Printf("Failed to invalidate cached traffic data: %v", err)
+		}
+	}
 
-	// Copy headers
+	// Copy headers from traffic-ingestor
 	for key, values := range resp.Header {
 		for _, value := range values {
 			c.Header(key, value)
 		}
 	}
 
-	c.Status(resp.StatusCode)
-	c.Writer.Write(responseData)
+	relay(c, resp)
+}
+
+func (h *Handler) AcknowledgeAlert(c *gin.Context) {
+	h.forwardAlertAction(c)
+}
+
+func (h *Handler) ResolveAlert(c *gin.Context) {
+	h.forwardAlertAction(c)
+}
+
+// forwardAlertAction proxies an alert state change (POST with body) to the alerting service
+func (h *Handler) forwardAlertAction(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad request",
+			Message: fmt.Sprintf("Failed to read request body: %v", err),
+		})
+		return
+	}
+
+	resp, err := h.proxyService.ProxyToService(ctx, "alerts", "POST", c.Request.URL.Path, body)
+	if err != nil {
+		h.upstreamError(c, "Failed to update alert", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Cached alert lists no longer reflect the alert's status
+	if resp.StatusCode < http.StatusBadRequest {
+		if err := h.responseCache.Invalidate(ctx, "alerts", ""); err != nil {
+			log.Printf("Failed to invalidate cached alerts: %v", err)
+		}
+	}
+
+	relay(c, resp)
+}
+
+// ForwardLocations proxies the location registry endpoints to the traffic-ingestor
+func (h *Handler) ForwardLocations(c *gin.Context) {
+	h.forward(c, "traffic")
+}
+
+// ForwardMap proxies the map endpoints to the traffic-ingestor. The Accept
+// header is forwarded so the ingestor can choose GeoJSON or JSON.
+func (h *Handler) ForwardMap(c *gin.Context) {
+	h.forward(c, "traffic")
+}
+
+// forward proxies the request as-is (method, path, query, body, Content-Type
+// and Accept) and relays the upstream status, Content-Type and Vary headers
+func (h *Handler) forward(c *gin.Context, serviceName string) {
+	ctx := c.Request.Context()
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		middleware.RespondError(c, http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Bad request",
+			Message: fmt.Sprintf("Failed to read request body: %v", err),
+		})
+		return
+	}
+
+	path := c.Request.URL.Path
+	if c.Request.URL.RawQuery != "" {
+		path = path + "?" + c.Request.URL.RawQuery
+	}
+
+	resp, err := h.proxyService.ProxyRequest(ctx, serviceName, c.Request.Method, path, body, c.Request.Header)
+	if err != nil {
+		h.upstreamError(c, "Failed to proxy request", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if vary := resp.Header.Get("Vary"); vary != "" {
+		c.Header("Vary", vary)
+	}
+	relay(c, resp)
 }
 
 func (h *Handler) ProxyToService(c *gin.Context) {
 	// Generic proxy for internal services
 	serviceName := c.Query("service")
 	if serviceName == "" {
-		errorResponse := models.ErrorResponse{
+		middleware.RespondError(c, http.StatusBadRequest, models.ErrorResponse{
 			Error:   "Bad request",
 			Message: "Service parameter is required",
-		}
-		c.JSON(http.StatusBadRequest, errorResponse)
+		})
 		return
 	}
 
@@ -178,22 +299,20 @@ func (h *Handler) ProxyToService(c *gin.Context) {
 	case "alerts":
 		targetURL = h.cfg.AlertingServiceURL
 	default:
-		errorResponse := models.ErrorResponse{
+		middleware.RespondError(c, http.StatusBadRequest, models.ErrorResponse{
 			Error:   "Bad request",
 			Message: "Invalid service name",
-		}
-		c.JSON(http.StatusBadRequest, errorResponse)
+		})
 		return
 	}
 
 	// Parse target URL
 	target, err := url.Parse(targetURL)
 	if err != nil {
-		errorResponse := models.ErrorResponse{
+		middleware.RespondError(c, http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Internal server error",
 			Message: "Invalid target URL",
-		}
-		c.JSON(http.StatusInternalServerError, errorResponse)
+		})
 		return
 	}
 
@@ -210,7 +329,92 @@ func (h *Handler) ProxyToService(c *gin.Context) {
 		if c.Request.URL.RawQuery != "" {
 			req.URL.RawQuery = c.Request.URL.RawQuery
 		}
+		// Replace the client's credentials with the authenticated identity
+		req.Header.Del("Authorization")
+		auth.StripHeaders(req.Header)
+		if identity, ok := auth.FromContext(c.Request.Context()); ok {
+			identity.SetHeaders(req.Header)
+		}
+	}
+
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		h.upstreamError(c, "Failed to proxy request", err)
 	}
 
 	proxy.ServeHTTP(c.Writer, c.Request)
 }
+
+// upstreamError answers a failed upstream call. Error responses of the
+// upstream keep their status and, when they follow models.ErrorResponse,
+// their body; 5xx without it become 502. Transport failures are 502, or 503
+// while the upstream's circuit is open and 504 when the call timed out.
+func (h *Handler) upstreamError(c *gin.Context, action string, err error) {
+	var upstreamErr *service.UpstreamError
+	switch {
+	case errors.As(err, &upstreamErr):
+		if upstreamErr.Response != nil {
+			middleware.RespondError(c, upstreamErr.StatusCode, *upstreamErr.Response)
+			return
+		}
+		status := upstreamErr.StatusCode
+		if status >= http.StatusInternalServerError {
+			status = http.StatusBadGateway
+		}
+		middleware.RespondError(c, status, models.ErrorResponse{
+			Error:   http.StatusText(status),
+			Code:    status,
+			Message: fmt.Sprintf("%s: %v", action, err),
+		})
+	case errors.Is(err, service.ErrCircuitOpen):
+		middleware.RespondError(c, http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "Service unavailable",
+			Code:    http.StatusServiceUnavailable,
+			Message: fmt.Sprintf("%s: %v", action, err),
+		})
+	case isTimeout(err):
+		middleware.RespondError(c, http.StatusGatewayTimeout, models.ErrorResponse{
+			Error:   "Gateway timeout",
+			Code:    http.StatusGatewayTimeout,
+			Message: fmt.Sprintf("%s: upstream did not answer in time", action),
+		})
+	case isTransportError(err):
+		middleware.RespondError(c, http.StatusBadGateway, models.ErrorResponse{
+			Error:   "Bad gateway",
+			Code:    http.StatusBadGateway,
+			Message: fmt.Sprintf("%s: %v", action, err),
+		})
+	default:
+		middleware.RespondError(c, http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Code:    http.StatusInternalServerError,
+			Message: fmt.Sprintf("%s: %v", action, err),
+		})
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func isTransportError(err error) bool {
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, context.Canceled)
+}
+
+// relay copies an upstream response, adding the request ID to error bodies
+// that follow models.ErrorResponse
+func relay(c *gin.Context, resp *http.Response) {
+	responseData, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		if errorResponse := service.ParseErrorResponse(responseData); errorResponse != nil {
+			// The body changes, so the upstream length no longer applies
+			c.Writer.Header().Del("Content-Length")
+			middleware.RespondError(c, resp.StatusCode, *errorResponse)
+			return
+		}
+	}
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), responseData)
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
+	"api-traffic-analytics/cmd/api-gateway/internal/config"
+	"api-traffic-analytics/cmd/api-gateway/internal/middleware"
+	"api-traffic-analytics/cmd/api-gateway/internal/openapi"
+	"api-traffic-analytics/internal/interfaces"
+)
+
+// NewRouter registers the gateway routes and middleware on a new Gin engine.
+// Protected routes accept JWTs checked by verifier or API keys. Each group
+// requires a minimum role from users and a scope from managed API keys, and
+// each route class has its own rate limit, counted in limiter. Traffic
+// readings may also come from sensors authenticated by devices. WebSocket
+// streams only accept the browser origins the CORS policy allows. The OpenAPI
+// contract is served at /openapi.json and /docs and, when
+// cfg.OpenAPIValidation is set, enforced on every request once the caller is
+// authenticated and authorized. It fails when the CORS policy or the contract
+// is invalid.
+func NewRouter(handler *Handler, cfg *config.Config, verifier *auth.Verifier, devices *auth.DeviceVerifier, limiter interfaces.RateLimiter) (*gin.Engine, error) {
+	cors, err := middleware.NewCORS(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// WebSocket upgrades are not covered by CORS in the browser
+	checkOrigin, err := middleware.NewOriginCheck(cfg)
+	if err != nil {
+		return nil, err
+	}
+	handler.upgrader = newUpgrader(checkOrigin)
+	spec, err := openapi.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	router := gin.New()
+
+	// Client IPs (rate limits, legacy ingestion allowlist) are only taken
+	// from X-Forwarded-For when the request comes through a trusted proxy
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Printf("Invalid TRUSTED_PROXIES, ignoring forwarded client IPs: %v", err)
+		router.SetTrustedProxies(nil)
+	}
+
+	// Global middleware
+	router.Use(gin.Recovery())
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Logging())
+	router.Use(cors)
+
+	// Contract validation runs last, so that anonymous callers get a 401
+	// rather than the details of the contract
+	validate := func(c *gin.Context) { c.Next() }
+	if cfg.OpenAPIValidation {
+		validate = middleware.ValidateOpenAPI(spec, cfg.OpenAPIMaxBodyBytes)
+	}
+
+	// Rate limits per route class
+	readLimit := middleware.RateLimit(limiter, "read", cfg.RateLimit(cfg.RateLimitRequests))
+	writeLimit := middleware.RateLimit(limiter, "write", cfg.RateLimit(cfg.RateLimitWriteRequests))
+	ingestLimit := middleware.RateLimit(limiter, "ingest", cfg.RateLimit(cfg.RateLimitIngestRequests))
+	streamLimit := middleware.RateLimit(limiter, "stream", cfg.RateLimit(cfg.RateLimitStreamRequests))
+
+	// Public routes (no auth required)
+	public := router.Group("/", validate)
+	{
+		public.GET("/health", handler.HealthCheck)
+		handler.checker.Register(public)
+		public.GET("/metrics", gin.WrapH(promhttp.Handler()))
+		spec.Register(public)
+	}
+	// Readings come from signed devices, callers with traffic:write or,
+	// without credentials, the legacy IP allowlist
+	router.POST("/traffic",
+		middleware.IngestAuth(verifier, handler.apiKeyService, devices, cfg.IngestMaxBodyBytes),
+		ingestLimit,
+		middleware.RequireIfAuthenticated(auth.RoleOperator, auth.ScopeTrafficWrite),
+		validate,
+		handler.ReceiveTrafficData)
+
+	// Protected routes (auth required)
+	protected := router.Group("/")
+	protected.Use(middleware.Authenticate(verifier, handler.apiKeyService))
+
+	// Read-only access
+	analytics := protected.Group("/", readLimit, middleware.Require(auth.RoleViewer, auth.ScopeAnalyticsRead), validate)
+	{
+		analytics.GET("/analytics", handler.GetAnalytics)
+		analytics.GET("/analytics/summary", handler.GetAnalyticsAggregates)
+		analytics.GET("/analytics/aggregate", handler.GetAnalyticsAggregates)
+		analytics.GET("/analytics/:locationId", handler.GetAnalyticsByLocation)
+	}
+
+	alerts := protected.Group("/", readLimit, middleware.Require(auth.RoleViewer, auth.ScopeAlertsRead), validate)
+	{
+		alerts.GET("/alerts", handler.GetAlerts)
+		alerts.GET("/alerts/:locationId", handler.GetAlertsByLocation)
+	}
+
+	traffic := protected.Group("/", readLimit, middleware.Require(auth.RoleViewer, auth.ScopeTrafficRead), validate)
+	{
+		// Traffic data endpoints
+		traffic.GET("/traffic", handler.GetTrafficData)
+		traffic.GET("/traffic/:locationId", handler.GetTrafficDataByLocation)
+		traffic.GET("/traffic/:locationId/latest", handler.GetTrafficDataByLocation)
+
+		// Location registry endpoints
+		traffic.GET("/locations", handler.ForwardLocations)
+		traffic.GET("/locations/search/:kind", handler.ForwardLocations)
+		traffic.POST("/locations/search/:kind", handler.ForwardLocations)
+		traffic.GET("/locations/:id", handler.ForwardLocations)
+
+		// Traffic time series (served from rollups for long ranges)
+		traffic.GET("/series/traffic", handler.GetTrafficData)
+
+		// Map endpoints (GeoJSON or JSON, negotiated via Accept)
+		traffic.GET("/map/traffic", handler.ForwardMap)
+		traffic.GET("/map/heatmap", handler.ForwardMap)
+	}
+
+	// Live streams (SSE, or WebSocket on upgrade). The limit counts new
+	// connections.
+	streams := protected.Group("/stream", streamLimit)
+	{
+		streams.GET("/traffic", middleware.Require(auth.RoleViewer, auth.ScopeTrafficRead), validate, handler.StreamTraffic)
+		streams.GET("/alerts", middleware.Require(auth.RoleViewer, auth.ScopeAlertsRead), validate, handler.StreamAlerts)
+	}
+
+	// Alert handling
+	operator := protected.Group("/", writeLimit, middleware.Require(auth.RoleOperator, auth.ScopeAlertsManage), validate)
+	{
+		operator.POST("/alerts/:id/acknowledge", handler.AcknowledgeAlert)
+		operator.POST("/alerts/:id/resolve", handler.ResolveAlert)
+	}
+
+	// Location registry changes
+	locations := protected.Group("/", writeLimit, middleware.Require(auth.RoleAdmin, auth.ScopeLocationsManage), validate)
+	{
+		locations.POST("/locations", handler.ForwardLocations)
+		locations.POST("/locations/import", handler.ForwardLocations)
+		locations.PUT("/locations/:id", handler.ForwardLocations)
+		locations.DELETE("/locations/:id", handler.ForwardLocations)
+	}
+
+	// Administration, closed to API keys
+	admin := protected.Group("/", writeLimit, middleware.Require(auth.RoleAdmin, ""), validate)
+	{
+		admin.POST("/admin/api-keys", handler.CreateAPIKey)
+		admin.GET("/admin/api-keys", handler.ListAPIKeys)
+		admin.POST("/admin/api-keys/:id/revoke", handler.RevokeAPIKey)
+		admin.POST("/admin/api-keys/:id/rotate", handler.RotateAPIKey)
+
+		// Proxy to internal services
+		admin.Any("/services/*path", handler.ProxyToService)
+	}
+
+	return router, nil
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/service"
+)
+
+// Time allowed for a websocket write (including pings) to complete
+const streamWriteWait = 10 * time.Second
+
+// newUpgrader creates the websocket upgrader of the streams. checkOrigin
+// decides which browser origins may open one; nil only allows the gateway's
+// own origin.
+func newUpgrader(checkOrigin func(r *http.Request) bool) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 4096,
+		CheckOrigin:     checkOrigin,
+	}
+}
+
+// StreamTraffic streams live traffic readings. Severity filters on congestion level.
+func (h *Handler) StreamTraffic(c *gin.Context) {
+	h.stream(c, h.streamService.Traffic)
+}
+
+// StreamAlerts streams live alert status changes.
+func (h *Handler) StreamAlerts(c *gin.Context) {
+	h.stream(c, h.streamService.Alerts)
+}
+
+// stream serves the hub over WebSocket when the client asks for an upgrade,
+// and over Server-Sent Events otherwise.
+func (h *Handler) stream(c *gin.Context, hub *service.StreamHub) {
+	filter := service.StreamFilter{
+		LocationIDs: splitSet(c.Query("location_id")),
+		City:        c.Query("city"),
+		Severities:  splitSet(c.Query("severity")),
+	}
+
+	// EventSource sends Last-Event-ID on reconnect; websocket clients use the query
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		h.serveWebSocket(c, hub, filter, lastEventID)
+		return
+	}
+	h.serveSSE(c, hub, filter, lastEventID)
+}
+
+func (h *Handler) serveSSE(c *gin.Context, hub *service.StreamHub, filter service.StreamFilter, lastEventID string) {
+	sub, replay := hub.Subscribe(filter, lastEventID)
+	defer hub.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, event := range replay {
+		writeSSE(w, event)
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeatInterval())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			w.Flush()
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Overflowed() {
+					// Tell the client to reconnect and resume from its last event id
+					fmt.Fprint(w, "event: overflow\ndata: {\"error\":\"client too slow, reconnect with Last-Event-ID\"}\n\n")
+					w.Flush()
+				}
+				return
+			}
+			writeSSE(w, event)
+			w.Flush()
+		}
+	}
+}
+
+func writeSSE(w gin.ResponseWriter, event *service.StreamEvent) {
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
+
+// wsMessage is the frame sent to websocket clients
+type wsMessage struct {
+	ID    string      `json:"id"`
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+func (h *Handler) serveWebSocket(c *gin.Context, hub *service.StreamHub, filter service.StreamFilter, lastEventID string) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade already wrote an HTTP error
+		return
+	}
+	defer conn.Close()
+
+	sub, replay := hub.Subscribe(filter, lastEventID)
+	defer hub.Unsubscribe(sub)
+
+	interval := h.heartbeatInterval()
+
+	// The reader only handles control frames; it stops when the client goes away
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * interval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * interval))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event *service.StreamEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+		return conn.WriteJSON(wsMessage{ID: event.ID, Event: event.Type, Data: event.Data})
+	}
+
+	for _, event := range replay {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait)); err != nil {
+				return
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Overflowed() {
+					msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow, reconnect with last_event_id")
+					conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(streamWriteWait))
+				}
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *Handler) heartbeatInterval() time.Duration {
+	if h.cfg.StreamHeartbeatSeconds <= 0 {
+		return 15 * time.Second
+	}
+	return time.Duration(h.cfg.StreamHeartbeatSeconds) * time.Second
+}
+
+// splitSet parses a comma-separated query value into a set
+func splitSet(value string) map[string]bool {
+	if value == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
@@ -1,53 +1,205 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
+	"api-traffic-analytics/cmd/api-gateway/internal/service"
 	"api-traffic-analytics/internal/shared/models"
 )
 
-func APIKeyAuth(validAPIKey string) gin.HandlerFunc {
+// APIKeyAuthenticator resuelve una API key a la identidad que concede
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (*auth.Identity, error)
+}
+
+// Authenticate acepta un JWT ("Bearer <token>") verificado por verifier o una
+// API key ("Bearer <key>", "ApiKey <key>" o el header X-API-Key) resuelta por
+// keys. La identidad se guarda en el contexto de la request para reenviarla a
+// los servicios internos.
+func Authenticate(verifier *auth.Verifier, keys APIKeyAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			errorResponse := models.ErrorResponse{
-				Error:   "Unauthorized",
-				Message: "Authorization header required",
-			}
-			c.JSON(http.StatusUnauthorized, errorResponse)
-			c.Abort()
+		// Los headers de identidad solo los pone el gateway
+		auth.StripHeaders(c.Request.Header)
+
+		if !hasCredentials(c) {
+			unauthorized(c, "Authorization header required")
 			return
 		}
+		authenticate(c, verifier, keys)
+	}
+}
 
-		// Support both "Bearer <key>" and "ApiKey <key>" formats
-		var apiKey string
-		_, err := fmt.Sscanf(authHeader, "Bearer %s", &apiKey)
-		if err != nil {
-			_, err = fmt.Sscanf(authHeader, "ApiKey %s", &apiKey)
+// IngestAuth autentica las lecturas de tráfico. Acepta credenciales como
+// Authenticate, la firma HMAC de un sensor comprobada por devices o, sin
+// credenciales, las requests de las IPs de la lista legacy de devices. El
+// resto se rechaza con 401. Los bodies de más de maxBodyBytes se rechazan con
+// 413 antes de comprobar la firma.
+func IngestAuth(verifier *auth.Verifier, keys APIKeyAuthenticator, devices *auth.DeviceVerifier, maxBodyBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth.StripHeaders(c.Request.Header)
+		if maxBodyBytes > 0 && c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes)
+		}
+
+		switch {
+		case hasCredentials(c):
+			authenticate(c, verifier, keys)
+
+		case auth.Signed(c.Request.Header):
+			body, err := io.ReadAll(c.Request.Body)
 			if err != nil {
-				errorResponse := models.ErrorResponse{
-					Error:   "Unauthorized",
-					Message: "Invalid authorization format",
+				RespondBodyError(c, err)
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+			identity, err := devices.Verify(c.Request.Context(), c.Request, body)
+			if err != nil {
+				if !errors.Is(err, auth.ErrInvalidSignature) {
+					log.Printf("Device authentication failed: %v", err)
+					RespondError(c, http.StatusServiceUnavailable, models.ErrorResponse{
+						Error:   "Service unavailable",
+						Message: "Could not verify the device signature",
+					})
+					return
 				}
-				c.JSON(http.StatusUnauthorized, errorResponse)
-				c.Abort()
+				unauthorized(c, err.Error())
 				return
 			}
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), identity))
+			c.Next()
+
+		case devices.LegacyAllowed(c.ClientIP()):
+			c.Next()
+
+		default:
+			unauthorized(c, "Traffic readings must be signed by a device or sent with credentials")
 		}
+	}
+}
+
+// RespondBodyError responde al error al leer el body de la request: 413 si
+// supera su límite de tamaño y 400 en otro caso
+func RespondBodyError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		RespondError(c, http.StatusRequestEntityTooLarge, models.ErrorResponse{
+			Error:   "Payload too large",
+			Message: fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit),
+		})
+		return
+	}
+	RespondError(c, http.StatusBadRequest, models.ErrorResponse{
+		Error:   "Bad request",
+		Message: fmt.Sprintf("Failed to read request body: %v", err),
+	})
+}
+
+func hasCredentials(c *gin.Context) bool {
+	return c.GetHeader("Authorization") != "" || c.GetHeader("X-API-Key") != ""
+}
 
-		if apiKey != validAPIKey {
-			errorResponse := models.ErrorResponse{
-				Error:   "Unauthorized",
-				Message: "Invalid API key",
+func authenticate(c *gin.Context, verifier *auth.Verifier, keys APIKeyAuthenticator) {
+	// Support "Bearer <credential>", "ApiKey <key>" and "X-API-Key: <key>"
+	scheme, credential := "ApiKey", strings.TrimSpace(c.GetHeader("X-API-Key"))
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		scheme, credential, _ = strings.Cut(authHeader, " ")
+		credential = strings.TrimSpace(credential)
+	}
+	if credential == "" || (scheme != "Bearer" && scheme != "ApiKey") {
+		unauthorized(c, "Invalid authorization format")
+		return
+	}
+
+	var identity *auth.Identity
+	var err error
+	if scheme == "Bearer" && auth.LooksLikeJWT(credential) {
+		if !verifier.Enabled() {
+			unauthorized(c, "JWT authentication is not configured")
+			return
+		}
+		if identity, err = verifier.Verify(credential); err != nil {
+			message := "Invalid token"
+			if errors.Is(err, auth.ErrInvalidToken) {
+				message = err.Error()
 			}
-			c.JSON(http.StatusUnauthorized, errorResponse)
-			c.Abort()
+			unauthorized(c, message)
+			return
+		}
+	} else if identity, err = keys.Authenticate(c.Request.Context(), credential); err != nil {
+		switch {
+		case errors.Is(err, service.ErrAPIKeyRevoked), errors.Is(err, service.ErrAPIKeyExpired):
+			unauthorized(c, err.Error())
+		case errors.Is(err, service.ErrInvalidAPIKey):
+			unauthorized(c, "Invalid API key")
+		default:
+			log.Printf("API key authentication failed: %v", err)
+			RespondError(c, http.StatusServiceUnavailable, models.ErrorResponse{
+				Error:   "Service unavailable",
+				Message: "Could not verify the API key",
+			})
+		}
+		return
+	}
+
+	c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), identity))
+	c.Next()
+}
+
+// Require rechaza con 403 a quien no tenga role (o uno superior) o, si
+// entra con una API key gestionada, el scope. Un scope vacío deja la ruta
+// fuera del alcance de las API keys. Va detrás de Authenticate.
+func Require(role, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			unauthorized(c, "Authentication required")
+			return
+		}
+		if !identity.Allows(role, scope) {
+			forbidden(c, role, scope)
 			return
 		}
+		c.Next()
+	}
+}
 
+// RequireIfAuthenticated es Require para rutas con IngestAuth: las requests
+// anónimas de la lista legacy pasan.
+func RequireIfAuthenticated(role, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if identity, ok := auth.FromContext(c.Request.Context()); ok && !identity.Allows(role, scope) {
+			forbidden(c, role, scope)
+			return
+		}
 		c.Next()
 	}
 }
+
+func forbidden(c *gin.Context, role, scope string) {
+	message := "This operation requires the " + role + " role"
+	if scope != "" {
+		message += " or the " + scope + " scope"
+	}
+	RespondError(c, http.StatusForbidden, models.ErrorResponse{
+		Error:   "Forbidden",
+		Message: message,
+	})
+}
+
+func unauthorized(c *gin.Context, message string) {
+	RespondError(c, http.StatusUnauthorized, models.ErrorResponse{
+		Error:   "Unauthorized",
+		Message: message,
+	})
+}
@@ -1,60 +1,258 @@
 package middleware
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/config"
 )
 
-// CORS es un middleware que maneja los headers de CORS
-func CORS() gin.HandlerFunc {
+// CORSPolicy describe qué orígenes pueden llamar al gateway desde un
+// navegador. Un origen es exacto ("https://app.example.com"), "*" o un patrón
+// de subdominios ("https://*.example.com").
+type CORSPolicy struct {
+	AllowedOrigins   []string `json:"allowed_origins,omitempty"`
+	AllowedMethods   []string `json:"allowed_methods,omitempty"`
+	AllowedHeaders   []string `json:"allowed_headers,omitempty"`
+	ExposedHeaders   []string `json:"exposed_headers,omitempty"`
+	AllowCredentials *bool    `json:"allow_credentials,omitempty"`
+	MaxAgeSeconds    *int     `json:"max_age_seconds,omitempty"`
+}
+
+// CORSRoute cambia la política para las rutas que empiezan por Path. Los
+// campos que no fija se heredan de la política por defecto.
+type CORSRoute struct {
+	Path string `json:"path"`
+	CORSPolicy
+}
+
+// corsPolicy es una CORSPolicy validada y lista para usar
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	patterns    []originPattern
+	methods     string
+	headers     string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+type originPattern struct {
+	prefix string // "https://"
+	suffix string // ".example.com"
+}
+
+type corsRoute struct {
+	path   string
+	policy *corsPolicy
+}
+
+// corsPolicies son la política por defecto y sus excepciones por ruta
+type corsPolicies struct {
+	defaultPolicy *corsPolicy
+	routes        []corsRoute
+}
+
+// NewCORS crea el middleware de CORS con la política de cfg y sus excepciones
+// por ruta (CORS_ROUTES, un array JSON de CORSRoute). Falla si alguna
+// política combina credenciales con cualquier origen.
+func NewCORS(cfg *config.Config) (gin.HandlerFunc, error) {
+	policies, err := compileCORS(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	return func(c *gin.Context) {
-		// Obtener el origen de la solicitud
 		origin := c.Request.Header.Get("Origin")
+		if origin == "" {
+			// No es una request CORS
+			c.Next()
+			return
+		}
 
-		// Lista de orígenes permitidos (en producción, haz esto configurable)
-		allowedOrigins := []string{
-			"http://localhost:3000",
-			"http://localhost:8080",
-			"http://127.0.0.1:3000",
-			"http://127.0.0.1:8080",
-			// Agrega tus dominios permitidos aquí
-		}
-
-		// Verificar si el origen está permitido
-		isAllowed := false
-		for _, allowed := range allowedOrigins {
-			if origin == allowed || allowed == "*" {
-				isAllowed = true
-				break
+		policy := policies.forPath(c.Request.URL.Path)
+		preflight := c.Request.Method == http.MethodOptions
+		c.Writer.Header().Add("Vary", "Origin")
+		if !policy.allows(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
 			}
+			// Sin headers de CORS el navegador bloquea la respuesta
+			c.Next()
+			return
 		}
 
-		if isAllowed || len(allowedOrigins) == 0 {
+		if policy.anyOrigin && !policy.credentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
 			c.Header("Access-Control-Allow-Origin", origin)
 		}
-
-		// Headers permitidos
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", strings.Join([]string{
-			"Origin",
-			"Content-Type",
-			"Accept",
-			"Authorization",
-			"X-Requested-With",
-			"X-API-Key",
-		}, ", "))
-
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Max-Age", "86400") // 24 hours
+		if policy.credentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
 
 		// Manejar preflight requests
-		if c.Request.Method == "OPTIONS" {
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", policy.methods)
+			c.Header("Access-Control-Allow-Headers", policy.headers)
+			c.Header("Access-Control-Max-Age", policy.maxAge)
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
+		if policy.exposed != "" {
+			c.Header("Access-Control-Expose-Headers", policy.exposed)
+		}
 		c.Next()
+	}, nil
+}
+
+// NewOriginCheck crea la comprobación de origen de los upgrades a WebSocket
+// con la misma política que NewCORS. El navegador no aplica CORS a los
+// WebSocket, así que sin ella cualquier web podría abrir un stream con las
+// credenciales del usuario: se rechazan los upgrades cuyo Origin no admite la
+// política de su ruta. Los clientes que no son navegadores no envían Origin.
+func NewOriginCheck(cfg *config.Config) (func(r *http.Request) bool, error) {
+	policies, err := compileCORS(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || policies.forPath(r.URL.Path).allows(origin)
+	}, nil
+}
+
+// compileCORS valida la política de cfg y sus excepciones por ruta
+func compileCORS(cfg *config.Config) (*corsPolicies, error) {
+	credentials, maxAge := cfg.CORSAllowCredentials, cfg.CORSMaxAgeSeconds
+	base := CORSPolicy{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   cfg.CORSExposedHeaders,
+		AllowCredentials: &credentials,
+		MaxAgeSeconds:    &maxAge,
+	}
+	defaultPolicy, err := compileCORSPolicy(base)
+	if err != nil {
+		return nil, fmt.Errorf("CORS policy: %w", err)
+	}
+
+	var overrides []CORSRoute
+	if strings.TrimSpace(cfg.CORSRoutes) != "" {
+		if err := json.Unmarshal([]byte(cfg.CORSRoutes), &overrides); err != nil {
+			return nil, fmt.Errorf("CORS routes: %w", err)
+		}
+	}
+	routes := make([]corsRoute, 0, len(overrides))
+	for _, override := range overrides {
+		if !strings.HasPrefix(override.Path, "/") {
+			return nil, fmt.Errorf("CORS route %q: path must start with /", override.Path)
+		}
+		policy, err := compileCORSPolicy(inheritCORSPolicy(override.CORSPolicy, base))
+		if err != nil {
+			return nil, fmt.Errorf("CORS route %s: %w", override.Path, err)
+		}
+		routes = append(routes, corsRoute{path: override.Path, policy: policy})
+	}
+	// La excepción más específica gana
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i].path) > len(routes[j].path) })
+	return &corsPolicies{defaultPolicy: defaultPolicy, routes: routes}, nil
+}
+
+// forPath devuelve la política que se aplica a path
+func (p *corsPolicies) forPath(path string) *corsPolicy {
+	for _, route := range p.routes {
+		if strings.HasPrefix(path, route.path) {
+			return route.policy
+		}
+	}
+	return p.defaultPolicy
+}
+
+// inheritCORSPolicy completa los campos vacíos de override con los de base
+func inheritCORSPolicy(override, base CORSPolicy) CORSPolicy {
+	if override.AllowedOrigins == nil {
+		override.AllowedOrigins = base.AllowedOrigins
+	}
+	if override.AllowedMethods == nil {
+		override.AllowedMethods = base.AllowedMethods
+	}
+	if override.AllowedHeaders == nil {
+		override.AllowedHeaders = base.AllowedHeaders
+	}
+	if override.ExposedHeaders == nil {
+		override.ExposedHeaders = base.ExposedHeaders
+	}
+	if override.AllowCredentials == nil {
+		override.AllowCredentials = base.AllowCredentials
+	}
+	if override.MaxAgeSeconds == nil {
+		override.MaxAgeSeconds = base.MaxAgeSeconds
+	}
+	return override
+}
+
+func compileCORSPolicy(p CORSPolicy) (*corsPolicy, error) {
+	compiled := &corsPolicy{
+		origins:     make(map[string]bool),
+		methods:     strings.Join(p.AllowedMethods, ", "),
+		headers:     strings.Join(p.AllowedHeaders, ", "),
+		exposed:     strings.Join(p.ExposedHeaders, ", "),
+		credentials: p.AllowCredentials != nil && *p.AllowCredentials,
+	}
+	if p.MaxAgeSeconds != nil {
+		compiled.maxAge = strconv.Itoa(*p.MaxAgeSeconds)
+	}
+
+	for _, origin := range p.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			compiled.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			scheme, host, ok := strings.Cut(origin, "://")
+			if !ok || !strings.HasPrefix(host, "*.") || strings.Count(host, "*") != 1 || strings.Contains(host, "/") {
+				return nil, fmt.Errorf("invalid origin pattern %q, use scheme://*.domain", origin)
+			}
+			compiled.patterns = append(compiled.patterns, originPattern{prefix: scheme + "://", suffix: host[1:]})
+		case origin != "":
+			compiled.origins[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+
+	// Los navegadores no aceptan "*" con credenciales, y reflejar cualquier
+	// origen con credenciales expondría las sesiones a cualquier web
+	if compiled.anyOrigin && compiled.credentials {
+		return nil, fmt.Errorf("allow_credentials cannot be combined with the * origin")
+	}
+	return compiled, nil
+}
+
+func (p *corsPolicy) allows(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if strings.HasPrefix(origin, pattern.prefix) && strings.HasSuffix(origin, pattern.suffix) {
+			subdomain := strings.TrimSuffix(strings.TrimPrefix(origin, pattern.prefix), pattern.suffix)
+			if subdomain != "" && !strings.ContainsAny(subdomain, "/:@") {
+				return true
+			}
+		}
 	}
+	return false
 }
@@ -31,13 +31,14 @@ func Logging() gin.HandlerFunc {
 			path = path + "?" + raw
 		}
 
-		log.Printf("[GIN] %v | %3d | %13v | %15s | %-7s %s",
+		log.Printf("[GIN] %v | %3d | %13v | %15s | %-7s %s | %s",
 			end.Format("2006/01/02 - 15:04:05"),
 			statusCode,
 			latency,
 			clientIP,
 			method,
 			path,
+			GetRequestID(c),
 		)
 
 		if errorMessage != "" {
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/openapi"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// ValidateOpenAPI valida cada request contra su operación en spec antes de
+// atenderla: las que no cumplen el contrato se rechazan con 400 (415 si el
+// Content-Type no está documentado) y los problemas en details. Las
+// respuestas también se validan y lo que no cumplen se registra en el log,
+// porque ya se enviaron; las de los streams no se validan. Las rutas sin
+// documentar pasan sin validar. Los bodies de más de maxBodyBytes se rechazan
+// con 413 sin leerlos enteros.
+func ValidateOpenAPI(spec *openapi.Spec, maxBodyBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		operation := spec.Operation(c.Request.Method, route)
+		if operation == nil {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			if maxBodyBytes > 0 {
+				c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes)
+			}
+			var err error
+			if body, err = io.ReadAll(c.Request.Body); err != nil {
+				RespondBodyError(c, err)
+				return
+			}
+			// El resto de la cadena vuelve a leer el body
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if err := spec.ValidateRequest(route, c.Request, body); err != nil {
+			var validationErr *openapi.ValidationError
+			switch {
+			case errors.Is(err, openapi.ErrUnsupportedMediaType):
+				RespondError(c, http.StatusUnsupportedMediaType, models.ErrorResponse{
+					Error:   "Unsupported media type",
+					Message: err.Error(),
+				})
+			case errors.As(err, &validationErr):
+				RespondError(c, http.StatusBadRequest, models.ErrorResponse{
+					Error:   "Bad request",
+					Message: "The request does not match the API contract, see " + openapi.DocsPath,
+					Details: validationErr.Problems,
+				})
+			default:
+				RespondError(c, http.StatusBadRequest, models.ErrorResponse{Error: "Bad request", Message: err.Error()})
+			}
+			return
+		}
+
+		// Un stream no termina nunca: no se guarda su body
+		if operation.Streaming() {
+			c.Next()
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if err := spec.ValidateResponse(c.Request.Method, route, recorder.Status(), recorder.Header(), recorder.body.Bytes()); err != nil {
+			log.Printf("OpenAPI: response %d to %s %s does not match the contract: %v | %s",
+				recorder.Status(), c.Request.Method, c.Request.URL.Path, err, GetRequestID(c))
+		}
+	}
+}
+
+// bodyRecorder guarda una copia de lo que se escribe en la respuesta
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -1,34 +1,51 @@
 package middleware
 
 import (
+	"fmt"
+	"log"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
-)
-
-type visitor struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
-}
-
-var visitors = make(map[string]*visitor)
-var mu sync.Mutex
 
-func RateLimit() gin.HandlerFunc {
-	go cleanupVisitors()
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/redis"
+	"api-traffic-analytics/internal/shared/models"
+)
 
+// RateLimit limita a cada cliente a limit requests en las rutas de class. El
+// estado vive en limiter (Redis), así que el límite es común a todas las
+// réplicas del gateway. El cliente es la API key, el sensor o el usuario
+// autenticado y, en las requests anónimas o con la API key compartida, la IP.
+// Las API keys con cuota propia la usan en lugar de limit. Si limiter falla,
+// la request pasa sin límite.
+func RateLimit(limiter interfaces.RateLimiter, class string, limit redis.RateLimit) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		limiter := getVisitor(ip)
+		client, quota := rateLimitClient(c)
+		applied := limit
+		if quota > 0 {
+			applied.Requests = quota
+		}
+
+		result, err := limiter.Allow(c.Request.Context(), class+":"+client, applied)
+		if err != nil {
+			log.Printf("Rate limit check failed, letting the request through: %v", err)
+			c.Next()
+			return
+		}
 
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded",
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(seconds(result.ResetAfter)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+			RespondError(c, http.StatusTooManyRequests, models.ErrorResponse{
+				Error:   "Too many requests",
+				Message: fmt.Sprintf("Rate limit of %d requests per %s exceeded", applied.Requests, applied.Period),
 			})
-			c.Abort()
 			return
 		}
 
@@ -36,31 +53,22 @@ func RateLimit() gin.HandlerFunc {
 	}
 }
 
-func getVisitor(ip string) *rate.Limiter {
-	mu.Lock()
-	defer mu.Unlock()
-
-	v, exists := visitors[ip]
-	if !exists {
-		// 100 requests per minute
-		limiter := rate.NewLimiter(rate.Every(time.Minute/100), 100)
-		visitors[ip] = &visitor{limiter, time.Now()}
-		return limiter
+// rateLimitClient identifica al cliente y devuelve su cuota propia, si tiene
+func rateLimitClient(c *gin.Context) (string, int) {
+	if identity, ok := auth.FromContext(c.Request.Context()); ok {
+		switch identity.Method {
+		case auth.MethodAPIKey:
+			return "key:" + identity.KeyID, identity.RateLimit
+		case auth.MethodDevice:
+			return "device:" + identity.Subject, 0
+		case auth.MethodJWT:
+			return "user:" + identity.Subject, identity.RateLimit
+		}
 	}
-
-	v.lastSeen = time.Now()
-	return v.limiter
+	return "ip:" + c.ClientIP(), 0
 }
 
-func cleanupVisitors() {
-	for {
-		time.Sleep(time.Minute)
-		mu.Lock()
-		for ip, v := range visitors {
-			if time.Since(v.lastSeen) > 3*time.Minute {
-				delete(visitors, ip)
-			}
-		}
-		mu.Unlock()
-	}
+// seconds redondea d hacia arriba a segundos enteros
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
 }
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/internal/shared"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+const requestIDKey = "request_id"
+
+// RequestID asigna un ID a cada request: el X-Request-ID del cliente si es
+// válido o uno nuevo. Se devuelve en la respuesta, se pasa a los servicios
+// internos y se incluye en los errores.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Request.Header.Get(shared.HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Request.Header.Set(shared.HeaderRequestID, id)
+		c.Request = c.Request.WithContext(shared.WithRequestID(c.Request.Context(), id))
+		c.Header(shared.HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+// GetRequestID devuelve el ID asignado por RequestID
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// RespondError responde con resp y status, con el ID de la request, y aborta
+// el resto de la cadena
+func RespondError(c *gin.Context, status int, resp models.ErrorResponse) {
+	resp.RequestID = GetRequestID(c)
+	c.AbortWithStatusJSON(status, resp)
+}
+
+// validRequestID acepta IDs cortos sin caracteres que ensucien los logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
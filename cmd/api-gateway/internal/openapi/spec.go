@@ -0,0 +1,318 @@
+// Package openapi holds the OpenAPI 3 contract of the gateway (openapi.json,
+// maintained by hand next to the router), serves it with a documentation
+// page and validates requests and responses against it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Routes of the document and of its documentation page
+const (
+	SpecPath = "/openapi.json"
+	DocsPath = "/docs"
+)
+
+//go:embed openapi.json
+var document []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// Spec is the parsed contract, with every $ref resolved
+type Spec struct {
+	raw        []byte
+	operations map[string]*Operation
+}
+
+// Operation is a documented method of a path
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody lists the accepted media types of a request body
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response lists the media types of a response; without content the
+// response has no body
+type Response struct {
+	Ref     string                `json:"$ref"`
+	Content map[string]*MediaType `json:"content"`
+}
+
+// MediaType is the schema of a body of one media type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema used by the document
+type Schema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Nullable             bool                  `json:"nullable"`
+	Enum                 []interface{}         `json:"enum"`
+	Minimum              *float64              `json:"minimum"`
+	Maximum              *float64              `json:"maximum"`
+	MinLength            *int                  `json:"minLength"`
+	MaxLength            *int                  `json:"maxLength"`
+	MinItems             *int                  `json:"minItems"`
+	Required             []string              `json:"required"`
+	Properties           map[string]*Schema    `json:"properties"`
+	AdditionalProperties *AdditionalProperties `json:"additionalProperties"`
+	Items                *Schema               `json:"items"`
+	AllOf                []*Schema             `json:"allOf"`
+	AnyOf                []*Schema             `json:"anyOf"`
+}
+
+// AdditionalProperties is false, true or the schema of the properties an
+// object may have besides the listed ones
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+type pathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Get        *Operation   `json:"get"`
+	Put        *Operation   `json:"put"`
+	Post       *Operation   `json:"post"`
+	Delete     *Operation   `json:"delete"`
+	Options    *Operation   `json:"options"`
+	Head       *Operation   `json:"head"`
+	Patch      *Operation   `json:"patch"`
+	Trace      *Operation   `json:"trace"`
+}
+
+func (p *pathItem) operations() map[string]*Operation {
+	return map[string]*Operation{
+		http.MethodGet:     p.Get,
+		http.MethodPut:     p.Put,
+		http.MethodPost:    p.Post,
+		http.MethodDelete:  p.Delete,
+		http.MethodOptions: p.Options,
+		http.MethodHead:    p.Head,
+		http.MethodPatch:   p.Patch,
+		http.MethodTrace:   p.Trace,
+	}
+}
+
+type components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+	Responses  map[string]*Response  `json:"responses"`
+}
+
+// Load parses the embedded document. It fails when the document is not valid
+// JSON or has a $ref to a missing component.
+func Load() (*Spec, error) {
+	var doc struct {
+		Paths      map[string]*pathItem `json:"paths"`
+		Components components           `json:"components"`
+	}
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+
+	l := &linker{components: doc.Components, linked: make(map[*Schema]bool)}
+	spec := &Spec{raw: document, operations: make(map[string]*Operation)}
+	for path, item := range doc.Paths {
+		for method, operation := range item.operations() {
+			if operation == nil {
+				continue
+			}
+			if err := l.linkOperation(operation, item.Parameters); err != nil {
+				return nil, fmt.Errorf("openapi: %s %s: %w", method, path, err)
+			}
+			spec.operations[method+" "+path] = operation
+		}
+	}
+	return spec, nil
+}
+
+// Operation returns the operation of method on a Gin route
+// ("/traffic/:locationId"), or nil when it is not documented
+func (s *Spec) Operation(method, route string) *Operation {
+	return s.operations[method+" "+PathTemplate(route)]
+}
+
+// Register serves the document at SpecPath and its documentation page at
+// DocsPath
+func (s *Spec) Register(routes gin.IRoutes) {
+	routes.GET(SpecPath, func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", s.raw)
+	})
+	routes.GET(DocsPath, func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+	})
+}
+
+// Streaming reports whether the operation answers with an event stream,
+// whose body is never complete
+func (o *Operation) Streaming() bool {
+	for _, response := range o.Responses {
+		if _, ok := response.Content["text/event-stream"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PathTemplate turns the parameters of a Gin route (":id", "*path") into
+// OpenAPI ones ("{id}", "{path}")
+func PathTemplate(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// linker replaces every $ref of the document with the component it points to
+type linker struct {
+	components components
+	linked     map[*Schema]bool
+}
+
+func (l *linker) linkOperation(operation *Operation, shared []*Parameter) error {
+	// Parameters of the operation override those of its path
+	var parameters []*Parameter
+	seen := make(map[string]bool)
+	for _, parameter := range append(append([]*Parameter(nil), operation.Parameters...), shared...) {
+		parameter, err := l.parameter(parameter)
+		if err != nil {
+			return err
+		}
+		if key := parameter.In + ":" + parameter.Name; !seen[key] {
+			seen[key] = true
+			parameters = append(parameters, parameter)
+		}
+	}
+	operation.Parameters = parameters
+
+	if operation.RequestBody != nil {
+		for _, media := range operation.RequestBody.Content {
+			if err := l.linkMedia(media); err != nil {
+				return err
+			}
+		}
+	}
+
+	for status, response := range operation.Responses {
+		if response.Ref != "" {
+			resolved, ok := l.components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+			if !ok {
+				return fmt.Errorf("unknown response %s", response.Ref)
+			}
+			response = resolved
+			operation.Responses[status] = resolved
+		}
+		for _, media := range response.Content {
+			if err := l.linkMedia(media); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *linker) parameter(parameter *Parameter) (*Parameter, error) {
+	if parameter.Ref != "" {
+		resolved, ok := l.components.Parameters[strings.TrimPrefix(parameter.Ref, "#/components/parameters/")]
+		if !ok {
+			return nil, fmt.Errorf("unknown parameter %s", parameter.Ref)
+		}
+		parameter = resolved
+	}
+	schema, err := l.schema(parameter.Schema)
+	if err != nil {
+		return nil, err
+	}
+	parameter.Schema = schema
+	return parameter, nil
+}
+
+func (l *linker) linkMedia(media *MediaType) error {
+	schema, err := l.schema(media.Schema)
+	if err != nil {
+		return err
+	}
+	media.Schema = schema
+	return nil
+}
+
+// schema returns the schema a $ref points to, or schema itself with its
+// subschemas linked. Components are shared, so each is linked once.
+func (l *linker) schema(schema *Schema) (*Schema, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	if schema.Ref != "" {
+		resolved, ok := l.components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema %s", schema.Ref)
+		}
+		schema = resolved
+	}
+	if l.linked[schema] {
+		return schema, nil
+	}
+	l.linked[schema] = true
+
+	var err error
+	for name, property := range schema.Properties {
+		if schema.Properties[name], err = l.schema(property); err != nil {
+			return nil, err
+		}
+	}
+	if schema.AdditionalProperties != nil {
+		if schema.AdditionalProperties.Schema, err = l.schema(schema.AdditionalProperties.Schema); err != nil {
+			return nil, err
+		}
+	}
+	if schema.Items, err = l.schema(schema.Items); err != nil {
+		return nil, err
+	}
+	for i, sub := range schema.AllOf {
+		if schema.AllOf[i], err = l.schema(sub); err != nil {
+			return nil, err
+		}
+	}
+	for i, sub := range schema.AnyOf {
+		if schema.AnyOf[i], err = l.schema(sub); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
@@ -0,0 +1,412 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrUnsupportedMediaType is returned for request bodies of a media type the
+// operation does not accept
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// ValidationError lists how a request or a response breaks the contract.
+// Each problem starts with where it was found: "query.limit",
+// "body.vehicle_count".
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// ValidateRequest checks the parameters and the body of a request to a Gin
+// route against its operation. Undocumented operations are not checked.
+func (s *Spec) ValidateRequest(route string, r *http.Request, body []byte) error {
+	operation := s.Operation(r.Method, route)
+	if operation == nil {
+		return nil
+	}
+
+	v := &validator{}
+	pathValues := matchPath(PathTemplate(route), r.URL.Path)
+	query := r.URL.Query()
+	for _, parameter := range operation.Parameters {
+		var raw string
+		var present bool
+		switch parameter.In {
+		case "path":
+			raw, present = pathValues[parameter.Name]
+		case "query":
+			if values, ok := query[parameter.Name]; ok && len(values) > 0 {
+				raw, present = values[0], true
+			}
+		case "header":
+			if values := r.Header.Values(parameter.Name); len(values) > 0 {
+				raw, present = values[0], true
+			}
+		default:
+			continue
+		}
+
+		at := parameter.In + "." + parameter.Name
+		if !present {
+			if parameter.Required {
+				v.add(at, "is required")
+			}
+			continue
+		}
+		v.parameter(at, parameter.Schema, raw)
+	}
+
+	if operation.RequestBody != nil {
+		if err := v.requestBody(operation.RequestBody, r.Header.Get("Content-Type"), body); err != nil {
+			return err
+		}
+	}
+	return v.err()
+}
+
+// ValidateResponse checks the status and the body of a response to method on
+// a Gin route against its operation. Undocumented operations are not checked.
+func (s *Spec) ValidateResponse(method, route string, status int, header http.Header, body []byte) error {
+	operation := s.Operation(method, route)
+	if operation == nil {
+		return nil
+	}
+
+	v := &validator{}
+	response := operation.response(status)
+	if response == nil {
+		v.add("status", fmt.Sprintf("%d is not documented", status))
+		return v.err()
+	}
+	if len(response.Content) == 0 || len(body) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	media, ok := response.Content[mediaType]
+	if !ok {
+		v.add("content-type", fmt.Sprintf("%q is not one of %s", mediaType, mediaTypes(response.Content)))
+		return v.err()
+	}
+	if media.Schema != nil && isJSON(mediaType) {
+		v.json("body", media.Schema, body)
+	}
+	return v.err()
+}
+
+// response returns the documented response for status: the exact one, its
+// class ("4XX") or the default
+func (o *Operation) response(status int) *Response {
+	for _, key := range []string{strconv.Itoa(status), fmt.Sprintf("%dXX", status/100), "default"} {
+		if response, ok := o.Responses[key]; ok {
+			return response
+		}
+	}
+	return nil
+}
+
+// matchPath returns the values of the parameters of template in path. The
+// last parameter takes the rest of the path, as Gin's catch-all parameters do.
+func matchPath(template, path string) map[string]string {
+	values := make(map[string]string)
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range templateSegments {
+		if i >= len(pathSegments) {
+			break
+		}
+		if !strings.HasPrefix(segment, "{") {
+			continue
+		}
+		name := strings.Trim(segment, "{}")
+		if i == len(templateSegments)-1 {
+			values[name] = strings.Join(pathSegments[i:], "/")
+		} else {
+			values[name] = pathSegments[i]
+		}
+	}
+	return values
+}
+
+func mediaTypes(content map[string]*MediaType) string {
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// validator collects the problems of a request or a response
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(at, problem string) {
+	v.problems = append(v.problems, at+": "+problem)
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+func (v *validator) requestBody(requestBody *RequestBody, contentType string, body []byte) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		if requestBody.Required {
+			v.add("body", "is required")
+		}
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	media, ok := requestBody.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%w %q, expected %s", ErrUnsupportedMediaType, mediaType, mediaTypes(requestBody.Content))
+	}
+	if media.Schema != nil && isJSON(mediaType) {
+		v.json("body", media.Schema, body)
+	}
+	return nil
+}
+
+// parameter converts a raw parameter to the type of its schema before
+// checking it
+func (v *validator) parameter(at string, schema *Schema, raw string) {
+	if schema == nil {
+		return
+	}
+	var value interface{} = raw
+	switch schema.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			v.add(at, fmt.Sprintf("expected %s, got %q", schema.Type, raw))
+			return
+		}
+		value = json.Number(raw)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			v.add(at, fmt.Sprintf("expected boolean, got %q", raw))
+			return
+		}
+		value = b
+	}
+	v.check(at, schema, value)
+}
+
+func (v *validator) json(at string, schema *Schema, body []byte) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		v.add(at, fmt.Sprintf("invalid JSON: %v", err))
+		return
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		v.add(at, "invalid JSON: unexpected data after the top-level value")
+		return
+	}
+	v.check(at, schema, value)
+}
+
+// check validates a decoded JSON value against schema
+func (v *validator) check(at string, schema *Schema, value interface{}) {
+	if schema == nil {
+		return
+	}
+	for _, sub := range schema.AllOf {
+		v.check(at, sub, value)
+	}
+	if len(schema.AnyOf) > 0 && !v.matchesAny(at, schema.AnyOf, value) {
+		v.add(at, "does not match any of the allowed schemas")
+	}
+
+	if value == nil {
+		if schema.Type != "" && !schema.Nullable {
+			v.add(at, "must not be null")
+		}
+		return
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		v.add(at, fmt.Sprintf("must be one of %s", enumList(schema.Enum)))
+		return
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			v.mismatch(at, "object", value)
+			return
+		}
+		v.object(at, schema, object)
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			v.mismatch(at, "array", value)
+			return
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			v.add(at, fmt.Sprintf("must have at least %d items", *schema.MinItems))
+		}
+		for i, item := range items {
+			v.check(fmt.Sprintf("%s[%d]", at, i), schema.Items, item)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			v.mismatch(at, "string", value)
+			return
+		}
+		v.string(at, schema, s)
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			v.mismatch(at, schema.Type, value)
+			return
+		}
+		v.number(at, schema, n)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.mismatch(at, "boolean", value)
+		}
+	default:
+		// Untyped schemas may still describe an object (allOf members)
+		if object, ok := value.(map[string]interface{}); ok && (len(schema.Properties) > 0 || len(schema.Required) > 0) {
+			v.object(at, schema, object)
+		}
+	}
+}
+
+func (v *validator) matchesAny(at string, schemas []*Schema, value interface{}) bool {
+	for _, schema := range schemas {
+		candidate := &validator{}
+		candidate.check(at, schema, value)
+		if len(candidate.problems) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) object(at string, schema *Schema, object map[string]interface{}) {
+	for _, name := range schema.Required {
+		if _, ok := object[name]; !ok {
+			v.add(at+"."+name, "is required")
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if property, ok := schema.Properties[name]; ok {
+			v.check(at+"."+name, property, object[name])
+			continue
+		}
+		if extra := schema.AdditionalProperties; extra != nil {
+			if !extra.Allowed {
+				v.add(at, fmt.Sprintf("unknown field %q", name))
+			} else {
+				v.check(at+"."+name, extra.Schema, object[name])
+			}
+		}
+	}
+}
+
+func (v *validator) string(at string, schema *Schema, s string) {
+	length := utf8.RuneCountInString(s)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		v.add(at, fmt.Sprintf("must be at least %d characters long", *schema.MinLength))
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		v.add(at, fmt.Sprintf("must be at most %d characters long", *schema.MaxLength))
+	}
+	if schema.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			v.add(at, fmt.Sprintf("expected an RFC 3339 date-time, got %q", s))
+		}
+	}
+}
+
+func (v *validator) number(at string, schema *Schema, n json.Number) {
+	if schema.Type == "integer" {
+		if _, err := n.Int64(); err != nil {
+			v.add(at, fmt.Sprintf("expected integer, got %s", n))
+			return
+		}
+	}
+	f, err := n.Float64()
+	if err != nil {
+		v.add(at, fmt.Sprintf("expected number, got %s", n))
+		return
+	}
+	if schema.Minimum != nil && f < *schema.Minimum {
+		v.add(at, fmt.Sprintf("must be >= %v", *schema.Minimum))
+	}
+	if schema.Maximum != nil && f > *schema.Maximum {
+		v.add(at, fmt.Sprintf("must be <= %v", *schema.Maximum))
+	}
+}
+
+func (v *validator) mismatch(at, expected string, value interface{}) {
+	v.add(at, fmt.Sprintf("expected %s, got %s", expected, kind(value)))
+}
+
+// kind names the JSON type of a decoded value
+func kind(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, option := range enum {
+		if fmt.Sprint(option) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	options := make([]string, len(enum))
+	for i, option := range enum {
+		options[i] = fmt.Sprint(option)
+	}
+	return strings.Join(options, ", ")
+}
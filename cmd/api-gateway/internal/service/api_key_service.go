@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
+	"api-traffic-analytics/cmd/api-gateway/internal/config"
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+var (
+	// ErrInvalidAPIKey is returned for keys that are malformed or unknown
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyRevoked is returned for keys that were revoked
+	ErrAPIKeyRevoked = errors.New("API key revoked")
+	// ErrAPIKeyExpired is returned for keys past their expiry, including
+	// rotated keys once their grace period is over
+	ErrAPIKeyExpired = errors.New("API key expired")
+	// ErrInvalidAPIKeyRequest is returned when a create or rotate request
+	// is incomplete or asks for unknown scopes
+	ErrInvalidAPIKeyRequest = errors.New("invalid API key request")
+)
+
+const (
+	// Managed keys look like tak_<key id>_<secret>. The key id is stored in
+	// clear to find the key; only a SHA-256 hash of the whole key is stored.
+	apiKeyPrefix = "tak"
+
+	apiKeyCachePrefix = "apikey:"
+
+	// lastUsedResolution bounds how often a key's last_used_at is written
+	lastUsedResolution = time.Minute
+)
+
+// CreateAPIKeyRequest describes a new key. RateLimit is the key's quota in
+// requests per RATE_LIMIT_DURATION; without one the route limits apply.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Owner     string     `json:"owner"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RateLimit *int       `json:"rate_limit,omitempty"`
+}
+
+// RotateAPIKeyRequest describes a key rotation. GracePeriodSeconds is how
+// long the old key keeps working; the configured default is used when it is
+// not set.
+type RotateAPIKeyRequest struct {
+	GracePeriodSeconds *int       `json:"grace_period_seconds,omitempty"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+}
+
+// IssuedAPIKey is a newly created key. The plaintext Key is only available
+// in this response.
+type IssuedAPIKey struct {
+	Key string `json:"key"`
+	*models.APIKey
+}
+
+// cachedAPIKey is what the cache holds for a key id, enough to authenticate
+// without going to the database
+type cachedAPIKey struct {
+	ID         int        `json:"id"`
+	KeyHash    string     `json:"key_hash"`
+	Owner      string     `json:"owner"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  *int       `json:"rate_limit,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// APIKeyService issues, rotates and revokes managed API keys and resolves
+// the keys sent by clients to an identity. Key lookups are cached so that
+// authenticating a request does not hit PostgreSQL every time.
+type APIKeyService struct {
+	repo          interfaces.APIKeyRepository
+	cache         interfaces.CacheRepository
+	cacheTTL      time.Duration
+	rotationGrace time.Duration
+	sharedKey     string
+	sharedKeyRole string
+	now           func() time.Time
+}
+
+// NewAPIKeyService creates an APIKeyService. The shared API_KEY, if set, is
+// still accepted with the API_KEY_ROLE role.
+func NewAPIKeyService(repo interfaces.APIKeyRepository, cache interfaces.CacheRepository, cfg *config.Config) *APIKeyService {
+	return &APIKeyService{
+		repo:          repo,
+		cache:         cache,
+		cacheTTL:      time.Duration(cfg.APIKeyCacheTTLSeconds) * time.Second,
+		rotationGrace: time.Duration(cfg.APIKeyRotationGraceSeconds) * time.Second,
+		sharedKey:     cfg.APIKey,
+		sharedKeyRole: cfg.APIKeyRole,
+		now:           time.Now,
+	}
+}
+
+// Create issues a new key and returns it with its plaintext
+func (s *APIKeyService) Create(ctx context.Context, req CreateAPIKeyRequest, createdBy string) (*IssuedAPIKey, error) {
+	if strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.Owner) == "" {
+		return nil, fmt.Errorf("%w: name and owner are required", ErrInvalidAPIKeyRequest)
+	}
+	if err := s.validateKey(req.Scopes, req.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if req.RateLimit != nil && *req.RateLimit <= 0 {
+		return nil, fmt.Errorf("%w: rate_limit must be positive", ErrInvalidAPIKeyRequest)
+	}
+
+	issued, err := newAPIKey(req.Name, req.Owner, req.Scopes, req.ExpiresAt, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	issued.RateLimit = req.RateLimit
+	if err := s.repo.Create(ctx, issued.APIKey); err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	return issued, nil
+}
+
+// List returns the keys matching filter, newest first
+func (s *APIKeyService) List(ctx context.Context, filter postgres.APIKeyFilter) ([]*models.APIKey, error) {
+	return s.repo.List(ctx, filter)
+}
+
+// Revoke revokes a key. It stops working immediately, on every replica.
+func (s *APIKeyService) Revoke(ctx context.Context, id int) (*models.APIKey, error) {
+	key, err := s.repo.Revoke(ctx, id, s.now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx, key.KeyID)
+	return key, nil
+}
+
+// Rotate issues a replacement for key id with the same name, owner, scopes
+// and rate limit. The old key keeps working until the grace period ends.
+func (s *APIKeyService) Rotate(ctx context.Context, id int, req RotateAPIKeyRequest, createdBy string) (*IssuedAPIKey, error) {
+	grace := s.rotationGrace
+	if req.GracePeriodSeconds != nil {
+		if *req.GracePeriodSeconds < 0 {
+			return nil, fmt.Errorf("%w: grace_period_seconds cannot be negative", ErrInvalidAPIKeyRequest)
+		}
+		grace = time.Duration(*req.GracePeriodSeconds) * time.Second
+	}
+
+	old, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if old.RevokedAt != nil {
+		return nil, fmt.Errorf("api key %d is revoked: %w", id, postgres.ErrNotFound)
+	}
+
+	expiresAt := old.ExpiresAt
+	if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt
+	}
+	if err := s.validateKey(old.Scopes, expiresAt); err != nil {
+		return nil, err
+	}
+
+	issued, err := newAPIKey(old.Name, old.Owner, old.Scopes, expiresAt, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	issued.RateLimit = old.RateLimit
+	if err := s.repo.Rotate(ctx, id, issued.APIKey, s.now().UTC().Add(grace)); err != nil {
+		return nil, err
+	}
+	s.invalidate(ctx, old.KeyID)
+	return issued, nil
+}
+
+// Authenticate resolves a key sent by a client to the identity it grants
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*auth.Identity, error) {
+	keyID, ok := parseAPIKey(key)
+	if !ok {
+		if s.sharedKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.sharedKey)) == 1 {
+			return &auth.Identity{Subject: "api-key", Roles: []string{s.sharedKeyRole}, Method: auth.MethodSharedKey}, nil
+		}
+		return nil, ErrInvalidAPIKey
+	}
+
+	entry, err := s.lookup(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(key)), []byte(entry.KeyHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := s.now()
+	if entry.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+	if entry.ExpiresAt != nil && !now.Before(*entry.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+	s.touch(ctx, keyID, entry, now)
+
+	identity := &auth.Identity{Subject: entry.Owner, Scopes: entry.Scopes, Method: auth.MethodAPIKey, KeyID: keyID}
+	if entry.RateLimit != nil {
+		identity.RateLimit = *entry.RateLimit
+	}
+	return identity, nil
+}
+
+// lookup returns the key with the given id from the cache or, on a miss,
+// from the database
+func (s *APIKeyService) lookup(ctx context.Context, keyID string) (*cachedAPIKey, error) {
+	cached, err := s.cache.GetCache(ctx, apiKeyCachePrefix+keyID)
+	if err != nil {
+		log.Printf("Error reading API key %s from cache: %v", keyID, err)
+	}
+	if cached != "" {
+		var entry cachedAPIKey
+		if err := json.Unmarshal([]byte(cached), &entry); err == nil {
+			return &entry, nil
+		}
+	}
+
+	key, err := s.repo.GetByKeyID(ctx, keyID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	entry := &cachedAPIKey{
+		ID:         key.ID,
+		KeyHash:    key.KeyHash,
+		Owner:      key.Owner,
+		Scopes:     key.Scopes,
+		RateLimit:  key.RateLimit,
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+	s.store(ctx, keyID, entry)
+	return entry, nil
+}
+
+// touch records the use of a key, at most once per lastUsedResolution
+func (s *APIKeyService) touch(ctx context.Context, keyID string, entry *cachedAPIKey, now time.Time) {
+	if entry.LastUsedAt != nil && now.Sub(*entry.LastUsedAt) < lastUsedResolution {
+		return
+	}
+	now = now.UTC()
+	if err := s.repo.TouchLastUsed(ctx, entry.ID, now); err != nil {
+		log.Printf("Error recording use of API key %s: %v", keyID, err)
+		return
+	}
+	entry.LastUsedAt = &now
+	s.store(ctx, keyID, entry)
+}
+
+func (s *APIKeyService) store(ctx context.Context, keyID string, entry *cachedAPIKey) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := s.cache.SetCache(ctx, apiKeyCachePrefix+keyID, string(data), s.cacheTTL); err != nil {
+		log.Printf("Error caching API key %s: %v", keyID, err)
+	}
+}
+
+func (s *APIKeyService) invalidate(ctx context.Context, keyID string) {
+	if err := s.cache.DeleteCache(ctx, apiKeyCachePrefix+keyID); err != nil {
+		log.Printf("Error invalidating cached API key %s: %v", keyID, err)
+	}
+}
+
+func (s *APIKeyService) validateKey(scopes []string, expiresAt *time.Time) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKeyRequest)
+	}
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKeyRequest, scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(s.now()) {
+		return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidAPIKeyRequest)
+	}
+	return nil
+}
+
+// newAPIKey generates a key and the record that stores its hash
+func newAPIKey(name, owner string, scopes []string, expiresAt *time.Time, createdBy string) (*IssuedAPIKey, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	keyID := hex.EncodeToString(id)
+	plaintext := apiKeyPrefix + "_" + keyID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return &IssuedAPIKey{
+		Key: plaintext,
+		APIKey: &models.APIKey{
+			KeyID:     keyID,
+			KeyHash:   hashAPIKey(plaintext),
+			Name:      strings.TrimSpace(name),
+			Owner:     strings.TrimSpace(owner),
+			Scopes:    scopes,
+			ExpiresAt: expiresAt,
+			CreatedBy: createdBy,
+		},
+	}, nil
+}
+
+// parseAPIKey returns the key id of a managed key
+func parseAPIKey(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || len(parts[1]) != 16 || parts[2] == "" {
+		return "", false
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
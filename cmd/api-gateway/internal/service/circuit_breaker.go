@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling an upstream whose circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calling an upstream after FailureThreshold
+// consecutive failures. Once open it rejects calls for OpenTimeout, then
+// lets a single probe through (half-open): a success closes the circuit
+// again and a failure reopens it.
+type CircuitBreaker struct {
+	failureThreshold int
+	openTimeout      time.Duration
+	onChange         func(state string)
+	now              func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker. onChange, if not nil, is
+// called with the new state on every transition.
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration, onChange func(state string)) *CircuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	b := &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		onChange:         onChange,
+		now:              time.Now,
+		state:            CircuitClosed,
+	}
+	if onChange != nil {
+		onChange(CircuitClosed)
+	}
+	return b
+}
+
+// State returns the current state
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may go ahead. Every allowed call must be
+// followed by Record or Abandon.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.setState(CircuitHalfOpen)
+		b.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of an allowed call
+func (b *CircuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		if b.state != CircuitClosed {
+			b.setState(CircuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.failureThreshold {
+		b.openedAt = b.now()
+		if b.state != CircuitOpen {
+			b.setState(CircuitOpen)
+		}
+	}
+}
+
+// Abandon releases an allowed call that ended without telling anything about
+// the upstream, e.g. because the client went away
+func (b *CircuitBreaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *CircuitBreaker) setState(state string) {
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
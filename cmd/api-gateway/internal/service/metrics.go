@@ -0,0 +1,72 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics are the gateway's Prometheus metrics about its upstreams and its
+// response cache
+type Metrics struct {
+	circuitState     *prometheus.GaugeVec
+	upstreamRequests *prometheus.CounterVec
+	upstreamRetries  *prometheus.CounterVec
+	cacheLookups     *prometheus.CounterVec
+}
+
+var (
+	metricsOnce sync.Once
+	metrics     *Metrics
+)
+
+// NewMetrics returns the gateway metrics, registering them only once in the
+// default Prometheus registry
+func NewMetrics() *Metrics {
+	metricsOnce.Do(func() { metrics = newMetrics() })
+	return metrics
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		circuitState: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "api_gateway_upstream_circuit_state",
+			Help: "Circuit breaker state per upstream (0 closed, 1 half-open, 2 open)",
+		}, []string{"upstream"}),
+		upstreamRequests: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "api_gateway_upstream_requests_total",
+			Help: "Requests sent to each upstream by outcome (success, failure, rejected)",
+		}, []string{"upstream", "outcome"}),
+		upstreamRetries: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "api_gateway_upstream_retries_total",
+			Help: "Retried upstream requests",
+		}, []string{"upstream"}),
+		cacheLookups: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "api_gateway_response_cache_lookups_total",
+			Help: "Response cache lookups by result (HIT, STALE, MISS)",
+		}, []string{"result"}),
+	}
+}
+
+var circuitStateValues = map[string]float64{
+	CircuitClosed:   0,
+	CircuitHalfOpen: 1,
+	CircuitOpen:     2,
+}
+
+func (m *Metrics) SetCircuitState(upstream, state string) {
+	m.circuitState.WithLabelValues(upstream).Set(circuitStateValues[state])
+}
+
+func (m *Metrics) IncrementUpstreamRequests(upstream, outcome string) {
+	m.upstreamRequests.WithLabelValues(upstream, outcome).Inc()
+}
+
+func (m *Metrics) IncrementRetries(upstream string) {
+	m.upstreamRetries.WithLabelValues(upstream).Inc()
+}
+
+func (m *Metrics) IncrementCacheLookups(result string) {
+	m.cacheLookups.WithLabelValues(result).Inc()
+}
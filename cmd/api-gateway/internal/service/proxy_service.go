@@ -3,113 +3,307 @@ package service
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
 	"time"
 
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
 	"api-traffic-analytics/cmd/api-gateway/internal/config"
+	"api-traffic-analytics/internal/shared"
+	"api-traffic-analytics/internal/shared/models"
 )
 
+// proxyUpstream is an internal service and the circuit breaker guarding it
+type proxyUpstream struct {
+	name    string
+	baseURL string
+	breaker *CircuitBreaker
+}
+
+type routeTimeout struct {
+	prefix  string
+	timeout time.Duration
+}
+
+// ProxyService calls the internal services. Each upstream has its own
+// circuit breaker, every attempt has the timeout of its route, and
+// idempotent requests are retried with jittered backoff.
 type ProxyService struct {
-	client *http.Client
-	config *config.Config
+	client        *http.Client
+	config        *config.Config
+	upstreams     map[string]*proxyUpstream
+	metrics       *Metrics
+	timeout       time.Duration
+	routeTimeouts []routeTimeout
+	retries       int
+	backoff       time.Duration
 }
 
 func NewProxyService(cfg *config.Config) *ProxyService {
-	return &ProxyService{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		config: cfg,
+	s := &ProxyService{
+		// Timeouts are set per attempt, from the route
+		client:    &http.Client{},
+		config:    cfg,
+		upstreams: make(map[string]*proxyUpstream),
+		metrics:   NewMetrics(),
+		timeout:   time.Duration(cfg.ProxyTimeoutSeconds) * time.Second,
+		retries:   cfg.ProxyRetries,
+		backoff:   time.Duration(cfg.ProxyRetryBackoffMillis) * time.Millisecond,
+	}
+	if s.timeout <= 0 {
+		s.timeout = 30 * time.Second
+	}
+
+	for name, baseURL := range map[string]string{
+		"traffic":   cfg.TrafficIngestorURL,
+		"analytics": cfg.AnalyticsServiceURL,
+		"alerts":    cfg.AlertingServiceURL,
+	} {
+		name := name
+		s.upstreams[name] = &proxyUpstream{
+			name:    name,
+			baseURL: baseURL,
+			breaker: NewCircuitBreaker(cfg.ProxyBreakerFailureThreshold,
+				time.Duration(cfg.ProxyBreakerOpenSeconds)*time.Second,
+				func(state string) { s.metrics.SetCircuitState(name, state) }),
+		}
+	}
+
+	for prefix, seconds := range cfg.ProxyRouteTimeouts {
+		s.routeTimeouts = append(s.routeTimeouts, routeTimeout{prefix: prefix, timeout: time.Duration(seconds) * time.Second})
+	}
+	// The most specific prefix wins
+	sort.Slice(s.routeTimeouts, func(i, j int) bool {
+		return len(s.routeTimeouts[i].prefix) > len(s.routeTimeouts[j].prefix)
+	})
+	return s
+}
+
+// CircuitStates returns the circuit breaker state of each upstream
+func (s *ProxyService) CircuitStates() map[string]string {
+	states := make(map[string]string, len(s.upstreams))
+	for name, upstream := range s.upstreams {
+		states[name] = upstream.breaker.State()
 	}
+	return states
 }
 
 func (s *ProxyService) ProxyToService(ctx context.Context, service string, method, path string, body []byte) (*http.Response, error) {
-	var baseURL string
-
-	switch service {
-	case "traffic":
-		baseURL = s.config.TrafficIngestorURL
-	case "analytics":
-		baseURL = s.config.AnalyticsServiceURL
-	case "alerts":
-		baseURL = s.config.AlertingServiceURL
-	default:
+	return s.ProxyRequest(ctx, service, method, path, body, http.Header{"Content-Type": {"application/json"}})
+}
+
+// forwardedHeaders are the client headers passed on by ProxyRequest
+var forwardedHeaders = []string{"Content-Type", "Accept"}
+
+// ProxyRequest is ProxyToService forwarding the client's Content-Type and
+// Accept headers, for non-JSON bodies (e.g. CSV imports) and negotiated
+// responses (e.g. GeoJSON). GET and HEAD requests that fail or get a 502,
+// 503 or 504 are retried; the last response is returned as is.
+func (s *ProxyService) ProxyRequest(ctx context.Context, service string, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	upstream, ok := s.upstreams[service]
+	if !ok {
 		return nil, fmt.Errorf("unknown service: %s", service)
 	}
 
-	// Construct full URL
-	fullURL, err := url.JoinPath(baseURL, path)
+	// Construct full URL (JoinPath would escape the query string)
+	path, rawQuery, _ := strings.Cut(path, "?")
+	fullURL, err := url.JoinPath(upstream.baseURL, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct URL: %w", err)
 	}
+	if rawQuery != "" {
+		fullURL += "?" + rawQuery
+	}
+
+	attempts := 1
+	if method == http.MethodGet || method == http.MethodHead {
+		attempts += s.retries
+	}
+	timeout := s.routeTimeout(path)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := s.send(ctx, upstream, method, fullURL, body, header, timeout)
+		retryable := (err != nil && !errors.Is(err, ErrCircuitOpen) && ctx.Err() == nil) ||
+			(err == nil && retryableStatus(resp.StatusCode))
+		if !retryable || attempt >= attempts {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		s.metrics.IncrementRetries(service)
+		select {
+		case <-time.After(s.backoffFor(attempt)):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to proxy request: %w", ctx.Err())
+		}
+	}
+}
+
+// send makes a single attempt, guarded by the upstream's circuit breaker.
+// Transport errors, timeouts and 5xx responses count as failures.
+func (s *ProxyService) send(ctx context.Context, upstream *proxyUpstream, method, fullURL string, body []byte, header http.Header, timeout time.Duration) (*http.Response, error) {
+	if err := upstream.breaker.Allow(); err != nil {
+		s.metrics.IncrementUpstreamRequests(upstream.name, "rejected")
+		return nil, fmt.Errorf("%s service unavailable: %w", upstream.name, err)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
 
 	// Create request
-	var req *http.Request
+	var bodyReader io.Reader
 	if body != nil {
-		req, err = http.NewRequestWithContext(ctx, method, fullURL, bytes.NewReader(body))
-	} else {
-		req, err = http.NewRequestWithContext(ctx, method, fullURL, nil)
+		bodyReader = bytes.NewReader(body)
 	}
-
+	req, err := http.NewRequestWithContext(attemptCtx, method, fullURL, bodyReader)
 	if err != nil {
+		cancel()
+		upstream.breaker.Abandon()
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Copy headers
 	// Note: Don't copy Authorization header for security
-	req.Header.Set("Content-Type", "application/json")
+	for _, name := range forwardedHeaders {
+		if value := header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
 	req.Header.Set("User-Agent", "API-Gateway")
 
+	// Pass the authenticated caller on instead
+	if identity, ok := auth.FromContext(ctx); ok {
+		identity.SetHeaders(req.Header)
+	}
+	if id := shared.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(shared.HeaderRequestID, id)
+	}
+
 	// Make request
 	resp, err := s.client.Do(req)
 	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			// The client went away; that says nothing about the upstream
+			upstream.breaker.Abandon()
+		} else {
+			upstream.breaker.Record(false)
+			s.metrics.IncrementUpstreamRequests(upstream.name, "failure")
+		}
 		return nil, fmt.Errorf("failed to proxy request: %w", err)
 	}
 
+	failed := resp.StatusCode >= http.StatusInternalServerError
+	upstream.breaker.Record(!failed)
+	if failed {
+		s.metrics.IncrementUpstreamRequests(upstream.name, "failure")
+	} else {
+		s.metrics.IncrementUpstreamRequests(upstream.name, "success")
+	}
+
+	// The timeout also covers reading the body
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
 	return resp, nil
 }
 
-func (s *ProxyService) GetAnalytics(ctx context.Context, path string) ([]byte, error) {
-	resp, err := s.ProxyToService(ctx, "analytics", "GET", path, nil)
-	if err != nil {
-		return nil, err
+// routeTimeout returns the timeout of the most specific route prefix
+// matching path, or the default one
+func (s *ProxyService) routeTimeout(path string) time.Duration {
+	for _, route := range s.routeTimeouts {
+		if strings.HasPrefix(path, route.prefix) {
+			return route.timeout
+		}
 	}
-	defer resp.Body.Close()
+	return s.timeout
+}
 
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("analytics service returned status %d", resp.StatusCode)
+// backoffFor returns the wait before retry number attempt: exponential from
+// the configured backoff, with half of it random so that gateway replicas do
+// not retry in lockstep
+func (s *ProxyService) backoffFor(attempt int) time.Duration {
+	backoff := s.backoff << (attempt - 1)
+	if backoff <= 0 {
+		return 0
 	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
 
-	return io.ReadAll(resp.Body)
+func retryableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
 }
 
-func (s *ProxyService) GetAlerts(ctx context.Context, path string) ([]byte, error) {
-	resp, err := s.ProxyToService(ctx, "alerts", "GET", path, nil)
-	if err != nil {
-		return nil, err
+// cancelOnClose releases the request context once the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// UpstreamError is an error status returned by an internal service.
+// Response is its body when it follows models.ErrorResponse.
+type UpstreamError struct {
+	Service    string
+	StatusCode int
+	Response   *models.ErrorResponse
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Response != nil && e.Response.Message != "" {
+		return fmt.Sprintf("%s service returned status %d: %s", e.Service, e.StatusCode, e.Response.Message)
 	}
-	defer resp.Body.Close()
+	return fmt.Sprintf("%s service returned status %d", e.Service, e.StatusCode)
+}
 
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("alerts service returned status %d", resp.StatusCode)
+// ParseErrorResponse decodes body as a models.ErrorResponse, returning nil
+// when it does not follow the model
+func ParseErrorResponse(body []byte) *models.ErrorResponse {
+	var response models.ErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil || response.Error == "" {
+		return nil
 	}
+	return &response
+}
 
-	return io.ReadAll(resp.Body)
+func (s *ProxyService) GetAnalytics(ctx context.Context, path string) ([]byte, error) {
+	return s.get(ctx, "analytics", path)
+}
+
+func (s *ProxyService) GetAlerts(ctx context.Context, path string) ([]byte, error) {
+	return s.get(ctx, "alerts", path)
 }
 
 func (s *ProxyService) GetTrafficData(ctx context.Context, path string) ([]byte, error) {
-	resp, err := s.ProxyToService(ctx, "traffic", "GET", path, nil)
+	return s.get(ctx, "traffic", path)
+}
+
+// get returns the body of a successful GET, or an *UpstreamError
+func (s *ProxyService) get(ctx context.Context, service, path string) ([]byte, error) {
+	resp, err := s.ProxyToService(ctx, service, http.MethodGet, path, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", service, err)
+	}
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("traffic service returned status %d", resp.StatusCode)
+		return nil, &UpstreamError{Service: service, StatusCode: resp.StatusCode, Response: ParseErrorResponse(body)}
 	}
-
-	return io.ReadAll(resp.Body)
+	return body, nil
 }
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	segkafka "github.com/segmentio/kafka-go"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
+	"api-traffic-analytics/cmd/api-gateway/internal/config"
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/kafka"
+)
+
+// X-Cache values of a cached route
+const (
+	CacheHit   = "HIT"
+	CacheStale = "STALE"
+	CacheMiss  = "MISS"
+)
+
+const (
+	responseCachePrefix = "respcache:"
+	// revalidationTimeout bounds the background refresh of a stale entry
+	revalidationTimeout = 30 * time.Second
+)
+
+// CachedResponse is a successful upstream response kept by the ResponseCache
+type CachedResponse struct {
+	Body       []byte    `json:"body"`
+	ETag       string    `json:"etag"`
+	FreshUntil time.Time `json:"fresh_until"`
+}
+
+// MaxAge returns how long the response stays fresh
+func (r *CachedResponse) MaxAge(now time.Time) time.Duration {
+	if remaining := r.FreshUntil.Sub(now); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+type cacheRoute struct {
+	prefix string
+	ttl    time.Duration
+}
+
+// ResponseCache keeps successful GET responses in Redis, shared by every
+// gateway replica. Entries are keyed by the upstream, the normalized path and
+// query and the caller's roles or scopes, so callers with different access
+// never share them. Expired entries are served for a while longer and
+// refreshed in the background (stale-while-revalidate).
+//
+// Entries are never deleted: each key includes generations of the upstream
+// and location, and Invalidate moves the generations forward.
+type ResponseCache struct {
+	cache   interfaces.CacheRepository
+	routes  []cacheRoute
+	stale   time.Duration
+	maxTTL  time.Duration
+	metrics *Metrics
+	now     func() time.Time
+}
+
+// NewResponseCache creates a ResponseCache with the route TTLs of cfg
+func NewResponseCache(cache interfaces.CacheRepository, cfg *config.Config) *ResponseCache {
+	rc := &ResponseCache{
+		cache:   cache,
+		stale:   time.Duration(cfg.CacheStaleSeconds) * time.Second,
+		metrics: NewMetrics(),
+		now:     time.Now,
+	}
+	for prefix, value := range cfg.CacheRouteTTLs {
+		ttl := cfg.CacheTTL(value)
+		if ttl <= 0 {
+			continue
+		}
+		rc.routes = append(rc.routes, cacheRoute{prefix: prefix, ttl: ttl})
+		if ttl > rc.maxTTL {
+			rc.maxTTL = ttl
+		}
+	}
+	// The most specific prefix wins
+	sort.Slice(rc.routes, func(i, j int) bool { return len(rc.routes[i].prefix) > len(rc.routes[j].prefix) })
+	return rc
+}
+
+// TTL returns how long responses of path stay fresh, zero when the route is
+// not cached
+func (rc *ResponseCache) TTL(path string) time.Duration {
+	for _, route := range rc.routes {
+		if path == route.prefix || strings.HasPrefix(path, strings.TrimSuffix(route.prefix, "/")+"/") {
+			return route.ttl
+		}
+	}
+	return 0
+}
+
+// Get returns the cached response of a GET to upstream, calling fetch on a
+// miss. location scopes the entry for invalidation; empty for responses
+// about every location. It also returns the X-Cache value.
+func (rc *ResponseCache) Get(ctx context.Context, upstream, location, path, rawQuery string, fetch func(context.Context) ([]byte, error)) (*CachedResponse, string, error) {
+	ttl := rc.TTL(path)
+	key, err := rc.key(ctx, upstream, location, path, rawQuery)
+	if err != nil {
+		// Without Redis the gateway still answers, uncached
+		log.Printf("Response cache unavailable: %v", err)
+		body, err := fetch(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		return rc.newResponse(body, ttl), CacheMiss, nil
+	}
+
+	if cached, ok := rc.lookup(ctx, key); ok {
+		if rc.now().Before(cached.FreshUntil) {
+			rc.metrics.IncrementCacheLookups(CacheHit)
+			return cached, CacheHit, nil
+		}
+		rc.metrics.IncrementCacheLookups(CacheStale)
+		go rc.revalidate(context.WithoutCancel(ctx), key, ttl, fetch)
+		return cached, CacheStale, nil
+	}
+
+	rc.metrics.IncrementCacheLookups(CacheMiss)
+	body, err := fetch(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	response := rc.newResponse(body, ttl)
+	rc.store(ctx, key, response, ttl)
+	return response, CacheMiss, nil
+}
+
+// Invalidate makes the cached responses of upstream about location, and
+// those about every location, miss. An empty location invalidates all the
+// responses of upstream.
+func (rc *ResponseCache) Invalidate(ctx context.Context, upstream, location string) error {
+	generation := strconv.FormatInt(rc.now().UnixNano(), 10)
+	// Generations outlive every entry created before them
+	expiration := rc.maxTTL + rc.stale + time.Minute
+
+	keys := []string{rc.generationKey(upstream, "*")}
+	if location != "" {
+		keys = []string{rc.generationKey(upstream, ""), rc.generationKey(upstream, location)}
+	}
+	for _, key := range keys {
+		if err := rc.cache.SetCache(ctx, key, generation, expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartInvalidation consumes analytics-results and alerts events until ctx is
+// cancelled. A result invalidates the analytics, alerts and traffic responses
+// of its location; an alert raised, acknowledged or resolved invalidates the alerts
+// responses of its location, since alerts are stored after the result that
+// raised them is published. The consumers should share their group with the
+// other replicas: the cache is common to all of them.
+func (rc *ResponseCache) StartInvalidation(ctx context.Context, results, alerts interfaces.MessageConsumer) {
+	go rc.consumeInvalidations(ctx, results, func(msg segkafka.Message) error {
+		event, _, err := kafka.DecodeAnalyticsResultEvent(msg)
+		if err != nil {
+			return err
+		}
+		rc.invalidateLocation(ctx, event.LocationID, "analytics", "alerts", "traffic")
+		return nil
+	})
+	go rc.consumeInvalidations(ctx, alerts, func(msg segkafka.Message) error {
+		event, _, err := kafka.DecodeAlertEvent(msg)
+		if err != nil {
+			return err
+		}
+		rc.invalidateLocation(ctx, event.LocationID, "alerts")
+		return nil
+	})
+}
+
+func (rc *ResponseCache) consumeInvalidations(ctx context.Context, consumer interfaces.MessageConsumer, handle func(segkafka.Message) error) {
+	for {
+		msg, err := consumer.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				return
+			}
+			log.Printf("cache: error fetching message: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if err := handle(msg); err != nil {
+			log.Printf("cache: skipping %s message at offset %d: %v", msg.Topic, msg.Offset, err)
+		}
+
+		if err := consumer.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			log.Printf("cache: failed to commit offset %d: %v", msg.Offset, err)
+		}
+	}
+}
+
+func (rc *ResponseCache) invalidateLocation(ctx context.Context, location string, upstreams ...string) {
+	for _, upstream := range upstreams {
+		if err := rc.Invalidate(ctx, upstream, location); err != nil {
+			log.Printf("cache: failed to invalidate %s responses of %q: %v", upstream, location, err)
+		}
+	}
+}
+
+// key builds the cache key from the request and the current generations
+func (rc *ResponseCache) key(ctx context.Context, upstream, location, requestPath, rawQuery string) (string, error) {
+	all, err := rc.cache.GetCache(ctx, rc.generationKey(upstream, "*"))
+	if err != nil {
+		return "", err
+	}
+	scoped, err := rc.cache.GetCache(ctx, rc.generationKey(upstream, location))
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, part := range []string{upstream, normalizePath(requestPath), normalizeQuery(rawQuery), accessScope(ctx), all, scoped} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return responseCachePrefix + upstream + ":" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (rc *ResponseCache) generationKey(upstream, location string) string {
+	return responseCachePrefix + "gen:" + upstream + ":" + location
+}
+
+func (rc *ResponseCache) lookup(ctx context.Context, key string) (*CachedResponse, bool) {
+	raw, err := rc.cache.GetCache(ctx, key)
+	if err != nil || raw == "" {
+		return nil, false
+	}
+	var cached CachedResponse
+	if err := json.Unmarshal([]byte(raw), &cached); err != nil {
+		return nil, false
+	}
+	return &cached, true
+}
+
+func (rc *ResponseCache) store(ctx context.Context, key string, response *CachedResponse, ttl time.Duration) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	if err := rc.cache.SetCache(ctx, key, data, ttl+rc.stale); err != nil {
+		log.Printf("Failed to cache response: %v", err)
+	}
+}
+
+// revalidate refreshes a stale entry. Only one replica refreshes each entry
+// at a time; the others keep serving it stale.
+func (rc *ResponseCache) revalidate(ctx context.Context, key string, ttl time.Duration, fetch func(context.Context) ([]byte, error)) {
+	lock := key + ":refresh"
+	acquired, err := rc.cache.SetCacheIfAbsent(ctx, lock, "1", revalidationTimeout)
+	if err != nil || !acquired {
+		return
+	}
+	defer rc.cache.DeleteCache(ctx, lock)
+
+	ctx, cancel := context.WithTimeout(ctx, revalidationTimeout)
+	defer cancel()
+
+	body, err := fetch(ctx)
+	if err != nil {
+		log.Printf("Failed to refresh cached response: %v", err)
+		return
+	}
+	rc.store(ctx, key, rc.newResponse(body, ttl), ttl)
+}
+
+func (rc *ResponseCache) newResponse(body []byte, ttl time.Duration) *CachedResponse {
+	digest := sha256.Sum256(body)
+	return &CachedResponse{
+		Body:       body,
+		ETag:       `"` + hex.EncodeToString(digest[:16]) + `"`,
+		FreshUntil: rc.now().Add(ttl),
+	}
+}
+
+// ETagMatches reports whether an If-None-Match header matches etag
+func ETagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizePath(p string) string {
+	p = path.Clean("/" + p)
+	return strings.TrimSuffix(p, "/")
+}
+
+// normalizeQuery sorts the parameters and their values, so that equivalent
+// queries share entries
+func normalizeQuery(rawQuery string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	for name := range values {
+		sort.Strings(values[name])
+	}
+	return values.Encode()
+}
+
+// accessScope identifies what the caller may see: its roles, or its scopes
+// for API keys and devices
+func accessScope(ctx context.Context) string {
+	identity, ok := auth.FromContext(ctx)
+	if !ok {
+		return "anonymous"
+	}
+	grants, kind := identity.Roles, "roles"
+	if identity.Method == auth.MethodAPIKey || identity.Method == auth.MethodDevice {
+		grants, kind = identity.Scopes, "scopes"
+	}
+	sorted := append([]string(nil), grants...)
+	sort.Strings(sorted)
+	return kind + ":" + strings.Join(sorted, ",")
+}
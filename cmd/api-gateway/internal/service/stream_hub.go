@@ -0,0 +1,185 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamEvent is a live event fanned out to streaming clients.
+type StreamEvent struct {
+	ID         string
+	Type       string
+	LocationID string
+	City       string
+	Severity   string
+	Data       json.RawMessage
+
+	seq uint64
+}
+
+// StreamFilter selects the events a client receives. Empty fields match all.
+type StreamFilter struct {
+	LocationIDs map[string]bool
+	City        string
+	Severities  map[string]bool
+}
+
+// Matches reports whether the event passes the filter.
+func (f StreamFilter) Matches(e *StreamEvent) bool {
+	if len(f.LocationIDs) > 0 && !f.LocationIDs[e.LocationID] {
+		return false
+	}
+	if f.City != "" && !strings.EqualFold(f.City, e.City) {
+		return false
+	}
+	if len(f.Severities) > 0 && !f.Severities[e.Severity] {
+		return false
+	}
+	return true
+}
+
+// Subscription is a client attached to a StreamHub. Its channel is closed when
+// the client is unsubscribed or falls too far behind.
+type Subscription struct {
+	events     chan *StreamEvent
+	filter     StreamFilter
+	overflowed bool
+}
+
+// Events returns the channel of live events.
+func (s *Subscription) Events() <-chan *StreamEvent {
+	return s.events
+}
+
+// Overflowed reports whether the subscription was dropped because the client
+// did not keep up. Only meaningful once Events is closed.
+func (s *Subscription) Overflowed() bool {
+	return s.overflowed
+}
+
+// StreamHub fans events out to subscribers and keeps a bounded history so
+// clients can resume with Last-Event-ID. Event ids are "<epoch>-<seq>"; the
+// epoch changes on restart, in which case there is nothing to resume from.
+type StreamHub struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	history     []*StreamEvent
+	historySize int
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+}
+
+// NewStreamHub creates a hub remembering historySize events and buffering up
+// to bufferSize events per subscriber.
+func NewStreamHub(historySize, bufferSize int) *StreamHub {
+	return &StreamHub{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns an id to the event and delivers it to matching subscribers.
+// Subscribers whose buffer is full are dropped rather than blocking the hub.
+func (h *StreamHub) Publish(e *StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	e.seq = h.seq
+	e.ID = fmt.Sprintf("%s-%d", h.epoch, h.seq)
+
+	if h.historySize > 0 {
+		if len(h.history) == h.historySize {
+			copy(h.history, h.history[1:])
+			h.history = h.history[:len(h.history)-1]
+		}
+		h.history = append(h.history, e)
+	}
+
+	for sub := range h.subscribers {
+		if !sub.filter.Matches(e) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			sub.overflowed = true
+			h.remove(sub)
+		}
+	}
+}
+
+// Subscribe registers a subscriber and returns the events published after
+// lastEventID that it missed. Replay and registration happen atomically so no
+// event is lost or duplicated in between.
+func (h *StreamHub) Subscribe(filter StreamFilter, lastEventID string) (*Subscription, []*StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var replay []*StreamEvent
+	if seq, ok := h.parseID(lastEventID); ok {
+		for _, e := range h.history {
+			if e.seq > seq && filter.Matches(e) {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	sub := &Subscription{
+		events: make(chan *StreamEvent, h.bufferSize),
+		filter: filter,
+	}
+	h.subscribers[sub] = struct{}{}
+
+	return sub, replay
+}
+
+// Unsubscribe detaches a subscriber and closes its channel.
+func (h *StreamHub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// Close detaches every subscriber, ending their streams.
+func (h *StreamHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		h.remove(sub)
+	}
+}
+
+// Subscribers returns the number of attached subscribers.
+func (h *StreamHub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+func (h *StreamHub) remove(sub *Subscription) {
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// parseID extracts the sequence from an event id of the current epoch.
+func (h *StreamHub) parseID(id string) (uint64, bool) {
+	epoch, seq, found := strings.Cut(id, "-")
+	if !found || epoch != h.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	segkafka "github.com/segmentio/kafka-go"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/config"
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/kafka"
+)
+
+// StreamService feeds live traffic readings and alert changes from Kafka into
+// the hubs used by the streaming endpoints.
+type StreamService struct {
+	Traffic *StreamHub
+	Alerts  *StreamHub
+
+	trafficConsumer interfaces.MessageConsumer
+	alertsConsumer  interfaces.MessageConsumer
+}
+
+// NewStreamService creates a StreamService reading the traffic and alert
+// topics from the given consumers. Offsets are never committed, so they
+// should start at the tail of their topics.
+func NewStreamService(cfg *config.Config, trafficConsumer, alertsConsumer interfaces.MessageConsumer) *StreamService {
+	return &StreamService{
+		Traffic:         NewStreamHub(cfg.StreamReplaySize, cfg.StreamConnectionBuffer),
+		Alerts:          NewStreamHub(cfg.StreamReplaySize, cfg.StreamConnectionBuffer),
+		trafficConsumer: trafficConsumer,
+		alertsConsumer:  alertsConsumer,
+	}
+}
+
+// Start consumes both topics until ctx is cancelled.
+func (s *StreamService) Start(ctx context.Context) {
+	go s.consume(ctx, s.trafficConsumer, s.Traffic, trafficStreamEvent)
+	go s.consume(ctx, s.alertsConsumer, s.Alerts, alertStreamEvent)
+}
+
+// Close closes the Kafka consumers and ends every open stream.
+func (s *StreamService) Close() {
+	s.trafficConsumer.Close()
+	s.alertsConsumer.Close()
+	s.Traffic.Close()
+	s.Alerts.Close()
+}
+
+func (s *StreamService) consume(ctx context.Context, consumer interfaces.MessageConsumer, hub *StreamHub, decode func(segkafka.Message) (*StreamEvent, error)) {
+	for {
+		// Offsets are never committed: live streams always start from the tail
+		msg, err := consumer.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				return
+			}
+			log.Printf("stream: error fetching message: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		event, err := decode(msg)
+		if err != nil {
+			log.Printf("stream: skipping message at offset %d: %v", msg.Offset, err)
+			continue
+		}
+		hub.Publish(event)
+	}
+}
+
+func trafficStreamEvent(msg segkafka.Message) (*StreamEvent, error) {
+	data, _, err := kafka.DecodeTrafficData(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(kafka.NewTrafficDataEvent(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamEvent{
+		Type:       "traffic",
+		LocationID: data.LocationID,
+		City:       data.Location.City,
+		Severity:   data.CongestionLevel,
+		Data:       payload,
+	}, nil
+}
+
+func alertStreamEvent(msg segkafka.Message) (*StreamEvent, error) {
+	event, _, err := kafka.DecodeAlertEvent(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamEvent{
+		Type:       "alert",
+		LocationID: event.LocationID,
+		City:       event.City,
+		Severity:   event.Severity,
+		Data:       payload,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/health"
+)
+
+// UpstreamHealth is the readiness of an internal service as seen by the
+// gateway, with the state of its circuit breaker
+type UpstreamHealth struct {
+	Status  string
+	Latency time.Duration
+	Circuit string
+}
+
+func (h UpstreamHealth) String() string {
+	description := fmt.Sprintf("%s (%dms)", h.Status, h.Latency.Milliseconds())
+	if h.Circuit != CircuitClosed {
+		description += ", circuit " + h.Circuit
+	}
+	return description
+}
+
+// CheckUpstreams asks every upstream for its readiness concurrently, giving
+// up on each after timeout. It bypasses the circuit breakers, so it also
+// tells whether an upstream with an open circuit is back.
+func (s *ProxyService) CheckUpstreams(ctx context.Context, timeout time.Duration) map[string]UpstreamHealth {
+	results := make(map[string]UpstreamHealth, len(s.upstreams))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, upstream := range s.upstreams {
+		wg.Add(1)
+		go func(name string, upstream *proxyUpstream) {
+			defer wg.Done()
+			result := s.checkUpstream(ctx, upstream, timeout)
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, upstream)
+	}
+	wg.Wait()
+	return results
+}
+
+func (s *ProxyService) checkUpstream(ctx context.Context, upstream *proxyUpstream, timeout time.Duration) UpstreamHealth {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	status := s.readiness(ctx, upstream)
+	return UpstreamHealth{Status: status, Latency: time.Since(start), Circuit: upstream.breaker.State()}
+}
+
+// readiness calls the /health/ready endpoint of upstream
+func (s *ProxyService) readiness(ctx context.Context, upstream *proxyUpstream) string {
+	readyURL, err := url.JoinPath(upstream.baseURL, "/health/ready")
+	if err != nil {
+		return fmt.Sprintf("%s: %v", health.StatusUnhealthy, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, readyURL, nil)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", health.StatusUnhealthy, err)
+	}
+	req.Header.Set("User-Agent", "API-Gateway")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return health.StatusUnhealthy + ": timed out"
+		}
+		return health.StatusUnhealthy + ": unreachable"
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Sprintf("%s: status %d", health.StatusUnhealthy, resp.StatusCode)
+	}
+	return health.StatusHealthy
+}
@@ -11,10 +11,16 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
 	"api-traffic-analytics/cmd/api-gateway/internal/config"
 	"api-traffic-analytics/cmd/api-gateway/internal/handler"
-	"api-traffic-analytics/cmd/api-gateway/internal/middleware"
 	"api-traffic-analytics/cmd/api-gateway/internal/service"
+	"api-traffic-analytics/internal/pkg/health"
+	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/migrate"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/pkg/redis"
+	"api-traffic-analytics/internal/shared"
 )
 
 func main() {
@@ -26,14 +32,107 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// Initialize authentication
+	if !auth.ValidRole(cfg.APIKeyRole) {
+		log.Fatalf("Invalid API_KEY_ROLE %q", cfg.APIKeyRole)
+	}
+	verifier, err := auth.NewVerifier(auth.Options{
+		HMACSecret: cfg.JWTSecret,
+		JWKSFile:   cfg.JWTJWKSFile,
+		Issuer:     cfg.JWTIssuer,
+		Audience:   cfg.JWTAudience,
+		Leeway:     time.Duration(cfg.JWTLeewaySeconds) * time.Second,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure JWT authentication: %v", err)
+	}
+	if !verifier.Enabled() {
+		log.Println("JWT authentication disabled: set JWT_SECRET or JWT_JWKS_FILE")
+	}
+
+	if cfg.APIKey != "" {
+		log.Println("Shared API_KEY enabled; prefer managed keys from /admin/api-keys")
+	}
+
+	// Initialize Database, which holds the managed API keys
+	db, err := postgres.ConnectDB()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	if err := migrate.AutoMigrate(context.Background(), db); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	// Settings kept in the configurations table override the environment
+	if err := cfg.LoadStoredSettings(context.Background(), postgres.NewConfigurationRepository(db)); err != nil {
+		log.Fatalf("Failed to load stored settings: %v", err)
+	}
+
+	// Initialize Redis, which caches API key lookups and responses and holds
+	// the rate limits
+	redisClient, err := redis.GetRedisClient()
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	defer redisClient.Close()
+
+	// Initialize device authentication for traffic ingestion
+	cache := redis.NewCacheRepository(redisClient)
+	devices, err := auth.NewDeviceVerifier(auth.DeviceOptions{
+		KeysFile:         cfg.DeviceKeysFile,
+		MaxSkew:          time.Duration(cfg.IngestSignatureMaxSkewSeconds) * time.Second,
+		Nonces:           cache,
+		LegacyAllowedIPs: cfg.IngestLegacyAllowedIPs,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure device authentication: %v", err)
+	}
+	if len(cfg.IngestLegacyAllowedIPs) > 0 {
+		log.Printf("Accepting unauthenticated traffic readings from %v", cfg.IngestLegacyAllowedIPs)
+	}
+
 	// Initialize services
 	proxyService := service.NewProxyService(cfg)
+	apiKeyService := service.NewAPIKeyService(
+		postgres.NewAPIKeyRepository(db),
+		cache,
+		cfg,
+	)
+
+	// Each gateway replica needs every event, so it reads the partitions
+	// directly instead of joining a group
+	streamService := service.NewStreamService(cfg,
+		kafka.CreateBroadcastConsumer(cfg.KafkaBrokers, cfg.KafkaTopicTraffic),
+		kafka.CreateBroadcastConsumer(cfg.KafkaBrokers, cfg.KafkaTopicAlerts),
+	)
+
+	streamCtx, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+	streamService.Start(streamCtx)
+
+	// The response cache is shared by the replicas, so one of them handles
+	// each invalidation
+	responseCache := service.NewResponseCache(cache, cfg)
+	resultInvalidations := kafka.CreateTailConsumer(cfg.KafkaBrokers, cfg.KafkaTopicAnalytics, "api-gateway-cache")
+	defer resultInvalidations.Close()
+	alertInvalidations := kafka.CreateTailConsumer(cfg.KafkaBrokers, cfg.KafkaTopicAlerts, "api-gateway-cache")
+	defer alertInvalidations.Close()
+	responseCache.StartInvalidation(streamCtx, resultInvalidations, alertInvalidations)
+
+	// Readiness depends on the database, Redis and Kafka
+	checker := health.NewChecker("api-gateway", time.Duration(cfg.HealthTimeoutSeconds)*time.Second).
+		Add("postgres", func(ctx context.Context) error { return postgres.Ping(ctx, db) }).
+		Add("redis", func(ctx context.Context) error { return redis.Ping(ctx, redisClient) }).
+		Add("kafka", func(ctx context.Context) error { return kafka.Ping(ctx, cfg.KafkaBrokers) })
 
 	// Initialize handler
-	apiHandler := handler.NewHandler(proxyService, cfg)
+	apiHandler := handler.NewHandler(proxyService, streamService, apiKeyService, responseCache, checker, cfg)
 
 	// Initialize router
-	router := setupRouter(apiHandler, cfg)
+	router, err := handler.NewRouter(apiHandler, cfg, verifier, devices, redis.NewRateLimiter(redisClient, "ratelimit:"))
+	if err != nil {
+		log.Fatalf("Failed to configure routes: %v", err)
+	}
 
 	// Start server
 	server := &http.Server{
@@ -48,7 +147,7 @@ func main() {
 		}
 	}()
 
-	log.Printf("API Gateway started on port %s", cfg.Port)
+	log.Printf("API Gateway %s started on port %s", shared.Version, cfg.Port)
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
@@ -57,6 +156,10 @@ func main() {
 
 	log.Println("Shutting down API Gateway...")
 
+	// End live streams, otherwise open connections would block the shutdown
+	stopStreams()
+	streamService.Close()
+
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -67,43 +170,3 @@ func main() {
 
 	log.Println("API Gateway exited")
 }
-
-func setupRouter(handler *handler.Handler, cfg *config.Config) *gin.Engine {
-	router := gin.New()
-
-	// Global middleware
-	router.Use(gin.Recovery())
-	router.Use(middleware.Logging())
-	router.Use(middleware.CORS())
-
-	// Public routes (no auth required)
-	public := router.Group("/")
-	{
-		public.GET("/health", handler.HealthCheck)
-		public.POST("/traffic", handler.ReceiveTrafficData) // Para compatibilidad
-	}
-
-	// Protected routes (auth required)
-	protected := router.Group("/")
-	protected.Use(middleware.APIKeyAuth(cfg.APIKey))
-	protected.Use(middleware.RateLimit())
-
-	{
-		// Analytics endpoints
-		protected.GET("/analytics", handler.GetAnalytics)
-		protected.GET("/analytics/:locationId", handler.GetAnalyticsByLocation)
-
-		// Alerts endpoints
-		protected.GET("/alerts", handler.GetAlerts)
-		protected.GET("/alerts/:locationId", handler.GetAlertsByLocation)
-
-		// Traffic data endpoints
-		protected.GET("/traffic", handler.GetTrafficData)
-		protected.GET("/traffic/:locationId", handler.GetTrafficDataByLocation)
-
-		// Proxy to internal services
-		protected.Any("/services/*path", handler.ProxyToService)
-	}
-
-	return router
-}
@@ -1 +1,1663 @@
-package test
\ No newline at end of file
+package test
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/auth"
+	"api-traffic-analytics/cmd/api-gateway/internal/config"
+	"api-traffic-analytics/cmd/api-gateway/internal/handler"
+	"api-traffic-analytics/cmd/api-gateway/internal/middleware"
+	"api-traffic-analytics/cmd/api-gateway/internal/openapi"
+	"api-traffic-analytics/cmd/api-gateway/internal/service"
+	"api-traffic-analytics/internal/pkg/health"
+	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/memory"
+	"api-traffic-analytics/internal/shared"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// upstream is a stub internal service recording the requests it receives
+type upstream struct {
+	server *httptest.Server
+	method string
+	path   string
+	body   string
+	header http.Header
+}
+
+func newUpstream(t *testing.T, status int, response string) *upstream {
+	t.Helper()
+
+	u := &upstream{}
+	u.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		u.method, u.path, u.body, u.header = r.Method, r.URL.RequestURI(), string(body), r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(u.server.Close)
+	return u
+}
+
+func newGateway(t *testing.T, ingestorURL string) (*gin.Engine, *service.StreamService, func(string, string, io.Reader) *http.Request) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = ingestorURL
+	router, streams := newRouter(t, cfg)
+
+	request := func(method, path string, body io.Reader) *http.Request {
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+	return router, streams, request
+}
+
+func newRouter(t *testing.T, cfg *config.Config) (*gin.Engine, *service.StreamService) {
+	t.Helper()
+	return newRouterWithLimiter(t, cfg, memory.NewRateLimiter())
+}
+
+// newRouterWithLimiter is newRouter counting the rate limits in limiter, which
+// several routers can share like gateway replicas share Redis
+func newRouterWithLimiter(t *testing.T, cfg *config.Config, limiter *memory.RateLimiter) (*gin.Engine, *service.StreamService) {
+	t.Helper()
+	router, streams, _ := buildRouter(t, cfg, limiter)
+	return router, streams
+}
+
+// buildRouter is newRouterWithLimiter also returning the response cache
+func buildRouter(t *testing.T, cfg *config.Config, limiter *memory.RateLimiter) (*gin.Engine, *service.StreamService, *service.ResponseCache) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	verifier, err := auth.NewVerifier(auth.Options{HMACSecret: cfg.JWTSecret, JWKSFile: cfg.JWTJWKSFile})
+	if err != nil {
+		t.Fatalf("creating verifier: %v", err)
+	}
+	cache := memory.NewCacheRepository()
+	devices, err := auth.NewDeviceVerifier(auth.DeviceOptions{
+		KeysFile:         cfg.DeviceKeysFile,
+		MaxSkew:          time.Duration(cfg.IngestSignatureMaxSkewSeconds) * time.Second,
+		Nonces:           cache,
+		LegacyAllowedIPs: cfg.IngestLegacyAllowedIPs,
+	})
+	if err != nil {
+		t.Fatalf("creating device verifier: %v", err)
+	}
+	streams, _ := newStreams(t, cfg)
+	keys := service.NewAPIKeyService(memory.NewAPIKeyRepository(memory.NewStore()), cache, cfg)
+	responses := service.NewResponseCache(cache, cfg)
+	checker := health.NewChecker("api-gateway", time.Second)
+	router, err := handler.NewRouter(handler.NewHandler(service.NewProxyService(cfg), streams, keys, responses, checker, cfg), cfg, verifier, devices, limiter)
+	if err != nil {
+		t.Fatalf("creating router: %v", err)
+	}
+	return router, streams, responses
+}
+
+func TestReceiveTrafficDataIsProxied(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"status":"ok"}`)
+	router, _, request := newGateway(t, ingestor.server.URL)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, request(http.MethodPost, "/traffic", strings.NewReader(`{"location_id":"LOC001"}`)))
+
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"status":"ok"}` {
+		t.Errorf("POST /traffic = %d %s", rec.Code, rec.Body)
+	}
+	if ingestor.method != http.MethodPost || ingestor.path != "/traffic" || ingestor.body != `{"location_id":"LOC001"}` {
+		t.Errorf("upstream received %s %s %s", ingestor.method, ingestor.path, ingestor.body)
+	}
+}
+
+func TestTrafficQueriesRequireAPIKey(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"data":[],"count":0}`)
+	router, _, request := newGateway(t, ingestor.server.URL)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/traffic/LOC001", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without key = %d, want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, request(http.MethodGet, "/traffic/LOC001?limit=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("with key = %d: %s", rec.Code, rec.Body)
+	}
+	if ingestor.path != "/traffic/LOC001?limit=5" {
+		t.Errorf("upstream path = %q", ingestor.path)
+	}
+}
+
+func TestTrafficStreamOverSSE(t *testing.T) {
+	router, streams, request := newGateway(t, "http://unused")
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := request(http.MethodGet, server.URL+"/stream/traffic?location_id=LOC001", nil).WithContext(ctx)
+	req.RequestURI = ""
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("opening stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	for streams.Traffic.Subscribers() == 0 {
+		if ctx.Err() != nil {
+			t.Fatal("client never subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	streams.Traffic.Publish(&service.StreamEvent{Type: "traffic", LocationID: "LOC001", Severity: models.CongestionLow, Data: []byte(`{"location_id":"LOC001"}`)})
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			if line != `data: {"location_id":"LOC001"}` {
+				t.Errorf("data line = %q", line)
+			}
+			return
+		}
+	}
+	t.Fatalf("stream ended without an event: %v", scanner.Err())
+}
+
+// claims are the claims of a token for subject with roles, valid for an hour
+func claims(subject string, roles ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   subject,
+		"roles": roles,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("encoding token segment: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+
+	input := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	input := encodeSegment(t, map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func withToken(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestJWTRolesPerRouteGroup(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"data":[]}`)
+	alerting := newUpstream(t, http.StatusOK, `{"success":true}`)
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = ingestor.server.URL
+	cfg.AlertingServiceURL = alerting.server.URL
+	router, _ := newRouter(t, cfg)
+
+	viewer := signHS256(t, cfg.JWTSecret, claims("ana", auth.RoleViewer))
+	operator := signHS256(t, cfg.JWTSecret, claims("luis", auth.RoleOperator))
+	admin := signHS256(t, cfg.JWTSecret, claims("root", auth.RoleAdmin))
+
+	cases := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"viewer reads traffic", viewer, http.MethodGet, "/traffic/LOC001", http.StatusOK},
+		{"viewer searches locations", viewer, http.MethodPost, "/locations/search/radius", http.StatusOK},
+		{"viewer cannot ack alerts", viewer, http.MethodPost, "/alerts/1/acknowledge", http.StatusForbidden},
+		{"operator acks alerts", operator, http.MethodPost, "/alerts/1/acknowledge", http.StatusOK},
+		{"operator cannot edit locations", operator, http.MethodPut, "/locations/LOC001", http.StatusForbidden},
+		{"admin edits locations", admin, http.MethodPut, "/locations/LOC001", http.StatusOK},
+		{"admin resolves alerts", admin, http.MethodPost, "/alerts/1/resolve", http.StatusOK},
+		{"no role reads nothing", signHS256(t, cfg.JWTSecret, claims("nobody", "guest")), http.MethodGet, "/traffic", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, withToken(httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{}`)), tc.token))
+			if rec.Code != tc.want {
+				t.Errorf("%s %s = %d, want %d: %s", tc.method, tc.path, rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestJWTIdentityIsForwarded(t *testing.T) {
+	alerting := newUpstream(t, http.StatusOK, `{"success":true}`)
+	cfg := testConfig()
+	cfg.AlertingServiceURL = alerting.server.URL
+	router, _ := newRouter(t, cfg)
+
+	req := withToken(httptest.NewRequest(http.MethodPost, "/alerts/7/acknowledge", nil),
+		signHS256(t, cfg.JWTSecret, claims("luis", auth.RoleOperator)))
+	// A client cannot impersonate someone else through the identity headers
+	req.Header.Set(shared.HeaderUserID, "root")
+	req.Header.Set(shared.HeaderUserRoles, auth.RoleAdmin)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("acknowledge = %d: %s", rec.Code, rec.Body)
+	}
+	if got := alerting.header.Get(shared.HeaderUserID); got != "luis" {
+		t.Errorf("%s = %q, want luis", shared.HeaderUserID, got)
+	}
+	if got := alerting.header.Get(shared.HeaderUserRoles); got != auth.RoleOperator {
+		t.Errorf("%s = %q, want operator", shared.HeaderUserRoles, got)
+	}
+	if got := alerting.header.Get("Authorization"); got != "" {
+		t.Errorf("Authorization was forwarded: %q", got)
+	}
+}
+
+func TestJWTRejectsInvalidTokens(t *testing.T) {
+	cfg := testConfig()
+	router, _ := newRouter(t, cfg)
+
+	expired := claims("ana", auth.RoleViewer)
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	noExpiry := claims("ana", auth.RoleViewer)
+	delete(noExpiry, "exp")
+	valid := signHS256(t, cfg.JWTSecret, claims("ana", auth.RoleViewer))
+
+	for name, token := range map[string]string{
+		"expired":        signHS256(t, cfg.JWTSecret, expired),
+		"no expiry":      signHS256(t, cfg.JWTSecret, noExpiry),
+		"wrong secret":   signHS256(t, "another-secret", claims("ana", auth.RoleViewer)),
+		"tampered":       valid[:strings.LastIndex(valid, ".")] + ".AAAA",
+		"algorithm none": encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, claims("ana", auth.RoleAdmin)) + ".",
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, withToken(httptest.NewRequest(http.MethodGet, "/traffic", nil), token))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s token = %d, want 401", name, rec.Code)
+		}
+	}
+}
+
+func TestJWTRS256WithJWKS(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"data":[]}`)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	jwks := map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "k1",
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("writing JWKS: %v", err)
+	}
+
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = ingestor.server.URL
+	cfg.JWTJWKSFile = path
+	router, _ := newRouter(t, cfg)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, withToken(httptest.NewRequest(http.MethodGet, "/traffic", nil),
+		signRS256(t, key, "k1", claims("partner", auth.RoleViewer))))
+	if rec.Code != http.StatusOK {
+		t.Errorf("RS256 token = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, withToken(httptest.NewRequest(http.MethodGet, "/traffic", nil),
+		signRS256(t, key, "unknown", claims("partner", auth.RoleViewer))))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown kid = %d, want 401", rec.Code)
+	}
+}
+
+func TestSharedAPIKeyIsViewerByDefault(t *testing.T) {
+	t.Setenv("API_KEY_ROLE", "")
+	cfg := testConfig()
+	cfg.APIKeyRole = config.Load().APIKeyRole
+	cfg.TrafficIngestorURL = newUpstream(t, http.StatusOK, `{"data":[]}`).server.URL
+	router, _ := newRouter(t, cfg)
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/traffic", http.StatusOK},
+		{http.MethodPost, "/admin/api-keys", http.StatusForbidden},
+		{http.MethodGet, "/services/traffic/traffic", http.StatusForbidden},
+		{http.MethodPost, "/alerts/1/acknowledge", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"name":"k","owner":"o","scopes":["traffic:read"]}`))
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s with the shared key = %d, want %d: %s", tc.method, tc.path, rec.Code, tc.want, rec.Body)
+		}
+	}
+}
+
+// issueAPIKey creates a managed key through the admin endpoint
+func issueAPIKey(t *testing.T, router http.Handler, adminToken, body string) service.IssuedAPIKey {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, withToken(httptest.NewRequest(http.MethodPost, "/admin/api-keys", strings.NewReader(body)), adminToken))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("creating API key = %d: %s", rec.Code, rec.Body)
+	}
+	var issued service.IssuedAPIKey
+	if err := json.Unmarshal(rec.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("decoding API key: %v", err)
+	}
+	if !strings.HasPrefix(issued.Key, "tak_"+issued.KeyID+"_") || strings.Contains(rec.Body.String(), "key_hash") {
+		t.Fatalf("unexpected API key response: %s", rec.Body)
+	}
+	return issued
+}
+
+func withAPIKey(req *http.Request, key string) *http.Request {
+	req.Header.Set("X-API-Key", key)
+	return req
+}
+
+func TestAPIKeyScopesPerRoute(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"data":[]}`)
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = ingestor.server.URL
+	cfg.AlertingServiceURL = newUpstream(t, http.StatusOK, `{"data":[]}`).server.URL
+	router, _ := newRouter(t, cfg)
+	admin := signHS256(t, cfg.JWTSecret, claims("root", auth.RoleAdmin))
+
+	partner := issueAPIKey(t, router, admin, `{"name":"dashboard","owner":"partner-a","scopes":["traffic:read"]}`)
+	fleet := issueAPIKey(t, router, admin, `{"name":"north fleet","owner":"fleet-north","scopes":["traffic:write"]}`)
+
+	cases := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		want   int
+	}{
+		{"partner reads traffic", partner.Key, http.MethodGet, "/traffic/LOC001", http.StatusOK},
+		{"partner cannot read alerts", partner.Key, http.MethodGet, "/alerts", http.StatusForbidden},
+		{"partner cannot ingest", partner.Key, http.MethodPost, "/traffic", http.StatusForbidden},
+		{"partner cannot manage keys", partner.Key, http.MethodGet, "/admin/api-keys", http.StatusForbidden},
+		{"fleet ingests", fleet.Key, http.MethodPost, "/traffic", http.StatusOK},
+		{"fleet cannot read traffic", fleet.Key, http.MethodGet, "/traffic", http.StatusForbidden},
+		{"unknown key", "tak_0123456789abcdef_secret", http.MethodGet, "/traffic", http.StatusUnauthorized},
+		{"wrong secret", partner.Key + "x", http.MethodGet, "/traffic", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, withAPIKey(httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{}`)), tc.key))
+			if rec.Code != tc.want {
+				t.Errorf("%s %s = %d, want %d: %s", tc.method, tc.path, rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+
+	// The key owner is forwarded as the caller
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/traffic", nil)
+	req.Header.Set("Authorization", "ApiKey "+partner.Key)
+	router.ServeHTTP(rec, req)
+	if got := ingestor.header.Get(shared.HeaderUserID); got != "partner-a" {
+		t.Errorf("%s = %q, want partner-a", shared.HeaderUserID, got)
+	}
+	if got := ingestor.header.Get(shared.HeaderUserScopes); got != auth.ScopeTrafficRead {
+		t.Errorf("%s = %q, want traffic:read", shared.HeaderUserScopes, got)
+	}
+
+	// Unknown scopes are rejected
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, withToken(httptest.NewRequest(http.MethodPost, "/admin/api-keys",
+		strings.NewReader(`{"name":"x","owner":"y","scopes":["everything"]}`)), admin))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown scope = %d, want 400", rec.Code)
+	}
+}
+
+func TestAPIKeyRevokeRotateAndLastUsed(t *testing.T) {
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = newUpstream(t, http.StatusOK, `{"data":[]}`).server.URL
+	router, _ := newRouter(t, cfg)
+	admin := signHS256(t, cfg.JWTSecret, claims("root", auth.RoleAdmin))
+
+	get := func(key string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, withAPIKey(httptest.NewRequest(http.MethodGet, "/traffic", nil), key))
+		return rec.Code
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, withToken(httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)), admin))
+		return rec
+	}
+
+	key := issueAPIKey(t, router, admin, `{"name":"dashboard","owner":"partner-a","scopes":["traffic:read"]}`)
+	if code := get(key.Key); code != http.StatusOK {
+		t.Fatalf("new key = %d", code)
+	}
+
+	// Last use and creator show up in the listing, without the hash
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, withToken(httptest.NewRequest(http.MethodGet, "/admin/api-keys?owner=partner-a", nil), admin))
+	var listing struct {
+		Data []models.APIKey `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &listing)
+	if len(listing.Data) != 1 || listing.Data[0].LastUsedAt == nil || listing.Data[0].CreatedBy != "root" {
+		t.Fatalf("listing = %s", rec.Body)
+	}
+
+	// Rotation keeps the old key working during the grace period
+	rec = post(fmt.Sprintf("/admin/api-keys/%d/rotate", key.ID), `{"grace_period_seconds":3600}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("rotate = %d: %s", rec.Code, rec.Body)
+	}
+	var rotated service.IssuedAPIKey
+	json.Unmarshal(rec.Body.Bytes(), &rotated)
+	if rotated.RotatedFrom == nil || *rotated.RotatedFrom != key.ID || rotated.Owner != "partner-a" {
+		t.Errorf("rotated key = %s", rec.Body)
+	}
+	if code := get(key.Key); code != http.StatusOK {
+		t.Errorf("old key during grace period = %d", code)
+	}
+	if code := get(rotated.Key); code != http.StatusOK {
+		t.Errorf("new key = %d", code)
+	}
+
+	// Without a grace period the old key stops working at once
+	second := post(fmt.Sprintf("/admin/api-keys/%d/rotate", rotated.ID), `{"grace_period_seconds":0}`)
+	if second.Code != http.StatusCreated {
+		t.Fatalf("second rotate = %d: %s", second.Code, second.Body)
+	}
+	if code := get(rotated.Key); code != http.StatusUnauthorized {
+		t.Errorf("key rotated without grace = %d, want 401", code)
+	}
+
+	// Revocation applies immediately, even though the key is cached
+	if rec := post(fmt.Sprintf("/admin/api-keys/%d/revoke", key.ID), ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoke = %d: %s", rec.Code, rec.Body)
+	}
+	if code := get(key.Key); code != http.StatusUnauthorized {
+		t.Errorf("revoked key = %d, want 401", code)
+	}
+	if rec := post(fmt.Sprintf("/admin/api-keys/%d/rotate", key.ID), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("rotating a revoked key = %d, want 404", rec.Code)
+	}
+}
+
+func TestRateLimitIsSharedAcrossReplicas(t *testing.T) {
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = newUpstream(t, http.StatusOK, `{"data":[]}`).server.URL
+	cfg.RateLimitRequests = 3
+
+	now := time.Now()
+	limiter := memory.NewRateLimiter()
+	limiter.Now = func() time.Time { return now }
+	replicas := []http.Handler{}
+	for i := 0; i < 2; i++ {
+		router, _ := newRouterWithLimiter(t, cfg, limiter)
+		replicas = append(replicas, router)
+	}
+	token := signHS256(t, cfg.JWTSecret, claims("ana", auth.RoleViewer))
+
+	get := func(i int, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		replicas[i%2].ServeHTTP(rec, withToken(httptest.NewRequest(http.MethodGet, "/traffic", nil), token))
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		rec := get(i, token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d", i, rec.Code)
+		}
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != strconv.Itoa(2-i) {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %d", i, got, 2-i)
+		}
+		if got := rec.Header().Get("X-RateLimit-Limit"); got != "3" {
+			t.Errorf("X-RateLimit-Limit = %q, want 3", got)
+		}
+	}
+
+	rec := get(3, token)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("4th request = %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "20" {
+		t.Errorf("Retry-After = %q, want 20", got)
+	}
+
+	// Other clients and other route classes have their own budget
+	if rec := get(0, signHS256(t, cfg.JWTSecret, claims("luis", auth.RoleViewer))); rec.Code != http.StatusOK {
+		t.Errorf("another user = %d", rec.Code)
+	}
+	write := httptest.NewRecorder()
+	replicas[0].ServeHTTP(write, withToken(httptest.NewRequest(http.MethodPost, "/alerts/1/acknowledge", nil), token))
+	if got := write.Header().Get("X-RateLimit-Limit"); got != strconv.Itoa(cfg.RateLimitWriteRequests) {
+		t.Errorf("write X-RateLimit-Limit = %q", got)
+	}
+
+	// The budget refills over time
+	now = now.Add(20 * time.Second)
+	if rec := get(1, token); rec.Code != http.StatusOK {
+		t.Errorf("after Retry-After = %d", rec.Code)
+	}
+}
+
+func TestRateLimitUsesAPIKeyQuota(t *testing.T) {
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = newUpstream(t, http.StatusOK, `{"data":[]}`).server.URL
+	cfg.RateLimitRequests = 2
+	router, _ := newRouter(t, cfg)
+	admin := signHS256(t, cfg.JWTSecret, claims("root", auth.RoleAdmin))
+
+	partner := issueAPIKey(t, router, admin, `{"name":"dashboard","owner":"partner-a","scopes":["traffic:read"],"rate_limit":5}`)
+	other := issueAPIKey(t, router, admin, `{"name":"dashboard","owner":"partner-b","scopes":["traffic:read"]}`)
+
+	count := func(key string) int {
+		allowed := 0
+		for i := 0; i < 10; i++ {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, withAPIKey(httptest.NewRequest(http.MethodGet, "/traffic", nil), key))
+			if rec.Code == http.StatusOK {
+				allowed++
+			}
+		}
+		return allowed
+	}
+	if got := count(partner.Key); got != 5 {
+		t.Errorf("key with a quota of 5 got %d requests", got)
+	}
+	if got := count(other.Key); got != 2 {
+		t.Errorf("key without quota got %d requests, want the route limit of 2", got)
+	}
+}
+
+// signedReading builds a POST /traffic request signed by a device
+func signedReading(secret, deviceID, nonce string, at time.Time, body string) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/traffic", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.HeaderDeviceID, deviceID)
+	req.Header.Set(auth.HeaderTimestamp, timestamp)
+	req.Header.Set(auth.HeaderNonce, nonce)
+	req.Header.Set(auth.HeaderSignature, fmt.Sprintf("%x",
+		auth.SignDeviceRequest([]byte(secret), timestamp, nonce, http.MethodPost, "/traffic", []byte(body))))
+	return req
+}
+
+func newIngestGateway(t *testing.T, ingestor *upstream) (http.Handler, string) {
+	t.Helper()
+
+	const secret = "sensor-001-secret-value"
+	path := filepath.Join(t.TempDir(), "devices.json")
+	keys := `{"devices":[{"id":"sensor-001","secret":"` + secret + `"}]}`
+	if err := os.WriteFile(path, []byte(keys), 0o600); err != nil {
+		t.Fatalf("writing device keys: %v", err)
+	}
+
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = ingestor.server.URL
+	cfg.DeviceKeysFile = path
+	cfg.IngestSignatureMaxSkewSeconds = 300
+	cfg.IngestLegacyAllowedIPs = []string{"198.51.100.0/24"}
+	cfg.IngestMaxBodyBytes = 4096
+	cfg.RateLimitIngestRequests = 3
+	router, _ := newRouter(t, cfg)
+	return router, secret
+}
+
+func TestIngestRequiresDeviceSignatureOrCredentials(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"status":"ok"}`)
+	router, secret := newIngestGateway(t, ingestor)
+	body := `{"location_id":"LOC001"}`
+	now := time.Now()
+
+	send := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	anonymous := httptest.NewRequest(http.MethodPost, "/traffic", strings.NewReader(body))
+	if code := send(anonymous); code != http.StatusUnauthorized {
+		t.Errorf("anonymous reading = %d, want 401", code)
+	}
+
+	if code := send(signedReading(secret, "sensor-001", "n-1", now, body)); code != http.StatusOK {
+		t.Fatalf("signed reading = %d", code)
+	}
+	if got := ingestor.header.Get(shared.HeaderUserID); got != "sensor-001" {
+		t.Errorf("%s = %q, want sensor-001", shared.HeaderUserID, got)
+	}
+	if ingestor.body != body {
+		t.Errorf("ingestor received %q", ingestor.body)
+	}
+
+	tampered := signedReading(secret, "sensor-001", "n-2", now, body)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"location_id":"LOC999"}`))
+	for name, req := range map[string]*http.Request{
+		"replayed":       signedReading(secret, "sensor-001", "n-1", now, body),
+		"wrong secret":   signedReading("another-secret-value", "sensor-001", "n-3", now, body),
+		"unknown device": signedReading(secret, "sensor-999", "n-4", now, body),
+		"stale":          signedReading(secret, "sensor-001", "n-5", now.Add(-10*time.Minute), body),
+		"tampered body":  tampered,
+	} {
+		if code := send(req); code != http.StatusUnauthorized {
+			t.Errorf("%s reading = %d, want 401", name, code)
+		}
+	}
+}
+
+func TestIngestRejectsOversizedBodies(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"status":"ok"}`)
+	router, secret := newIngestGateway(t, ingestor)
+	oversized := `{"location_id":"LOC001","data_source":"` + strings.Repeat("x", 8192) + `"}`
+
+	send := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	credentialed := httptest.NewRequest(http.MethodPost, "/traffic", strings.NewReader(oversized))
+	credentialed.Header.Set("Authorization", "Bearer "+testConfig().APIKey)
+	legacy := httptest.NewRequest(http.MethodPost, "/traffic", strings.NewReader(oversized))
+	legacy.RemoteAddr = "198.51.100.7:4000"
+	for name, req := range map[string]*http.Request{
+		"signed":       signedReading(secret, "sensor-001", "n-1", time.Now(), oversized),
+		"credentialed": credentialed,
+		"legacy":       legacy,
+	} {
+		rec := send(req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("oversized %s reading = %d, want 413: %s", name, rec.Code, rec.Body)
+		}
+	}
+	if ingestor.path != "" {
+		t.Errorf("an oversized reading reached the ingestor")
+	}
+
+	if rec := send(signedReading(secret, "sensor-001", "n-2", time.Now(), `{"location_id":"LOC001"}`)); rec.Code != http.StatusOK {
+		t.Errorf("signed reading under the limit = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestIngestLegacyAllowlistAndRateLimit(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"status":"ok"}`)
+	router, secret := newIngestGateway(t, ingestor)
+
+	send := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	legacy := func(remoteAddr, forwardedFor string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/traffic", strings.NewReader(`{}`))
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		return req
+	}
+
+	if rec := send(legacy("198.51.100.7:4000", "")); rec.Code != http.StatusOK {
+		t.Errorf("allowlisted IP = %d", rec.Code)
+	}
+	// X-Forwarded-For is ignored unless the proxy is trusted
+	if rec := send(legacy("203.0.113.9:4000", "198.51.100.7")); rec.Code != http.StatusUnauthorized {
+		t.Errorf("spoofed X-Forwarded-For = %d, want 401", rec.Code)
+	}
+
+	// Each device has its own ingestion budget
+	for i := 0; i < 4; i++ {
+		rec := send(signedReading(secret, "sensor-001", fmt.Sprintf("rl-%d", i), time.Now(), `{}`))
+		want := http.StatusOK
+		if i == 3 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Errorf("reading %d = %d, want %d", i, rec.Code, want)
+		}
+	}
+	if rec := send(legacy("198.51.100.8:4000", "")); rec.Code != http.StatusOK {
+		t.Errorf("legacy sender after the device hit its limit = %d", rec.Code)
+	}
+}
+
+func TestCORSPolicy(t *testing.T) {
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = newUpstream(t, http.StatusOK, `{"data":[]}`).server.URL
+	cfg.CORSAllowedOrigins = []string{"https://app.example.com", "https://*.partner.io"}
+	cfg.CORSAllowedMethods = []string{"GET", "POST"}
+	cfg.CORSAllowedHeaders = []string{"Authorization", "Content-Type"}
+	cfg.CORSExposedHeaders = []string{"X-RateLimit-Remaining", "Retry-After"}
+	cfg.CORSAllowCredentials = true
+	cfg.CORSMaxAgeSeconds = 600
+	cfg.CORSRoutes = `[{"path":"/health","allowed_origins":["*"],"allow_credentials":false}]`
+	router, _ := newRouter(t, cfg)
+
+	preflight := func(path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for origin, allowed := range map[string]bool{
+		"https://app.example.com":      true,
+		"https://eu.partner.io":        true,
+		"https://a.b.partner.io":       true,
+		"https://partner.io":           false,
+		"http://eu.partner.io":         false,
+		"https://evil.com/.partner.io": false,
+		"https://app.example.com.evil": false,
+	} {
+		rec := preflight("/traffic", origin)
+		if !allowed {
+			if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+				t.Errorf("%s preflight = %d, allowed %q", origin, rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+			}
+			continue
+		}
+		if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != origin {
+			t.Errorf("%s preflight = %d, allowed %q", origin, rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+		if rec.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+			rec.Header().Get("Access-Control-Allow-Methods") != "GET, POST" ||
+			rec.Header().Get("Access-Control-Max-Age") != "600" {
+			t.Errorf("%s preflight headers = %v", origin, rec.Header())
+		}
+	}
+
+	// Actual requests expose the rate limit headers
+	req := withToken(httptest.NewRequest(http.MethodGet, "/traffic", nil), signHS256(t, cfg.JWTSecret, claims("ana", auth.RoleViewer)))
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-RateLimit-Remaining, Retry-After" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+
+	// Per-route override
+	rec = preflight("/health", "https://anyone.org")
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("/health preflight = %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestCORSRejectsCredentialedWildcard(t *testing.T) {
+	cfg := testConfig()
+	cfg.CORSAllowedOrigins = []string{"*"}
+	cfg.CORSAllowCredentials = true
+	if _, err := middleware.NewCORS(cfg); err == nil {
+		t.Error("credentials with the * origin were accepted")
+	}
+
+	// Overrides inherit the credentials of the default policy
+	cfg = testConfig()
+	cfg.CORSAllowedOrigins = []string{"https://app.example.com"}
+	cfg.CORSAllowCredentials = true
+	cfg.CORSRoutes = `[{"path":"/stream/","allowed_origins":["*"]}]`
+	if _, err := middleware.NewCORS(cfg); err == nil {
+		t.Error("a route override combining credentials and * was accepted")
+	}
+
+	cfg.CORSRoutes = `[{"path":"/stream/","allowed_origins":["https://*"]}]`
+	if _, err := middleware.NewCORS(cfg); err == nil {
+		t.Error("an invalid origin pattern was accepted")
+	}
+}
+
+func TestWebSocketStreamsEnforceCORSOrigins(t *testing.T) {
+	cfg := testConfig()
+	cfg.CORSAllowedOrigins = []string{"https://app.example.com"}
+	cfg.CORSRoutes = `[{"path":"/stream/alerts","allowed_origins":["https://ops.example.com"]}]`
+	router, _ := newRouter(t, cfg)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	dial := func(path, origin string) (*http.Response, error) {
+		header := http.Header{"Authorization": {"Bearer " + cfg.APIKey}}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+		if err == nil {
+			conn.Close()
+		}
+		return resp, err
+	}
+
+	for _, tc := range []struct {
+		path, origin string
+		allowed      bool
+	}{
+		{"/stream/traffic", "https://app.example.com", true},
+		{"/stream/traffic", "https://evil.example", false},
+		{"/stream/traffic", "", true}, // not a browser
+		{"/stream/alerts", "https://ops.example.com", true},
+		{"/stream/alerts", "https://app.example.com", false},
+	} {
+		resp, err := dial(tc.path, tc.origin)
+		if tc.allowed && err != nil {
+			t.Errorf("%s from %q rejected: %v", tc.path, tc.origin, err)
+		}
+		if !tc.allowed && (err == nil || resp == nil || resp.StatusCode != http.StatusForbidden) {
+			t.Errorf("%s from %q was not rejected with 403: %v", tc.path, tc.origin, err)
+		}
+	}
+}
+
+// settings is a configurations table in memory
+type settings map[string]string
+
+func (s settings) GetString(ctx context.Context, key, defaultValue string) (string, error) {
+	if value, ok := s[key]; ok {
+		return value, nil
+	}
+	return defaultValue, nil
+}
+
+func TestCORSSettingsFromConfigurationsTable(t *testing.T) {
+	cfg := testConfig()
+	cfg.CORSAllowedOrigins = []string{"*"}
+	err := cfg.LoadStoredSettings(context.Background(), settings{
+		"cors.allowed_origins":   "https://app.example.com, https://*.partner.io",
+		"cors.allow_credentials": "true",
+		"cors.max_age_seconds":   "120",
+	})
+	if err != nil {
+		t.Fatalf("loading settings: %v", err)
+	}
+	if len(cfg.CORSAllowedOrigins) != 2 || cfg.CORSAllowedOrigins[1] != "https://*.partner.io" ||
+		!cfg.CORSAllowCredentials || cfg.CORSMaxAgeSeconds != 120 {
+		t.Errorf("settings not applied: %+v", cfg)
+	}
+	if _, err := middleware.NewCORS(cfg); err != nil {
+		t.Errorf("stored policy rejected: %v", err)
+	}
+
+	if err := cfg.LoadStoredSettings(context.Background(), settings{"cors.allow_credentials": "maybe"}); err == nil {
+		t.Error("invalid boolean accepted")
+	}
+}
+
+// getAnalytics sends GET path to a gateway whose analytics service is at url
+func getAnalytics(t *testing.T, cfg *config.Config, path string) (*httptest.ResponseRecorder, models.ErrorResponse) {
+	t.Helper()
+
+	router, _ := newRouter(t, cfg)
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var errorResponse models.ErrorResponse
+	if rec.Code >= http.StatusBadRequest {
+		if err := json.Unmarshal(rec.Body.Bytes(), &errorResponse); err != nil {
+			t.Fatalf("GET %s = %d with a body that is not an ErrorResponse: %s", path, rec.Code, rec.Body)
+		}
+		if errorResponse.RequestID == "" || errorResponse.RequestID != rec.Header().Get(shared.HeaderRequestID) {
+			t.Errorf("GET %s error request_id %q, header %q", path, errorResponse.RequestID, rec.Header().Get(shared.HeaderRequestID))
+		}
+	}
+	return rec, errorResponse
+}
+
+func TestUpstreamErrorsArePropagated(t *testing.T) {
+	notFound := newUpstream(t, http.StatusNotFound, `{"error":"Not found","code":404,"message":"location LOC999 not found"}`)
+	cfg := testConfig()
+	cfg.AnalyticsServiceURL = notFound.server.URL
+	rec, errorResponse := getAnalytics(t, cfg, "/analytics/LOC999")
+	if rec.Code != http.StatusNotFound || errorResponse.Message != "location LOC999 not found" {
+		t.Errorf("upstream 404 = %d %+v", rec.Code, errorResponse)
+	}
+
+	plain := newUpstream(t, http.StatusInternalServerError, `panic: oops`)
+	cfg = testConfig()
+	cfg.AnalyticsServiceURL = plain.server.URL
+	if rec, _ := getAnalytics(t, cfg, "/analytics"); rec.Code != http.StatusBadGateway {
+		t.Errorf("upstream 500 without an ErrorResponse = %d, want 502", rec.Code)
+	}
+
+	badRequest := newUpstream(t, http.StatusBadRequest, `not json`)
+	cfg = testConfig()
+	cfg.AnalyticsServiceURL = badRequest.server.URL
+	if rec, _ := getAnalytics(t, cfg, "/analytics?limit=x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("upstream 400 without an ErrorResponse = %d, want 400", rec.Code)
+	}
+
+	// Relayed responses get the request ID too
+	ingestor := newUpstream(t, http.StatusConflict, `{"error":"Conflict","code":409,"message":"location exists"}`)
+	router, _, request := newGateway(t, ingestor.server.URL)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, request(http.MethodPost, "/locations", strings.NewReader(`{"id":"LOC001"}`)))
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), `"request_id":"`) {
+		t.Errorf("POST /locations = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTransportFailuresMapToGatewayStatuses(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	cfg := testConfig()
+	cfg.AnalyticsServiceURL = down.URL
+	cfg.ProxyTimeoutSeconds = 5
+	if rec, _ := getAnalytics(t, cfg, "/analytics"); rec.Code != http.StatusBadGateway {
+		t.Errorf("unreachable upstream = %d, want 502", rec.Code)
+	}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(slow.Close)
+	cfg = testConfig()
+	cfg.AnalyticsServiceURL = slow.URL
+	cfg.ProxyTimeoutSeconds = 1
+	if rec, _ := getAnalytics(t, cfg, "/analytics"); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("slow upstream = %d, want 504", rec.Code)
+	}
+
+	failing := newUpstream(t, http.StatusInternalServerError, `{"error":"Internal server error","message":"db down"}`)
+	cfg = testConfig()
+	cfg.AnalyticsServiceURL = failing.server.URL
+	cfg.ProxyTimeoutSeconds = 5
+	cfg.ProxyBreakerFailureThreshold = 1
+	cfg.ProxyBreakerOpenSeconds = 60
+	router, _ := newRouter(t, cfg)
+	statuses := make([]int, 0, 2)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/analytics", nil)
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		statuses = append(statuses, rec.Code)
+	}
+	if statuses[0] != http.StatusInternalServerError || statuses[1] != http.StatusServiceUnavailable {
+		t.Errorf("failing upstream then open circuit = %v, want [500 503]", statuses)
+	}
+}
+
+func TestRequestIDIsKeptAndForwarded(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"data":[]}`)
+	router, _, request := newGateway(t, ingestor.server.URL)
+
+	req := request(http.MethodGet, "/traffic", nil)
+	req.Header.Set(shared.HeaderRequestID, "client-req-42")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Header().Get(shared.HeaderRequestID) != "client-req-42" || ingestor.header.Get(shared.HeaderRequestID) != "client-req-42" {
+		t.Errorf("request ID returned %q, forwarded %q", rec.Header().Get(shared.HeaderRequestID), ingestor.header.Get(shared.HeaderRequestID))
+	}
+
+	req = request(http.MethodGet, "/traffic", nil)
+	req.Header.Set(shared.HeaderRequestID, "bad id\n")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if id := rec.Header().Get(shared.HeaderRequestID); id == "" || id == "bad id\n" {
+		t.Errorf("malformed request ID kept as %q", id)
+	}
+
+	// Errors raised by the gateway itself carry it as well
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/traffic", nil))
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), rec.Header().Get(shared.HeaderRequestID)) {
+		t.Errorf("unauthenticated GET /traffic = %d %s", rec.Code, rec.Body)
+	}
+}
+
+// countingUpstream answers 200 with the number of requests received so far
+func countingUpstream(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"calls":%d}`, atomic.AddInt32(&calls, 1))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestResponseCacheWithETags(t *testing.T) {
+	analytics, calls := countingUpstream(t)
+	cfg := testConfig()
+	cfg.AnalyticsServiceURL = analytics.URL
+	cfg.CacheRouteTTLs = map[string]string{"/analytics": "60"}
+	router, _ := newRouter(t, cfg)
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for name := range header {
+			req.Header.Set(name, header.Get(name))
+		}
+		if req.Header.Get("Authorization") == "" {
+			req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := get("/analytics?metric=speed&location_id=LOC001", nil)
+	if first.Code != http.StatusOK || first.Header().Get("X-Cache") != service.CacheMiss || first.Header().Get("ETag") == "" {
+		t.Fatalf("first GET = %d %v", first.Code, first.Header())
+	}
+
+	// The same query with its parameters in another order is a hit
+	second := get("/analytics?location_id=LOC001&metric=speed", nil)
+	if second.Header().Get("X-Cache") != service.CacheHit || second.Body.String() != first.Body.String() {
+		t.Errorf("second GET = %s %s", second.Header().Get("X-Cache"), second.Body)
+	}
+
+	notModified := get("/analytics?metric=speed&location_id=LOC001", http.Header{"If-None-Match": {first.Header().Get("ETag")}})
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Errorf("conditional GET = %d %s", notModified.Code, notModified.Body)
+	}
+
+	// Callers with other access do not share entries
+	token := signHS256(t, cfg.JWTSecret, claims("viewer-1", auth.RoleViewer))
+	if rec := get("/analytics?metric=speed&location_id=LOC001", http.Header{"Authorization": {"Bearer " + token}}); rec.Header().Get("X-Cache") != service.CacheMiss {
+		t.Errorf("GET as a viewer = %s, want a miss", rec.Header().Get("X-Cache"))
+	}
+
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("upstream called %d times, want 2", got)
+	}
+}
+
+func TestResponseCacheInvalidatedByAnalyticsResults(t *testing.T) {
+	analytics, _ := countingUpstream(t)
+	cfg := testConfig()
+	cfg.AnalyticsServiceURL = analytics.URL
+	cfg.CacheRouteTTLs = map[string]string{"/analytics": "60"}
+	router, _, responses := buildRouter(t, cfg, memory.NewRateLimiter())
+
+	broker := memory.NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	responses.StartInvalidation(ctx, broker.Consumer("analytics-results"), broker.Consumer("alerts"))
+
+	get := func(path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Header().Get("X-Cache")
+	}
+	for _, path := range []string{"/analytics/LOC001", "/analytics/LOC002", "/analytics"} {
+		get(path)
+		if got := get(path); got != service.CacheHit {
+			t.Fatalf("GET %s = %s, want a hit", path, got)
+		}
+	}
+
+	locationID := "LOC001"
+	result := &models.AnalyticsResult{LocationID: &locationID, MetricType: "average_speed", Value: 42}
+	err := broker.Producer("analytics-results", "analytics-processor").PublishEvent(context.Background(), locationID,
+		kafka.EventTypeAnalyticsResultStored, kafka.AnalyticsResultSchemaVersion, kafka.NewAnalyticsResultEvent(result))
+	if err != nil {
+		t.Fatalf("publishing result: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for get("/analytics/LOC001") != service.CacheMiss {
+		if time.Now().After(deadline) {
+			t.Fatal("LOC001 responses were not invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := get("/analytics"); got != service.CacheMiss {
+		t.Errorf("GET /analytics after a LOC001 result = %s, want a miss", got)
+	}
+	if got := get("/analytics/LOC002"); got != service.CacheHit {
+		t.Errorf("GET /analytics/LOC002 after a LOC001 result = %s, want a hit", got)
+	}
+}
+
+// The summary and the aggregates span every location: any new result makes
+// them miss, whatever location they were filtered by
+func TestResponseCacheInvalidatesAggregatesOnEveryResult(t *testing.T) {
+	analytics, _ := countingUpstream(t)
+	cfg := testConfig()
+	cfg.AnalyticsServiceURL = analytics.URL
+	cfg.CacheRouteTTLs = map[string]string{"/analytics": "60"}
+	router, _, responses := buildRouter(t, cfg, memory.NewRateLimiter())
+
+	broker := memory.NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	responses.StartInvalidation(ctx, broker.Consumer("analytics-results"), broker.Consumer("alerts"))
+
+	get := func(path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Header().Get("X-Cache")
+	}
+	paths := []string{
+		"/analytics/aggregate?metric_type=average_speed&group_by=location",
+		"/analytics/summary",
+		"/analytics/summary?location_id=LOC002",
+	}
+	for _, path := range paths {
+		get(path)
+		if got := get(path); got != service.CacheHit {
+			t.Fatalf("GET %s = %s, want a hit", path, got)
+		}
+	}
+
+	locationID := "LOC001"
+	result := &models.AnalyticsResult{LocationID: &locationID, MetricType: "average_speed", Value: 42}
+	err := broker.Producer("analytics-results", "analytics-processor").PublishEvent(context.Background(), locationID,
+		kafka.EventTypeAnalyticsResultStored, kafka.AnalyticsResultSchemaVersion, kafka.NewAnalyticsResultEvent(result))
+	if err != nil {
+		t.Fatalf("publishing result: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for get(paths[0]) != service.CacheMiss {
+		if time.Now().After(deadline) {
+			t.Fatal("the aggregates were not invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, path := range paths[1:] {
+		if got := get(path); got != service.CacheMiss {
+			t.Errorf("GET %s after a LOC001 result = %s, want a miss", path, got)
+		}
+	}
+}
+
+func TestResponseCacheInvalidatedByAlertChanges(t *testing.T) {
+	alerting, _ := countingUpstream(t)
+	analytics, _ := countingUpstream(t)
+	cfg := testConfig()
+	cfg.AlertingServiceURL = alerting.URL
+	cfg.AnalyticsServiceURL = analytics.URL
+	cfg.CacheRouteTTLs = map[string]string{"/alerts": "60", "/analytics": "60"}
+	router, _, responses := buildRouter(t, cfg, memory.NewRateLimiter())
+
+	broker := memory.NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	responses.StartInvalidation(ctx, broker.Consumer("analytics-results"), broker.Consumer("alerts"))
+
+	get := func(path string) string {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Header().Get("X-Cache")
+	}
+	for _, path := range []string{"/alerts/LOC001", "/alerts/LOC002", "/alerts", "/analytics/LOC001"} {
+		get(path)
+		if got := get(path); got != service.CacheHit {
+			t.Fatalf("GET %s = %s, want a hit", path, got)
+		}
+	}
+
+	// Acknowledged in the alerting-service
+	alert := &models.Alert{ID: 7, LocationID: shared.StringPtr("LOC001"), AlertType: models.AlertTypeCongestion,
+		Severity: models.SeverityHigh, Status: models.AlertStatusAcknowledged}
+	event := kafka.NewAlertEvent(alert, models.AlertStatusActive)
+	err := broker.Producer("alerts", "alerting-service").PublishEvent(context.Background(), event.Key(),
+		kafka.EventTypeAlertStatusChanged, kafka.AlertSchemaVersion, event)
+	if err != nil {
+		t.Fatalf("publishing alert: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for get("/alerts/LOC001") != service.CacheMiss {
+		if time.Now().After(deadline) {
+			t.Fatal("LOC001 alerts were not invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := get("/alerts"); got != service.CacheMiss {
+		t.Errorf("GET /alerts after a LOC001 alert = %s, want a miss", got)
+	}
+	for _, path := range []string{"/alerts/LOC002", "/analytics/LOC001"} {
+		if got := get(path); got != service.CacheHit {
+			t.Errorf("GET %s after a LOC001 alert = %s, want a hit", path, got)
+		}
+	}
+}
+
+func TestResponseCacheInvalidatesTrafficOfNewReadings(t *testing.T) {
+	ingestor, _ := countingUpstream(t)
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = ingestor.URL
+	cfg.CacheRouteTTLs = map[string]string{"/traffic": "60", "/series": "300"}
+	router, _, responses := buildRouter(t, cfg, memory.NewRateLimiter())
+
+	broker := memory.NewBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	responses.StartInvalidation(ctx, broker.Consumer("analytics-results"), broker.Consumer("alerts"))
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	get := func(path string) string {
+		return serve(http.MethodGet, path, "").Header().Get("X-Cache")
+	}
+	paths := []string{"/traffic/LOC001/latest", "/series/traffic?location_id=LOC001", "/traffic/LOC002"}
+	for _, path := range paths {
+		get(path)
+		if got := get(path); got != service.CacheHit {
+			t.Fatalf("GET %s = %s, want a hit", path, got)
+		}
+	}
+
+	locationID := "LOC001"
+	result := &models.AnalyticsResult{LocationID: &locationID, MetricType: "average_speed", Value: 42}
+	err := broker.Producer("analytics-results", "analytics-processor").PublishEvent(context.Background(), locationID,
+		kafka.EventTypeAnalyticsResultStored, kafka.AnalyticsResultSchemaVersion, kafka.NewAnalyticsResultEvent(result))
+	if err != nil {
+		t.Fatalf("publishing result: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for get(paths[0]) != service.CacheMiss {
+		if time.Now().After(deadline) {
+			t.Fatal("LOC001 traffic was not invalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := get(paths[1]); got != service.CacheMiss {
+		t.Errorf("GET %s after a LOC001 result = %s, want a miss", paths[1], got)
+	}
+	if got := get(paths[2]); got != service.CacheHit {
+		t.Errorf("GET %s after a LOC001 result = %s, want a hit", paths[2], got)
+	}
+
+	// A reading ingested through the gateway invalidates its location at once
+	if rec := serve(http.MethodPost, "/traffic", `{"location_id":"LOC002"}`); rec.Code != http.StatusOK {
+		t.Fatalf("POST /traffic = %d: %s", rec.Code, rec.Body)
+	}
+	if got := get(paths[2]); got != service.CacheMiss {
+		t.Errorf("GET %s after a LOC002 reading = %s, want a miss", paths[2], got)
+	}
+	if got := get(paths[0]); got != service.CacheHit {
+		t.Errorf("GET %s after a LOC002 reading = %s, want a hit", paths[0], got)
+	}
+}
+
+func TestResponseCacheServesStaleWhileRevalidating(t *testing.T) {
+	analytics, calls := countingUpstream(t)
+	cfg := testConfig()
+	cfg.AnalyticsServiceURL = analytics.URL
+	cfg.CacheRouteTTLs = map[string]string{"/analytics": "1"}
+	cfg.CacheStaleSeconds = 60
+	router, _ := newRouter(t, cfg)
+
+	get := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/analytics", nil)
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	get()
+	time.Sleep(1100 * time.Millisecond)
+	stale := get()
+	if stale.Header().Get("X-Cache") != service.CacheStale || stale.Body.String() != `{"calls":1}` {
+		t.Fatalf("expired entry = %s %s, want the stale response", stale.Header().Get("X-Cache"), stale.Body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := get()
+		if rec.Header().Get("X-Cache") == service.CacheHit && rec.Body.String() == `{"calls":2}` {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("entry not refreshed: %s %s", rec.Header().Get("X-Cache"), rec.Body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("upstream called %d times, want 2", got)
+	}
+}
+
+func TestHealthFansOutToUpstreams(t *testing.T) {
+	ready := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health/ready" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ready.Close)
+	notReady := newUpstream(t, http.StatusServiceUnavailable, `{"status":"unhealthy"}`)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	cfg := testConfig()
+	cfg.AnalyticsServiceURL = ready.URL
+	cfg.AlertingServiceURL = notReady.server.URL
+	cfg.TrafficIngestorURL = slow.URL
+	cfg.HealthTimeoutSeconds = 1
+	router, _ := newRouter(t, cfg)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("/health took %s with a 1s timeout per upstream", elapsed)
+	}
+
+	var response models.HealthCheckResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding /health: %v", err)
+	}
+	if rec.Code != http.StatusOK || response.Status != health.StatusDegraded || response.Version != shared.Version {
+		t.Errorf("/health = %d %+v", rec.Code, response)
+	}
+	expected := map[string]string{
+		"analytics": "healthy (",
+		"alerts":    "unhealthy: status 503 (",
+		"traffic":   "unhealthy: timed out (",
+	}
+	for upstream, prefix := range expected {
+		if !strings.HasPrefix(response.Services[upstream], prefix) {
+			t.Errorf("%s = %q, want %q...", upstream, response.Services[upstream], prefix)
+		}
+	}
+}
+
+func TestReadinessChecksDependencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	checker := health.NewChecker("api-gateway", 200*time.Millisecond).
+		Add("postgres", func(ctx context.Context) error { return nil }).
+		Add("redis", func(ctx context.Context) error { return fmt.Errorf("connection refused") }).
+		Add("kafka", func(ctx context.Context) error {
+			// A check that ignores ctx still times out
+			time.Sleep(2 * time.Second)
+			return nil
+		})
+	router := gin.New()
+	checker.Register(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/health/live = %d", rec.Code)
+	}
+
+	start := time.Now()
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("/health/ready took %s", elapsed)
+	}
+	var response models.HealthCheckResponse
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if rec.Code != http.StatusServiceUnavailable || response.Status != health.StatusUnhealthy ||
+		response.Services["postgres"] != health.StatusHealthy ||
+		response.Services["redis"] != "unhealthy: connection refused" ||
+		response.Services["kafka"] != "unhealthy: timed out" {
+		t.Errorf("/health/ready = %d %+v", rec.Code, response)
+	}
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	router, _ := newRouter(t, testConfig())
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("loading the contract: %v", err)
+	}
+
+	for _, route := range router.Routes() {
+		// OpenAPI has no CONNECT operations; Any registers it for /services
+		if route.Method == http.MethodConnect {
+			continue
+		}
+		if spec.Operation(route.Method, route.Path) == nil {
+			t.Errorf("%s %s is not documented in openapi.json", route.Method, route.Path)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, openapi.SpecPath, nil))
+	var document struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &document); rec.Code != http.StatusOK || err != nil || document.OpenAPI != "3.0.3" {
+		t.Errorf("%s = %d %q (%v)", openapi.SpecPath, rec.Code, document.OpenAPI, err)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, openapi.DocsPath, nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(rec.Body.String(), "openapi.json") {
+		t.Errorf("%s = %d %s", openapi.DocsPath, rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestOpenAPIValidationRejectsInvalidRequests(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"status":"ok"}`)
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = ingestor.server.URL
+	cfg.OpenAPIValidation = true
+	router, _ := newRouter(t, cfg)
+
+	send := func(method, path, contentType, body string) (*httptest.ResponseRecorder, models.ErrorResponse) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var response models.ErrorResponse
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec, response
+	}
+	problems := func(response models.ErrorResponse) string {
+		details, _ := response.Details.([]interface{})
+		return fmt.Sprint(details...)
+	}
+
+	// A partner guessing field names learns which ones are wrong
+	rec, response := send(http.MethodPost, "/traffic", "application/json",
+		`{"location_id":"LOC001","vehicles":12,"average_speed":"fast","congestion_level":"jammed","occupancy":140}`)
+	if rec.Code != http.StatusBadRequest || response.RequestID == "" {
+		t.Fatalf("invalid reading = %d %s", rec.Code, rec.Body)
+	}
+	for _, want := range []string{
+		`body: unknown field "vehicles"`,
+		`body.vehicle_count: is required`,
+		`body.average_speed: expected number, got string`,
+		`body.congestion_level: must be one of low, medium, high, severe`,
+		`body.occupancy: must be <= 100`,
+	} {
+		if !strings.Contains(problems(response), want) {
+			t.Errorf("details %s do not include %q", problems(response), want)
+		}
+	}
+	if ingestor.method != "" {
+		t.Errorf("invalid reading reached the ingestor: %s", ingestor.body)
+	}
+
+	valid := `{"location_id":"LOC001","timestamp":"2024-05-01T08:00:00Z","vehicle_count":12,"average_speed":41.5,"congestion_level":"medium"}`
+	if rec, _ := send(http.MethodPost, "/traffic", "application/json", valid); rec.Code != http.StatusOK || ingestor.body != valid {
+		t.Errorf("valid reading = %d, ingestor received %q", rec.Code, ingestor.body)
+	}
+
+	if rec, _ := send(http.MethodPost, "/traffic", "text/plain", valid); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain reading = %d, want 415", rec.Code)
+	}
+
+	rec, response = send(http.MethodGet, "/traffic?limit=5000&from=yesterday", "", "")
+	if rec.Code != http.StatusBadRequest ||
+		!strings.Contains(problems(response), "query.limit: must be <= 1000") ||
+		!strings.Contains(problems(response), "query.from: expected an RFC 3339 date-time") {
+		t.Errorf("invalid query = %d %s", rec.Code, problems(response))
+	}
+
+	if rec, _ := send(http.MethodPost, "/admin/api-keys/abc/revoke", "", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("non-integer key id = %d, want 400", rec.Code)
+	}
+}
+
+func TestOpenAPIValidationRunsAfterAuthentication(t *testing.T) {
+	ingestor := newUpstream(t, http.StatusOK, `{"status":"ok"}`)
+	cfg := testConfig()
+	cfg.TrafficIngestorURL = ingestor.server.URL
+	cfg.OpenAPIValidation = true
+	cfg.OpenAPIMaxBodyBytes = 1024
+	router, _ := newRouter(t, cfg)
+
+	send := func(method, path, credential, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if credential != "" {
+			req.Header.Set("Authorization", "Bearer "+credential)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Anonymous callers learn nothing about the contract
+	invalid := `{"location_id":"LOC001","vehicles":12}`
+	if rec := send(http.MethodPost, "/traffic", "", invalid); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous invalid reading = %d, want 401: %s", rec.Code, rec.Body)
+	}
+	if rec := send(http.MethodGet, "/traffic?limit=5000", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous invalid query = %d, want 401: %s", rec.Code, rec.Body)
+	}
+
+	// and the body is never read past the limit
+	oversized := `{"location_id":"LOC001","data_source":"` + strings.Repeat("x", 4096) + `"}`
+	if rec := send(http.MethodPost, "/traffic", "", oversized); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous oversized reading = %d, want 401", rec.Code)
+	}
+	if rec := send(http.MethodPost, "/traffic", cfg.APIKey, oversized); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized reading = %d, want 413: %s", rec.Code, rec.Body)
+	}
+	if ingestor.method != "" {
+		t.Errorf("a rejected reading reached the ingestor: %s", ingestor.body)
+	}
+
+	if rec := send(http.MethodPost, "/traffic", cfg.APIKey, invalid); rec.Code != http.StatusBadRequest {
+		t.Errorf("authenticated invalid reading = %d, want 400", rec.Code)
+	}
+}
+
+func TestOpenAPIValidationLogsInvalidResponses(t *testing.T) {
+	analytics := newUpstream(t, http.StatusOK, `{"data":"not a list","count":"one"}`)
+	cfg := testConfig()
+	cfg.AnalyticsServiceURL = analytics.server.URL
+	cfg.OpenAPIValidation = true
+	router, _ := newRouter(t, cfg)
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	req := httptest.NewRequest(http.MethodGet, "/analytics", nil)
+	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	// The response already went out: it is only reported
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /analytics = %d", rec.Code)
+	}
+	for _, want := range []string{"does not match the contract", "body.data: expected array, got string", "body.count: expected integer, got string"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs do not include %q:\n%s", want, logs.String())
+		}
+	}
+}
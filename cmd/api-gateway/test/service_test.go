@@ -1 +1,229 @@
-package test
\ No newline at end of file
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/cmd/api-gateway/internal/config"
+	"api-traffic-analytics/cmd/api-gateway/internal/service"
+	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/memory"
+	"api-traffic-analytics/internal/shared"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+const (
+	trafficTopic = "traffic-data"
+	alertsTopic  = "alerts"
+)
+
+// newStreams starts a StreamService fed by an in-memory broker. It is
+// stopped when the test ends.
+func newStreams(t *testing.T, cfg *config.Config) (*service.StreamService, *memory.Broker) {
+	t.Helper()
+
+	broker := memory.NewBroker()
+	streams := service.NewStreamService(cfg, broker.Consumer(trafficTopic), broker.Consumer(alertsTopic))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	streams.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		streams.Close()
+	})
+	return streams, broker
+}
+
+func testConfig() *config.Config {
+	return &config.Config{
+		APIKey:                  "test-key",
+		APIKeyRole:              "admin",
+		JWTSecret:               "test-jwt-secret",
+		RateLimitRequests:       100,
+		RateLimitDuration:       60,
+		RateLimitWriteRequests:  30,
+		RateLimitIngestRequests: 100,
+		RateLimitStreamRequests: 10,
+		StreamHeartbeatSeconds:  15,
+		StreamReplaySize:        10,
+		StreamConnectionBuffer:  10,
+	}
+}
+
+func publishReading(t *testing.T, broker *memory.Broker, locationID, city, congestion string) {
+	t.Helper()
+
+	data := &models.TrafficData{
+		ID:              1,
+		Timestamp:       time.Now().UTC(),
+		LocationID:      locationID,
+		VehicleCount:    50,
+		AverageSpeed:    40,
+		CongestionLevel: congestion,
+		Location:        models.Location{ID: locationID, City: city},
+	}
+	err := broker.Producer(trafficTopic, "traffic-ingestor").PublishEvent(context.Background(), locationID,
+		kafka.EventTypeTrafficRecorded, kafka.TrafficDataSchemaVersion, kafka.NewTrafficDataEvent(data))
+	if err != nil {
+		t.Fatalf("publishing reading: %v", err)
+	}
+}
+
+func receive(t *testing.T, events <-chan *service.StreamEvent) *service.StreamEvent {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+		return nil
+	}
+}
+
+func TestTrafficStreamFiltersByCity(t *testing.T) {
+	streams, broker := newStreams(t, testConfig())
+
+	sub, _ := streams.Traffic.Subscribe(service.StreamFilter{City: "madrid"}, "")
+	defer streams.Traffic.Unsubscribe(sub)
+
+	publishReading(t, broker, "LOC002", "Barcelona", models.CongestionLow)
+	publishReading(t, broker, "LOC001", "Madrid", models.CongestionHigh)
+
+	event := receive(t, sub.Events())
+	if event.Type != "traffic" || event.LocationID != "LOC001" || event.Severity != models.CongestionHigh {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestAlertStream(t *testing.T) {
+	streams, broker := newStreams(t, testConfig())
+
+	sub, _ := streams.Alerts.Subscribe(service.StreamFilter{Severities: map[string]bool{models.SeverityHigh: true}}, "")
+	defer streams.Alerts.Unsubscribe(sub)
+
+	alert := &models.Alert{ID: 7, LocationID: shared.StringPtr("LOC001"), AlertType: models.AlertTypeCongestion,
+		Severity: models.SeverityHigh, Status: models.AlertStatusActive, Location: &models.Location{City: "Madrid"}}
+	event := kafka.NewAlertEvent(alert, "")
+	err := broker.Producer(alertsTopic, "analytics-processor").PublishEvent(context.Background(), event.Key(),
+		kafka.EventTypeAlertStatusChanged, kafka.AlertSchemaVersion, event)
+	if err != nil {
+		t.Fatalf("publishing alert: %v", err)
+	}
+
+	received := receive(t, sub.Events())
+	if received.Type != "alert" || received.City != "Madrid" || received.LocationID != "LOC001" {
+		t.Errorf("event = %+v", received)
+	}
+}
+
+// proxyConfig is testConfig pointing every upstream at url, without backoff
+func proxyConfig(url string) *config.Config {
+	cfg := testConfig()
+	cfg.TrafficIngestorURL, cfg.AnalyticsServiceURL, cfg.AlertingServiceURL = url, url, url
+	cfg.ProxyTimeoutSeconds = 5
+	cfg.ProxyRetries = 2
+	cfg.ProxyBreakerFailureThreshold = 5
+	cfg.ProxyBreakerOpenSeconds = 30
+	return cfg
+}
+
+// failingUpstream answers status to the first failures requests and 200
+// afterwards, counting the requests it receives
+func failingUpstream(t *testing.T, status, failures int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(atomic.AddInt32(&calls, 1)) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		io.WriteString(w, `{"status":"ok"}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestProxyRetriesOnlyIdempotentRequests(t *testing.T) {
+	server, calls := failingUpstream(t, http.StatusServiceUnavailable, 2)
+	proxy := service.NewProxyService(proxyConfig(server.URL))
+
+	resp, err := proxy.ProxyToService(context.Background(), "analytics", http.MethodGet, "/analytics", nil)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(calls) != 3 {
+		t.Errorf("GET = %d after %d calls, want 200 after 3", resp.StatusCode, atomic.LoadInt32(calls))
+	}
+
+	server, calls = failingUpstream(t, http.StatusServiceUnavailable, 2)
+	proxy = service.NewProxyService(proxyConfig(server.URL))
+
+	resp, err = proxy.ProxyToService(context.Background(), "alerts", http.MethodPost, "/alerts/1/acknowledge", nil)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(calls) != 1 {
+		t.Errorf("POST = %d after %d calls, want 503 after 1", resp.StatusCode, atomic.LoadInt32(calls))
+	}
+}
+
+func TestProxyCircuitBreakerOpens(t *testing.T) {
+	server, calls := failingUpstream(t, http.StatusInternalServerError, 100)
+	cfg := proxyConfig(server.URL)
+	cfg.ProxyBreakerFailureThreshold = 3
+	proxy := service.NewProxyService(cfg)
+
+	for i := 0; i < 3; i++ {
+		resp, err := proxy.ProxyToService(context.Background(), "analytics", http.MethodGet, "/analytics", nil)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		resp.Body.Close()
+	}
+	if got := proxy.CircuitStates()["analytics"]; got != service.CircuitOpen {
+		t.Fatalf("analytics circuit = %s, want open", got)
+	}
+
+	_, err := proxy.ProxyToService(context.Background(), "analytics", http.MethodGet, "/analytics", nil)
+	if !errors.Is(err, service.ErrCircuitOpen) || atomic.LoadInt32(calls) != 3 {
+		t.Errorf("request with open circuit = %v after %d calls", err, atomic.LoadInt32(calls))
+	}
+	// Other upstreams have their own breaker
+	if got := proxy.CircuitStates()["alerts"]; got != service.CircuitClosed {
+		t.Errorf("alerts circuit = %s, want closed", got)
+	}
+}
+
+func TestProxyRouteTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := proxyConfig(server.URL)
+	cfg.ProxyRetries = 0
+	cfg.ProxyRouteTimeouts = map[string]int{"/analytics": 1}
+	proxy := service.NewProxyService(cfg)
+
+	start := time.Now()
+	_, err := proxy.ProxyToService(context.Background(), "analytics", http.MethodGet, "/analytics/LOC001", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow upstream = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("request took %s with a 1s route timeout", elapsed)
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	// Number of monthly partitions kept ready ahead of the current month
+	PartitionMonthsAhead int
+	// Retention used when the configurations table has no value
+	DefaultRetentionMonths int
+	DefaultRetentionAction string
+	// How often "run -loop" repeats the maintenance tasks
+	Interval time.Duration
+
+	// Whether "run" archives closed partitions before applying retention
+	ArchiveEnabled bool
+	// Local directory archives are written to when no S3 bucket is set
+	ArchiveDir string
+	// Key prefix of the archives inside the store
+	ArchivePrefix string
+	// Format of the data files: "parquet" or "ndjson.gz"
+	ArchiveFormat string
+	// Rows per archive data file
+	ArchiveRowsPerFile int
+	// S3-compatible store; used instead of ArchiveDir when the bucket is set
+	ArchiveS3Endpoint  string
+	ArchiveS3Bucket    string
+	ArchiveS3Region    string
+	ArchiveS3AccessKey string
+	ArchiveS3SecretKey string
+}
+
+func Load() *Config {
+	return &Config{
+		PartitionMonthsAhead:   getIntEnv("PARTITION_MONTHS_AHEAD", 3),
+		DefaultRetentionMonths: getIntEnv("RETENTION_TRAFFIC_DATA_MONTHS", 12),
+		DefaultRetentionAction: getEnv("RETENTION_TRAFFIC_DATA_ACTION", "archive"),
+		Interval:               time.Duration(getIntEnv("MAINTENANCE_INTERVAL_HOURS", 24)) * time.Hour,
+		ArchiveEnabled:         getEnv("ARCHIVE_ENABLED", "false") == "true",
+		ArchiveDir:             getEnv("ARCHIVE_DIR", "archive"),
+		ArchivePrefix:          getEnv("ARCHIVE_PREFIX", ""),
+		ArchiveFormat:          getEnv("ARCHIVE_FORMAT", "parquet"),
+		ArchiveRowsPerFile:     getIntEnv("ARCHIVE_ROWS_PER_FILE", 1000000),
+		ArchiveS3Endpoint:      getEnv("ARCHIVE_S3_ENDPOINT", "https://s3.amazonaws.com"),
+		ArchiveS3Bucket:        getEnv("ARCHIVE_S3_BUCKET", ""),
+		ArchiveS3Region:        getEnv("ARCHIVE_S3_REGION", "us-east-1"),
+		ArchiveS3AccessKey:     getEnv("ARCHIVE_S3_ACCESS_KEY", ""),
+		ArchiveS3SecretKey:     getEnv("ARCHIVE_S3_SECRET_KEY", ""),
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		res, err := strconv.Atoi(value)
+		if err == nil {
+			return res
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/archive"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// Rows inserted per statement when restoring an archive
+const restoreBatchSize = 1000
+
+// ArchiveClosed exports every closed traffic_data partition that has no
+// archive yet, including the ones retention already moved to the archive
+// schema. A partition is closed once its month is over.
+func (s *Service) ArchiveClosed(ctx context.Context) error {
+	currentMonth := time.Now().UTC()
+	currentMonth = time.Date(currentMonth.Year(), currentMonth.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	attached, err := s.partitions.List(ctx, trafficDataTable)
+	if err != nil {
+		return err
+	}
+	archived, err := s.partitions.ListArchived(ctx, trafficDataTable)
+	if err != nil {
+		return err
+	}
+
+	sources := make([]postgres.ExportSource, 0, len(attached)+len(archived))
+	for _, p := range attached {
+		if p.To.After(currentMonth) {
+			continue
+		}
+		sources = append(sources, postgres.ExportSource{Table: p.Name})
+	}
+	for _, p := range archived {
+		sources = append(sources, postgres.ExportSource{Schema: postgres.ArchiveSchema, Table: p.Name})
+	}
+
+	exported := 0
+	for _, src := range sources {
+		exists, err := s.archiver.Exists(ctx, src.Table)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if err := s.export(ctx, src.Table, src); err != nil {
+			return err
+		}
+		exported++
+	}
+	if exported == 0 {
+		log.Printf("every closed %s partition is archived", trafficDataTable)
+	}
+	return nil
+}
+
+// ArchivePartition exports one traffic_data partition, attached or in the
+// archive schema, replacing any previous archive of it
+func (s *Service) ArchivePartition(ctx context.Context, name string) error {
+	if !strings.HasPrefix(name, trafficDataTable+"_y") {
+		return fmt.Errorf("%s is not a monthly %s partition", name, trafficDataTable)
+	}
+
+	archived, err := s.partitions.ListArchived(ctx, trafficDataTable)
+	if err != nil {
+		return err
+	}
+	src := postgres.ExportSource{Table: name}
+	for _, p := range archived {
+		if p.Name == name {
+			src.Schema = postgres.ArchiveSchema
+		}
+	}
+	return s.export(ctx, name, src)
+}
+
+// ArchiveDays exports the readings of the days from first to last, both
+// included, whatever partitions hold them
+func (s *Service) ArchiveDays(ctx context.Context, first, last time.Time) error {
+	if last.Before(first) {
+		return fmt.Errorf("last day %s is before first day %s", last.Format("2006-01-02"), first.Format("2006-01-02"))
+	}
+	name := fmt.Sprintf("%s_d%s-%s", trafficDataTable, first.Format("20060102"), last.Format("20060102"))
+	return s.export(ctx, name, postgres.ExportSource{
+		Table: trafficDataTable,
+		From:  first,
+		To:    last.AddDate(0, 0, 1),
+	})
+}
+
+// Restore loads an archive into a new staging table. The table is named
+// restore_<archive> unless table is given, and must not exist.
+func (s *Service) Restore(ctx context.Context, name, table string) error {
+	if table == "" {
+		table = "restore_" + strings.ReplaceAll(name, "-", "_")
+	}
+
+	var manifest *archive.Manifest
+	err := s.traffic.LoadStaging(ctx, table, func(insert func([]*models.TrafficData) error) error {
+		var err error
+		manifest, err = s.archiver.Restore(ctx, name, restoreBatchSize, insert)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("restored %d rows of %s into %s", manifest.Rows, name, table)
+	return nil
+}
+
+func (s *Service) export(ctx context.Context, name string, src postgres.ExportSource) error {
+	spec := archive.Manifest{Name: name, Table: trafficDataTable, From: src.From, To: src.To}
+	if spec.From.IsZero() {
+		if from, err := time.Parse("2006m01", strings.TrimPrefix(name, trafficDataTable+"_y")); err == nil {
+			spec.From, spec.To = from, from.AddDate(0, 1, 0)
+		}
+	}
+
+	manifest, err := s.archiver.Export(ctx, spec, func(emit func(*models.TrafficData) error) error {
+		return s.traffic.Export(ctx, src, emit)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("archived %d rows of %s in %d files", manifest.Rows, name, len(manifest.Files))
+	return nil
+}
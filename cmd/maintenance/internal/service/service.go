@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"api-traffic-analytics/cmd/maintenance/internal/config"
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/pkg/archive"
+)
+
+// Partitioned tables managed by the maintenance command
+const trafficDataTable = "traffic_data"
+
+// Keys of the retention settings in the configurations table
+const (
+	retentionMonthsKey = "retention.traffic_data_months"
+	retentionActionKey = "retention.traffic_data_action"
+)
+
+type Service struct {
+	partitions interfaces.PartitionManager
+	configs    interfaces.ConfigurationRepository
+	traffic    interfaces.TrafficArchiveRepository
+	archiver   *archive.Archiver
+	cfg        *config.Config
+}
+
+func NewService(partitions interfaces.PartitionManager, configs interfaces.ConfigurationRepository, traffic interfaces.TrafficArchiveRepository, archiver *archive.Archiver, cfg *config.Config) *Service {
+	return &Service{partitions: partitions, configs: configs, traffic: traffic, archiver: archiver, cfg: cfg}
+}
+
+// EnsurePartitions creates the traffic_data partitions of the current month
+// and of the configured number of months ahead
+func (s *Service) EnsurePartitions(ctx context.Context) error {
+	created, err := s.partitions.EnsureMonthly(ctx, trafficDataTable, time.Now(), s.cfg.PartitionMonthsAhead)
+	for _, name := range created {
+		log.Printf("created partition %s", name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(created) == 0 {
+		log.Printf("%s partitions are up to date", trafficDataTable)
+	}
+	return nil
+}
+
+// ApplyRetention retires the traffic_data partitions older than the retention
+// window read from the configurations table
+func (s *Service) ApplyRetention(ctx context.Context) error {
+	months, err := s.configs.GetInt(ctx, retentionMonthsKey, s.cfg.DefaultRetentionMonths)
+	if err != nil {
+		return err
+	}
+	action, err := s.configs.GetString(ctx, retentionActionKey, s.cfg.DefaultRetentionAction)
+	if err != nil {
+		return err
+	}
+
+	retired, err := s.partitions.Retire(ctx, trafficDataTable, time.Now(), months, action)
+	for _, name := range retired {
+		log.Printf("retired partition %s (%s)", name, action)
+	}
+	if err != nil {
+		return err
+	}
+	if len(retired) == 0 {
+		log.Printf("no %s partitions older than %d months", trafficDataTable, months)
+	}
+	return nil
+}
+
+// Run creates upcoming partitions, archives the closed ones when archiving is
+// enabled, and then applies the retention policy
+func (s *Service) Run(ctx context.Context) error {
+	if err := s.EnsurePartitions(ctx); err != nil {
+		return err
+	}
+	if s.cfg.ArchiveEnabled {
+		if err := s.ArchiveClosed(ctx); err != nil {
+			return err
+		}
+	}
+	return s.ApplyRetention(ctx)
+}
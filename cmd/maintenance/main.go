@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"api-traffic-analytics/cmd/maintenance/internal/config"
+	"api-traffic-analytics/cmd/maintenance/internal/service"
+	"api-traffic-analytics/internal/pkg/archive"
+	"api-traffic-analytics/internal/pkg/migrate"
+	"api-traffic-analytics/internal/pkg/postgres"
+)
+
+const usage = `Usage: maintenance <command> [flags]
+
+Commands:
+  partitions   create the traffic_data partitions for the coming months
+  retention    detach and drop or archive partitions past the retention window
+  run          partitions, archive (when ARCHIVE_ENABLED) and retention
+  archive      export traffic_data to compressed NDJSON files with a manifest;
+               every closed partition not archived yet unless -partition or
+               -from/-to is given
+  restore      load an archive into a staging table
+  migrate      manage the database schema:
+                 up             apply every pending migration
+                 down [n]       roll back the last n migrations (default 1)
+                 status         list the migrations and when they were applied
+                 baseline <v>   mark migrations up to v as applied without running them
+
+Flags:
+  -loop        keep running, repeating the command every MAINTENANCE_INTERVAL_HOURS
+  -partition   archive: partition to export, e.g. traffic_data_y2024m01
+  -from, -to   archive: first and last day (YYYY-MM-DD) to export
+  -archive     restore: name of the archive to load
+  -table       restore: staging table to create (default restore_<archive>)
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	if command == "migrate" {
+		db, err := postgres.ConnectDB()
+		if err != nil {
+			log.Fatalf("Unable to connect to database: %v\n", err)
+		}
+		if err := migrate.Command(context.Background(), db, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("migrate failed: %v", err)
+		}
+		return
+	}
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	loop := flags.Bool("loop", false, "repeat the command every MAINTENANCE_INTERVAL_HOURS")
+	partition := flags.String("partition", "", "partition to archive")
+	from := flags.String("from", "", "first day to archive (YYYY-MM-DD)")
+	to := flags.String("to", "", "last day to archive (YYYY-MM-DD)")
+	archiveName := flags.String("archive", "", "archive to restore")
+	table := flags.String("table", "", "staging table to restore into")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flags.Parse(os.Args[2:])
+
+	cfg := config.Load()
+
+	db, err := postgres.ConnectDB()
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %v\n", err)
+	}
+
+	archiver, err := newArchiver(cfg)
+	if err != nil {
+		log.Fatalf("Unable to configure archive store: %v\n", err)
+	}
+
+	svc := service.NewService(
+		postgres.NewPartitionManager(db),
+		postgres.NewConfigurationRepository(db),
+		postgres.NewTrafficDataRepository(db),
+		archiver,
+		cfg,
+	)
+
+	var task func(context.Context) error
+	switch command {
+	case "partitions":
+		task = svc.EnsurePartitions
+	case "retention":
+		task = svc.ApplyRetention
+	case "run":
+		task = svc.Run
+	case "archive":
+		task, err = archiveTask(svc, *partition, *from, *to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n\n%s", err, usage)
+			os.Exit(2)
+		}
+	case "restore":
+		if *archiveName == "" {
+			fmt.Fprintf(os.Stderr, "restore needs -archive\n\n%s", usage)
+			os.Exit(2)
+		}
+		task = func(ctx context.Context) error { return svc.Restore(ctx, *archiveName, *table) }
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if !*loop {
+		if err := task(ctx); err != nil {
+			log.Fatalf("%s failed: %v", command, err)
+		}
+		return
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := task(ctx); err != nil {
+			log.Printf("%s failed: %v", command, err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("Maintenance exiting")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newArchiver writes archives to the S3 bucket when one is configured and to
+// the local archive directory otherwise
+func newArchiver(cfg *config.Config) (*archive.Archiver, error) {
+	var store archive.Store = archive.NewLocalStore(cfg.ArchiveDir)
+	if cfg.ArchiveS3Bucket != "" {
+		s3, err := archive.NewS3Store(cfg.ArchiveS3Endpoint, cfg.ArchiveS3Bucket, cfg.ArchiveS3Region,
+			cfg.ArchiveS3AccessKey, cfg.ArchiveS3SecretKey)
+		if err != nil {
+			return nil, err
+		}
+		store = s3
+	}
+	return archive.NewArchiver(store, cfg.ArchivePrefix, cfg.ArchiveFormat, int64(cfg.ArchiveRowsPerFile))
+}
+
+// archiveTask picks what "archive" exports from its flags
+func archiveTask(svc *service.Service, partition, from, to string) (func(context.Context) error, error) {
+	switch {
+	case partition != "" && (from != "" || to != ""):
+		return nil, fmt.Errorf("use either -partition or -from/-to")
+	case partition != "":
+		return func(ctx context.Context) error { return svc.ArchivePartition(ctx, partition) }, nil
+	case from != "" || to != "":
+		if from == "" || to == "" {
+			return nil, fmt.Errorf("-from and -to go together")
+		}
+		first, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -from %q", from)
+		}
+		last, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -to %q", to)
+		}
+		return func(ctx context.Context) error { return svc.ArchiveDays(ctx, first, last) }, nil
+	default:
+		return svc.ArchiveClosed, nil
+	}
+}
@@ -0,0 +1,311 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/cmd/maintenance/internal/config"
+	"api-traffic-analytics/cmd/maintenance/internal/service"
+	"api-traffic-analytics/internal/pkg/archive"
+	"api-traffic-analytics/internal/pkg/memory"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+const trafficTable = "traffic_data"
+
+// maintenance is a maintenance service wired to the in-memory fakes and an
+// archive directory
+type maintenance struct {
+	svc        *service.Service
+	partitions *memory.PartitionManager
+	configs    *memory.ConfigurationRepository
+	traffic    *memory.TrafficDataRepository
+	archiver   *archive.Archiver
+	dir        string
+}
+
+func newMaintenance(t *testing.T) *maintenance {
+	t.Helper()
+
+	store := memory.NewStore()
+	if err := memory.NewLocationRepository(store).Create(context.Background(), &models.Location{ID: "LOC001", Name: "Gran Via", City: "Madrid", IsActive: true}); err != nil {
+		t.Fatalf("creating location: %v", err)
+	}
+
+	m := &maintenance{
+		partitions: memory.NewPartitionManager(store),
+		configs:    memory.NewConfigurationRepository(store),
+		traffic:    memory.NewTrafficDataRepository(store),
+		dir:        t.TempDir(),
+	}
+	archiver, err := archive.NewArchiver(archive.NewLocalStore(m.dir), "", archive.FormatParquet, 2)
+	if err != nil {
+		t.Fatalf("creating archiver: %v", err)
+	}
+	m.archiver = archiver
+	m.svc = service.NewService(m.partitions, m.configs, m.traffic, m.archiver, &config.Config{
+		PartitionMonthsAhead:   1,
+		DefaultRetentionMonths: 12,
+		DefaultRetentionAction: postgres.RetentionArchive,
+		ArchiveEnabled:         true,
+	})
+	return m
+}
+
+// record stores a reading taken at ts
+func (m *maintenance) record(t *testing.T, ts time.Time) {
+	t.Helper()
+
+	data := &models.TrafficData{LocationID: "LOC001", Timestamp: ts, VehicleCount: 10, CongestionLevel: models.CongestionLow}
+	if _, err := m.traffic.Create(context.Background(), data); err != nil {
+		t.Fatalf("recording reading: %v", err)
+	}
+}
+
+func (m *maintenance) manifest(t *testing.T, name string) *archive.Manifest {
+	t.Helper()
+
+	manifest, err := m.archiver.ReadManifest(context.Background(), name)
+	if err != nil {
+		t.Fatalf("reading manifest of %s: %v", name, err)
+	}
+	return manifest
+}
+
+func currentMonth() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestArchiveClosedSkipsArchivedAndOpenPartitions(t *testing.T) {
+	m := newMaintenance(t)
+	ctx := context.Background()
+	current := currentMonth()
+
+	// Partitions from three months ago to next month, two readings in each
+	if _, err := m.partitions.EnsureMonthly(ctx, trafficTable, current.AddDate(0, -3, 0), 4); err != nil {
+		t.Fatalf("EnsureMonthly: %v", err)
+	}
+	for i := -3; i <= 1; i++ {
+		month := current.AddDate(0, i, 0)
+		m.record(t, month.Add(time.Hour))
+		m.record(t, month.Add(48*time.Hour))
+	}
+	// Retention moves the oldest one to the archive schema
+	if _, err := m.partitions.Retire(ctx, trafficTable, time.Now(), 2, postgres.RetentionArchive); err != nil {
+		t.Fatalf("Retire: %v", err)
+	}
+
+	lastMonth := postgres.PartitionName(trafficTable, current.AddDate(0, -1, 0))
+	if err := m.svc.ArchivePartition(ctx, lastMonth); err != nil {
+		t.Fatalf("ArchivePartition: %v", err)
+	}
+	before := m.manifest(t, lastMonth)
+	m.record(t, current.AddDate(0, -1, 0).Add(72*time.Hour))
+
+	if err := m.svc.ArchiveClosed(ctx); err != nil {
+		t.Fatalf("ArchiveClosed: %v", err)
+	}
+
+	for _, offset := range []int{-3, -2} {
+		name := postgres.PartitionName(trafficTable, current.AddDate(0, offset, 0))
+		manifest := m.manifest(t, name)
+		if manifest.Rows != 2 {
+			t.Errorf("%s archived with %d rows, want 2", name, manifest.Rows)
+		}
+		if from := current.AddDate(0, offset, 0); !manifest.From.Equal(from) || !manifest.To.Equal(from.AddDate(0, 1, 0)) {
+			t.Errorf("%s archived as [%s, %s)", name, manifest.From, manifest.To)
+		}
+	}
+
+	after := m.manifest(t, lastMonth)
+	if after.Rows != 2 || !after.CreatedAt.Equal(before.CreatedAt) {
+		t.Errorf("already archived %s was exported again: %d rows created at %s", lastMonth, after.Rows, after.CreatedAt)
+	}
+
+	for _, offset := range []int{0, 1} {
+		name := postgres.PartitionName(trafficTable, current.AddDate(0, offset, 0))
+		if exists, err := m.archiver.Exists(ctx, name); err != nil || exists {
+			t.Errorf("open partition %s archived: %v, %v", name, exists, err)
+		}
+	}
+}
+
+func TestRetentionRetiresReadingsWithoutAPartition(t *testing.T) {
+	m := newMaintenance(t)
+	ctx := context.Background()
+	current := currentMonth()
+
+	// Only this month has a partition, older readings sit in the default one
+	if _, err := m.partitions.EnsureMonthly(ctx, trafficTable, current, 0); err != nil {
+		t.Fatalf("EnsureMonthly: %v", err)
+	}
+	m.record(t, current.AddDate(0, -5, 0).Add(time.Hour))
+	m.record(t, current.AddDate(0, -4, 0).Add(time.Hour))
+	m.record(t, current.AddDate(0, -4, 0).Add(48*time.Hour))
+	m.record(t, current.AddDate(0, -1, 0).Add(time.Hour))
+
+	retired, err := m.partitions.Retire(ctx, trafficTable, time.Now(), 3, postgres.RetentionArchive)
+	if err != nil {
+		t.Fatalf("Retire: %v", err)
+	}
+	want := []string{
+		postgres.PartitionName(trafficTable, current.AddDate(0, -5, 0)),
+		postgres.PartitionName(trafficTable, current.AddDate(0, -4, 0)),
+	}
+	if len(retired) != 2 || retired[0] != want[0] || retired[1] != want[1] {
+		t.Fatalf("retired %v, want %v", retired, want)
+	}
+
+	if err := m.svc.ArchiveClosed(ctx); err != nil {
+		t.Fatalf("ArchiveClosed: %v", err)
+	}
+	if manifest := m.manifest(t, want[1]); manifest.Rows != 2 {
+		t.Errorf("%s archived with %d rows, want 2", want[1], manifest.Rows)
+	}
+
+	rows, _, err := m.traffic.Query(ctx, postgres.TrafficDataFilter{LocationID: "LOC001", Limit: 10})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Errorf("traffic kept %d readings, want only last month's", len(rows))
+	}
+}
+
+func TestArchivePartitionRejectsOtherTables(t *testing.T) {
+	m := newMaintenance(t)
+
+	for _, name := range []string{"traffic_data", "analytics_results_y2024m01", "restore_traffic_data_y2024m01"} {
+		if err := m.svc.ArchivePartition(context.Background(), name); err == nil {
+			t.Errorf("ArchivePartition(%s) succeeded", name)
+		}
+	}
+}
+
+func TestArchiveDaysExportsWholeDays(t *testing.T) {
+	m := newMaintenance(t)
+	ctx := context.Background()
+	first := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	m.record(t, first.Add(-time.Second))
+	m.record(t, first)
+	m.record(t, first.Add(36*time.Hour))
+	m.record(t, first.Add(48*time.Hour-time.Second))
+	m.record(t, first.Add(48*time.Hour))
+
+	if err := m.svc.ArchiveDays(ctx, first, first.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("ArchiveDays: %v", err)
+	}
+
+	manifest := m.manifest(t, "traffic_data_d20240110-20240111")
+	if manifest.Rows != 3 {
+		t.Errorf("archived %d rows, want the 3 of Jan 10 and 11", manifest.Rows)
+	}
+	if !manifest.From.Equal(first) || !manifest.To.Equal(first.AddDate(0, 0, 2)) {
+		t.Errorf("archive covers [%s, %s)", manifest.From, manifest.To)
+	}
+
+	if err := m.svc.ArchiveDays(ctx, first, first.AddDate(0, 0, -1)); err == nil {
+		t.Error("ArchiveDays accepted a last day before the first")
+	}
+}
+
+func TestRestoreLoadsTheArchiveIntoAStagingTable(t *testing.T) {
+	m := newMaintenance(t)
+	ctx := context.Background()
+	first := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		m.record(t, first.Add(time.Duration(i)*time.Hour))
+	}
+	if err := m.svc.ArchiveDays(ctx, first, first); err != nil {
+		t.Fatalf("ArchiveDays: %v", err)
+	}
+
+	if err := m.svc.Restore(ctx, "traffic_data_d20240110-20240110", ""); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	rows := m.traffic.Staging("restore_traffic_data_d20240110_20240110")
+	if len(rows) != 5 {
+		t.Fatalf("staging table has %d rows, want 5", len(rows))
+	}
+	for i, row := range rows {
+		if want := first.Add(time.Duration(i) * time.Hour); !row.Timestamp.Equal(want) || row.LocationID != "LOC001" {
+			t.Errorf("row %d = %+v, want the reading of %s", i, row, want)
+		}
+	}
+
+	if err := m.svc.Restore(ctx, "traffic_data_d20240110-20240110", ""); err == nil {
+		t.Error("Restore into an existing table succeeded")
+	}
+	if err := m.svc.Restore(ctx, "traffic_data_d20240110-20240110", "jan10"); err != nil {
+		t.Errorf("Restore into a named table: %v", err)
+	} else if rows := m.traffic.Staging("jan10"); len(rows) != 5 {
+		t.Errorf("jan10 has %d rows, want 5", len(rows))
+	}
+}
+
+func TestRestoreRejectsACorruptArchive(t *testing.T) {
+	m := newMaintenance(t)
+	ctx := context.Background()
+	first := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		m.record(t, first.Add(time.Duration(i)*time.Hour))
+	}
+	if err := m.svc.ArchiveDays(ctx, first, first); err != nil {
+		t.Fatalf("ArchiveDays: %v", err)
+	}
+
+	// Replace the last file with the first one: valid data, wrong checksum
+	name := "traffic_data_d20240110-20240110"
+	manifest := m.manifest(t, name)
+	firstFile, err := os.ReadFile(filepath.Join(m.dir, name, manifest.Files[0].Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(m.dir, name, manifest.Files[len(manifest.Files)-1].Key), firstFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.svc.Restore(ctx, name, "corrupt")
+	if !errors.Is(err, archive.ErrChecksumMismatch) {
+		t.Errorf("Restore of a corrupt archive: got %v, want ErrChecksumMismatch", err)
+	}
+	if rows := m.traffic.Staging("corrupt"); rows != nil {
+		t.Errorf("staging table kept %d rows of a failed restore", len(rows))
+	}
+}
+
+func TestRunAppliesTheConfiguredRetention(t *testing.T) {
+	m := newMaintenance(t)
+	ctx := context.Background()
+	current := currentMonth()
+
+	if _, err := m.partitions.EnsureMonthly(ctx, trafficTable, current.AddDate(0, -4, 0), 0); err != nil {
+		t.Fatalf("EnsureMonthly: %v", err)
+	}
+	m.record(t, current.AddDate(0, -4, 0).Add(time.Hour))
+	m.configs.Set("retention.traffic_data_months", "3")
+
+	if err := m.svc.Run(ctx); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	old := postgres.PartitionName(trafficTable, current.AddDate(0, -4, 0))
+	if manifest := m.manifest(t, old); manifest.Rows != 1 {
+		t.Errorf("%s archived with %d rows before retention, want 1", old, manifest.Rows)
+	}
+	archived, _ := m.partitions.ListArchived(ctx, trafficTable)
+	if len(archived) != 1 || archived[0].Name != old {
+		t.Errorf("archived partitions = %+v, want %s", archived, old)
+	}
+	attached, _ := m.partitions.List(ctx, trafficTable)
+	if len(attached) != 2 {
+		t.Errorf("attached partitions = %+v, want this month and the next", attached)
+	}
+}
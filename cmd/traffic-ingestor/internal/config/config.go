@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	Port             string
+	KafkaBrokers     []string
+	KafkaTopic       string
+	LocationCacheTTL time.Duration
+}
+
+func Load() *Config {
+	return &Config{
+		Port:             getEnv("SERVICE_PORT", "8080"),
+		KafkaBrokers:     []string{getEnv("KAFKA_BROKER", "kafka:9092")},
+		KafkaTopic:       getEnv("KAFKA_TOPIC_TRAFFIC", "traffic-data"),
+		LocationCacheTTL: time.Duration(getIntEnv("CACHE_TTL_DEFAULT", 300)) * time.Second,
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		res, err := strconv.Atoi(value)
+		if err == nil {
+			return res
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Default number of locations returned by GET /locations/search/nearest
+const defaultNearest = 10
+
+// geoJSONPolygon is the body of POST /locations/search/polygon
+type geoJSONPolygon struct {
+	Type        string        `json:"type" binding:"required"`
+	Coordinates [][][]float64 `json:"coordinates" binding:"required"`
+}
+
+// SearchLocationsByRadius handles GET /locations/search/radius?lat=&lon=&radius=
+// (radius in meters)
+func (h *Handler) SearchLocationsByRadius(c *gin.Context) {
+	opts, err := parseGeoOptions(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	center, err := parsePoint(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	radius, err := strconv.ParseFloat(c.Query("radius"), 64)
+	if err != nil {
+		badRequest(c, "radius is required and must be a number of meters")
+		return
+	}
+
+	locations, err := h.svc.LocationsWithinRadius(c.Request.Context(), center, radius, opts)
+	h.writeLocations(c, locations, err)
+}
+
+// SearchNearestLocations handles GET /locations/search/nearest?lat=&lon=&k=
+func (h *Handler) SearchNearestLocations(c *gin.Context) {
+	opts, err := parseGeoOptions(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	center, err := parsePoint(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	k := defaultNearest
+	if raw := c.Query("k"); raw != "" {
+		if k, err = strconv.Atoi(raw); err != nil {
+			badRequest(c, "k must be an integer")
+			return
+		}
+	}
+
+	locations, err := h.svc.NearestLocations(c.Request.Context(), center, k, opts)
+	h.writeLocations(c, locations, err)
+}
+
+// SearchLocationsByBoundingBox handles GET /locations/search/bbox?bbox=minLon,minLat,maxLon,maxLat
+// (GeoJSON order; minLon > maxLon crosses the antimeridian)
+func (h *Handler) SearchLocationsByBoundingBox(c *gin.Context) {
+	opts, err := parseGeoOptions(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	box, err := parseBoundingBox(c.Query("bbox"))
+	if err != nil || box == nil {
+		badRequest(c, "bbox must be minLon,minLat,maxLon,maxLat")
+		return
+	}
+
+	locations, err := h.svc.LocationsWithinBoundingBox(c.Request.Context(), *box, opts)
+	h.writeLocations(c, locations, err)
+}
+
+// SearchLocationsByPolygon handles POST /locations/search/polygon with a
+// GeoJSON Polygon geometry as body. Only the outer ring is used.
+func (h *Handler) SearchLocationsByPolygon(c *gin.Context) {
+	opts, err := parseGeoOptions(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	var polygon geoJSONPolygon
+	if err := c.ShouldBindJSON(&polygon); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	if polygon.Type != "Polygon" || len(polygon.Coordinates) == 0 {
+		badRequest(c, "body must be a GeoJSON Polygon")
+		return
+	}
+
+	ring := make([]postgres.GeoPoint, 0, len(polygon.Coordinates[0]))
+	for _, position := range polygon.Coordinates[0] {
+		if len(position) < 2 {
+			badRequest(c, "polygon positions must be [longitude, latitude]")
+			return
+		}
+		ring = append(ring, postgres.GeoPoint{Lon: position[0], Lat: position[1]})
+	}
+
+	locations, err := h.svc.LocationsWithinPolygon(c.Request.Context(), ring, opts)
+	h.writeLocations(c, locations, err)
+}
+
+func (h *Handler) writeLocations(c *gin.Context, locations []*postgres.LocationWithTraffic, err error) {
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.PageResponse{Data: locations, Count: len(locations)})
+}
+
+// parseGeoOptions reads city, include_inactive, include_traffic and limit
+func parseGeoOptions(c *gin.Context) (postgres.GeoOptions, error) {
+	opts := postgres.GeoOptions{City: c.Query("city"), Limit: defaultLimit}
+
+	var err error
+	if raw := c.Query("include_inactive"); raw != "" {
+		if opts.IncludeInactive, err = strconv.ParseBool(raw); err != nil {
+			return opts, fmt.Errorf("include_inactive must be true or false")
+		}
+	}
+	if raw := c.Query("include_traffic"); raw != "" {
+		if opts.IncludeTraffic, err = strconv.ParseBool(raw); err != nil {
+			return opts, fmt.Errorf("include_traffic must be true or false")
+		}
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return opts, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		opts.Limit = limit
+	}
+
+	return opts, nil
+}
+
+// parseBoundingBox parses an optional minLon,minLat,maxLon,maxLat value
+func parseBoundingBox(value string) (*postgres.BoundingBox, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+	values := make([]float64, 4)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+		}
+		values[i] = v
+	}
+	return &postgres.BoundingBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}, nil
+}
+
+// parsePoint reads the lat and lon query parameters
+func parsePoint(c *gin.Context) (postgres.GeoPoint, error) {
+	lat, err := strconv.ParseFloat(c.Query("lat"), 64)
+	if err != nil {
+		return postgres.GeoPoint{}, fmt.Errorf("lat is required and must be a number")
+	}
+	lon, err := strconv.ParseFloat(c.Query("lon"), 64)
+	if err != nil {
+		return postgres.GeoPoint{}, fmt.Errorf("lon is required and must be a number")
+	}
+	return postgres.GeoPoint{Lat: lat, Lon: lon}, nil
+}
@@ -1,13 +1,24 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"api-traffic-analytics/cmd/traffic-ingestor/internal/service"
+	"api-traffic-analytics/internal/pkg/postgres"
 	"api-traffic-analytics/internal/shared/models"
 	"github.com/gin-gonic/gin"
 )
 
+// Bounds for the limit query parameter
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
 type Handler struct {
 	svc *service.Service
 }
@@ -24,9 +35,115 @@ func (h *Handler) ReceiveTrafficData(c *gin.Context) {
 	}
 
 	if err := h.svc.ProcessTrafficData(c.Request.Context(), &data); err != nil {
+		if errors.Is(err, service.ErrUnknownLocation) || errors.Is(err, service.ErrInactiveLocation) {
+			c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{Error: "Unprocessable entity", Code: http.StatusUnprocessableEntity, Message: err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
-}
\ No newline at end of file
+}
+
+// ListTrafficData handles GET /traffic
+func (h *Handler) ListTrafficData(c *gin.Context) {
+	h.listTrafficData(c, c.Query("location_id"))
+}
+
+// ListTrafficDataByLocation handles GET /traffic/:locationId
+func (h *Handler) ListTrafficDataByLocation(c *gin.Context) {
+	h.listTrafficData(c, c.Param("locationId"))
+}
+
+func (h *Handler) listTrafficData(c *gin.Context, locationID string) {
+	filter, err := parseTrafficFilter(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	filter.LocationID = locationID
+
+	data, next, err := h.svc.QueryTrafficData(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, postgres.ErrInvalidCursor) {
+			badRequest(c, err.Error())
+			return
+		}
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PageResponse{Data: data, Count: len(data), NextCursor: next})
+}
+
+// GetLatestTrafficData handles GET /traffic/:locationId/latest
+func (h *Handler) GetLatestTrafficData(c *gin.Context) {
+	data, err := h.svc.GetLatestTrafficData(c.Request.Context(), c.Param("locationId"))
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Not found", Code: http.StatusNotFound, Message: err.Error()})
+			return
+		}
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: data})
+}
+
+// parseTrafficFilter reads from, to, congestion_level, limit and cursor
+func parseTrafficFilter(c *gin.Context) (postgres.TrafficDataFilter, error) {
+	filter := postgres.TrafficDataFilter{
+		CongestionLevel: c.Query("congestion_level"),
+		Cursor:          c.Query("cursor"),
+		Limit:           defaultLimit,
+	}
+
+	switch filter.CongestionLevel {
+	case "", models.CongestionLow, models.CongestionMedium, models.CongestionHigh, models.CongestionSevere:
+	default:
+		return filter, fmt.Errorf("congestion_level must be one of low, medium, high, severe")
+	}
+
+	var err error
+	if filter.From, err = parseTime(c.Query("from")); err != nil {
+		return filter, fmt.Errorf("from: %w", err)
+	}
+	if filter.To, err = parseTime(c.Query("to")); err != nil {
+		return filter, fmt.Errorf("to: %w", err)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return filter, fmt.Errorf("to must not be before from")
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+// parseTime parses an optional RFC3339 timestamp
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC3339 timestamp, got %q", value)
+	}
+	return t.UTC(), nil
+}
+
+func badRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Bad request", Code: http.StatusBadRequest, Message: message})
+}
+
+func internalError(c *gin.Context, err error) {
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Internal server error", Code: http.StatusInternalServerError, Message: err.Error()})
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"api-traffic-analytics/cmd/traffic-ingestor/internal/service"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+	"github.com/gin-gonic/gin"
+)
+
+// locationRequest is the body of POST /locations and PUT /locations/:id
+type locationRequest struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name" binding:"required"`
+	Description string  `json:"description"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Address     string  `json:"address"`
+	City        string  `json:"city"`
+	Country     string  `json:"country"`
+	IsActive    *bool   `json:"is_active"`
+}
+
+func (r locationRequest) toModel() *models.Location {
+	location := &models.Location{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Latitude:    r.Latitude,
+		Longitude:   r.Longitude,
+		Address:     r.Address,
+		City:        r.City,
+		Country:     r.Country,
+		IsActive:    true,
+	}
+	if r.IsActive != nil {
+		location.IsActive = *r.IsActive
+	}
+	return location
+}
+
+// CreateLocation handles POST /locations
+func (h *Handler) CreateLocation(c *gin.Context) {
+	var req locationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	location := req.toModel()
+	if err := h.svc.CreateLocation(c.Request.Context(), location); err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.SuccessResponse{Success: true, Data: location})
+}
+
+// ListLocations handles GET /locations
+func (h *Handler) ListLocations(c *gin.Context) {
+	filter := postgres.LocationFilter{City: c.Query("city")}
+	if raw := c.Query("active"); raw != "" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			badRequest(c, "active must be true or false")
+			return
+		}
+		filter.IsActive = &active
+	}
+
+	locations, err := h.svc.ListLocations(c.Request.Context(), filter)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PageResponse{Data: locations, Count: len(locations)})
+}
+
+// GetLocation handles GET /locations/:id
+func (h *Handler) GetLocation(c *gin.Context) {
+	location, err := h.svc.GetLocation(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: location})
+}
+
+// UpdateLocation handles PUT /locations/:id
+func (h *Handler) UpdateLocation(c *gin.Context) {
+	var req locationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+	req.ID = c.Param("id")
+
+	location := req.toModel()
+	if err := h.svc.UpdateLocation(c.Request.Context(), location); err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: location})
+}
+
+// DeactivateLocation handles DELETE /locations/:id. Locations are never
+// deleted because traffic data references them.
+func (h *Handler) DeactivateLocation(c *gin.Context) {
+	if err := h.svc.SetLocationActive(c.Request.Context(), c.Param("id"), false); err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ImportLocations handles POST /locations/import. The body is a GeoJSON
+// FeatureCollection or a CSV file, depending on its Content-Type. A malformed
+// file is rejected with 400 and a well formed one with invalid or duplicated
+// locations with 422; nothing is imported in either case.
+func (h *Handler) ImportLocations(c *gin.Context) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+
+	var locations []*models.Location
+	var err error
+	switch mediaType {
+	case "application/geo+json", "application/json":
+		locations, err = service.ParseGeoJSONLocations(c.Request.Body)
+	case "text/csv":
+		locations, err = service.ParseCSVLocations(c.Request.Body)
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, models.ErrorResponse{
+			Error:   "Unsupported media type",
+			Code:    http.StatusUnsupportedMediaType,
+			Message: "Content-Type must be application/geo+json or text/csv",
+		})
+		return
+	}
+	if err == nil {
+		err = h.svc.ImportLocations(c.Request.Context(), locations)
+	}
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: gin.H{"imported": len(locations)}})
+}
+
+func (h *Handler) locationError(c *gin.Context, err error) {
+	var validationErr *service.ValidationError
+	var importErr *service.ImportError
+	switch {
+	case errors.As(err, &validationErr):
+		badRequest(c, err.Error())
+	case errors.As(err, &importErr):
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{Error: "Unprocessable entity", Code: http.StatusUnprocessableEntity, Message: err.Error()})
+	case errors.Is(err, postgres.ErrNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Not found", Code: http.StatusNotFound, Message: err.Error()})
+	case errors.Is(err, postgres.ErrDuplicate):
+		c.JSON(http.StatusConflict, models.ErrorResponse{Error: "Conflict", Code: http.StatusConflict, Message: err.Error()})
+	default:
+		internalError(c, err)
+	}
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/internal/pkg/health"
+)
+
+// NewRouter registers the ingestor routes and the health endpoints of
+// checker on a new Gin engine
+func NewRouter(h *Handler, checker *health.Checker) *gin.Engine {
+	router := gin.Default()
+	checker.Register(router)
+	router.POST("/traffic", h.ReceiveTrafficData)
+	router.GET("/traffic", h.ListTrafficData)
+	router.GET("/traffic/:locationId", h.ListTrafficDataByLocation)
+	router.GET("/traffic/:locationId/latest", h.GetLatestTrafficData)
+	router.GET("/series/traffic", h.GetTrafficSeries)
+	router.GET("/map/traffic", h.GetTrafficMap)
+	router.GET("/map/heatmap", h.GetTrafficHeatmap)
+	router.GET("/locations", h.ListLocations)
+	router.POST("/locations", h.CreateLocation)
+	router.POST("/locations/import", h.ImportLocations)
+	router.GET("/locations/search/radius", h.SearchLocationsByRadius)
+	router.GET("/locations/search/nearest", h.SearchNearestLocations)
+	router.GET("/locations/search/bbox", h.SearchLocationsByBoundingBox)
+	router.POST("/locations/search/polygon", h.SearchLocationsByPolygon)
+	router.GET("/locations/:id", h.GetLocation)
+	router.PUT("/locations/:id", h.UpdateLocation)
+	router.DELETE("/locations/:id", h.DeactivateLocation)
+	return router
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"api-traffic-analytics/cmd/traffic-ingestor/internal/service"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Range of GET /series/traffic when from is not given
+const defaultSeriesRange = 24 * time.Hour
+
+// GetTrafficSeries handles GET /series/traffic?location_id=&from=&to=&resolution=.
+// Resolution accepts Go durations and days ("15m", "6h", "7d"); it is chosen
+// from the range when omitted. Long ranges are served from the rollup tables.
+func (h *Handler) GetTrafficSeries(c *gin.Context) {
+	spec := postgres.SeriesSpec{LocationID: c.Query("location_id")}
+
+	var err error
+	if spec.From, err = parseTime(c.Query("from")); err != nil {
+		badRequest(c, "from: "+err.Error())
+		return
+	}
+	if spec.To, err = parseTime(c.Query("to")); err != nil {
+		badRequest(c, "to: "+err.Error())
+		return
+	}
+	if spec.To.IsZero() {
+		spec.To = time.Now().UTC()
+	}
+	if spec.From.IsZero() {
+		spec.From = spec.To.Add(-defaultSeriesRange)
+	}
+	if raw := c.Query("resolution"); raw != "" {
+		if spec.Resolution, err = service.ParseResolution(raw); err != nil {
+			badRequest(c, "resolution must be a duration such as 15m, 1h or 1d")
+			return
+		}
+	}
+
+	series, err := h.svc.TrafficSeries(c.Request.Context(), spec)
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Success: true, Data: series})
+}
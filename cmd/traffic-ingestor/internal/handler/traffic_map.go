@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api-traffic-analytics/cmd/traffic-ingestor/internal/service"
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mediaTypeGeoJSON = "application/geo+json"
+
+	// Heatmap defaults: roughly 1 km cells over the last hour
+	defaultHeatmapCellSize = 0.01
+	defaultHeatmapRange    = time.Hour
+)
+
+// GetTrafficMap handles GET /map/traffic: every active location with its
+// current congestion, as GeoJSON points or as plain JSON
+func (h *Handler) GetTrafficMap(c *gin.Context) {
+	filter, err := parseMapFilter(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	statuses, err := h.svc.CurrentTrafficStatus(c.Request.Context(), filter)
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	if wantsGeoJSON(c) {
+		writeGeoJSON(c, service.StatusFeatureCollection(statuses))
+		return
+	}
+	c.JSON(http.StatusOK, models.PageResponse{Data: statuses, Count: len(statuses)})
+}
+
+// GetTrafficHeatmap handles GET /map/heatmap: readings between from and to
+// aggregated into cell_size degree grid cells
+func (h *Handler) GetTrafficHeatmap(c *gin.Context) {
+	filter, err := parseMapFilter(c)
+	if err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	spec := postgres.HeatmapSpec{Filter: filter, CellSize: defaultHeatmapCellSize}
+	if spec.From, err = parseTime(c.Query("from")); err != nil {
+		badRequest(c, "from: "+err.Error())
+		return
+	}
+	if spec.To, err = parseTime(c.Query("to")); err != nil {
+		badRequest(c, "to: "+err.Error())
+		return
+	}
+	if spec.To.IsZero() {
+		spec.To = time.Now().UTC()
+	}
+	if spec.From.IsZero() {
+		spec.From = spec.To.Add(-defaultHeatmapRange)
+	}
+	if raw := c.Query("cell_size"); raw != "" {
+		if spec.CellSize, err = strconv.ParseFloat(raw, 64); err != nil {
+			badRequest(c, "cell_size must be a number of degrees")
+			return
+		}
+	}
+
+	cells, err := h.svc.TrafficHeatmap(c.Request.Context(), spec)
+	if err != nil {
+		h.locationError(c, err)
+		return
+	}
+
+	if wantsGeoJSON(c) {
+		writeGeoJSON(c, service.HeatmapFeatureCollection(cells))
+		return
+	}
+	c.JSON(http.StatusOK, models.PageResponse{Data: cells, Count: len(cells)})
+}
+
+// wantsGeoJSON negotiates the map format. The format query parameter wins over
+// the Accept header so clients that cannot set headers can still choose;
+// GeoJSON is the default.
+func wantsGeoJSON(c *gin.Context) bool {
+	c.Header("Vary", "Accept")
+	switch c.Query("format") {
+	case "geojson":
+		return true
+	case "json":
+		return false
+	}
+	return c.NegotiateFormat(mediaTypeGeoJSON, gin.MIMEJSON) != gin.MIMEJSON
+}
+
+func writeGeoJSON(c *gin.Context, collection *models.GeoJSONFeatureCollection) {
+	body, err := json.Marshal(collection)
+	if err != nil {
+		internalError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, mediaTypeGeoJSON, body)
+}
+
+// parseMapFilter reads city and bbox
+func parseMapFilter(c *gin.Context) (postgres.MapFilter, error) {
+	box, err := parseBoundingBox(c.Query("bbox"))
+	if err != nil {
+		return postgres.MapFilter{}, err
+	}
+	return postgres.MapFilter{City: c.Query("city"), Box: box}, nil
+}
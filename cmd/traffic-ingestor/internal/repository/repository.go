@@ -3,19 +3,24 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"log"
+	"time"
 
+	"api-traffic-analytics/internal/interfaces"
 	"api-traffic-analytics/internal/pkg/postgres"
-	"api-traffic-analytics/internal/pkg/redis"
 	"api-traffic-analytics/internal/shared/models"
 )
 
 type Repository struct {
-	db  *postgres.TrafficDataRepository
-	rdb *redis.CacheRepository
+	db          interfaces.TrafficDataRepository
+	locations   interfaces.LocationRepository
+	rollups     interfaces.RollupRepository
+	rdb         interfaces.CacheRepository
+	locationTTL time.Duration
 }
 
-func NewRepository(db *postgres.TrafficDataRepository, rdb *redis.CacheRepository) *Repository {
-	return &Repository{db: db, rdb: rdb}
+func NewRepository(db interfaces.TrafficDataRepository, locations interfaces.LocationRepository, rollups interfaces.RollupRepository, rdb interfaces.CacheRepository, locationTTL time.Duration) *Repository {
+	return &Repository{db: db, locations: locations, rollups: rollups, rdb: rdb, locationTTL: locationTTL}
 }
 
 func (r *Repository) StoreTrafficData(ctx context.Context, data *models.TrafficData) error {
@@ -25,10 +30,149 @@ func (r *Repository) StoreTrafficData(ctx context.Context, data *models.TrafficD
 	}
 
 	// Store in Redis
-	key := "latest_traffic:" + data.LocationID
+	return r.cacheLatest(ctx, data)
+}
+
+func (r *Repository) QueryTrafficData(ctx context.Context, filter postgres.TrafficDataFilter) ([]*models.TrafficData, string, error) {
+	return r.db.Query(ctx, filter)
+}
+
+// GetLatestTrafficData serves the latest reading from Redis, falling back to
+// PostgreSQL and refilling the cache on a miss
+func (r *Repository) GetLatestTrafficData(ctx context.Context, locationID string) (*models.TrafficData, error) {
+	val, err := r.rdb.GetCache(ctx, latestKey(locationID))
+	if err != nil {
+		log.Printf("failed to read latest traffic from cache: %v", err)
+	}
+	if val != "" {
+		var data models.TrafficData
+		if err := json.Unmarshal([]byte(val), &data); err == nil {
+			return &data, nil
+		}
+	}
+
+	data, err := r.db.GetLatestByLocation(ctx, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.cacheLatest(ctx, data); err != nil {
+		log.Printf("failed to cache latest traffic: %v", err)
+	}
+	return data, nil
+}
+
+// GetLocation serves a location from Redis, falling back to PostgreSQL
+func (r *Repository) GetLocation(ctx context.Context, id string) (*models.Location, error) {
+	val, err := r.rdb.GetCache(ctx, locationKey(id))
+	if err != nil {
+		log.Printf("failed to read location from cache: %v", err)
+	}
+	if val != "" {
+		var location models.Location
+		if err := json.Unmarshal([]byte(val), &location); err == nil {
+			return &location, nil
+		}
+	}
+
+	location, err := r.locations.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if val, err := json.Marshal(location); err == nil {
+		if err := r.rdb.SetCache(ctx, locationKey(id), val, r.locationTTL); err != nil {
+			log.Printf("failed to cache location: %v", err)
+		}
+	}
+	return location, nil
+}
+
+func (r *Repository) ListLocations(ctx context.Context, filter postgres.LocationFilter) ([]*models.Location, error) {
+	return r.locations.List(ctx, filter)
+}
+
+func (r *Repository) LocationsWithinRadius(ctx context.Context, center postgres.GeoPoint, radiusMeters float64, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	return r.locations.WithinRadius(ctx, center, radiusMeters, opts)
+}
+
+func (r *Repository) NearestLocations(ctx context.Context, center postgres.GeoPoint, k int, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	return r.locations.Nearest(ctx, center, k, opts)
+}
+
+func (r *Repository) LocationsWithinBoundingBox(ctx context.Context, box postgres.BoundingBox, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	return r.locations.WithinBoundingBox(ctx, box, opts)
+}
+
+func (r *Repository) LocationsWithinPolygon(ctx context.Context, ring []postgres.GeoPoint, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	return r.locations.WithinPolygon(ctx, ring, opts)
+}
+
+func (r *Repository) CurrentTrafficStatus(ctx context.Context, filter postgres.MapFilter) ([]*postgres.LocationStatus, error) {
+	return r.locations.CurrentStatus(ctx, filter)
+}
+
+func (r *Repository) TrafficHeatmap(ctx context.Context, spec postgres.HeatmapSpec) ([]*postgres.HeatmapCell, error) {
+	return r.db.Heatmap(ctx, spec)
+}
+
+func (r *Repository) TrafficSeries(ctx context.Context, spec postgres.SeriesSpec) ([]*postgres.TrafficSeriesPoint, string, error) {
+	return r.rollups.Series(ctx, spec)
+}
+
+func (r *Repository) CreateLocation(ctx context.Context, location *models.Location) error {
+	if err := r.locations.Create(ctx, location); err != nil {
+		return err
+	}
+	return r.invalidateLocations(ctx, location.ID)
+}
+
+func (r *Repository) UpdateLocation(ctx context.Context, location *models.Location) error {
+	if err := r.locations.Update(ctx, location); err != nil {
+		return err
+	}
+	return r.invalidateLocations(ctx, location.ID)
+}
+
+func (r *Repository) SetLocationActive(ctx context.Context, id string, active bool) error {
+	if err := r.locations.SetActive(ctx, id, active); err != nil {
+		return err
+	}
+	return r.invalidateLocations(ctx, id)
+}
+
+func (r *Repository) ImportLocations(ctx context.Context, locations []*models.Location) error {
+	if err := r.locations.BulkUpsert(ctx, locations); err != nil {
+		return err
+	}
+
+	ids := make([]string, len(locations))
+	for i, location := range locations {
+		ids[i] = location.ID
+	}
+	return r.invalidateLocations(ctx, ids...)
+}
+
+func (r *Repository) invalidateLocations(ctx context.Context, ids ...string) error {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = locationKey(id)
+	}
+	return r.rdb.DeleteCache(ctx, keys...)
+}
+
+func (r *Repository) cacheLatest(ctx context.Context, data *models.TrafficData) error {
 	val, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return r.rdb.SetCache(ctx, key, val, 0)
+	return r.rdb.SetCache(ctx, latestKey(data.LocationID), val, 0)
+}
+
+func latestKey(locationID string) string {
+	return "latest_traffic:" + locationID
+}
+
+func locationKey(id string) string {
+	return "location:" + id
 }
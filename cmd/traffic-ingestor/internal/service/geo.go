@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+)
+
+// Upper bounds for spatial searches
+const (
+	MaxSearchRadiusMeters = 100000
+	MaxNearest            = 100
+)
+
+func (s *Service) LocationsWithinRadius(ctx context.Context, center postgres.GeoPoint, radiusMeters float64, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	if err := validatePoint(center); err != nil {
+		return nil, err
+	}
+	if radiusMeters <= 0 || radiusMeters > MaxSearchRadiusMeters {
+		return nil, &ValidationError{Message: fmt.Sprintf("radius must be between 0 and %d meters", MaxSearchRadiusMeters)}
+	}
+	return s.repo.LocationsWithinRadius(ctx, center, radiusMeters, opts)
+}
+
+func (s *Service) NearestLocations(ctx context.Context, center postgres.GeoPoint, k int, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	if err := validatePoint(center); err != nil {
+		return nil, err
+	}
+	if k < 1 || k > MaxNearest {
+		return nil, &ValidationError{Message: fmt.Sprintf("k must be between 1 and %d", MaxNearest)}
+	}
+	return s.repo.NearestLocations(ctx, center, k, opts)
+}
+
+func (s *Service) LocationsWithinBoundingBox(ctx context.Context, box postgres.BoundingBox, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	if err := validateMapFilter(postgres.MapFilter{Box: &box}); err != nil {
+		return nil, err
+	}
+	return s.repo.LocationsWithinBoundingBox(ctx, box, opts)
+}
+
+func (s *Service) LocationsWithinPolygon(ctx context.Context, ring []postgres.GeoPoint, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	// A closing point equal to the first one is optional
+	if n := len(ring); n > 1 && ring[0] == ring[n-1] {
+		ring = ring[:n-1]
+	}
+	if len(ring) < 3 {
+		return nil, &ValidationError{Message: "polygon needs at least 3 distinct points"}
+	}
+	for _, p := range ring {
+		if err := validatePoint(p); err != nil {
+			return nil, err
+		}
+	}
+	return s.repo.LocationsWithinPolygon(ctx, ring, opts)
+}
+
+func validatePoint(p postgres.GeoPoint) error {
+	if p.Lat < -90 || p.Lat > 90 {
+		return &ValidationError{Message: "latitude must be between -90 and 90"}
+	}
+	if p.Lon < -180 || p.Lon > 180 {
+		return &ValidationError{Message: "longitude must be between -180 and 180"}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// geoJSONFeatureCollection is the subset of GeoJSON accepted by location imports
+type geoJSONFeatureCollection struct {
+	Type     string `json:"type"`
+	Features []struct {
+		Type     string      `json:"type"`
+		ID       interface{} `json:"id"`
+		Geometry struct {
+			Type string `json:"type"`
+			// Only Point coordinates are decoded
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]interface{} `json:"properties"`
+	} `json:"features"`
+}
+
+// ParseGeoJSONLocations reads a FeatureCollection of Point features. The
+// location id comes from the feature id or the "id" property; the remaining
+// fields are read from the properties. A document that is not a
+// FeatureCollection is a ValidationError, an invalid feature an ImportError.
+func ParseGeoJSONLocations(r io.Reader) ([]*models.Location, error) {
+	var collection geoJSONFeatureCollection
+	if err := json.NewDecoder(r).Decode(&collection); err != nil {
+		return nil, &ValidationError{Message: fmt.Sprintf("invalid GeoJSON: %v", err)}
+	}
+	if collection.Type != "FeatureCollection" {
+		return nil, &ValidationError{Message: "GeoJSON must be a FeatureCollection"}
+	}
+
+	locations := make([]*models.Location, 0, len(collection.Features))
+	for i, feature := range collection.Features {
+		var position []float64
+		if feature.Geometry.Type != "Point" || json.Unmarshal(feature.Geometry.Coordinates, &position) != nil || len(position) < 2 {
+			return nil, &ImportError{Message: fmt.Sprintf("feature #%d: geometry must be a Point", i+1)}
+		}
+
+		props := feature.Properties
+		id := stringValue(feature.ID)
+		if id == "" {
+			id = stringValue(props["id"])
+		}
+
+		location := &models.Location{
+			ID:          id,
+			Name:        stringValue(props["name"]),
+			Description: stringValue(props["description"]),
+			// GeoJSON positions are [longitude, latitude]
+			Longitude: position[0],
+			Latitude:  position[1],
+			Address:   stringValue(props["address"]),
+			City:      stringValue(props["city"]),
+			Country:   stringValue(props["country"]),
+			IsActive:  true,
+		}
+		if raw, ok := props["is_active"]; ok && raw != nil {
+			active, ok := raw.(bool)
+			if !ok {
+				return nil, &ImportError{Message: fmt.Sprintf("feature #%d: is_active must be a boolean", i+1)}
+			}
+			location.IsActive = active
+		}
+		locations = append(locations, location)
+	}
+
+	return locations, nil
+}
+
+// ParseCSVLocations reads a CSV file with a header row. The id, name,
+// latitude and longitude columns are required; description, address, city,
+// country and is_active are optional. A malformed file or header is a
+// ValidationError, an invalid row an ImportError.
+func ParseCSVLocations(r io.Reader) ([]*models.Location, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, &ValidationError{Message: fmt.Sprintf("invalid CSV header: %v", err)}
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"id", "name", "latitude", "longitude"} {
+		if _, ok := columns[required]; !ok {
+			return nil, &ValidationError{Message: fmt.Sprintf("CSV is missing the %q column", required)}
+		}
+	}
+
+	var locations []*models.Location
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, &ValidationError{Message: fmt.Sprintf("invalid CSV: %v", err)}
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		location := &models.Location{
+			ID:          field("id"),
+			Name:        field("name"),
+			Description: field("description"),
+			Address:     field("address"),
+			City:        field("city"),
+			Country:     field("country"),
+			IsActive:    true,
+		}
+		if location.Latitude, err = strconv.ParseFloat(field("latitude"), 64); err != nil {
+			return nil, &ImportError{Message: fmt.Sprintf("line %d: invalid latitude", line)}
+		}
+		if location.Longitude, err = strconv.ParseFloat(field("longitude"), 64); err != nil {
+			return nil, &ImportError{Message: fmt.Sprintf("line %d: invalid longitude", line)}
+		}
+		if raw := field("is_active"); raw != "" {
+			if location.IsActive, err = strconv.ParseBool(raw); err != nil {
+				return nil, &ImportError{Message: fmt.Sprintf("line %d: invalid is_active", line)}
+			}
+		}
+		locations = append(locations, location)
+	}
+
+	return locations, nil
+}
+
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
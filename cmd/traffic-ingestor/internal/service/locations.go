@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// ValidationError describes why a location was rejected
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// ImportError describes why a location of a bulk import was rejected. Unlike
+// a ValidationError of the import, the file itself was well formed.
+type ImportError struct {
+	Message string
+}
+
+func (e *ImportError) Error() string {
+	return e.Message
+}
+
+func (s *Service) GetLocation(ctx context.Context, id string) (*models.Location, error) {
+	return s.repo.GetLocation(ctx, id)
+}
+
+func (s *Service) ListLocations(ctx context.Context, filter postgres.LocationFilter) ([]*models.Location, error) {
+	return s.repo.ListLocations(ctx, filter)
+}
+
+func (s *Service) CreateLocation(ctx context.Context, location *models.Location) error {
+	if err := ValidateLocation(location); err != nil {
+		return err
+	}
+	return s.repo.CreateLocation(ctx, location)
+}
+
+func (s *Service) UpdateLocation(ctx context.Context, location *models.Location) error {
+	if err := ValidateLocation(location); err != nil {
+		return err
+	}
+	return s.repo.UpdateLocation(ctx, location)
+}
+
+func (s *Service) SetLocationActive(ctx context.Context, id string, active bool) error {
+	return s.repo.SetLocationActive(ctx, id, active)
+}
+
+// ImportLocations validates every location before upserting them all at once
+func (s *Service) ImportLocations(ctx context.Context, locations []*models.Location) error {
+	seen := make(map[string]bool, len(locations))
+	for i, location := range locations {
+		if err := ValidateLocation(location); err != nil {
+			return &ImportError{Message: fmt.Sprintf("location #%d: %v", i+1, err)}
+		}
+		if seen[location.ID] {
+			return &ImportError{Message: fmt.Sprintf("location #%d: duplicate id %s", i+1, location.ID)}
+		}
+		seen[location.ID] = true
+	}
+	return s.repo.ImportLocations(ctx, locations)
+}
+
+// ValidateLocation checks the constraints of the locations table
+func ValidateLocation(location *models.Location) error {
+	location.ID = strings.TrimSpace(location.ID)
+	location.Name = strings.TrimSpace(location.Name)
+
+	switch {
+	case location.ID == "" || len(location.ID) > 50:
+		return &ValidationError{Message: "id is required and must be at most 50 characters"}
+	case location.Name == "" || len(location.Name) > 255:
+		return &ValidationError{Message: "name is required and must be at most 255 characters"}
+	case math.IsNaN(location.Latitude) || location.Latitude < -90 || location.Latitude > 90:
+		return &ValidationError{Message: "latitude must be between -90 and 90"}
+	case math.IsNaN(location.Longitude) || location.Longitude < -180 || location.Longitude > 180:
+		return &ValidationError{Message: "longitude must be between -180 and 180"}
+	case len(location.City) > 100:
+		return &ValidationError{Message: "city must be at most 100 characters"}
+	case len(location.Country) > 100:
+		return &ValidationError{Message: "country must be at most 100 characters"}
+	}
+
+	if location.Country == "" {
+		location.Country = "Argentina"
+	}
+	return nil
+}
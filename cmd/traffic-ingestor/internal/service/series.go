@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+)
+
+// Bounds for traffic series requests
+const (
+	MinSeriesResolution = time.Minute
+	MaxSeriesPoints     = 5000
+	// Target number of buckets when no resolution is requested
+	targetSeriesPoints = 500
+)
+
+// seriesResolutions are the resolutions picked automatically, finest first
+var seriesResolutions = []time.Duration{
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// TrafficSeries is a traffic time series and how it was computed
+type TrafficSeries struct {
+	Resolution string                         `json:"resolution"`
+	Source     string                         `json:"source"`
+	From       time.Time                      `json:"from"`
+	To         time.Time                      `json:"to"`
+	Points     []*postgres.TrafficSeriesPoint `json:"points"`
+}
+
+// TrafficSeries returns per-bucket traffic statistics over [spec.From,
+// spec.To), widened to whole buckets. A zero resolution picks the finest one
+// that keeps the series around 500 points.
+func (s *Service) TrafficSeries(ctx context.Context, spec postgres.SeriesSpec) (*TrafficSeries, error) {
+	if !spec.To.After(spec.From) {
+		return nil, &ValidationError{Message: "to must be after from"}
+	}
+
+	if spec.Resolution == 0 {
+		spec.Resolution = seriesResolutions[len(seriesResolutions)-1]
+		for _, resolution := range seriesResolutions {
+			if spec.To.Sub(spec.From)/resolution <= targetSeriesPoints {
+				spec.Resolution = resolution
+				break
+			}
+		}
+	}
+	if spec.Resolution < MinSeriesResolution || spec.Resolution%time.Minute != 0 {
+		return nil, &ValidationError{Message: "resolution must be a whole number of minutes"}
+	}
+
+	spec.From, spec.To = postgres.AlignSeriesRange(spec.From, spec.To, spec.Resolution)
+	if spec.To.Sub(spec.From)/spec.Resolution > MaxSeriesPoints {
+		return nil, &ValidationError{Message: fmt.Sprintf("range and resolution give more than %d points, use a coarser resolution", MaxSeriesPoints)}
+	}
+
+	points, source, err := s.repo.TrafficSeries(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrafficSeries{
+		Resolution: FormatResolution(spec.Resolution),
+		Source:     source,
+		From:       spec.From,
+		To:         spec.To,
+		Points:     points,
+	}, nil
+}
+
+// FormatResolution renders a resolution as ParseResolution accepts it
+func FormatResolution(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+}
+
+// ParseResolution parses a Go duration, also accepting whole days ("7d")
+func ParseResolution(value string) (time.Duration, error) {
+	var days int
+	if n, err := fmt.Sscanf(value, "%dd", &days); err == nil && n == 1 && fmt.Sprintf("%dd", days) == value {
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -2,39 +2,56 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 
 	"api-traffic-analytics/cmd/traffic-ingestor/internal/repository"
+	"api-traffic-analytics/internal/interfaces"
 	kafkaPkg "api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/postgres"
 	"api-traffic-analytics/internal/shared/models"
-	"github.com/segmentio/kafka-go"
+)
+
+var (
+	// ErrUnknownLocation is returned when a reading references a location that does not exist
+	ErrUnknownLocation = errors.New("unknown location_id")
+	// ErrInactiveLocation is returned when a reading references a deactivated location
+	ErrInactiveLocation = errors.New("location is inactive")
 )
 
 type Service struct {
 	repo     *repository.Repository
-	producer *kafkaPkg.Producer
+	producer interfaces.EventProducer
 }
 
-func NewService(repo *repository.Repository, producer *kafkaPkg.Producer) *Service {
+func NewService(repo *repository.Repository, producer interfaces.EventProducer) *Service {
 	return &Service{repo: repo, producer: producer}
 }
 
 func (s *Service) ProcessTrafficData(ctx context.Context, data *models.TrafficData) error {
-	// Store data
-	if err := s.repo.StoreTrafficData(ctx, data); err != nil {
+	// Validate location
+	location, err := s.repo.GetLocation(ctx, data.LocationID)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return fmt.Errorf("%w: %s", ErrUnknownLocation, data.LocationID)
+		}
 		return err
 	}
+	if !location.IsActive {
+		return fmt.Errorf("%w: %s", ErrInactiveLocation, data.LocationID)
+	}
+	data.Location = *location
 
-	// Publish to Kafka
-	msg, err := json.Marshal(data)
-	if err != nil {
+	// Store data
+	if err := s.repo.StoreTrafficData(ctx, data); err != nil {
 		return err
 	}
 
-	err = s.producer.WriteMessages(ctx, kafka.Message{
-		Value: msg,
-	})
+	// Publish to Kafka, keyed by location so readings stay ordered per location
+	err = s.producer.PublishEvent(ctx, data.LocationID,
+		kafkaPkg.EventTypeTrafficRecorded, kafkaPkg.TrafficDataSchemaVersion,
+		kafkaPkg.NewTrafficDataEvent(data))
 	if err != nil {
 		log.Printf("failed to write message to kafka: %v", err)
 		return err
@@ -42,4 +59,12 @@ func (s *Service) ProcessTrafficData(ctx context.Context, data *models.TrafficDa
 
 	log.Println("Successfully published message to kafka")
 	return nil
-}
\ No newline at end of file
+}
+
+func (s *Service) QueryTrafficData(ctx context.Context, filter postgres.TrafficDataFilter) ([]*models.TrafficData, string, error) {
+	return s.repo.QueryTrafficData(ctx, filter)
+}
+
+func (s *Service) GetLatestTrafficData(ctx context.Context, locationID string) (*models.TrafficData, error) {
+	return s.repo.GetLatestTrafficData(ctx, locationID)
+}
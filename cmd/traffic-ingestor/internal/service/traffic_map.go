@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// Bounds for heatmap requests
+const (
+	MinHeatmapCellSize = 0.001
+	MaxHeatmapCellSize = 1.0
+	MaxHeatmapRange    = 31 * 24 * time.Hour
+)
+
+func (s *Service) CurrentTrafficStatus(ctx context.Context, filter postgres.MapFilter) ([]*postgres.LocationStatus, error) {
+	if err := validateMapFilter(filter); err != nil {
+		return nil, err
+	}
+	return s.repo.CurrentTrafficStatus(ctx, filter)
+}
+
+func (s *Service) TrafficHeatmap(ctx context.Context, spec postgres.HeatmapSpec) ([]*postgres.HeatmapCell, error) {
+	if err := validateMapFilter(spec.Filter); err != nil {
+		return nil, err
+	}
+	if spec.CellSize < MinHeatmapCellSize || spec.CellSize > MaxHeatmapCellSize {
+		return nil, &ValidationError{Message: fmt.Sprintf("cell_size must be between %g and %g degrees", MinHeatmapCellSize, MaxHeatmapCellSize)}
+	}
+	if !spec.To.After(spec.From) {
+		return nil, &ValidationError{Message: "to must be after from"}
+	}
+	if spec.To.Sub(spec.From) > MaxHeatmapRange {
+		return nil, &ValidationError{Message: "time range must be at most 31 days"}
+	}
+	return s.repo.TrafficHeatmap(ctx, spec)
+}
+
+// StatusFeatureCollection renders location statuses as GeoJSON points
+func StatusFeatureCollection(statuses []*postgres.LocationStatus) *models.GeoJSONFeatureCollection {
+	collection := &models.GeoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]*models.GeoJSONFeature, len(statuses))}
+	for i, status := range statuses {
+		properties := map[string]interface{}{
+			"name":             status.Name,
+			"city":             status.City,
+			"country":          status.Country,
+			"address":          status.Address,
+			"congestion_level": status.CongestionLevel,
+			"vehicle_count":    status.VehicleCount,
+			"average_speed":    status.AverageSpeed,
+			"occupancy":        status.Occupancy,
+			"travel_time":      status.TravelTime,
+			"last_reading":     status.LastReading,
+		}
+		collection.Features[i] = &models.GeoJSONFeature{
+			Type: "Feature",
+			ID:   status.ID,
+			Geometry: models.GeoJSONGeometry{
+				Type:        "Point",
+				Coordinates: []float64{status.Longitude, status.Latitude},
+			},
+			Properties: properties,
+		}
+	}
+	return collection
+}
+
+// HeatmapFeatureCollection renders heatmap cells as GeoJSON polygons
+func HeatmapFeatureCollection(cells []*postgres.HeatmapCell) *models.GeoJSONFeatureCollection {
+	collection := &models.GeoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]*models.GeoJSONFeature, len(cells))}
+	for i, cell := range cells {
+		ring := [][]float64{
+			{cell.MinLon, cell.MinLat},
+			{cell.MaxLon, cell.MinLat},
+			{cell.MaxLon, cell.MaxLat},
+			{cell.MinLon, cell.MaxLat},
+			{cell.MinLon, cell.MinLat},
+		}
+		collection.Features[i] = &models.GeoJSONFeature{
+			Type: "Feature",
+			Geometry: models.GeoJSONGeometry{
+				Type:        "Polygon",
+				Coordinates: [][][]float64{ring},
+			},
+			Properties: map[string]interface{}{
+				"sample_count":      cell.SampleCount,
+				"location_count":    cell.LocationCount,
+				"avg_vehicle_count": cell.AvgVehicleCount,
+				"avg_speed":         cell.AvgSpeed,
+				"congestion_score":  cell.CongestionScore,
+			},
+		}
+	}
+	return collection
+}
+
+func validateMapFilter(filter postgres.MapFilter) error {
+	if filter.Box == nil {
+		return nil
+	}
+	if err := validatePoint(postgres.GeoPoint{Lat: filter.Box.MinLat, Lon: filter.Box.MinLon}); err != nil {
+		return err
+	}
+	if err := validatePoint(postgres.GeoPoint{Lat: filter.Box.MaxLat, Lon: filter.Box.MaxLon}); err != nil {
+		return err
+	}
+	if filter.Box.MinLat > filter.Box.MaxLat {
+		return &ValidationError{Message: "bbox min latitude must not exceed max latitude"}
+	}
+	return nil
+}
@@ -9,22 +9,37 @@ import (
 	"syscall"
 	"time"
 
+	"api-traffic-analytics/cmd/traffic-ingestor/internal/config"
 	"api-traffic-analytics/cmd/traffic-ingestor/internal/handler"
 	"api-traffic-analytics/cmd/traffic-ingestor/internal/repository"
 	"api-traffic-analytics/cmd/traffic-ingestor/internal/service"
+	"api-traffic-analytics/internal/pkg/health"
 	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/migrate"
 	"api-traffic-analytics/internal/pkg/postgres"
 	"api-traffic-analytics/internal/pkg/redis"
-
-	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	cfg := config.Load()
+
 	// Initialize PostgreSQL
 	db, err := postgres.ConnectDB()
 	if err != nil {
 		log.Fatalf("Unable to connect to database: %v\n", err)
 	}
+
+	// "migrate" manages the schema and exits; otherwise apply pending
+	// migrations when DB_AUTO_MIGRATE is set
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate.Command(context.Background(), db, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("migrate failed: %v", err)
+		}
+		return
+	}
+	if err := migrate.AutoMigrate(context.Background(), db); err != nil {
+		log.Fatalf("Unable to migrate database: %v\n", err)
+	}
 	// Initialize Redis
 	rdb, err := redis.GetRedisClient()
 	if err != nil {
@@ -33,25 +48,32 @@ func main() {
 
 	// Initialize Kafka Producer
 	producer := kafka.CreateProducer(
-		[]string{os.Getenv("KAFKA_BROKERS")},
-		"traffic-data",
+		cfg.KafkaBrokers,
+		cfg.KafkaTopic,
+		"traffic-ingestor",
 	)
 	defer producer.Close()
 
 	// Create repository, service, and handler
 	postgresRepo := postgres.NewTrafficDataRepository(db)
+	locationRepo := postgres.NewLocationRepository(db)
+	rollupRepo := postgres.NewRollupRepository(db)
 	redisRepo := redis.NewCacheRepository(rdb)
-	repo := repository.NewRepository(postgresRepo, redisRepo)
+	repo := repository.NewRepository(postgresRepo, locationRepo, rollupRepo, redisRepo, cfg.LocationCacheTTL)
 	svc := service.NewService(repo, producer)
 	h := handler.NewHandler(svc)
 
-	// Create Gin router
-	router := gin.Default()
-	router.POST("/traffic", h.ReceiveTrafficData)
+	// Readiness depends on the database, Redis and Kafka
+	checker := health.NewChecker("traffic-ingestor", health.DefaultTimeout).
+		Add("postgres", func(ctx context.Context) error { return postgres.Ping(ctx, db) }).
+		Add("redis", func(ctx context.Context) error { return redis.Ping(ctx, rdb) }).
+		Add("kafka", func(ctx context.Context) error { return kafka.Ping(ctx, cfg.KafkaBrokers) })
+
+	router := handler.NewRouter(h, checker)
 
 	// Create HTTP server
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    ":" + cfg.Port,
 		Handler: router,
 	}
 
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// Meters per degree of a great circle on the sphere of postgres.DistanceMeters
+const metersPerDegree = 6371000 * math.Pi / 180
+
+func TestLocationsWithinRadiusIncludeTheEdge(t *testing.T) {
+	in := newIngestor(t)
+	ctx := context.Background()
+	center := postgres.GeoPoint{Lat: 40.4168, Lon: -3.7038}
+
+	for _, location := range []*models.Location{
+		{ID: "CENTER", Latitude: center.Lat, Longitude: center.Lon},
+		{ID: "NORTH_999", Latitude: center.Lat + 999/metersPerDegree, Longitude: center.Lon},
+		{ID: "SOUTH_999", Latitude: center.Lat - 999/metersPerDegree, Longitude: center.Lon},
+		{ID: "NORTH_1001", Latitude: center.Lat + 1001/metersPerDegree, Longitude: center.Lon},
+		{ID: "EAST_600", Latitude: center.Lat, Longitude: center.Lon + 600/metersPerDegree/math.Cos(center.Lat*math.Pi/180)},
+	} {
+		location.Name, location.City, location.IsActive = location.ID, "Madrid", true
+		if err := in.svc.CreateLocation(ctx, location); err != nil {
+			t.Fatalf("creating %s: %v", location.ID, err)
+		}
+	}
+
+	found, err := in.svc.LocationsWithinRadius(ctx, center, 1000, postgres.GeoOptions{})
+	if err != nil {
+		t.Fatalf("LocationsWithinRadius: %v", err)
+	}
+
+	want := []string{"CENTER", "EAST_600", "NORTH_999", "SOUTH_999"}
+	if len(found) != len(want) {
+		t.Fatalf("found %d locations, want %v", len(found), want)
+	}
+	for i, location := range found {
+		// The two at 999 m tie, so only their distance is checked
+		if i < 2 && location.ID != want[i] {
+			t.Errorf("location %d = %s, want %s", i, location.ID, want[i])
+		}
+		if location.DistanceMeters == nil || *location.DistanceMeters > 1000 {
+			t.Errorf("%s distance = %v, want at most 1000 m", location.ID, location.DistanceMeters)
+		}
+	}
+	if d := *found[2].DistanceMeters; math.Abs(d-999) > 0.5 {
+		t.Errorf("%s is %.2f m away, want 999", found[2].ID, d)
+	}
+}
+
+func TestSearchByBoundingBoxAcrossTheAntimeridian(t *testing.T) {
+	router, in := newRouter(t)
+	ctx := context.Background()
+
+	for _, location := range []*models.Location{
+		{ID: "FIJI", Latitude: -17.8, Longitude: 178.4},
+		{ID: "SAMOA", Latitude: -13.8, Longitude: -171.8},
+		{ID: "MADRID", Latitude: 40.4168, Longitude: -3.7038},
+	} {
+		location.Name, location.IsActive = location.ID, true
+		if err := in.svc.CreateLocation(ctx, location); err != nil {
+			t.Fatalf("creating %s: %v", location.ID, err)
+		}
+	}
+
+	rec := doJSON(t, router, http.MethodGet, "/locations/search/bbox?bbox=170,-20,-170,-10", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET bbox = %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Data []postgres.LocationWithTraffic `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	if len(body.Data) != 2 || body.Data[0].ID != "FIJI" || body.Data[1].ID != "SAMOA" {
+		t.Errorf("found %+v, want FIJI and SAMOA", body.Data)
+	}
+}
@@ -1 +1,164 @@
-package test
\ No newline at end of file
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/cmd/traffic-ingestor/internal/handler"
+	"api-traffic-analytics/internal/pkg/health"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+func newRouter(t *testing.T) (*gin.Engine, *ingestor) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	in := newIngestor(t)
+	return handler.NewRouter(handler.NewHandler(in.svc), health.NewChecker("traffic-ingestor", time.Second)), in
+}
+
+func doJSON(t *testing.T, router http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encoding body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTrafficRoundTrip(t *testing.T) {
+	router, in := newRouter(t)
+
+	rec := doJSON(t, router, http.MethodPost, "/locations", map[string]interface{}{
+		"id": "LOC001", "name": "Gran Via", "city": "Madrid", "latitude": 40.42, "longitude": -3.70,
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /locations = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = doJSON(t, router, http.MethodPost, "/traffic", map[string]interface{}{
+		"location_id": "LOC001", "vehicle_count": 80, "average_speed": 42.0, "congestion_level": "medium",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /traffic = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = doJSON(t, router, http.MethodGet, "/traffic/LOC001/latest", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET latest = %d: %s", rec.Code, rec.Body)
+	}
+	var latest struct {
+		Data models.TrafficData `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &latest); err != nil {
+		t.Fatalf("decoding latest: %v", err)
+	}
+	if latest.Data.VehicleCount != 80 || latest.Data.CongestionLevel != models.CongestionMedium {
+		t.Errorf("latest = %+v", latest.Data)
+	}
+
+	rec = doJSON(t, router, http.MethodGet, "/traffic?location_id=LOC001", nil)
+	var page models.PageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding page: %v", err)
+	}
+	if rec.Code != http.StatusOK || page.Count != 1 {
+		t.Errorf("GET /traffic = %d with %d readings, want 1", rec.Code, page.Count)
+	}
+
+	if msgs := in.broker.Messages(trafficTopic); len(msgs) != 1 {
+		t.Errorf("published %d messages, want 1", len(msgs))
+	}
+}
+
+func TestReceiveTrafficDataUnknownLocation(t *testing.T) {
+	router, _ := newRouter(t)
+
+	rec := doJSON(t, router, http.MethodPost, "/traffic", map[string]interface{}{
+		"location_id": "NOPE", "vehicle_count": 10, "average_speed": 50.0, "congestion_level": "low",
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("POST /traffic = %d, want 422: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestLatestTrafficNotFound(t *testing.T) {
+	router, _ := newRouter(t)
+
+	if rec := doJSON(t, router, http.MethodGet, "/traffic/NOPE/latest", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET latest = %d, want 404", rec.Code)
+	}
+}
+
+func TestListTrafficPagesThroughEqualTimestamps(t *testing.T) {
+	router, in := newRouter(t)
+	in.addLocation(t, "LOC001", true)
+	ctx := context.Background()
+
+	// Five readings share a timestamp: pages must split them by id
+	noon := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	var ids []int64
+	for _, ts := range []time.Time{noon, noon, noon.Add(time.Minute), noon, noon, noon} {
+		data := &models.TrafficData{LocationID: "LOC001", Timestamp: ts, CongestionLevel: models.CongestionLow}
+		if err := in.svc.ProcessTrafficData(ctx, data); err != nil {
+			t.Fatalf("ProcessTrafficData: %v", err)
+		}
+		ids = append(ids, data.ID)
+	}
+	want := []int64{ids[2], ids[5], ids[4], ids[3], ids[1], ids[0]}
+
+	var got []int64
+	path := "/traffic?location_id=LOC001&limit=2"
+	for pages := 0; ; pages++ {
+		if pages == len(want) {
+			t.Fatal("pagination did not end")
+		}
+		rec := doJSON(t, router, http.MethodGet, path, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d: %s", path, rec.Code, rec.Body)
+		}
+		var page struct {
+			Data       []models.TrafficData `json:"data"`
+			NextCursor string               `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("decoding page: %v", err)
+		}
+		for _, d := range page.Data {
+			got = append(got, d.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/traffic?location_id=LOC001&limit=2&cursor=" + page.NextCursor
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("paged ids %v, want %v", got, want)
+	}
+}
+
+func TestListTrafficRejectsInvalidCursors(t *testing.T) {
+	router, _ := newRouter(t)
+
+	for _, cursor := range []string{"%25%25", "bm90LWEtY3Vyc29y"} {
+		if rec := doJSON(t, router, http.MethodGet, "/traffic?cursor="+cursor, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /traffic?cursor=%s = %d, want 400", cursor, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"api-traffic-analytics/cmd/traffic-ingestor/internal/service"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// importResult is what a bulk import ended in
+type importResult int
+
+const (
+	imported importResult = iota
+	malformed
+	rejected
+)
+
+func classify(err error) importResult {
+	var validationErr *service.ValidationError
+	var importErr *service.ImportError
+	switch {
+	case err == nil:
+		return imported
+	case errors.As(err, &validationErr):
+		return malformed
+	case errors.As(err, &importErr):
+		return rejected
+	default:
+		return -1
+	}
+}
+
+func TestParseCSVLocations(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want importResult
+	}{
+		{"valid", "id,name,latitude,longitude,city\nLOC001,Gran Via,40.42,-3.70,Madrid\n", imported},
+		{"columns in any order", "Longitude, Latitude, Name, ID\n-3.70,40.42,Gran Via,LOC001\n", imported},
+		{"missing latitude column", "id,name,longitude\nLOC001,Gran Via,-3.70\n", malformed},
+		{"missing id column", "name,latitude,longitude\nGran Via,40.42,-3.70\n", malformed},
+		{"short row", "id,name,latitude,longitude\nLOC001,Gran Via,40.42\n", malformed},
+		{"empty file", "", malformed},
+		{"non numeric latitude", "id,name,latitude,longitude\nLOC001,Gran Via,north,-3.70\n", rejected},
+		{"NaN longitude", "id,name,latitude,longitude\nLOC001,Gran Via,40.42,NaN\n", rejected},
+		{"latitude out of range", "id,name,latitude,longitude\nLOC001,Gran Via,140.42,-3.70\n", rejected},
+		{"bad is_active", "id,name,latitude,longitude,is_active\nLOC001,Gran Via,40.42,-3.70,maybe\n", rejected},
+		{"missing name", "id,name,latitude,longitude\nLOC001,,40.42,-3.70\n", rejected},
+		{"duplicate ids", "id,name,latitude,longitude\nLOC001,Gran Via,40.42,-3.70\nLOC001,Sol,40.41,-3.70\n", rejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locations, err := service.ParseCSVLocations(strings.NewReader(tt.csv))
+			if err == nil {
+				err = newIngestor(t).svc.ImportLocations(context.Background(), locations)
+			}
+			if got := classify(err); got != tt.want {
+				t.Errorf("import ended in %d (%v), want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSVLocationsReadsEveryColumn(t *testing.T) {
+	csv := "id,name,description,latitude,longitude,address,city,country,is_active\n" +
+		"LOC001,Gran Via,Main street,40.42,-3.70,Gran Via 1,Madrid,Spain,false\n" +
+		"LOC002,Obelisco,,-34.60,-58.38,,Buenos Aires,,\n"
+	locations, err := service.ParseCSVLocations(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("ParseCSVLocations: %v", err)
+	}
+	if len(locations) != 2 {
+		t.Fatalf("parsed %d locations, want 2", len(locations))
+	}
+
+	first := locations[0]
+	if first.ID != "LOC001" || first.Description != "Main street" || first.Address != "Gran Via 1" ||
+		first.City != "Madrid" || first.Country != "Spain" || first.IsActive {
+		t.Errorf("first location = %+v", first)
+	}
+	if first.Latitude != 40.42 || first.Longitude != -3.70 {
+		t.Errorf("first location at (%v, %v), want (40.42, -3.70)", first.Latitude, first.Longitude)
+	}
+	if !locations[1].IsActive {
+		t.Errorf("a location without is_active should be active")
+	}
+}
+
+func TestParseGeoJSONLocations(t *testing.T) {
+	feature := func(id, coordinates, properties string) string {
+		return `{"type":"Feature","id":` + id + `,"geometry":{"type":"Point","coordinates":` + coordinates + `},"properties":` + properties + `}`
+	}
+	collection := func(features ...string) string {
+		return `{"type":"FeatureCollection","features":[` + strings.Join(features, ",") + `]}`
+	}
+
+	tests := []struct {
+		name    string
+		geojson string
+		want    importResult
+	}{
+		{"valid", collection(feature(`"LOC001"`, `[-3.70, 40.42]`, `{"name":"Gran Via"}`)), imported},
+		{"id in the properties", collection(feature(`null`, `[-3.70, 40.42]`, `{"id":"LOC001","name":"Gran Via"}`)), imported},
+		{"numeric id", collection(feature(`17`, `[-3.70, 40.42]`, `{"name":"Gran Via"}`)), imported},
+		{"invalid JSON", `{"type":"FeatureCollection","features":[`, malformed},
+		{"not a collection", feature(`"LOC001"`, `[-3.70, 40.42]`, `{"name":"Gran Via"}`), malformed},
+		{"not a point", collection(`{"type":"Feature","id":"LOC001","geometry":{"type":"LineString","coordinates":[[0,0],[1,1]]},"properties":{"name":"Gran Via"}}`), rejected},
+		{"single coordinate", collection(feature(`"LOC001"`, `[-3.70]`, `{"name":"Gran Via"}`)), rejected},
+		{"latitude first", collection(feature(`"LOC001"`, `[-34.60, -158.38]`, `{"name":"Obelisco"}`)), rejected},
+		{"bad is_active", collection(feature(`"LOC001"`, `[-3.70, 40.42]`, `{"name":"Gran Via","is_active":"yes"}`)), rejected},
+		{"missing id", collection(feature(`null`, `[-3.70, 40.42]`, `{"name":"Gran Via"}`)), rejected},
+		{"duplicate ids", collection(
+			feature(`"LOC001"`, `[-3.70, 40.42]`, `{"name":"Gran Via"}`),
+			feature(`null`, `[-3.70, 40.41]`, `{"id":"LOC001","name":"Sol"}`),
+		), rejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			locations, err := service.ParseGeoJSONLocations(strings.NewReader(tt.geojson))
+			if err == nil {
+				err = newIngestor(t).svc.ImportLocations(context.Background(), locations)
+			}
+			if got := classify(err); got != tt.want {
+				t.Errorf("import ended in %d (%v), want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGeoJSONLocationsReadsLongitudeFirst(t *testing.T) {
+	geojson := `{"type":"FeatureCollection","features":[{"type":"Feature","id":"LOC001",
+		"geometry":{"type":"Point","coordinates":[-58.38, -34.60]},
+		"properties":{"name":"Obelisco","city":"Buenos Aires","is_active":false}}]}`
+	locations, err := service.ParseGeoJSONLocations(strings.NewReader(geojson))
+	if err != nil {
+		t.Fatalf("ParseGeoJSONLocations: %v", err)
+	}
+	if len(locations) != 1 {
+		t.Fatalf("parsed %d locations, want 1", len(locations))
+	}
+	location := locations[0]
+	if location.Longitude != -58.38 || location.Latitude != -34.60 {
+		t.Errorf("location at (lat %v, lon %v), want (lat -34.60, lon -58.38)", location.Latitude, location.Longitude)
+	}
+	if location.City != "Buenos Aires" || location.IsActive {
+		t.Errorf("location = %+v", location)
+	}
+}
+
+func TestValidateLocationRejectsNaN(t *testing.T) {
+	for name, location := range map[string]*models.Location{
+		"latitude":  {ID: "LOC001", Name: "Gran Via", Latitude: math.NaN(), Longitude: -3.70},
+		"longitude": {ID: "LOC001", Name: "Gran Via", Latitude: 40.42, Longitude: math.NaN()},
+	} {
+		var validationErr *service.ValidationError
+		if err := service.ValidateLocation(location); !errors.As(err, &validationErr) {
+			t.Errorf("NaN %s: got %v, want a ValidationError", name, err)
+		}
+	}
+}
+
+func importLocations(router http.Handler, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/locations/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImportLocationsStatusCodes(t *testing.T) {
+	router, _ := newRouter(t)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"csv", "text/csv", "id,name,latitude,longitude\nLOC001,Gran Via,40.42,-3.70\n", http.StatusOK},
+		{"geojson", "application/geo+json", `{"type":"FeatureCollection","features":[{"type":"Feature","id":"LOC002","geometry":{"type":"Point","coordinates":[-3.70,40.41]},"properties":{"name":"Sol"}}]}`, http.StatusOK},
+		{"csv without a required column", "text/csv", "id,name,latitude\nLOC001,Gran Via,40.42\n", http.StatusBadRequest},
+		{"malformed geojson", "application/geo+json", `{"type":`, http.StatusBadRequest},
+		{"geojson that is not a collection", "application/json", `{"type":"Feature"}`, http.StatusBadRequest},
+		{"csv with NaN coordinates", "text/csv", "id,name,latitude,longitude\nLOC001,Gran Via,NaN,-3.70\n", http.StatusUnprocessableEntity},
+		{"csv with bad is_active", "text/csv", "id,name,latitude,longitude,is_active\nLOC001,Gran Via,40.42,-3.70,maybe\n", http.StatusUnprocessableEntity},
+		{"csv with duplicate ids", "text/csv", "id,name,latitude,longitude\nLOC003,A,40.42,-3.70\nLOC003,B,40.41,-3.70\n", http.StatusUnprocessableEntity},
+		{"plain text", "text/plain", "LOC001", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := importLocations(router, tt.contentType, tt.body); rec.Code != tt.want {
+				t.Errorf("POST /locations/import = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	// Rejected imports store nothing
+	rec := doJSON(t, router, http.MethodGet, "/locations", nil)
+	var page struct {
+		Data []models.Location `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decoding locations: %v", err)
+	}
+	if len(page.Data) != 2 {
+		t.Errorf("stored %d locations, want only the 2 of the accepted imports", len(page.Data))
+	}
+}
+
+func TestImportLocationsUpdatesExistingOnes(t *testing.T) {
+	router, in := newRouter(t)
+	in.addLocation(t, "LOC001", true)
+
+	rec := importLocations(router, "text/csv", "id,name,latitude,longitude,is_active\nLOC001,Renamed,40.42,-3.70,false\n")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /locations/import = %d: %s", rec.Code, rec.Body)
+	}
+	location, err := in.svc.GetLocation(context.Background(), "LOC001")
+	if err != nil {
+		t.Fatalf("GetLocation: %v", err)
+	}
+	if location.Name != "Renamed" || location.IsActive {
+		t.Errorf("imported location = %+v", location)
+	}
+}
+
+func TestLocationLifecycle(t *testing.T) {
+	router, _ := newRouter(t)
+
+	create := map[string]interface{}{"id": "LOC001", "name": "Gran Via", "city": "Madrid", "latitude": 40.42, "longitude": -3.70}
+	if rec := doJSON(t, router, http.MethodPost, "/locations", create); rec.Code != http.StatusCreated {
+		t.Fatalf("POST /locations = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doJSON(t, router, http.MethodPost, "/locations", create); rec.Code != http.StatusConflict {
+		t.Errorf("creating LOC001 again = %d, want 409", rec.Code)
+	}
+	for name, body := range map[string]interface{}{
+		"missing name":       map[string]interface{}{"id": "LOC002", "latitude": 40.42, "longitude": -3.70},
+		"latitude too large": map[string]interface{}{"id": "LOC002", "name": "Sol", "latitude": 140.42, "longitude": -3.70},
+		"missing id":         map[string]interface{}{"name": "Sol", "latitude": 40.42, "longitude": -3.70},
+	} {
+		if rec := doJSON(t, router, http.MethodPost, "/locations", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("creating a location with %s = %d, want 400", name, rec.Code)
+		}
+	}
+
+	update := map[string]interface{}{"name": "Gran Via (centro)", "city": "Madrid", "latitude": 40.42, "longitude": -3.70}
+	if rec := doJSON(t, router, http.MethodPut, "/locations/LOC001", update); rec.Code != http.StatusOK {
+		t.Fatalf("PUT /locations/LOC001 = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doJSON(t, router, http.MethodPut, "/locations/LOC999", update); rec.Code != http.StatusNotFound {
+		t.Errorf("updating an unknown location = %d, want 404", rec.Code)
+	}
+
+	if rec := doJSON(t, router, http.MethodDelete, "/locations/LOC001", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /locations/LOC001 = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := doJSON(t, router, http.MethodDelete, "/locations/LOC999", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("deactivating an unknown location = %d, want 404", rec.Code)
+	}
+
+	// Deactivated locations are kept, and listed as inactive
+	rec := doJSON(t, router, http.MethodGet, "/locations/LOC001", nil)
+	var got struct {
+		Data models.Location `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /locations/LOC001 = %d: %s", rec.Code, rec.Body)
+	}
+	if got.Data.Name != "Gran Via (centro)" || got.Data.IsActive {
+		t.Errorf("location = %+v", got.Data)
+	}
+
+	rec = doJSON(t, router, http.MethodGet, "/locations?active=false&city=Madrid", nil)
+	var page models.PageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil || page.Count != 1 {
+		t.Errorf("inactive locations in Madrid = %d (%v): %s", page.Count, err, rec.Body)
+	}
+	if rec := doJSON(t, router, http.MethodGet, "/locations?active=maybe", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /locations?active=maybe = %d, want 400", rec.Code)
+	}
+}
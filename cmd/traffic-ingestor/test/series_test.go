@@ -0,0 +1,134 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+type seriesBody struct {
+	Data struct {
+		Resolution string                        `json:"resolution"`
+		Source     string                        `json:"source"`
+		From       time.Time                     `json:"from"`
+		To         time.Time                     `json:"to"`
+		Points     []postgres.TrafficSeriesPoint `json:"points"`
+	} `json:"data"`
+}
+
+func TestSeriesPicksCoarserBucketsForLongerRanges(t *testing.T) {
+	router, _ := newRouter(t)
+
+	tests := []struct {
+		from, to   string
+		resolution string
+		source     string
+	}{
+		{from: "2024-05-01T00:00:00Z", to: "2024-05-02T00:00:00Z", resolution: "5m", source: postgres.SeriesSourceRaw},
+		{from: "2024-05-01T00:00:00Z", to: "2024-05-04T00:00:00Z", resolution: "15m", source: postgres.SeriesSourceRaw},
+		{from: "2024-05-01T00:00:00Z", to: "2024-05-15T00:00:00Z", resolution: "1h", source: postgres.SeriesSourceHourly},
+		{from: "2024-03-01T00:00:00Z", to: "2024-06-01T00:00:00Z", resolution: "6h", source: postgres.SeriesSourceHourly},
+		{from: "2023-06-01T00:00:00Z", to: "2024-06-01T00:00:00Z", resolution: "1d", source: postgres.SeriesSourceDaily},
+		{from: "2014-06-01T00:00:00Z", to: "2024-06-01T00:00:00Z", resolution: "7d", source: postgres.SeriesSourceDaily},
+		// Beyond 500 weeks the coarsest resolution is kept
+		{from: "1960-06-01T00:00:00Z", to: "2024-06-01T00:00:00Z", resolution: "7d", source: postgres.SeriesSourceDaily},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"/"+tt.to, func(t *testing.T) {
+			rec := doJSON(t, router, http.MethodGet, "/series/traffic?from="+tt.from+"&to="+tt.to, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET series = %d: %s", rec.Code, rec.Body)
+			}
+			var body seriesBody
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding series: %v", err)
+			}
+			if body.Data.Resolution != tt.resolution || body.Data.Source != tt.source {
+				t.Errorf("resolution %s from %s, want %s from %s", body.Data.Resolution, body.Data.Source, tt.resolution, tt.source)
+			}
+
+			from, _ := time.Parse(time.RFC3339, tt.from)
+			to, _ := time.Parse(time.RFC3339, tt.to)
+			if body.Data.From.After(from) || body.Data.To.Before(to) {
+				t.Errorf("series covers [%s, %s), want at least [%s, %s)", body.Data.From, body.Data.To, from, to)
+			}
+		})
+	}
+}
+
+func TestSeriesRejectsTooManyBuckets(t *testing.T) {
+	router, _ := newRouter(t)
+
+	for _, query := range []string{
+		"from=1900-01-01T00:00:00Z&to=2024-01-01T00:00:00Z",
+		"from=2020-01-01T00:00:00Z&to=2024-01-01T00:00:00Z&resolution=1h",
+	} {
+		rec := doJSON(t, router, http.MethodGet, "/series/traffic?"+query, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestSeriesWeeklyBucketsAddUpTheReadings(t *testing.T) {
+	router, in := newRouter(t)
+	in.addLocation(t, "LOC001", true)
+	ctx := context.Background()
+
+	// 1999-12-25 and 2000-01-01 are both Saturdays, the second one the origin
+	for _, reading := range []struct {
+		at       string
+		vehicles int
+	}{
+		{at: "1999-12-20T10:00:00Z", vehicles: 1},
+		{at: "1999-12-25T00:00:00Z", vehicles: 2},
+		{at: "1999-12-31T23:59:59Z", vehicles: 4},
+		{at: "2000-01-01T00:00:00Z", vehicles: 8},
+		{at: "2000-01-07T12:00:00Z", vehicles: 16},
+	} {
+		at, _ := time.Parse(time.RFC3339, reading.at)
+		data := &models.TrafficData{LocationID: "LOC001", Timestamp: at, VehicleCount: reading.vehicles, CongestionLevel: models.CongestionLow}
+		if err := in.svc.ProcessTrafficData(ctx, data); err != nil {
+			t.Fatalf("ProcessTrafficData: %v", err)
+		}
+	}
+
+	rec := doJSON(t, router, http.MethodGet, "/series/traffic?location_id=LOC001&resolution=7d&from=1999-12-22T00:00:00Z&to=2000-01-05T00:00:00Z", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET series = %d: %s", rec.Code, rec.Body)
+	}
+	var body seriesBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding series: %v", err)
+	}
+
+	// The range widens to whole weeks on both sides of the origin
+	wantFrom := time.Date(1999, 12, 18, 0, 0, 0, 0, time.UTC)
+	wantTo := time.Date(2000, 1, 8, 0, 0, 0, 0, time.UTC)
+	if !body.Data.From.Equal(wantFrom) || !body.Data.To.Equal(wantTo) {
+		t.Errorf("series covers [%s, %s), want [%s, %s)", body.Data.From, body.Data.To, wantFrom, wantTo)
+	}
+
+	want := []struct {
+		bucket   time.Time
+		vehicles int64
+	}{
+		{bucket: wantFrom, vehicles: 1},
+		{bucket: time.Date(1999, 12, 25, 0, 0, 0, 0, time.UTC), vehicles: 2 + 4},
+		{bucket: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), vehicles: 8 + 16},
+	}
+	if len(body.Data.Points) != len(want) {
+		t.Fatalf("got %d points, want %d: %+v", len(body.Data.Points), len(want), body.Data.Points)
+	}
+	for i, point := range body.Data.Points {
+		if !point.BucketStart.Equal(want[i].bucket) || point.VehicleTotal != want[i].vehicles {
+			t.Errorf("point %d = %s with %d vehicles, want %s with %d", i, point.BucketStart, point.VehicleTotal, want[i].bucket, want[i].vehicles)
+		}
+	}
+}
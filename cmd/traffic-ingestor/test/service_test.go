@@ -1 +1,154 @@
-package test
\ No newline at end of file
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/cmd/traffic-ingestor/internal/repository"
+	"api-traffic-analytics/cmd/traffic-ingestor/internal/service"
+	"api-traffic-analytics/internal/pkg/kafka"
+	"api-traffic-analytics/internal/pkg/memory"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+const trafficTopic = "traffic-data"
+
+// ingestor is a traffic-ingestor wired to the in-memory fakes
+type ingestor struct {
+	svc    *service.Service
+	store  *memory.Store
+	cache  *memory.CacheRepository
+	broker *memory.Broker
+}
+
+func newIngestor(t *testing.T) *ingestor {
+	t.Helper()
+
+	store := memory.NewStore()
+	cache := memory.NewCacheRepository()
+	broker := memory.NewBroker()
+	repo := repository.NewRepository(
+		memory.NewTrafficDataRepository(store),
+		memory.NewLocationRepository(store),
+		memory.NewRollupRepository(store),
+		cache,
+		time.Minute,
+	)
+
+	return &ingestor{
+		svc:    service.NewService(repo, broker.Producer(trafficTopic, "traffic-ingestor")),
+		store:  store,
+		cache:  cache,
+		broker: broker,
+	}
+}
+
+func (in *ingestor) addLocation(t *testing.T, id string, active bool) {
+	t.Helper()
+
+	location := &models.Location{ID: id, Name: "Location " + id, City: "Madrid", Latitude: 40.4168, Longitude: -3.7038, IsActive: active}
+	if err := in.svc.CreateLocation(context.Background(), location); err != nil {
+		t.Fatalf("creating location %s: %v", id, err)
+	}
+}
+
+func TestProcessTrafficDataStoresCachesAndPublishes(t *testing.T) {
+	in := newIngestor(t)
+	in.addLocation(t, "LOC001", true)
+	ctx := context.Background()
+
+	data := &models.TrafficData{LocationID: "LOC001", VehicleCount: 120, AverageSpeed: 35.5, CongestionLevel: models.CongestionHigh}
+	if err := in.svc.ProcessTrafficData(ctx, data); err != nil {
+		t.Fatalf("ProcessTrafficData: %v", err)
+	}
+
+	latest, err := in.svc.GetLatestTrafficData(ctx, "LOC001")
+	if err != nil {
+		t.Fatalf("GetLatestTrafficData: %v", err)
+	}
+	if latest.ID != data.ID || latest.VehicleCount != 120 {
+		t.Errorf("latest reading = %+v, want id %d with 120 vehicles", latest, data.ID)
+	}
+
+	if cached, _ := in.cache.GetCache(ctx, "latest_traffic:LOC001"); cached == "" {
+		t.Error("latest reading was not cached")
+	}
+
+	msgs := in.broker.Messages(trafficTopic)
+	if len(msgs) != 1 {
+		t.Fatalf("published %d messages, want 1", len(msgs))
+	}
+	if string(msgs[0].Key) != "LOC001" {
+		t.Errorf("message key = %q, want LOC001", msgs[0].Key)
+	}
+	published, env, err := kafka.DecodeTrafficData(msgs[0])
+	if err != nil {
+		t.Fatalf("decoding published message: %v", err)
+	}
+	if env.Source != "traffic-ingestor" || env.EventType != kafka.EventTypeTrafficRecorded {
+		t.Errorf("envelope = %+v", env)
+	}
+	if published.UUID != data.UUID || published.Location.City != "Madrid" {
+		t.Errorf("published reading = %+v", published)
+	}
+}
+
+// countingLocations counts the location lookups that reach the database
+type countingLocations struct {
+	*memory.LocationRepository
+	lookups int
+}
+
+func (r *countingLocations) GetByID(ctx context.Context, id string) (*models.Location, error) {
+	r.lookups++
+	return r.LocationRepository.GetByID(ctx, id)
+}
+
+func TestProcessTrafficDataLooksUpLocationsThroughTheCache(t *testing.T) {
+	store := memory.NewStore()
+	locations := &countingLocations{LocationRepository: memory.NewLocationRepository(store)}
+	broker := memory.NewBroker()
+	repo := repository.NewRepository(memory.NewTrafficDataRepository(store), locations, memory.NewRollupRepository(store), memory.NewCacheRepository(), time.Minute)
+	svc := service.NewService(repo, broker.Producer(trafficTopic, "traffic-ingestor"))
+	ctx := context.Background()
+
+	if err := svc.CreateLocation(ctx, &models.Location{ID: "LOC001", Name: "Gran Via", City: "Madrid", Latitude: 40.42, Longitude: -3.70, IsActive: true}); err != nil {
+		t.Fatalf("creating location: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := svc.ProcessTrafficData(ctx, &models.TrafficData{LocationID: "LOC001", VehicleCount: i, CongestionLevel: models.CongestionLow}); err != nil {
+			t.Fatalf("ProcessTrafficData: %v", err)
+		}
+	}
+
+	if locations.lookups != 1 {
+		t.Errorf("location read from the database %d times for 5 readings, want 1", locations.lookups)
+	}
+	for _, msg := range broker.Messages(trafficTopic) {
+		if data, _, err := kafka.DecodeTrafficData(msg); err != nil || data.Location.City != "Madrid" {
+			t.Errorf("published reading = %+v, %v", data, err)
+		}
+	}
+}
+
+func TestProcessTrafficDataRejectsUnknownAndInactiveLocations(t *testing.T) {
+	in := newIngestor(t)
+	in.addLocation(t, "LOC002", false)
+	ctx := context.Background()
+
+	err := in.svc.ProcessTrafficData(ctx, &models.TrafficData{LocationID: "MISSING", CongestionLevel: models.CongestionLow})
+	if !errors.Is(err, service.ErrUnknownLocation) {
+		t.Errorf("unknown location: got %v, want ErrUnknownLocation", err)
+	}
+
+	err = in.svc.ProcessTrafficData(ctx, &models.TrafficData{LocationID: "LOC002", CongestionLevel: models.CongestionLow})
+	if !errors.Is(err, service.ErrInactiveLocation) {
+		t.Errorf("inactive location: got %v, want ErrInactiveLocation", err)
+	}
+
+	if msgs := in.broker.Messages(trafficTopic); len(msgs) != 0 {
+		t.Errorf("published %d messages for rejected readings", len(msgs))
+	}
+}
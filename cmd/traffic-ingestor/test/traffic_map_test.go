@@ -0,0 +1,130 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+func TestHeatmapBinsReadingsIntoCells(t *testing.T) {
+	router, in := newRouter(t)
+	ctx := context.Background()
+
+	for _, location := range []*models.Location{
+		{ID: "SOL", Latitude: 40.4168, Longitude: -3.7038},
+		{ID: "OPERA", Latitude: 40.4180, Longitude: -3.7090},
+		{ID: "CASTELLANA", Latitude: 40.4530, Longitude: -3.6883},
+		{ID: "POLE", Latitude: 90, Longitude: 180},
+	} {
+		location.Name, location.City, location.IsActive = location.ID, "Madrid", true
+		if err := in.svc.CreateLocation(ctx, location); err != nil {
+			t.Fatalf("creating %s: %v", location.ID, err)
+		}
+	}
+	for _, data := range []*models.TrafficData{
+		{LocationID: "SOL", VehicleCount: 100, AverageSpeed: 20, CongestionLevel: models.CongestionSevere},
+		{LocationID: "SOL", VehicleCount: 50, AverageSpeed: 40, CongestionLevel: models.CongestionLow},
+		{LocationID: "OPERA", VehicleCount: 30, AverageSpeed: 30, CongestionLevel: models.CongestionMedium},
+		{LocationID: "CASTELLANA", VehicleCount: 10, AverageSpeed: 60, CongestionLevel: models.CongestionLow},
+		{LocationID: "POLE", VehicleCount: 1, AverageSpeed: 5, CongestionLevel: models.CongestionLow},
+	} {
+		if err := in.svc.ProcessTrafficData(ctx, data); err != nil {
+			t.Fatalf("ProcessTrafficData(%s): %v", data.LocationID, err)
+		}
+	}
+
+	rec := doJSON(t, router, http.MethodGet, "/map/heatmap?cell_size=0.01&format=json", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET heatmap = %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Data  []postgres.HeatmapCell `json:"data"`
+		Count int                    `json:"count"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding heatmap: %v", err)
+	}
+	if body.Count != 3 || len(body.Data) != 3 {
+		t.Fatalf("heatmap has %d cells, want 3: %+v", len(body.Data), body.Data)
+	}
+
+	// Cells come ordered by latitude then longitude index
+	center, north, pole := body.Data[0], body.Data[1], body.Data[2]
+	if !closeTo(center.MinLat, 40.41) || !closeTo(center.MaxLat, 40.42) || !closeTo(center.MinLon, -3.71) || !closeTo(center.MaxLon, -3.70) {
+		t.Errorf("center cell bounds = %+v", center)
+	}
+	if center.SampleCount != 3 || center.LocationCount != 2 {
+		t.Errorf("center cell has %d samples from %d locations, want 3 from 2", center.SampleCount, center.LocationCount)
+	}
+	if !closeTo(center.AvgVehicleCount, 60) || !closeTo(center.AvgSpeed, 30) || !closeTo(center.CongestionScore, (1+0+1.0/3)/3) {
+		t.Errorf("center cell averages = %+v", center)
+	}
+	if north.SampleCount != 1 || !closeTo(north.MinLat, 40.45) || !closeTo(north.MinLon, -3.69) {
+		t.Errorf("north cell = %+v", north)
+	}
+	if pole.MaxLat != 90 || pole.MaxLon != 180 || pole.MaxLat <= pole.MinLat || pole.MaxLon <= pole.MinLon {
+		t.Errorf("pole cell = %+v, want a non empty cell ending at 90, 180", pole)
+	}
+}
+
+func TestHeatmapGeoJSONPolygons(t *testing.T) {
+	router, in := newRouter(t)
+	in.addLocation(t, "LOC001", true)
+	if err := in.svc.ProcessTrafficData(context.Background(), &models.TrafficData{LocationID: "LOC001", VehicleCount: 7, CongestionLevel: models.CongestionHigh}); err != nil {
+		t.Fatalf("ProcessTrafficData: %v", err)
+	}
+
+	rec := doJSON(t, router, http.MethodGet, "/map/heatmap?cell_size=0.5&format=geojson", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET heatmap = %d: %s", rec.Code, rec.Body)
+	}
+	var collection models.GeoJSONFeatureCollection
+	if err := json.Unmarshal(rec.Body.Bytes(), &collection); err != nil {
+		t.Fatalf("decoding GeoJSON: %v", err)
+	}
+	if len(collection.Features) != 1 {
+		t.Fatalf("got %d features, want 1", len(collection.Features))
+	}
+
+	feature := collection.Features[0]
+	if feature.Geometry.Type != "Polygon" {
+		t.Fatalf("geometry type = %s, want Polygon", feature.Geometry.Type)
+	}
+	raw, _ := json.Marshal(feature.Geometry.Coordinates)
+	var rings [][][]float64
+	if err := json.Unmarshal(raw, &rings); err != nil {
+		t.Fatalf("decoding coordinates: %v", err)
+	}
+	want := [][]float64{{-4, 40}, {-3.5, 40}, {-3.5, 40.5}, {-4, 40.5}, {-4, 40}}
+	if len(rings) != 1 || len(rings[0]) != len(want) {
+		t.Fatalf("rings = %v, want %v", rings, want)
+	}
+	for i, point := range rings[0] {
+		if !closeTo(point[0], want[i][0]) || !closeTo(point[1], want[i][1]) {
+			t.Errorf("ring point %d = %v, want %v", i, point, want[i])
+		}
+	}
+	if feature.Properties["sample_count"] != float64(1) || feature.Properties["avg_vehicle_count"] != float64(7) {
+		t.Errorf("properties = %v", feature.Properties)
+	}
+}
+
+func TestHeatmapRejectsInvalidCellSizes(t *testing.T) {
+	router, _ := newRouter(t)
+
+	for _, cellSize := range []string{"0", "0.0001", "2", "-1", "abc"} {
+		rec := doJSON(t, router, http.MethodGet, "/map/heatmap?cell_size="+cellSize, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("cell_size=%s: got %d, want 400", cellSize, rec.Code)
+		}
+	}
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
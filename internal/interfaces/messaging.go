@@ -0,0 +1,41 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	segkafka "github.com/segmentio/kafka-go"
+
+	"api-traffic-analytics/internal/pkg/kafka"
+)
+
+// EventProducer publica mensajes y eventos con sobre versionado en un tópico
+type EventProducer interface {
+	WriteMessages(ctx context.Context, msgs ...segkafka.Message) error
+	NewEventMessage(key, eventType string, schemaVersion int, payload interface{}) (segkafka.Message, error)
+	PublishEvent(ctx context.Context, key, eventType string, schemaVersion int, payload interface{}) error
+	Close() error
+}
+
+// MessageConsumer lee mensajes de un tópico y confirma los procesados
+type MessageConsumer interface {
+	FetchMessage(ctx context.Context) (segkafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...segkafka.Message) error
+	Close() error
+}
+
+// MessageReplayer lee un tópico partición a partición entre offsets
+// explícitos, fuera de cualquier grupo de consumidores
+type MessageReplayer interface {
+	Partitions(ctx context.Context) ([]int, error)
+	Offsets(ctx context.Context, partition int) (first, last int64, err error)
+	OffsetAt(ctx context.Context, partition int, t time.Time) (int64, error)
+	ReadPartition(ctx context.Context, partition int, from, to int64, fn func(segkafka.Message) error) error
+}
+
+var (
+	_ EventProducer   = (*kafka.Producer)(nil)
+	_ MessageConsumer = (*kafka.Consumer)(nil)
+	_ MessageConsumer = (*kafka.BroadcastConsumer)(nil)
+	_ MessageReplayer = (*kafka.Replayer)(nil)
+)
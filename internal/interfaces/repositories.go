@@ -0,0 +1,128 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/pkg/redis"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// TrafficDataRepository almacena y consulta lecturas de tráfico
+type TrafficDataRepository interface {
+	Create(ctx context.Context, data *models.TrafficData) (*models.TrafficData, error)
+	Query(ctx context.Context, filter postgres.TrafficDataFilter) ([]*models.TrafficData, string, error)
+	GetLatestByLocation(ctx context.Context, locationID string) (*models.TrafficData, error)
+	Heatmap(ctx context.Context, spec postgres.HeatmapSpec) ([]*postgres.HeatmapCell, error)
+	ListRange(ctx context.Context, rng postgres.TrafficRange) ([]*models.TrafficData, error)
+}
+
+// LocationRepository gestiona el registro de ubicaciones y sus búsquedas espaciales
+type LocationRepository interface {
+	Create(ctx context.Context, location *models.Location) error
+	GetByID(ctx context.Context, id string) (*models.Location, error)
+	List(ctx context.Context, filter postgres.LocationFilter) ([]*models.Location, error)
+	Update(ctx context.Context, location *models.Location) error
+	SetActive(ctx context.Context, id string, active bool) error
+	BulkUpsert(ctx context.Context, locations []*models.Location) error
+	WithinRadius(ctx context.Context, center postgres.GeoPoint, radiusMeters float64, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error)
+	Nearest(ctx context.Context, center postgres.GeoPoint, k int, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error)
+	WithinBoundingBox(ctx context.Context, box postgres.BoundingBox, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error)
+	WithinPolygon(ctx context.Context, ring []postgres.GeoPoint, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error)
+	CurrentStatus(ctx context.Context, filter postgres.MapFilter) ([]*postgres.LocationStatus, error)
+}
+
+// RollupRepository mantiene los rollups de tráfico y sirve series temporales
+type RollupRepository interface {
+	Refresh(ctx context.Context, until time.Time) (int64, error)
+	Series(ctx context.Context, spec postgres.SeriesSpec) ([]*postgres.TrafficSeriesPoint, string, error)
+}
+
+// AnalyticsResultRepository almacena y consulta resultados de análisis
+type AnalyticsResultRepository interface {
+	BulkInsert(ctx context.Context, results []*models.AnalyticsResult) error
+	Upsert(ctx context.Context, results []*models.AnalyticsResult) error
+	ListByPeriod(ctx context.Context, from, to time.Time, metricTypes ...string) ([]*models.AnalyticsResult, error)
+	LatestByMetric(ctx context.Context, locationID, metricType string) (*models.AnalyticsResult, error)
+	Query(ctx context.Context, filter postgres.AnalyticsFilter) ([]*models.AnalyticsResult, string, error)
+	Aggregate(ctx context.Context, spec postgres.AggregateSpec) ([]*postgres.AnalyticsAggregate, error)
+	Summary(ctx context.Context, locationID, metricType string) ([]*models.AnalyticsSummary, error)
+}
+
+// AlertRepository almacena alertas y sus cambios de estado
+type AlertRepository interface {
+	Create(ctx context.Context, alert *models.Alert) error
+	GetByID(ctx context.Context, id int64) (*models.Alert, error)
+	List(ctx context.Context, filter postgres.AlertFilter) ([]*models.Alert, error)
+	FindOpen(ctx context.Context, locationID, alertType string) (*models.Alert, error)
+	Transition(ctx context.Context, id int64, apply func(alert *models.Alert) error) (*models.Alert, string, error)
+}
+
+// BackfillCheckpointRepository guarda el progreso de los reprocesamientos históricos
+type BackfillCheckpointRepository interface {
+	Get(ctx context.Context, name string) (*models.BackfillCheckpoint, error)
+	Save(ctx context.Context, checkpoint *models.BackfillCheckpoint) error
+	Delete(ctx context.Context, name string) error
+}
+
+// APIKeyRepository gestiona las API keys del api-gateway
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	GetByID(ctx context.Context, id int) (*models.APIKey, error)
+	GetByKeyID(ctx context.Context, keyID string) (*models.APIKey, error)
+	List(ctx context.Context, filter postgres.APIKeyFilter) ([]*models.APIKey, error)
+	Revoke(ctx context.Context, id int, at time.Time) (*models.APIKey, error)
+	Rotate(ctx context.Context, id int, replacement *models.APIKey, graceUntil time.Time) error
+	TouchLastUsed(ctx context.Context, id int, at time.Time) error
+}
+
+// ConfigurationRepository lee los ajustes de la tabla configurations
+type ConfigurationRepository interface {
+	GetString(ctx context.Context, key, defaultValue string) (string, error)
+	GetInt(ctx context.Context, key string, defaultValue int) (int, error)
+}
+
+// PartitionManager crea y retira las particiones mensuales de una tabla
+type PartitionManager interface {
+	List(ctx context.Context, table string) ([]postgres.Partition, error)
+	ListArchived(ctx context.Context, table string) ([]postgres.Partition, error)
+	EnsureMonthly(ctx context.Context, table string, now time.Time, monthsAhead int) ([]string, error)
+	Retire(ctx context.Context, table string, now time.Time, keepMonths int, action string) ([]string, error)
+}
+
+// TrafficArchiveRepository exporta lecturas de tráfico para archivarlas y
+// las restaura en tablas de staging
+type TrafficArchiveRepository interface {
+	Export(ctx context.Context, src postgres.ExportSource, fn func(*models.TrafficData) error) error
+	LoadStaging(ctx context.Context, table string, fill func(insert func([]*models.TrafficData) error) error) error
+}
+
+// CacheRepository es una caché clave-valor con expiración
+type CacheRepository interface {
+	SetCache(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	SetCacheIfAbsent(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	GetCache(ctx context.Context, key string) (string, error)
+	DeleteCache(ctx context.Context, keys ...string) error
+}
+
+// RateLimiter cuenta requests por clave con un estado común a todas las réplicas
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit redis.RateLimit) (*redis.RateLimitResult, error)
+}
+
+// Las implementaciones de PostgreSQL y Redis cumplen las interfaces
+var (
+	_ TrafficDataRepository        = (*postgres.TrafficDataRepository)(nil)
+	_ LocationRepository           = (*postgres.LocationRepository)(nil)
+	_ RollupRepository             = (*postgres.RollupRepository)(nil)
+	_ AnalyticsResultRepository    = (*postgres.AnalyticsResultRepository)(nil)
+	_ AlertRepository              = (*postgres.AlertRepository)(nil)
+	_ BackfillCheckpointRepository = (*postgres.BackfillCheckpointRepository)(nil)
+	_ APIKeyRepository             = (*postgres.APIKeyRepository)(nil)
+	_ ConfigurationRepository      = (*postgres.ConfigurationRepository)(nil)
+	_ PartitionManager             = (*postgres.PartitionManager)(nil)
+	_ TrafficArchiveRepository     = (*postgres.TrafficDataRepository)(nil)
+	_ CacheRepository              = (*redis.CacheRepository)(nil)
+	_ RateLimiter                  = (*redis.RateLimiter)(nil)
+)
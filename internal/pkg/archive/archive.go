@@ -0,0 +1,406 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// Formats archives are written in. Parquet, with zstd compressed columns, is
+// the default; gzip compressed newline delimited JSON, one reading per line,
+// is the fallback for consumers without a Parquet reader. Manifests record the
+// format, so Restore reads both.
+const (
+	FormatParquet    = "parquet"
+	FormatNDJSONGzip = "ndjson.gz"
+)
+
+// manifestFile is the name of the manifest inside an archive. It is written
+// last, so an archive without one is incomplete.
+const manifestFile = "manifest.json"
+
+// Manifest describes an archive: what was exported and the files holding it
+type Manifest struct {
+	Name      string         `json:"name"`
+	Table     string         `json:"table"`
+	Format    string         `json:"format"`
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Rows      int64          `json:"rows"`
+	Files     []ManifestFile `json:"files"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// ManifestFile is one file of an archive. Key is relative to the archive and
+// SHA256 is the checksum of the stored (compressed) bytes.
+type ManifestFile struct {
+	Key    string `json:"key"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// ErrChecksumMismatch is returned when a file does not match its manifest
+var ErrChecksumMismatch = errors.New("archive checksum mismatch")
+
+// ErrUnsupportedFormat is returned for formats other than FormatParquet and
+// FormatNDJSONGzip
+var ErrUnsupportedFormat = errors.New("unsupported archive format")
+
+// record is how a reading is serialized. The location is left out: the
+// shadowing field is always nil and omitted.
+type record struct {
+	*models.TrafficData
+	Location *struct{} `json:"location,omitempty"`
+}
+
+// Archiver writes traffic data archives to a Store. Each archive lives under
+// <prefix>/<name>/ and holds numbered data files plus manifest.json.
+type Archiver struct {
+	store       Store
+	prefix      string
+	format      string
+	rowsPerFile int64
+}
+
+// NewArchiver creates a new instance of Archiver writing data files in format,
+// FormatParquet when empty. Data files are split every rowsPerFile rows.
+func NewArchiver(store Store, prefix, format string, rowsPerFile int64) (*Archiver, error) {
+	if format == "" {
+		format = FormatParquet
+	}
+	if format != FormatParquet && format != FormatNDJSONGzip {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedFormat, format)
+	}
+	if rowsPerFile <= 0 {
+		rowsPerFile = 1000000
+	}
+	return &Archiver{store: store, prefix: prefix, format: format, rowsPerFile: rowsPerFile}, nil
+}
+
+// Exists reports whether a complete archive with that name exists
+func (a *Archiver) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := a.ReadManifest(ctx, name)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ReadManifest reads the manifest of an archive
+func (a *Archiver) ReadManifest(ctx context.Context, name string) (*Manifest, error) {
+	body, err := a.store.Get(ctx, a.key(name, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("error decoding manifest of %s: %w", name, err)
+	}
+	return &manifest, nil
+}
+
+// Export writes an archive. stream must call emit once per reading; the
+// readings are written to data files as they come, and the manifest (with
+// Name, Table, From and To taken from spec) is written once all of them are
+// stored.
+func (a *Archiver) Export(ctx context.Context, spec Manifest, stream func(emit func(*models.TrafficData) error) error) (*Manifest, error) {
+	manifest := spec
+	manifest.Format = a.format
+	manifest.Rows = 0
+	manifest.Files = nil
+
+	var part *partWriter
+	flush := func() error {
+		if part == nil {
+			return nil
+		}
+		file, err := part.finish(ctx, a.store, a.key(manifest.Name, part.key))
+		part = nil
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	}
+	defer func() {
+		if part != nil {
+			part.discard()
+		}
+	}()
+
+	err := stream(func(data *models.TrafficData) error {
+		if part == nil {
+			var err error
+			if part, err = newPartWriter(fmt.Sprintf("part-%05d.%s", len(manifest.Files), a.format), a.format); err != nil {
+				return err
+			}
+		}
+		if err := part.write(data); err != nil {
+			return err
+		}
+		manifest.Rows++
+		if part.rows >= a.rowsPerFile {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error exporting %s: %w", manifest.Name, err)
+	}
+	if err := flush(); err != nil {
+		return nil, fmt.Errorf("error exporting %s: %w", manifest.Name, err)
+	}
+
+	manifest.CreatedAt = time.Now().UTC()
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := a.store.Put(ctx, a.key(manifest.Name, manifestFile), bytes.NewReader(content)); err != nil {
+		return nil, fmt.Errorf("error writing manifest of %s: %w", manifest.Name, err)
+	}
+	return &manifest, nil
+}
+
+// Restore reads every file of an archive and passes its readings to load in
+// batches of up to batchSize. A file whose checksum or row count does not
+// match the manifest makes Restore fail with ErrChecksumMismatch once the file
+// has been read, so load should run inside a transaction. Parquet files are
+// checksummed before any of their rows are loaded.
+func (a *Archiver) Restore(ctx context.Context, name string, batchSize int, load func([]*models.TrafficData) error) (*Manifest, error) {
+	manifest, err := a.ReadManifest(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	restoreFile := a.restoreNDJSON
+	switch manifest.Format {
+	case FormatNDJSONGzip:
+	case FormatParquet:
+		restoreFile = a.restoreParquet
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedFormat, manifest.Format)
+	}
+
+	for _, file := range manifest.Files {
+		if err := restoreFile(ctx, name, file, batchSize, load); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// restoreParquet downloads a Parquet data file, which is only readable with
+// random access, to a temporary file and checks it before loading its rows
+func (a *Archiver) restoreParquet(ctx context.Context, name string, file ManifestFile, batchSize int, load func([]*models.TrafficData) error) error {
+	body, err := a.store.Get(ctx, a.key(name, file.Key))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "restore-*."+FormatParquet)
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), body)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", file.Key, err)
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != file.SHA256 || size != file.Bytes {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, file.Key)
+	}
+
+	rows, err := readParquet(tmp, size, batchSize, load)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", file.Key, err)
+	}
+	if rows != file.Rows {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, file.Key)
+	}
+	return nil
+}
+
+func (a *Archiver) restoreNDJSON(ctx context.Context, name string, file ManifestFile, batchSize int, load func([]*models.TrafficData) error) error {
+	body, err := a.store.Get(ctx, a.key(name, file.Key))
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	hasher := sha256.New()
+	counter := &countingWriter{w: hasher}
+	gz, err := gzip.NewReader(io.TeeReader(body, counter))
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", file.Key, err)
+	}
+
+	decoder := json.NewDecoder(gz)
+	var rows int64
+	batch := make([]*models.TrafficData, 0, batchSize)
+	for {
+		data := &models.TrafficData{}
+		if err := decoder.Decode(&record{TrafficData: data}); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error decoding %s: %w", file.Key, err)
+		}
+		rows++
+		batch = append(batch, data)
+		if len(batch) == batchSize {
+			if err := load(batch); err != nil {
+				return err
+			}
+			batch = make([]*models.TrafficData, 0, batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		if err := load(batch); err != nil {
+			return err
+		}
+	}
+
+	// Drain whatever follows the gzip stream so the checksum covers the whole file
+	if _, err := io.Copy(io.Discard, io.TeeReader(body, counter)); err != nil {
+		return fmt.Errorf("error reading %s: %w", file.Key, err)
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != file.SHA256 || counter.n != file.Bytes || rows != file.Rows {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, file.Key)
+	}
+	return nil
+}
+
+func (a *Archiver) key(name, file string) string {
+	return path.Join(a.prefix, name, file)
+}
+
+// rowEncoder writes readings in the format of a data file
+type rowEncoder interface {
+	encode(data *models.TrafficData) error
+	// close writes whatever the format keeps buffered, like the gzip trailer
+	// or the Parquet footer
+	close() error
+}
+
+// partWriter encodes readings into a temporary file, hashing the stored
+// bytes as they are written
+type partWriter struct {
+	key     string
+	file    *os.File
+	hasher  hash.Hash
+	counter *countingWriter
+	buf     *bufio.Writer
+	encoder rowEncoder
+	rows    int64
+}
+
+func newPartWriter(key, format string) (*partWriter, error) {
+	file, err := os.CreateTemp("", "archive-*."+format)
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file: %w", err)
+	}
+
+	hasher := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(file, hasher)}
+	buf := bufio.NewWriter(counter)
+	var encoder rowEncoder
+	if format == FormatParquet {
+		encoder = newParquetEncoder(buf)
+	} else {
+		encoder = newNDJSONEncoder(buf)
+	}
+	return &partWriter{
+		key:     key,
+		file:    file,
+		hasher:  hasher,
+		counter: counter,
+		buf:     buf,
+		encoder: encoder,
+	}, nil
+}
+
+func (p *partWriter) write(data *models.TrafficData) error {
+	p.rows++
+	return p.encoder.encode(data)
+}
+
+// finish closes the encoded stream and uploads the file to the store
+func (p *partWriter) finish(ctx context.Context, store Store, key string) (ManifestFile, error) {
+	defer p.discard()
+
+	if err := p.encoder.close(); err != nil {
+		return ManifestFile{}, err
+	}
+	if err := p.buf.Flush(); err != nil {
+		return ManifestFile{}, err
+	}
+	if _, err := p.file.Seek(0, io.SeekStart); err != nil {
+		return ManifestFile{}, err
+	}
+	if err := store.Put(ctx, key, p.file); err != nil {
+		return ManifestFile{}, err
+	}
+
+	return ManifestFile{
+		Key:    p.key,
+		Rows:   p.rows,
+		Bytes:  p.counter.n,
+		SHA256: hex.EncodeToString(p.hasher.Sum(nil)),
+	}, nil
+}
+
+func (p *partWriter) discard() {
+	p.file.Close()
+	os.Remove(p.file.Name())
+}
+
+// ndjsonEncoder writes readings as gzip compressed NDJSON
+type ndjsonEncoder struct {
+	gz      *gzip.Writer
+	encoder *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) *ndjsonEncoder {
+	gz := gzip.NewWriter(w)
+	return &ndjsonEncoder{gz: gz, encoder: json.NewEncoder(gz)}
+}
+
+func (e *ndjsonEncoder) encode(data *models.TrafficData) error {
+	return e.encoder.Encode(record{TrafficData: data})
+}
+
+func (e *ndjsonEncoder) close() error {
+	return e.gz.Close()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,156 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// parquetBatchSize is how many readings are buffered before handing them to
+// the Parquet writer, and how many are read at once when restoring
+const parquetBatchSize = 1024
+
+// parquetRowGroupSize bounds the readings held in memory per row group
+const parquetRowGroupSize = 128 * 1024
+
+// parquetRecord is the Parquet schema of a reading. Columns keep the names of
+// traffic_data, and the nullable ones are optional.
+type parquetRecord struct {
+	ID              int64     `parquet:"id"`
+	UUID            string    `parquet:"uuid"`
+	Timestamp       time.Time `parquet:"timestamp,timestamp(microsecond)"`
+	LocationID      string    `parquet:"location_id,dict"`
+	VehicleCount    int64     `parquet:"vehicle_count"`
+	AverageSpeed    float64   `parquet:"average_speed"`
+	CongestionLevel string    `parquet:"congestion_level,dict"`
+	MaxSpeed        *float64  `parquet:"max_speed,optional"`
+	MinSpeed        *float64  `parquet:"min_speed,optional"`
+	Occupancy       *float64  `parquet:"occupancy,optional"`
+	QueueLength     float64   `parquet:"queue_length"`
+	TravelTime      float64   `parquet:"travel_time"`
+	DataSource      string    `parquet:"data_source,dict"`
+	IsValidated     bool      `parquet:"is_validated"`
+	CreatedAt       time.Time `parquet:"created_at,timestamp(microsecond)"`
+	UpdatedAt       time.Time `parquet:"updated_at,timestamp(microsecond)"`
+}
+
+func newParquetRecord(data *models.TrafficData) parquetRecord {
+	return parquetRecord{
+		ID:              data.ID,
+		UUID:            data.UUID,
+		Timestamp:       data.Timestamp,
+		LocationID:      data.LocationID,
+		VehicleCount:    int64(data.VehicleCount),
+		AverageSpeed:    data.AverageSpeed,
+		CongestionLevel: data.CongestionLevel,
+		MaxSpeed:        data.MaxSpeed,
+		MinSpeed:        data.MinSpeed,
+		Occupancy:       data.Occupancy,
+		QueueLength:     data.QueueLength,
+		TravelTime:      data.TravelTime,
+		DataSource:      data.DataSource,
+		IsValidated:     data.IsValidated,
+		CreatedAt:       data.CreatedAt,
+		UpdatedAt:       data.UpdatedAt,
+	}
+}
+
+func (r *parquetRecord) trafficData() *models.TrafficData {
+	return &models.TrafficData{
+		ID:              r.ID,
+		UUID:            r.UUID,
+		Timestamp:       r.Timestamp.UTC(),
+		LocationID:      r.LocationID,
+		VehicleCount:    int(r.VehicleCount),
+		AverageSpeed:    r.AverageSpeed,
+		CongestionLevel: r.CongestionLevel,
+		MaxSpeed:        r.MaxSpeed,
+		MinSpeed:        r.MinSpeed,
+		Occupancy:       r.Occupancy,
+		QueueLength:     r.QueueLength,
+		TravelTime:      r.TravelTime,
+		DataSource:      r.DataSource,
+		IsValidated:     r.IsValidated,
+		CreatedAt:       r.CreatedAt.UTC(),
+		UpdatedAt:       r.UpdatedAt.UTC(),
+	}
+}
+
+// parquetEncoder writes readings as a zstd compressed Parquet file
+type parquetEncoder struct {
+	writer  *parquet.GenericWriter[parquetRecord]
+	pending []parquetRecord
+}
+
+func newParquetEncoder(w io.Writer) *parquetEncoder {
+	return &parquetEncoder{
+		writer: parquet.NewGenericWriter[parquetRecord](w,
+			parquet.Compression(&parquet.Zstd),
+			parquet.MaxRowsPerRowGroup(parquetRowGroupSize)),
+		pending: make([]parquetRecord, 0, parquetBatchSize),
+	}
+}
+
+func (e *parquetEncoder) encode(data *models.TrafficData) error {
+	e.pending = append(e.pending, newParquetRecord(data))
+	if len(e.pending) == parquetBatchSize {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *parquetEncoder) flush() error {
+	if _, err := e.writer.Write(e.pending); err != nil {
+		return err
+	}
+	e.pending = e.pending[:0]
+	return nil
+}
+
+func (e *parquetEncoder) close() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+	return e.writer.Close()
+}
+
+// readParquet reads the readings of a Parquet data file in batches of up to
+// batchSize and returns how many it read
+func readParquet(file *os.File, size int64, batchSize int, load func([]*models.TrafficData) error) (int64, error) {
+	f, err := parquet.OpenFile(file, size)
+	if err != nil {
+		return 0, err
+	}
+	reader := parquet.NewGenericReader[parquetRecord](f)
+	defer reader.Close()
+
+	var rows int64
+	records := make([]parquetRecord, batchSize)
+	for {
+		// Optional columns are read into the pointers already in records
+		clear(records)
+		n, err := reader.Read(records)
+		if n > 0 {
+			batch := make([]*models.TrafficData, n)
+			for i := range batch {
+				batch[i] = records[i].trafficData()
+			}
+			rows += int64(n)
+			if err := load(batch); err != nil {
+				return rows, err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, fmt.Errorf("error decoding rows: %w", err)
+		}
+	}
+}
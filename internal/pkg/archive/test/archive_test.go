@@ -0,0 +1,285 @@
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/archive"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+var january = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var formats = []string{archive.FormatParquet, archive.FormatNDJSONGzip}
+
+func readings(n int) []*models.TrafficData {
+	out := make([]*models.TrafficData, n)
+	for i := range out {
+		out[i] = &models.TrafficData{
+			ID:              int64(i + 1),
+			UUID:            fmt.Sprintf("reading-%d", i+1),
+			LocationID:      "LOC001",
+			Timestamp:       january.Add(time.Duration(i) * time.Minute),
+			VehicleCount:    i,
+			AverageSpeed:    42.5,
+			CongestionLevel: models.CongestionLow,
+			Location:        models.Location{ID: "LOC001", City: "Madrid"},
+		}
+		if i%2 == 0 {
+			occupancy := float64(i)
+			out[i].Occupancy = &occupancy
+		}
+	}
+	return out
+}
+
+func stream(data []*models.TrafficData) func(emit func(*models.TrafficData) error) error {
+	return func(emit func(*models.TrafficData) error) error {
+		for _, d := range data {
+			if err := emit(d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func newArchiver(t *testing.T, dir, format string) *archive.Archiver {
+	t.Helper()
+
+	archiver, err := archive.NewArchiver(archive.NewLocalStore(dir), "traffic", format, 4)
+	if err != nil {
+		t.Fatalf("NewArchiver: %v", err)
+	}
+	return archiver
+}
+
+func exportJanuary(t *testing.T, dir, format string, rows int) *archive.Manifest {
+	t.Helper()
+
+	archiver := newArchiver(t, dir, format)
+	spec := archive.Manifest{Name: "traffic_data_y2024m01", Table: "traffic_data", From: january, To: january.AddDate(0, 1, 0)}
+	manifest, err := archiver.Export(context.Background(), spec, stream(readings(rows)))
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	return manifest
+}
+
+func TestNewArchiverDefaultsToParquet(t *testing.T) {
+	archiver, err := archive.NewArchiver(archive.NewLocalStore(t.TempDir()), "", "", 0)
+	if err != nil {
+		t.Fatalf("NewArchiver: %v", err)
+	}
+	manifest, err := archiver.Export(context.Background(), archive.Manifest{Name: "traffic_data_y2024m01"}, stream(readings(1)))
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if manifest.Format != archive.FormatParquet || manifest.Files[0].Key != "part-00000.parquet" {
+		t.Errorf("default archive is %s in %s, want parquet", manifest.Format, manifest.Files[0].Key)
+	}
+
+	if _, err := archive.NewArchiver(archive.NewLocalStore(t.TempDir()), "", "csv", 0); !errors.Is(err, archive.ErrUnsupportedFormat) {
+		t.Errorf("NewArchiver with csv: got %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestExportSplitsFilesAndRecordsChecksums(t *testing.T) {
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			testExportSplitsFiles(t, format)
+		})
+	}
+}
+
+func testExportSplitsFiles(t *testing.T, format string) {
+	dir := t.TempDir()
+	manifest := exportJanuary(t, dir, format, 10)
+
+	if manifest.Format != format || manifest.Rows != 10 {
+		t.Errorf("manifest format %q with %d rows, want %s with 10", manifest.Format, manifest.Rows, format)
+	}
+	if !manifest.From.Equal(january) || manifest.Table != "traffic_data" {
+		t.Errorf("manifest spec = %s from %s", manifest.Table, manifest.From)
+	}
+
+	wantRows := []int64{4, 4, 2}
+	if len(manifest.Files) != len(wantRows) {
+		t.Fatalf("exported %d files, want %d", len(manifest.Files), len(wantRows))
+	}
+	for i, file := range manifest.Files {
+		if want := fmt.Sprintf("part-%05d.%s", i, format); file.Key != want {
+			t.Errorf("file %d key = %s, want %s", i, file.Key, want)
+		}
+		if file.Rows != wantRows[i] {
+			t.Errorf("%s has %d rows, want %d", file.Key, file.Rows, wantRows[i])
+		}
+
+		stored, err := os.ReadFile(filepath.Join(dir, "traffic", manifest.Name, file.Key))
+		if err != nil {
+			t.Fatalf("reading %s: %v", file.Key, err)
+		}
+		sum := sha256.Sum256(stored)
+		if file.SHA256 != hex.EncodeToString(sum[:]) || file.Bytes != int64(len(stored)) {
+			t.Errorf("%s manifest says %d bytes %s, stored %d bytes %x", file.Key, file.Bytes, file.SHA256, len(stored), sum)
+		}
+	}
+
+	archiver := newArchiver(t, dir, format)
+	read, err := archiver.ReadManifest(context.Background(), manifest.Name)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	if read.Rows != manifest.Rows || len(read.Files) != len(manifest.Files) {
+		t.Errorf("stored manifest = %+v, want %+v", read, manifest)
+	}
+}
+
+func TestExistsNeedsTheManifest(t *testing.T) {
+	dir := t.TempDir()
+	archiver := newArchiver(t, dir, archive.FormatParquet)
+	ctx := context.Background()
+
+	if exists, err := archiver.Exists(ctx, "traffic_data_y2024m01"); err != nil || exists {
+		t.Fatalf("Exists before export = %v, %v", exists, err)
+	}
+
+	// A failed export leaves its data files behind but no manifest
+	failure := errors.New("connection reset")
+	_, err := archiver.Export(ctx, archive.Manifest{Name: "traffic_data_y2024m01"}, func(emit func(*models.TrafficData) error) error {
+		for _, d := range readings(6) {
+			if err := emit(d); err != nil {
+				return err
+			}
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Export error = %v, want the stream error", err)
+	}
+	if exists, err := archiver.Exists(ctx, "traffic_data_y2024m01"); err != nil || exists {
+		t.Errorf("Exists after a failed export = %v, %v", exists, err)
+	}
+
+	exportJanuary(t, dir, archive.FormatParquet, 3)
+	if exists, err := archiver.Exists(ctx, "traffic_data_y2024m01"); err != nil || !exists {
+		t.Errorf("Exists after export = %v, %v", exists, err)
+	}
+}
+
+func TestRestoreReadsBackEveryReadingInBatches(t *testing.T) {
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			testRestoreReadsBack(t, format)
+		})
+	}
+}
+
+func testRestoreReadsBack(t *testing.T, format string) {
+	dir := t.TempDir()
+	manifest := exportJanuary(t, dir, format, 10)
+	archiver := newArchiver(t, dir, format)
+
+	var batches []int
+	var restored []*models.TrafficData
+	got, err := archiver.Restore(context.Background(), manifest.Name, 3, func(batch []*models.TrafficData) error {
+		batches = append(batches, len(batch))
+		restored = append(restored, batch...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got.Rows != 10 {
+		t.Errorf("restored manifest has %d rows, want 10", got.Rows)
+	}
+
+	// Batches never span two files
+	if want := []int{3, 1, 3, 1, 2}; fmt.Sprint(batches) != fmt.Sprint(want) {
+		t.Errorf("batch sizes = %v, want %v", batches, want)
+	}
+	original := readings(10)
+	if len(restored) != len(original) {
+		t.Fatalf("restored %d readings, want %d", len(restored), len(original))
+	}
+	for i, data := range restored {
+		want := original[i]
+		if data.ID != want.ID || data.UUID != want.UUID || !data.Timestamp.Equal(want.Timestamp) || data.VehicleCount != want.VehicleCount {
+			t.Errorf("reading %d = %+v, want %+v", i, data, want)
+		}
+		if (data.Occupancy == nil) != (want.Occupancy == nil) || (want.Occupancy != nil && *data.Occupancy != *want.Occupancy) {
+			t.Errorf("reading %d occupancy = %v, want %v", i, data.Occupancy, want.Occupancy)
+		}
+		if data.Location.ID != "" {
+			t.Errorf("reading %d restored with a location", i)
+		}
+	}
+}
+
+func TestRestoreRejectsATamperedFile(t *testing.T) {
+	dir := t.TempDir()
+	manifest := exportJanuary(t, dir, archive.FormatNDJSONGzip, 10)
+	archiver := newArchiver(t, dir, archive.FormatNDJSONGzip)
+
+	// Append a second gzip member: still valid gzip, but not what was archived
+	second := filepath.Join(dir, "traffic", manifest.Name, manifest.Files[1].Key)
+	extra, err := os.ReadFile(filepath.Join(dir, "traffic", manifest.Name, manifest.Files[2].Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(second, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(extra)
+	f.Close()
+
+	_, err = archiver.Restore(context.Background(), manifest.Name, 100, func([]*models.TrafficData) error { return nil })
+	if !errors.Is(err, archive.ErrChecksumMismatch) {
+		t.Errorf("Restore of a tampered archive: got %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestRestoreRejectsATamperedParquetFileBeforeLoading(t *testing.T) {
+	dir := t.TempDir()
+	manifest := exportJanuary(t, dir, archive.FormatParquet, 10)
+	archiver := newArchiver(t, dir, archive.FormatParquet)
+
+	// Flip a byte of the second file
+	second := filepath.Join(dir, "traffic", manifest.Name, manifest.Files[1].Key)
+	content, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(content)/2] ^= 0xff
+	if err := os.WriteFile(second, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded int
+	_, err = archiver.Restore(context.Background(), manifest.Name, 100, func(batch []*models.TrafficData) error {
+		loaded += len(batch)
+		return nil
+	})
+	if !errors.Is(err, archive.ErrChecksumMismatch) {
+		t.Errorf("Restore of a tampered archive: got %v, want ErrChecksumMismatch", err)
+	}
+	if loaded != int(manifest.Files[0].Rows) {
+		t.Errorf("loaded %d readings, want only the %d of the first file", loaded, manifest.Files[0].Rows)
+	}
+}
+
+func TestRestoreOfAMissingArchive(t *testing.T) {
+	archiver := newArchiver(t, t.TempDir(), archive.FormatParquet)
+	_, err := archiver.Restore(context.Background(), "traffic_data_y2024m01", 100, func([]*models.TrafficData) error { return nil })
+	if !errors.Is(err, archive.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
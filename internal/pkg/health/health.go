@@ -0,0 +1,140 @@
+// Package health serves the liveness and readiness endpoints of the services.
+// Readiness runs the dependency checks of the service concurrently, each with
+// a timeout.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"api-traffic-analytics/internal/shared"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// DefaultTimeout bounds each dependency check
+const DefaultTimeout = 2 * time.Second
+
+// Statuses of a service or dependency
+const (
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+	StatusDegraded  = "degraded"
+)
+
+// Check returns an error when a dependency cannot be used
+type Check func(ctx context.Context) error
+
+// Checker holds the dependency checks of a service
+type Checker struct {
+	service string
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+}
+
+// NewChecker creates a Checker for service without checks
+func NewChecker(service string, timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{service: service, timeout: timeout, checks: make(map[string]Check)}
+}
+
+// Add registers the check of a dependency
+func (c *Checker) Add(name string, check Check) *Checker {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+	return c
+}
+
+// Ready runs every check and reports whether all of them passed, with the
+// status of each dependency
+func (c *Checker) Ready(ctx context.Context) (*models.HealthCheckResponse, bool) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]string, len(c.names))
+	var wg sync.WaitGroup
+	for i, name := range c.names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, c.checks[name])
+	}
+	wg.Wait()
+
+	response := &models.HealthCheckResponse{
+		Status:    StatusHealthy,
+		Timestamp: models.TimeNow(),
+		Version:   shared.Version,
+		Services:  map[string]string{c.service: StatusHealthy},
+	}
+	ready := true
+	for i, name := range c.names {
+		response.Services[name] = results[i]
+		if results[i] != StatusHealthy {
+			ready = false
+		}
+	}
+	if !ready {
+		response.Status = StatusUnhealthy
+		response.Services[c.service] = StatusUnhealthy
+	}
+	return response, ready
+}
+
+// run returns the status of a check, which gives up when ctx is done even if
+// the check does not
+func run(ctx context.Context, check Check) string {
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Sprintf("%s: %v", StatusUnhealthy, err)
+		}
+		return StatusHealthy
+	case <-ctx.Done():
+		return StatusUnhealthy + ": timed out"
+	}
+}
+
+// Register adds GET /health/live, which only tells that the process serves
+// requests, and GET /health/ready, which answers 503 while a dependency is
+// down
+func (c *Checker) Register(router gin.IRoutes) {
+	router.GET("/health/live", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, models.HealthCheckResponse{
+			Status:    StatusHealthy,
+			Timestamp: models.TimeNow(),
+			Version:   shared.Version,
+		})
+	})
+	router.GET("/health/ready", func(ctx *gin.Context) {
+		response, ready := c.Ready(ctx.Request.Context())
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		ctx.JSON(status, response)
+	})
+}
+
+// MaxLag fails while lag reports more than max pending messages
+func MaxLag(lag func() int64, max int64) Check {
+	return func(ctx context.Context) error {
+		if pending := lag(); pending > max {
+			return fmt.Errorf("consumer lag %d above %d", pending, max)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,144 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// BroadcastConsumer reads every partition of a topic from its end, outside of
+// any consumer group, so every process running one receives all the messages
+// written after it started. Nothing is committed and no group is left behind
+// in the brokers. Partitions added to the topic after it starts are not read.
+type BroadcastConsumer struct {
+	brokers []string
+	topic   string
+
+	mu       sync.Mutex
+	readers  []*kafka.Reader
+	messages chan kafka.Message
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// CreateBroadcastConsumer creates a new BroadcastConsumer of topic. It
+// connects on the first fetch.
+func CreateBroadcastConsumer(brokers []string, topic string) *BroadcastConsumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BroadcastConsumer{
+		brokers:  brokers,
+		topic:    topic,
+		messages: make(chan kafka.Message),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// FetchMessage returns the next message of any partition.
+func (c *BroadcastConsumer) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if err := c.start(ctx); err != nil {
+		return kafka.Message{}, err
+	}
+
+	select {
+	case msg := <-c.messages:
+		return msg, nil
+	case <-c.ctx.Done():
+		return kafka.Message{}, io.EOF
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+// CommitMessages does nothing: there is no group to commit offsets to.
+func (c *BroadcastConsumer) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	return nil
+}
+
+// Close closes the partition readers.
+func (c *BroadcastConsumer) Close() error {
+	c.cancel()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for _, reader := range c.readers {
+		errs = append(errs, reader.Close())
+	}
+	c.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// start opens a reader at the end of every partition the first time it is
+// called, and again after a failed attempt
+func (c *BroadcastConsumer) start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.readers != nil {
+		return nil
+	}
+	if c.ctx.Err() != nil {
+		return io.EOF
+	}
+
+	partitions, err := NewReplayer(c.brokers, c.topic).Partitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	readers := make([]*kafka.Reader, 0, len(partitions))
+	for _, partition := range partitions {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     c.brokers,
+			Topic:       c.topic,
+			Partition:   partition,
+			MinBytes:    1,
+			MaxBytes:    10e6, // 10MB
+			MaxWait:     500 * time.Millisecond,
+			ErrorLogger: kafka.LoggerFunc(log.Printf),
+		})
+		if err := reader.SetOffset(kafka.LastOffset); err != nil {
+			reader.Close()
+			for _, r := range readers {
+				r.Close()
+			}
+			return err
+		}
+		readers = append(readers, reader)
+	}
+
+	c.readers = readers
+	for _, reader := range readers {
+		c.wg.Add(1)
+		go c.read(reader)
+	}
+	return nil
+}
+
+// read forwards the messages of one partition until the consumer is closed
+func (c *BroadcastConsumer) read(reader *kafka.Reader) {
+	defer c.wg.Done()
+
+	for {
+		msg, err := reader.FetchMessage(c.ctx)
+		if err != nil {
+			if c.ctx.Err() == nil && !errors.Is(err, io.EOF) {
+				log.Printf("kafka: stopped reading %s/%d: %v", c.topic, reader.Config().Partition, err)
+			}
+			return
+		}
+
+		select {
+		case c.messages <- msg:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
@@ -28,6 +28,25 @@ func CreateConsumer(brokers []string, topic string, groupID string) *Consumer {
 	}
 }
 
+// CreateTailConsumer creates a consumer that starts at the end of the topic
+// when its group has no committed offsets. Processes sharing the group id
+// share the partitions; use a BroadcastConsumer for every process to receive
+// all messages.
+func CreateTailConsumer(brokers []string, topic string, groupID string) *Consumer {
+	return &Consumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     brokers,
+			GroupID:     groupID,
+			Topic:       topic,
+			MinBytes:    1,
+			MaxBytes:    10e6, // 10MB
+			MaxWait:     500 * time.Millisecond,
+			StartOffset: kafka.LastOffset,
+			ErrorLogger: kafka.LoggerFunc(log.Printf),
+		}),
+	}
+}
+
 // FetchMessage fetches a message from Kafka.
 func (c *Consumer) FetchMessage(ctx context.Context) (kafka.Message, error) {
 	return c.reader.FetchMessage(ctx)
@@ -42,3 +61,21 @@ func (c *Consumer) CommitMessages(ctx context.Context, msgs ...kafka.Message) er
 func (c *Consumer) Close() error {
 	return c.reader.Close()
 }
+
+// Lag returns how many messages the consumer is behind the end of its
+// partitions, as of the last fetch.
+func (c *Consumer) Lag() int64 {
+	return c.reader.Stats().Lag
+}
+
+// Ping checks that one of the brokers accepts connections.
+func Ping(ctx context.Context, brokers []string) error {
+	var err error
+	for _, broker := range brokers {
+		var conn *kafka.Conn
+		if conn, err = kafka.DialContext(ctx, "tcp", broker); err == nil {
+			return conn.Close()
+		}
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// Header names used to carry the event envelope.
+const (
+	HeaderSchemaVersion = "schema-version"
+	HeaderEventID       = "event-id"
+	HeaderEventType     = "event-type"
+	HeaderProducedAt    = "produced-at"
+	HeaderSource        = "source-service"
+	HeaderContentType   = "content-type"
+)
+
+// LegacySchemaVersion is assumed for messages published without envelope headers.
+const LegacySchemaVersion = 1
+
+// Envelope describes an event published to Kafka. It travels in the message
+// headers so the payload stays a plain JSON document.
+type Envelope struct {
+	SchemaVersion int
+	EventID       string
+	EventType     string
+	ProducedAt    time.Time
+	Source        string
+}
+
+// NewEnvelope creates an envelope with a fresh event id.
+func NewEnvelope(eventType string, schemaVersion int, source string) Envelope {
+	return Envelope{
+		SchemaVersion: schemaVersion,
+		EventID:       uuid.NewString(),
+		EventType:     eventType,
+		ProducedAt:    time.Now().UTC(),
+		Source:        source,
+	}
+}
+
+// Headers returns the envelope encoded as Kafka headers.
+func (e Envelope) Headers() []kafka.Header {
+	return []kafka.Header{
+		{Key: HeaderSchemaVersion, Value: []byte(strconv.Itoa(e.SchemaVersion))},
+		{Key: HeaderEventID, Value: []byte(e.EventID)},
+		{Key: HeaderEventType, Value: []byte(e.EventType)},
+		{Key: HeaderProducedAt, Value: []byte(e.ProducedAt.Format(time.RFC3339Nano))},
+		{Key: HeaderSource, Value: []byte(e.Source)},
+		{Key: HeaderContentType, Value: []byte("application/json")},
+	}
+}
+
+// ParseEnvelope reads the envelope from Kafka headers. Messages without a
+// schema-version header are treated as LegacySchemaVersion.
+func ParseEnvelope(headers []kafka.Header) (Envelope, error) {
+	env := Envelope{SchemaVersion: LegacySchemaVersion}
+
+	for _, h := range headers {
+		switch h.Key {
+		case HeaderSchemaVersion:
+			v, err := strconv.Atoi(string(h.Value))
+			if err != nil || v < 1 {
+				return env, fmt.Errorf("invalid %s header: %q", HeaderSchemaVersion, h.Value)
+			}
+			env.SchemaVersion = v
+		case HeaderEventID:
+			env.EventID = string(h.Value)
+		case HeaderEventType:
+			env.EventType = string(h.Value)
+		case HeaderProducedAt:
+			t, err := time.Parse(time.RFC3339Nano, string(h.Value))
+			if err != nil {
+				return env, fmt.Errorf("invalid %s header: %w", HeaderProducedAt, err)
+			}
+			env.ProducedAt = t
+		case HeaderSource:
+			env.Source = string(h.Value)
+		}
+	}
+
+	return env, nil
+}
+
+// NewMessage builds a keyed Kafka message carrying payload as JSON and the
+// envelope as headers.
+func NewMessage(key string, env Envelope, payload interface{}) (kafka.Message, error) {
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("error encoding %s payload: %w", env.EventType, err)
+	}
+
+	return kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: env.Headers(),
+		Time:    env.ProducedAt,
+	}, nil
+}
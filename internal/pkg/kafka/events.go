@@ -0,0 +1,317 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// Event types and their current schema versions.
+const (
+	EventTypeTrafficRecorded = "traffic.reading.recorded"
+	TrafficDataSchemaVersion = 2
+)
+
+// TrafficDataEvent is the payload of a traffic.reading.recorded event.
+//
+// Version history:
+//   - v1: raw json.Marshal(models.TrafficData), including the nested Location
+//     and the database id, published without headers.
+//   - v2: flat reading without the nested Location. City was added later as
+//     an optional, additive field rather than a new version: readings
+//     published without it decode with an empty Location.
+type TrafficDataEvent struct {
+	UUID            string    `json:"uuid,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+	LocationID      string    `json:"location_id"`
+	City            string    `json:"city,omitempty"`
+	VehicleCount    int       `json:"vehicle_count"`
+	AverageSpeed    float64   `json:"average_speed"`
+	CongestionLevel string    `json:"congestion_level"`
+	MaxSpeed        *float64  `json:"max_speed,omitempty"`
+	MinSpeed        *float64  `json:"min_speed,omitempty"`
+	Occupancy       *float64  `json:"occupancy,omitempty"`
+	QueueLength     float64   `json:"queue_length"`
+	TravelTime      float64   `json:"travel_time"`
+	DataSource      string    `json:"data_source,omitempty"`
+	IsValidated     bool      `json:"is_validated"`
+}
+
+// NewTrafficDataEvent builds the current event payload from a traffic reading.
+func NewTrafficDataEvent(data *models.TrafficData) TrafficDataEvent {
+	return TrafficDataEvent{
+		UUID:            data.UUID,
+		Timestamp:       data.Timestamp,
+		LocationID:      data.LocationID,
+		City:            data.Location.City,
+		VehicleCount:    data.VehicleCount,
+		AverageSpeed:    data.AverageSpeed,
+		CongestionLevel: data.CongestionLevel,
+		MaxSpeed:        data.MaxSpeed,
+		MinSpeed:        data.MinSpeed,
+		Occupancy:       data.Occupancy,
+		QueueLength:     data.QueueLength,
+		TravelTime:      data.TravelTime,
+		DataSource:      data.DataSource,
+		IsValidated:     data.IsValidated,
+	}
+}
+
+// ToModel converts the event payload back into a traffic reading. The
+// Location is only filled in with what the event carries (id and city).
+func (e TrafficDataEvent) ToModel() *models.TrafficData {
+	data := &models.TrafficData{
+		UUID:            e.UUID,
+		Timestamp:       e.Timestamp,
+		LocationID:      e.LocationID,
+		VehicleCount:    e.VehicleCount,
+		AverageSpeed:    e.AverageSpeed,
+		CongestionLevel: e.CongestionLevel,
+		MaxSpeed:        e.MaxSpeed,
+		MinSpeed:        e.MinSpeed,
+		Occupancy:       e.Occupancy,
+		QueueLength:     e.QueueLength,
+		TravelTime:      e.TravelTime,
+		DataSource:      e.DataSource,
+		IsValidated:     e.IsValidated,
+	}
+	if e.City != "" {
+		data.Location = models.Location{ID: e.LocationID, City: e.City}
+	}
+	return data
+}
+
+// upcaster rewrites a payload from one schema version to the next.
+type upcaster func(payload []byte) ([]byte, error)
+
+// trafficDataUpcasters maps a schema version to the function that lifts it
+// to version+1.
+var trafficDataUpcasters = map[int]upcaster{
+	1: upcastTrafficDataV1,
+}
+
+func upcastTrafficDataV1(payload []byte) ([]byte, error) {
+	var legacy models.TrafficData
+	if err := json.Unmarshal(payload, &legacy); err != nil {
+		return nil, fmt.Errorf("invalid v1 traffic data: %w", err)
+	}
+	return json.Marshal(NewTrafficDataEvent(&legacy))
+}
+
+// DecodeTrafficData decodes a traffic.reading.recorded message, upcasting
+// older schema versions to the current one.
+func DecodeTrafficData(msg kafka.Message) (*models.TrafficData, Envelope, error) {
+	env, err := ParseEnvelope(msg.Headers)
+	if err != nil {
+		return nil, env, err
+	}
+
+	if env.EventType != "" && env.EventType != EventTypeTrafficRecorded {
+		return nil, env, fmt.Errorf("unexpected event type %q", env.EventType)
+	}
+
+	payload, err := upcast(msg.Value, env.SchemaVersion, TrafficDataSchemaVersion, trafficDataUpcasters)
+	if err != nil {
+		return nil, env, err
+	}
+
+	var event TrafficDataEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, env, fmt.Errorf("JSON unmarshal failed: %w", err)
+	}
+
+	return event.ToModel(), env, nil
+}
+
+// upcast applies upcasters until the payload reaches the target version.
+func upcast(payload []byte, from, to int, upcasters map[int]upcaster) ([]byte, error) {
+	if from > to {
+		return nil, fmt.Errorf("unsupported schema version %d (latest known is %d)", from, to)
+	}
+
+	for v := from; v < to; v++ {
+		up, ok := upcasters[v]
+		if !ok {
+			return nil, fmt.Errorf("no upcaster from schema version %d", v)
+		}
+
+		var err error
+		payload, err = up(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return payload, nil
+}
+
+// Event types published by the analytics-processor and the alerting-service.
+const (
+	EventTypeAnalyticsResultStored = "analytics.result.stored"
+	AnalyticsResultSchemaVersion   = 1
+
+	EventTypeAlertStatusChanged = "alert.status.changed"
+	AlertSchemaVersion          = 1
+)
+
+// AnalyticsResultEvent is the payload of an analytics.result.stored event.
+type AnalyticsResultEvent struct {
+	UUID              string          `json:"uuid,omitempty"`
+	AnalysisTimestamp time.Time       `json:"analysis_timestamp"`
+	PeriodStart       time.Time       `json:"period_start"`
+	PeriodEnd         time.Time       `json:"period_end"`
+	LocationID        string          `json:"location_id,omitempty"`
+	MetricType        string          `json:"metric_type"`
+	Value             float64         `json:"value"`
+	Unit              string          `json:"unit,omitempty"`
+	ConfidenceLevel   *float64        `json:"confidence_level,omitempty"`
+	Trend             string          `json:"trend,omitempty"`
+	SampleSize        *int            `json:"sample_size,omitempty"`
+	AggregationMethod string          `json:"aggregation_method,omitempty"`
+	IsAnomaly         bool            `json:"is_anomaly"`
+	Metadata          json.RawMessage `json:"metadata,omitempty"`
+}
+
+// NewAnalyticsResultEvent builds the event payload for a stored result.
+func NewAnalyticsResultEvent(result *models.AnalyticsResult) AnalyticsResultEvent {
+	event := AnalyticsResultEvent{
+		UUID:              result.UUID,
+		AnalysisTimestamp: result.AnalysisTimestamp,
+		PeriodStart:       result.PeriodStart,
+		PeriodEnd:         result.PeriodEnd,
+		MetricType:        result.MetricType,
+		Value:             result.Value,
+		Unit:              result.Unit,
+		ConfidenceLevel:   result.ConfidenceLevel,
+		Trend:             result.Trend,
+		SampleSize:        result.SampleSize,
+		AggregationMethod: result.AggregationMethod,
+		IsAnomaly:         result.IsAnomaly,
+	}
+	if result.LocationID != nil {
+		event.LocationID = *result.LocationID
+	}
+	if len(result.Metadata) > 0 {
+		event.Metadata = json.RawMessage(result.Metadata)
+	}
+	return event
+}
+
+// DecodeAnalyticsResultEvent decodes an analytics.result.stored message.
+func DecodeAnalyticsResultEvent(msg kafka.Message) (*AnalyticsResultEvent, Envelope, error) {
+	env, err := ParseEnvelope(msg.Headers)
+	if err != nil {
+		return nil, env, err
+	}
+
+	if env.EventType != EventTypeAnalyticsResultStored {
+		return nil, env, fmt.Errorf("unexpected event type %q", env.EventType)
+	}
+
+	payload, err := upcast(msg.Value, env.SchemaVersion, AnalyticsResultSchemaVersion, nil)
+	if err != nil {
+		return nil, env, err
+	}
+
+	var event AnalyticsResultEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, env, fmt.Errorf("JSON unmarshal failed: %w", err)
+	}
+
+	return &event, env, nil
+}
+
+// AlertEvent is the payload of an alert.status.changed event. PreviousStatus
+// is empty when the alert has just been raised.
+type AlertEvent struct {
+	ID              int        `json:"id"`
+	UUID            string     `json:"uuid,omitempty"`
+	Timestamp       time.Time  `json:"timestamp"`
+	LocationID      string     `json:"location_id,omitempty"`
+	City            string     `json:"city,omitempty"`
+	AlertType       string     `json:"alert_type"`
+	Severity        string     `json:"severity"`
+	Message         string     `json:"message"`
+	Value           *float64   `json:"value,omitempty"`
+	Threshold       *float64   `json:"threshold,omitempty"`
+	Category        string     `json:"category,omitempty"`
+	Priority        int        `json:"priority"`
+	PreviousStatus  string     `json:"previous_status,omitempty"`
+	Status          string     `json:"status"`
+	AssignedTo      string     `json:"assigned_to,omitempty"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy      string     `json:"resolved_by,omitempty"`
+	ResolutionNotes string     `json:"resolution_notes,omitempty"`
+	ChangedAt       time.Time  `json:"changed_at"`
+}
+
+// NewAlertEvent builds the event payload for an alert that moved from
+// previousStatus to its current status.
+func NewAlertEvent(alert *models.Alert, previousStatus string) AlertEvent {
+	event := AlertEvent{
+		ID:              alert.ID,
+		UUID:            alert.UUID,
+		Timestamp:       alert.Timestamp,
+		AlertType:       alert.AlertType,
+		Severity:        alert.Severity,
+		Message:         alert.Message,
+		Value:           alert.Value,
+		Threshold:       alert.Threshold,
+		Category:        alert.Category,
+		Priority:        alert.Priority,
+		PreviousStatus:  previousStatus,
+		Status:          alert.Status,
+		AssignedTo:      alert.AssignedTo,
+		ResolvedAt:      alert.ResolvedAt,
+		ResolvedBy:      alert.ResolvedBy,
+		ResolutionNotes: alert.ResolutionNotes,
+		ChangedAt:       alert.UpdatedAt,
+	}
+	if alert.LocationID != nil {
+		event.LocationID = *alert.LocationID
+	}
+	if alert.Location != nil {
+		event.City = alert.Location.City
+	}
+	if event.ChangedAt.IsZero() {
+		event.ChangedAt = time.Now().UTC()
+	}
+	return event
+}
+
+// Key returns the partition key for the event: the location when present,
+// otherwise the alert itself.
+func (e AlertEvent) Key() string {
+	if e.LocationID != "" {
+		return e.LocationID
+	}
+	return e.UUID
+}
+
+// DecodeAlertEvent decodes an alert.status.changed message.
+func DecodeAlertEvent(msg kafka.Message) (*AlertEvent, Envelope, error) {
+	env, err := ParseEnvelope(msg.Headers)
+	if err != nil {
+		return nil, env, err
+	}
+
+	if env.EventType != EventTypeAlertStatusChanged {
+		return nil, env, fmt.Errorf("unexpected event type %q", env.EventType)
+	}
+
+	payload, err := upcast(msg.Value, env.SchemaVersion, AlertSchemaVersion, nil)
+	if err != nil {
+		return nil, env, err
+	}
+
+	var event AlertEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, env, fmt.Errorf("JSON unmarshal failed: %w", err)
+	}
+
+	return &event, env, nil
+}
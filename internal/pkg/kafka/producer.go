@@ -11,19 +11,22 @@ import (
 // Producer wraps a kafka.Writer.
 type Producer struct {
 	writer *kafka.Writer
+	source string
 }
 
-// CreateProducer creates a new Kafka producer.
-func CreateProducer(brokers []string, topic string) *Producer {
+// CreateProducer creates a new Kafka producer. source identifies the
+// publishing service in the envelope of every event it writes.
+func CreateProducer(brokers []string, topic string, source string) *Producer {
 	return &Producer{
 		writer: &kafka.Writer{
 			Addr:         kafka.TCP(brokers...),
 			Topic:        topic,
-			Balancer:     &kafka.LeastBytes{},
+			Balancer:     &kafka.Hash{}, // Keep messages with the same key in the same partition
 			WriteTimeout: 10 * time.Second,
 			ReadTimeout:  10 * time.Second,
 			ErrorLogger:  kafka.LoggerFunc(log.Printf),
 		},
+		source: source,
 	}
 }
 
@@ -32,6 +35,21 @@ func (p *Producer) WriteMessages(ctx context.Context, msgs ...kafka.Message) err
 	return p.writer.WriteMessages(ctx, msgs...)
 }
 
+// NewEventMessage wraps payload in a versioned envelope stamped with the
+// producer's source service.
+func (p *Producer) NewEventMessage(key, eventType string, schemaVersion int, payload interface{}) (kafka.Message, error) {
+	return NewMessage(key, NewEnvelope(eventType, schemaVersion, p.source), payload)
+}
+
+// PublishEvent wraps payload in a versioned envelope and writes it keyed by key.
+func (p *Producer) PublishEvent(ctx context.Context, key, eventType string, schemaVersion int, payload interface{}) error {
+	msg, err := p.NewEventMessage(key, eventType, schemaVersion, payload)
+	if err != nil {
+		return err
+	}
+	return p.writer.WriteMessages(ctx, msg)
+}
+
 // Close closes the Kafka writer.
 func (p *Producer) Close() error {
 	return p.writer.Close()
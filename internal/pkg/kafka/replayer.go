@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Replayer reads a topic partition by partition between explicit offsets,
+// outside of any consumer group, to reprocess historical messages without
+// touching the committed offsets of the live consumers.
+type Replayer struct {
+	brokers []string
+	topic   string
+}
+
+// NewReplayer creates a new Replayer of topic
+func NewReplayer(brokers []string, topic string) *Replayer {
+	return &Replayer{brokers: brokers, topic: topic}
+}
+
+// Partitions returns the partition ids of the topic in ascending order
+func (r *Replayer) Partitions(ctx context.Context) ([]int, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", r.brokers[0])
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to kafka: %w", err)
+	}
+	defer conn.Close()
+
+	partitions, err := conn.ReadPartitions(r.topic)
+	if err != nil {
+		return nil, fmt.Errorf("error reading partitions of %s: %w", r.topic, err)
+	}
+
+	ids := make([]int, len(partitions))
+	for i, partition := range partitions {
+		ids[i] = partition.ID
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// Offsets returns the offset of the oldest retained message of a partition
+// and the offset the next message written to it will get
+func (r *Replayer) Offsets(ctx context.Context, partition int) (first, last int64, err error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", r.brokers[0], r.topic, partition)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error connecting to leader of %s/%d: %w", r.topic, partition, err)
+	}
+	defer conn.Close()
+
+	first, last, err = conn.ReadOffsets()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading offsets of %s/%d: %w", r.topic, partition, err)
+	}
+	return first, last, nil
+}
+
+// OffsetAt returns the offset of the first message of a partition written at
+// or after t, or the end of the partition if there is none
+func (r *Replayer) OffsetAt(ctx context.Context, partition int, t time.Time) (int64, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", r.brokers[0], r.topic, partition)
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to leader of %s/%d: %w", r.topic, partition, err)
+	}
+	defer conn.Close()
+
+	offset, err := conn.ReadOffset(t)
+	if err != nil {
+		return 0, fmt.Errorf("error looking up offset of %s/%d at %s: %w", r.topic, partition, t, err)
+	}
+	if offset < 0 {
+		return conn.ReadLastOffset()
+	}
+	return offset, nil
+}
+
+// ReadPartition calls fn for every message of a partition with an offset in
+// [from, to), in order. It stops at the first error fn returns.
+func (r *Replayer) ReadPartition(ctx context.Context, partition int, from, to int64, fn func(kafka.Message) error) error {
+	if from >= to {
+		return nil
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     r.brokers,
+		Topic:       r.topic,
+		Partition:   partition,
+		MinBytes:    1,
+		MaxBytes:    10e6, // 10MB
+		MaxWait:     500 * time.Millisecond,
+		ErrorLogger: kafka.LoggerFunc(log.Printf),
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(from); err != nil {
+		return fmt.Errorf("error seeking %s/%d to %d: %w", r.topic, partition, from, err)
+	}
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("error reading %s/%d: %w", r.topic, partition, err)
+		}
+		if msg.Offset >= to {
+			return nil
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+		// Compacted topics can skip offsets, so the last one may never arrive
+		if msg.Offset+1 >= to {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	kafkaPkg "api-traffic-analytics/internal/pkg/kafka"
+)
+
+// Without a reachable broker the first fetch fails and the next one retries,
+// until the consumer is closed
+func TestBroadcastConsumerRetriesUntilClosed(t *testing.T) {
+	consumer := kafkaPkg.CreateBroadcastConsumer([]string{"127.0.0.1:1"}, "traffic-data")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if _, err := consumer.FetchMessage(ctx); err == nil || errors.Is(err, io.EOF) {
+			t.Fatalf("fetch %d without a broker = %v, want a connection error", i, err)
+		}
+	}
+
+	if err := consumer.CommitMessages(ctx); err != nil {
+		t.Errorf("CommitMessages = %v, want nil", err)
+	}
+	if err := consumer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := consumer.FetchMessage(ctx); !errors.Is(err, io.EOF) {
+		t.Errorf("fetch after Close = %v, want io.EOF", err)
+	}
+}
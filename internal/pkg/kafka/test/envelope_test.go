@@ -0,0 +1,160 @@
+package test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	kafkaPkg "api-traffic-analytics/internal/pkg/kafka"
+)
+
+func TestEnvelopeHeadersRoundTrip(t *testing.T) {
+	env := kafkaPkg.NewEnvelope(kafkaPkg.EventTypeTrafficRecorded, kafkaPkg.TrafficDataSchemaVersion, "traffic-ingestor")
+
+	parsed, err := kafkaPkg.ParseEnvelope(env.Headers())
+	if err != nil {
+		t.Fatalf("ParseEnvelope: %v", err)
+	}
+	if parsed.SchemaVersion != env.SchemaVersion || parsed.EventID != env.EventID || parsed.EventType != env.EventType ||
+		parsed.Source != env.Source || !parsed.ProducedAt.Equal(env.ProducedAt) {
+		t.Errorf("parsed envelope = %+v, want %+v", parsed, env)
+	}
+	if env.EventID == "" || env.ProducedAt.IsZero() {
+		t.Errorf("new envelope without event id or time: %+v", env)
+	}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	header := func(key, value string) kafka.Header { return kafka.Header{Key: key, Value: []byte(value)} }
+
+	tests := []struct {
+		name    string
+		headers []kafka.Header
+		version int
+		wantErr string
+	}{
+		{name: "no headers is the legacy version", headers: nil, version: kafkaPkg.LegacySchemaVersion},
+		{name: "headers without a version", headers: []kafka.Header{header(kafkaPkg.HeaderEventType, "x")}, version: kafkaPkg.LegacySchemaVersion},
+		{name: "explicit version", headers: []kafka.Header{header(kafkaPkg.HeaderSchemaVersion, "2")}, version: 2},
+		{name: "unknown headers are ignored", headers: []kafka.Header{header("traceparent", "00-abc"), header(kafkaPkg.HeaderSchemaVersion, "2")}, version: 2},
+		{name: "non numeric version", headers: []kafka.Header{header(kafkaPkg.HeaderSchemaVersion, "v2")}, wantErr: "invalid schema-version header"},
+		{name: "empty version", headers: []kafka.Header{header(kafkaPkg.HeaderSchemaVersion, "")}, wantErr: "invalid schema-version header"},
+		{name: "version zero", headers: []kafka.Header{header(kafkaPkg.HeaderSchemaVersion, "0")}, wantErr: "invalid schema-version header"},
+		{name: "negative version", headers: []kafka.Header{header(kafkaPkg.HeaderSchemaVersion, "-1")}, wantErr: "invalid schema-version header"},
+		{name: "malformed produced-at", headers: []kafka.Header{header(kafkaPkg.HeaderProducedAt, "yesterday")}, wantErr: "invalid produced-at header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := kafkaPkg.ParseEnvelope(tt.headers)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEnvelope: %v", err)
+			}
+			if env.SchemaVersion != tt.version {
+				t.Errorf("schema version = %d, want %d", env.SchemaVersion, tt.version)
+			}
+		})
+	}
+}
+
+// v1 readings were json.Marshal(models.TrafficData): database id, created_at
+// and the nested location included, published without headers
+const v1Payload = `{"id":7,"uuid":"r-1","timestamp":"2024-01-10T08:00:00Z","location_id":"LOC001","vehicle_count":42,` +
+	`"average_speed":51.5,"congestion_level":"high","max_speed":80,"queue_length":3,"travel_time":12.5,"is_validated":true,` +
+	`"created_at":"2024-01-10T08:00:01Z","updated_at":"2024-01-10T08:00:01Z",` +
+	`"location":{"id":"LOC001","name":"Gran Via","city":"Madrid","latitude":40.42,"longitude":-3.70}}`
+
+const v2Payload = `{"uuid":"r-1","timestamp":"2024-01-10T08:00:00Z","location_id":"LOC001","city":"Madrid","vehicle_count":42,` +
+	`"average_speed":51.5,"congestion_level":"high","max_speed":80,"queue_length":3,"travel_time":12.5,"is_validated":true}`
+
+func TestDecodeTrafficDataVersions(t *testing.T) {
+	headers := func(eventType, version string) []kafka.Header {
+		return []kafka.Header{
+			{Key: kafkaPkg.HeaderSchemaVersion, Value: []byte(version)},
+			{Key: kafkaPkg.HeaderEventType, Value: []byte(eventType)},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		headers []kafka.Header
+		payload string
+		version int
+		wantErr string
+	}{
+		{name: "v1 without headers", payload: v1Payload, version: 1},
+		{name: "v1 with headers", headers: headers(kafkaPkg.EventTypeTrafficRecorded, "1"), payload: v1Payload, version: 1},
+		{name: "v2", headers: headers(kafkaPkg.EventTypeTrafficRecorded, "2"), payload: v2Payload, version: 2},
+		{name: "unknown future version", headers: headers(kafkaPkg.EventTypeTrafficRecorded, "3"), payload: v2Payload, wantErr: "unsupported schema version 3"},
+		{name: "malformed version header", headers: headers(kafkaPkg.EventTypeTrafficRecorded, "two"), payload: v2Payload, wantErr: "invalid schema-version header"},
+		{name: "other event type", headers: headers(kafkaPkg.EventTypeAlertStatusChanged, "2"), payload: v2Payload, wantErr: "unexpected event type"},
+		{name: "malformed v1 payload", payload: `{"vehicle_count":"many"}`, wantErr: "invalid v1 traffic data"},
+		{name: "malformed v2 payload", headers: headers(kafkaPkg.EventTypeTrafficRecorded, "2"), payload: `{"uuid":`, wantErr: "JSON unmarshal failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, env, err := kafkaPkg.DecodeTrafficData(kafka.Message{Key: []byte("LOC001"), Value: []byte(tt.payload), Headers: tt.headers})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeTrafficData: %v", err)
+			}
+			if env.SchemaVersion != tt.version {
+				t.Errorf("schema version = %d, want %d", env.SchemaVersion, tt.version)
+			}
+
+			// Every version decodes to the same reading
+			if data.UUID != "r-1" || data.LocationID != "LOC001" || data.VehicleCount != 42 || data.AverageSpeed != 51.5 ||
+				data.CongestionLevel != "high" || data.QueueLength != 3 || data.TravelTime != 12.5 || !data.IsValidated {
+				t.Errorf("reading = %+v", data)
+			}
+			if !data.Timestamp.Equal(time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC)) {
+				t.Errorf("timestamp = %s", data.Timestamp)
+			}
+			if data.MaxSpeed == nil || *data.MaxSpeed != 80 || data.MinSpeed != nil {
+				t.Errorf("max/min speed = %v/%v, want 80/nil", data.MaxSpeed, data.MinSpeed)
+			}
+			// Only the location id and city survive; v1's database id does not
+			if data.Location.ID != "LOC001" || data.Location.City != "Madrid" || data.Location.Name != "" {
+				t.Errorf("location = %+v, want id and city only", data.Location)
+			}
+			if data.ID != 0 || !data.CreatedAt.IsZero() {
+				t.Errorf("database columns leaked from the payload: id %d created %s", data.ID, data.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestDecodeTrafficDataRoundTrip(t *testing.T) {
+	data, _, err := kafkaPkg.DecodeTrafficData(kafka.Message{Value: []byte(v1Payload)})
+	if err != nil {
+		t.Fatalf("decoding v1: %v", err)
+	}
+
+	env := kafkaPkg.NewEnvelope(kafkaPkg.EventTypeTrafficRecorded, kafkaPkg.TrafficDataSchemaVersion, "traffic-ingestor")
+	msg, err := kafkaPkg.NewMessage("LOC001", env, kafkaPkg.NewTrafficDataEvent(data))
+	if err != nil {
+		t.Fatalf("NewMessage: %v", err)
+	}
+	again, decoded, err := kafkaPkg.DecodeTrafficData(msg)
+	if err != nil {
+		t.Fatalf("decoding v2: %v", err)
+	}
+	if decoded.EventID != env.EventID || !reflect.DeepEqual(again, data) {
+		t.Errorf("round trip = %+v, want %+v", again, data)
+	}
+}
@@ -0,0 +1,34 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+
+	kafkaPkg "api-traffic-analytics/internal/pkg/kafka"
+)
+
+// v2 messages published before City was added to TrafficDataEvent still
+// decode: the field is optional and additive, so there is no v3
+func TestDecodeTrafficDataV2WithoutCity(t *testing.T) {
+	env := kafkaPkg.NewEnvelope(kafkaPkg.EventTypeTrafficRecorded, 2, "traffic-ingestor")
+	msg := kafka.Message{
+		Key:     []byte("LOC001"),
+		Value:   []byte(`{"uuid":"r-1","timestamp":"2026-10-18T08:00:00Z","location_id":"LOC001","vehicle_count":42,"average_speed":51.5,"congestion_level":"LOW"}`),
+		Headers: env.Headers(),
+	}
+
+	data, decoded, err := kafkaPkg.DecodeTrafficData(msg)
+	if err != nil {
+		t.Fatalf("DecodeTrafficData: %v", err)
+	}
+	if decoded.SchemaVersion != 2 {
+		t.Errorf("schema version = %d, want 2", decoded.SchemaVersion)
+	}
+	if data.UUID != "r-1" || data.LocationID != "LOC001" || data.VehicleCount != 42 {
+		t.Errorf("reading = %+v", data)
+	}
+	if data.Location.City != "" || data.Location.ID != "" {
+		t.Errorf("location = %+v, want it empty without a city", data.Location)
+	}
+}
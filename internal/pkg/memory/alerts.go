@@ -0,0 +1,156 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// AlertRepository is the in-memory counterpart of postgres.AlertRepository
+type AlertRepository struct {
+	store *Store
+}
+
+// NewAlertRepository creates a new instance of AlertRepository
+func NewAlertRepository(store *Store) *AlertRepository {
+	return &AlertRepository{store: store}
+}
+
+// Create stores a copy of alert, applying the column defaults of the alerts table
+func (r *AlertRepository) Create(ctx context.Context, alert *models.Alert) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now().UTC()
+	r.store.nextAlertID++
+	alert.ID = r.store.nextAlertID
+	if alert.UUID == "" {
+		alert.UUID = uuid.NewString()
+	}
+	if alert.Timestamp.IsZero() {
+		alert.Timestamp = now
+	}
+	if alert.Status == "" {
+		alert.Status = models.AlertStatusActive
+	}
+	if alert.Category == "" {
+		alert.Category = "traffic"
+	}
+	if alert.Priority == 0 {
+		alert.Priority = 1
+	}
+	alert.CreatedAt, alert.UpdatedAt = now, now
+
+	stored := *alert
+	stored.Location = nil
+	r.store.alerts = append(r.store.alerts, stored)
+	return nil
+}
+
+func (r *AlertRepository) GetByID(ctx context.Context, id int64) (*models.Alert, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	i := r.store.alertIndex(id)
+	if i < 0 {
+		return nil, fmt.Errorf("alert %d: %w", id, postgres.ErrNotFound)
+	}
+	alert := r.store.alerts[i]
+	return &alert, nil
+}
+
+// List returns the alerts matching the filter, newest first
+func (r *AlertRepository) List(ctx context.Context, filter postgres.AlertFilter) ([]*models.Alert, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	alerts := []*models.Alert{}
+	for i := range r.store.alerts {
+		alert := r.store.alerts[i]
+		if filter.Status != "" && alert.Status != filter.Status {
+			continue
+		}
+		if filter.Severity != "" && alert.Severity != filter.Severity {
+			continue
+		}
+		if filter.AlertType != "" && alert.AlertType != filter.AlertType {
+			continue
+		}
+		if filter.LocationID != "" && (alert.LocationID == nil || *alert.LocationID != filter.LocationID) {
+			continue
+		}
+		alerts = append(alerts, &alert)
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].Timestamp.After(alerts[j].Timestamp) })
+
+	if filter.Limit > 0 && len(alerts) > filter.Limit {
+		alerts = alerts[:filter.Limit]
+	}
+	return alerts, nil
+}
+
+// FindOpen returns the newest active or acknowledged alert of a given type
+// for a location, or nil if there is none
+func (r *AlertRepository) FindOpen(ctx context.Context, locationID, alertType string) (*models.Alert, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var open *models.Alert
+	for i := range r.store.alerts {
+		alert := r.store.alerts[i]
+		if alert.LocationID == nil || *alert.LocationID != locationID || alert.AlertType != alertType {
+			continue
+		}
+		if alert.Status != models.AlertStatusActive && alert.Status != models.AlertStatusAcknowledged {
+			continue
+		}
+		if open == nil || alert.Timestamp.After(open.Timestamp) {
+			open = &alert
+		}
+	}
+	return open, nil
+}
+
+// Transition lets apply mutate a copy of the alert and stores it only if
+// apply succeeds. It returns the updated alert and its previous status.
+func (r *AlertRepository) Transition(ctx context.Context, id int64, apply func(alert *models.Alert) error) (*models.Alert, string, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	i := r.store.alertIndex(id)
+	if i < 0 {
+		return nil, "", fmt.Errorf("alert %d: %w", id, postgres.ErrNotFound)
+	}
+
+	alert := r.store.alerts[i]
+	previous := alert.Status
+	if err := apply(&alert); err != nil {
+		return nil, "", err
+	}
+	alert.UpdatedAt = time.Now().UTC()
+	alert.Location = nil
+	r.store.alerts[i] = alert
+
+	if alert.LocationID != nil {
+		location := r.store.locations[*alert.LocationID]
+		alert.Location = &location
+	}
+	return &alert, previous, nil
+}
+
+// alertIndex returns the position of an alert in the store, or -1. The
+// caller holds the lock.
+func (s *Store) alertIndex(id int64) int {
+	for i := range s.alerts {
+		if int64(s.alerts[i].ID) == id {
+			return i
+		}
+	}
+	return -1
+}
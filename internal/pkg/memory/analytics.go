@@ -0,0 +1,365 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// summaryWindow mirrors the analytics_summary view
+const summaryWindow = 24 * time.Hour
+
+// AnalyticsResultRepository is the in-memory counterpart of postgres.AnalyticsResultRepository
+type AnalyticsResultRepository struct {
+	store *Store
+}
+
+// NewAnalyticsResultRepository creates a new instance of AnalyticsResultRepository
+func NewAnalyticsResultRepository(store *Store) *AnalyticsResultRepository {
+	return &AnalyticsResultRepository{store: store}
+}
+
+// BulkInsert stores copies of results, failing with postgres.ErrDuplicate
+// without storing anything if one of them already exists
+func (r *AnalyticsResultRepository) BulkInsert(ctx context.Context, results []*models.AnalyticsResult) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	seen := make(map[postgres.AnalyticsIdentity]bool, len(results))
+	for _, result := range results {
+		identity := postgres.IdentityOf(result)
+		if seen[identity] || r.store.resultIndex(identity) >= 0 {
+			return fmt.Errorf("analytics result: %w", postgres.ErrDuplicate)
+		}
+		seen[identity] = true
+	}
+
+	for _, result := range results {
+		r.store.insertResult(result)
+	}
+	return nil
+}
+
+// Upsert stores copies of results, overwriting the values of the results
+// that already exist with the same identity
+func (r *AnalyticsResultRepository) Upsert(ctx context.Context, results []*models.AnalyticsResult) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, result := range results {
+		i := r.store.resultIndex(postgres.IdentityOf(result))
+		if i < 0 {
+			r.store.insertResult(result)
+			continue
+		}
+
+		existing := r.store.results[i]
+		result.ID, result.UUID, result.CreatedAt = existing.ID, existing.UUID, existing.CreatedAt
+		if result.AnalysisTimestamp.IsZero() {
+			result.AnalysisTimestamp = time.Now().UTC()
+		}
+		result.UpdatedAt = time.Now().UTC()
+
+		stored := *result
+		stored.Location = nil
+		r.store.results[i] = stored
+	}
+	return nil
+}
+
+// ListByPeriod returns the results whose period starts in [from, to),
+// ordered by period, location and metric
+func (r *AnalyticsResultRepository) ListByPeriod(ctx context.Context, from, to time.Time, metricTypes ...string) ([]*models.AnalyticsResult, error) {
+	metrics := make(map[string]bool, len(metricTypes))
+	for _, metric := range metricTypes {
+		metrics[metric] = true
+	}
+
+	results := []*models.AnalyticsResult{}
+	for _, result := range r.filtered(postgres.AnalyticsFilter{}) {
+		if result.PeriodStart.Before(from) || !result.PeriodStart.Before(to) {
+			continue
+		}
+		if len(metrics) > 0 && !metrics[result.MetricType] {
+			continue
+		}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := postgres.IdentityOf(results[i]), postgres.IdentityOf(results[j])
+		if !a.PeriodStart.Equal(b.PeriodStart) {
+			return a.PeriodStart.Before(b.PeriodStart)
+		}
+		if a.LocationID != b.LocationID {
+			return a.LocationID < b.LocationID
+		}
+		return a.MetricType < b.MetricType
+	})
+	return results, nil
+}
+
+// LatestByMetric returns the result of a metric with the most recent period
+// for a location
+func (r *AnalyticsResultRepository) LatestByMetric(ctx context.Context, locationID, metricType string) (*models.AnalyticsResult, error) {
+	var latest *models.AnalyticsResult
+	for _, result := range r.filtered(postgres.AnalyticsFilter{LocationID: locationID, MetricType: metricType}) {
+		if latest == nil || keyBefore(latest.PeriodStart, int64(latest.ID), result.PeriodStart, int64(result.ID)) {
+			latest = result
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no %s result for location %s: %w", metricType, locationID, postgres.ErrNotFound)
+	}
+	return latest, nil
+}
+
+// insertResult stores a copy of a new result. The caller holds the lock.
+func (s *Store) insertResult(result *models.AnalyticsResult) {
+	now := time.Now().UTC()
+	s.nextResultID++
+	result.ID = s.nextResultID
+	if result.UUID == "" {
+		result.UUID = uuid.NewString()
+	}
+	if result.AnalysisTimestamp.IsZero() {
+		result.AnalysisTimestamp = now
+	}
+	result.CreatedAt, result.UpdatedAt = now, now
+
+	stored := *result
+	stored.Location = nil
+	s.results = append(s.results, stored)
+}
+
+// resultIndex returns the position of the result with the given identity,
+// or -1. The caller holds the lock.
+func (s *Store) resultIndex(identity postgres.AnalyticsIdentity) int {
+	for i := range s.results {
+		if postgres.IdentityOf(&s.results[i]) == identity {
+			return i
+		}
+	}
+	return -1
+}
+
+// Query returns the results matching the filter, newest period first, with
+// the same keyset cursors as the Postgres implementation
+func (r *AnalyticsResultRepository) Query(ctx context.Context, filter postgres.AnalyticsFilter) ([]*models.AnalyticsResult, string, error) {
+	var cursorTS time.Time
+	var cursorID int64
+	if filter.Cursor != "" {
+		var err error
+		if cursorTS, cursorID, err = postgres.DecodeCursor(filter.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	results := []*models.AnalyticsResult{}
+	for _, result := range r.filtered(filter) {
+		if filter.Cursor != "" && !keyBefore(result.PeriodStart, int64(result.ID), cursorTS, cursorID) {
+			continue
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return keyBefore(results[j].PeriodStart, int64(results[j].ID), results[i].PeriodStart, int64(results[i].ID))
+	})
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	var next string
+	if len(results) > limit {
+		results = results[:limit]
+		last := results[len(results)-1]
+		next = postgres.EncodeCursor(last.PeriodStart, int64(last.ID))
+	}
+	return results, next, nil
+}
+
+// Aggregate computes spec.Function over the filtered results, grouped by the
+// requested dimensions
+func (r *AnalyticsResultRepository) Aggregate(ctx context.Context, spec postgres.AggregateSpec) ([]*postgres.AnalyticsAggregate, error) {
+	for _, dim := range spec.GroupBy {
+		if dim != postgres.GroupByHour && dim != postgres.GroupByDay && dim != postgres.GroupByLocation {
+			return nil, fmt.Errorf("unsupported group_by %q", dim)
+		}
+	}
+	switch spec.Function {
+	case postgres.AggregateAvg, postgres.AggregateMin, postgres.AggregateMax, postgres.AggregateSum, postgres.AggregateCount:
+	case postgres.AggregatePercentile:
+		if spec.Percentile < 0 || spec.Percentile > 1 {
+			return nil, fmt.Errorf("percentile must be between 0 and 1")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported aggregation %q", spec.Function)
+	}
+
+	type groupKey struct {
+		bucket   time.Time
+		location string
+	}
+	groups := make(map[groupKey][]float64)
+	for _, result := range r.filtered(spec.Filter) {
+		var key groupKey
+		for _, dim := range spec.GroupBy {
+			switch dim {
+			case postgres.GroupByHour:
+				key.bucket = result.PeriodStart.UTC().Truncate(time.Hour)
+			case postgres.GroupByDay:
+				start := result.PeriodStart.UTC()
+				key.bucket = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+			case postgres.GroupByLocation:
+				if result.LocationID != nil {
+					key.location = *result.LocationID
+				}
+			}
+		}
+		groups[key] = append(groups[key], result.Value)
+	}
+
+	aggregates := []*postgres.AnalyticsAggregate{}
+	for key, values := range groups {
+		aggregate := &postgres.AnalyticsAggregate{Value: aggregateValues(spec, values), SampleCount: int64(len(values))}
+		for _, dim := range spec.GroupBy {
+			switch dim {
+			case postgres.GroupByHour, postgres.GroupByDay:
+				bucket := key.bucket
+				aggregate.BucketStart = &bucket
+			case postgres.GroupByLocation:
+				location := key.location
+				aggregate.LocationID = &location
+			}
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		a, b := aggregates[i], aggregates[j]
+		if a.BucketStart != nil && !a.BucketStart.Equal(*b.BucketStart) {
+			return a.BucketStart.Before(*b.BucketStart)
+		}
+		return a.LocationID != nil && *a.LocationID < *b.LocationID
+	})
+	return aggregates, nil
+}
+
+// Summary aggregates the last 24 hours of results per location and metric,
+// like the analytics_summary view
+func (r *AnalyticsResultRepository) Summary(ctx context.Context, locationID, metricType string) ([]*models.AnalyticsSummary, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	since := time.Now().UTC().Add(-summaryWindow)
+	type summaryKey struct{ location, metric string }
+	summaries := make(map[summaryKey]*models.AnalyticsSummary)
+	for _, result := range r.store.results {
+		if result.LocationID == nil || result.AnalysisTimestamp.Before(since) {
+			continue
+		}
+		location, ok := r.store.locations[*result.LocationID]
+		if !ok {
+			continue
+		}
+		if (locationID != "" && location.ID != locationID) || (metricType != "" && result.MetricType != metricType) {
+			continue
+		}
+
+		key := summaryKey{location.ID, result.MetricType}
+		summary := summaries[key]
+		if summary == nil {
+			summary = &models.AnalyticsSummary{LocationID: location.ID, LocationName: location.Name,
+				MetricType: result.MetricType, MinValue: result.Value, MaxValue: result.Value}
+			summaries[key] = summary
+		}
+		// AvgValue holds the sum until every result is in
+		summary.AvgValue += result.Value
+		summary.MinValue = math.Min(summary.MinValue, result.Value)
+		summary.MaxValue = math.Max(summary.MaxValue, result.Value)
+		summary.SampleCount++
+		if result.AnalysisTimestamp.After(summary.LastAnalysis) {
+			summary.LastAnalysis = result.AnalysisTimestamp
+		}
+	}
+
+	list := make([]*models.AnalyticsSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		summary.AvgValue /= float64(summary.SampleCount)
+		list = append(list, summary)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].LocationID != list[j].LocationID {
+			return list[i].LocationID < list[j].LocationID
+		}
+		return list[i].MetricType < list[j].MetricType
+	})
+	return list, nil
+}
+
+// filtered returns copies of the results matching filter, ignoring its
+// cursor and limit
+func (r *AnalyticsResultRepository) filtered(filter postgres.AnalyticsFilter) []*models.AnalyticsResult {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var results []*models.AnalyticsResult
+	for i := range r.store.results {
+		result := r.store.results[i]
+		if filter.MetricType != "" && result.MetricType != filter.MetricType {
+			continue
+		}
+		if filter.LocationID != "" && (result.LocationID == nil || *result.LocationID != filter.LocationID) {
+			continue
+		}
+		if !filter.From.IsZero() && result.PeriodStart.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && result.PeriodStart.After(filter.To) {
+			continue
+		}
+		if filter.IsAnomaly != nil && result.IsAnomaly != *filter.IsAnomaly {
+			continue
+		}
+		results = append(results, &result)
+	}
+	return results
+}
+
+// aggregateValues applies spec.Function to a non-empty group of values
+func aggregateValues(spec postgres.AggregateSpec, values []float64) float64 {
+	switch spec.Function {
+	case postgres.AggregateCount:
+		return float64(len(values))
+	case postgres.AggregatePercentile:
+		// percentile_cont: linear interpolation between the closest ranks
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		pos := spec.Percentile * float64(len(sorted)-1)
+		lower, upper := int(math.Floor(pos)), int(math.Ceil(pos))
+		return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+	}
+
+	sum, lowest, highest := 0.0, values[0], values[0]
+	for _, v := range values {
+		sum += v
+		lowest = math.Min(lowest, v)
+		highest = math.Max(highest, v)
+	}
+	switch spec.Function {
+	case postgres.AggregateMin:
+		return lowest
+	case postgres.AggregateMax:
+		return highest
+	case postgres.AggregateSum:
+		return sum
+	default:
+		return sum / float64(len(values))
+	}
+}
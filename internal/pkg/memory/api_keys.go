@@ -0,0 +1,135 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// APIKeyRepository is the in-memory counterpart of postgres.APIKeyRepository
+type APIKeyRepository struct {
+	store *Store
+}
+
+// NewAPIKeyRepository creates a new instance of APIKeyRepository
+func NewAPIKeyRepository(store *Store) *APIKeyRepository {
+	return &APIKeyRepository{store: store}
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	return r.store.insertAPIKey(key)
+}
+
+func (r *APIKeyRepository) GetByID(ctx context.Context, id int) (*models.APIKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	return r.store.findAPIKey(func(key *models.APIKey) bool { return key.ID == id }, id)
+}
+
+func (r *APIKeyRepository) GetByKeyID(ctx context.Context, keyID string) (*models.APIKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	return r.store.findAPIKey(func(key *models.APIKey) bool { return key.KeyID == keyID }, keyID)
+}
+
+// List returns the keys matching the filter, newest first
+func (r *APIKeyRepository) List(ctx context.Context, filter postgres.APIKeyFilter) ([]*models.APIKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	keys := []*models.APIKey{}
+	for i := len(r.store.apiKeys) - 1; i >= 0; i-- {
+		key := r.store.apiKeys[i]
+		if filter.Owner != "" && key.Owner != filter.Owner {
+			continue
+		}
+		if !filter.IncludeRevoked && key.RevokedAt != nil {
+			continue
+		}
+		keys = append(keys, &key)
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepository) Revoke(ctx context.Context, id int, at time.Time) (*models.APIKey, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i := range r.store.apiKeys {
+		key := &r.store.apiKeys[i]
+		if key.ID != id {
+			continue
+		}
+		if key.RevokedAt == nil {
+			key.RevokedAt = &at
+			key.UpdatedAt = at
+		}
+		copied := *key
+		return &copied, nil
+	}
+	return nil, fmt.Errorf("api key %d: %w", id, postgres.ErrNotFound)
+}
+
+func (r *APIKeyRepository) Rotate(ctx context.Context, id int, replacement *models.APIKey, graceUntil time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i := range r.store.apiKeys {
+		old := &r.store.apiKeys[i]
+		if old.ID != id || old.RevokedAt != nil {
+			continue
+		}
+		if old.ExpiresAt == nil || graceUntil.Before(*old.ExpiresAt) {
+			old.ExpiresAt = &graceUntil
+		}
+		replacement.RotatedFrom = &old.ID
+		return r.store.insertAPIKey(replacement)
+	}
+	return fmt.Errorf("api key %d: %w", id, postgres.ErrNotFound)
+}
+
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id int, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i := range r.store.apiKeys {
+		key := &r.store.apiKeys[i]
+		if key.ID == id && (key.LastUsedAt == nil || key.LastUsedAt.Before(at)) {
+			key.LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+// insertAPIKey stores a copy of key. The caller holds the lock.
+func (s *Store) insertAPIKey(key *models.APIKey) error {
+	for _, existing := range s.apiKeys {
+		if existing.KeyID == key.KeyID {
+			return fmt.Errorf("api key %s: %w", key.KeyID, postgres.ErrDuplicate)
+		}
+	}
+
+	now := time.Now().UTC()
+	s.nextAPIKeyID++
+	key.ID = s.nextAPIKeyID
+	key.CreatedAt, key.UpdatedAt = now, now
+	s.apiKeys = append(s.apiKeys, *key)
+	return nil
+}
+
+// findAPIKey returns a copy of the first key accepted by match. The caller
+// holds the lock.
+func (s *Store) findAPIKey(match func(*models.APIKey) bool, ref interface{}) (*models.APIKey, error) {
+	for i := range s.apiKeys {
+		if match(&s.apiKeys[i]) {
+			key := s.apiKeys[i]
+			return &key, nil
+		}
+	}
+	return nil, fmt.Errorf("api key %v: %w", ref, postgres.ErrNotFound)
+}
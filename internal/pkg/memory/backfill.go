@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// BackfillCheckpointRepository is the in-memory counterpart of postgres.BackfillCheckpointRepository
+type BackfillCheckpointRepository struct {
+	store *Store
+}
+
+// NewBackfillCheckpointRepository creates a new instance of BackfillCheckpointRepository
+func NewBackfillCheckpointRepository(store *Store) *BackfillCheckpointRepository {
+	return &BackfillCheckpointRepository{store: store}
+}
+
+func (r *BackfillCheckpointRepository) Get(ctx context.Context, name string) (*models.BackfillCheckpoint, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	checkpoint, ok := r.store.checkpoints[name]
+	if !ok {
+		return nil, fmt.Errorf("backfill checkpoint %s: %w", name, postgres.ErrNotFound)
+	}
+	return &checkpoint, nil
+}
+
+func (r *BackfillCheckpointRepository) Save(ctx context.Context, checkpoint *models.BackfillCheckpoint) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	checkpoint.UpdatedAt = time.Now().UTC()
+	checkpoint.CreatedAt = checkpoint.UpdatedAt
+	if existing, ok := r.store.checkpoints[checkpoint.Name]; ok {
+		checkpoint.CreatedAt = existing.CreatedAt
+	}
+	r.store.checkpoints[checkpoint.Name] = *checkpoint
+	return nil
+}
+
+func (r *BackfillCheckpointRepository) Delete(ctx context.Context, name string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.checkpoints, name)
+	return nil
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// CacheRepository is an in-memory counterpart of redis.CacheRepository
+type CacheRepository struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewCacheRepository creates an empty CacheRepository
+func NewCacheRepository() *CacheRepository {
+	return &CacheRepository{entries: make(map[string]cacheEntry)}
+}
+
+// SetCache stores value formatted the way Redis stores it. A zero expiration
+// keeps the key forever.
+func (c *CacheRepository) SetCache(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = newCacheEntry(value, expiration)
+	return nil
+}
+
+// SetCacheIfAbsent is SetCache for keys that do not exist or expired. It
+// reports whether the value was set.
+func (c *CacheRepository) SetCacheIfAbsent(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[key]; ok && (entry.expiresAt.IsZero() || time.Now().Before(entry.expiresAt)) {
+		return false, nil
+	}
+	c.entries[key] = newCacheEntry(value, expiration)
+	return true, nil
+}
+
+func newCacheEntry(value interface{}, expiration time.Duration) cacheEntry {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	entry := cacheEntry{value: s}
+	if expiration > 0 {
+		entry.expiresAt = time.Now().Add(expiration)
+	}
+	return entry
+}
+
+// GetCache returns the value of key, or "" if it does not exist or expired
+func (c *CacheRepository) GetCache(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", nil
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return "", nil
+	}
+	return entry.value, nil
+}
+
+func (c *CacheRepository) DeleteCache(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	return nil
+}
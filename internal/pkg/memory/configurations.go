@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// ConfigurationRepository is the in-memory counterpart of postgres.ConfigurationRepository
+type ConfigurationRepository struct {
+	store *Store
+}
+
+// NewConfigurationRepository creates a new instance of ConfigurationRepository
+func NewConfigurationRepository(store *Store) *ConfigurationRepository {
+	return &ConfigurationRepository{store: store}
+}
+
+// Set stores an active setting, replacing any previous value
+func (r *ConfigurationRepository) Set(key, value string) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.configurations[key] = value
+}
+
+// GetString returns the value of key, or defaultValue when it is not set
+func (r *ConfigurationRepository) GetString(ctx context.Context, key, defaultValue string) (string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	if value, ok := r.store.configurations[key]; ok {
+		return value, nil
+	}
+	return defaultValue, nil
+}
+
+// GetInt returns the integer value of key, or defaultValue when it is not set
+func (r *ConfigurationRepository) GetInt(ctx context.Context, key string, defaultValue int) (int, error) {
+	value, err := r.GetString(ctx, key, "")
+	if err != nil || value == "" {
+		return defaultValue, err
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("configuration %s: %q is not an integer", key, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,201 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	segkafka "github.com/segmentio/kafka-go"
+
+	"api-traffic-analytics/internal/pkg/kafka"
+)
+
+// Broker is an in-memory stand-in for Kafka with a single partition per topic
+type Broker struct {
+	mu     sync.Mutex
+	topics map[string][]segkafka.Message
+	// written is closed and replaced on every write to wake up consumers
+	written chan struct{}
+}
+
+// NewBroker creates an empty Broker
+func NewBroker() *Broker {
+	return &Broker{topics: make(map[string][]segkafka.Message), written: make(chan struct{})}
+}
+
+// Messages returns a copy of the messages written to a topic so far
+func (b *Broker) Messages(topic string) []segkafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]segkafka.Message(nil), b.topics[topic]...)
+}
+
+func (b *Broker) write(topic string, msgs []segkafka.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for _, msg := range msgs {
+		msg.Topic = topic
+		msg.Offset = int64(len(b.topics[topic]))
+		if msg.Time.IsZero() {
+			msg.Time = now
+		}
+		b.topics[topic] = append(b.topics[topic], msg)
+	}
+	close(b.written)
+	b.written = make(chan struct{})
+}
+
+// Producer returns a producer writing to topic that stamps source in the
+// envelope of its events, like kafka.CreateProducer
+func (b *Broker) Producer(topic, source string) *Producer {
+	return &Producer{broker: b, topic: topic, source: source}
+}
+
+// Consumer returns a consumer reading topic from its first message
+func (b *Broker) Consumer(topic string) *Consumer {
+	return &Consumer{broker: b, topic: topic, closed: make(chan struct{})}
+}
+
+// Producer is the in-memory counterpart of kafka.Producer
+type Producer struct {
+	broker *Broker
+	topic  string
+	source string
+}
+
+func (p *Producer) WriteMessages(ctx context.Context, msgs ...segkafka.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.broker.write(p.topic, msgs)
+	return nil
+}
+
+func (p *Producer) NewEventMessage(key, eventType string, schemaVersion int, payload interface{}) (segkafka.Message, error) {
+	return kafka.NewMessage(key, kafka.NewEnvelope(eventType, schemaVersion, p.source), payload)
+}
+
+func (p *Producer) PublishEvent(ctx context.Context, key, eventType string, schemaVersion int, payload interface{}) error {
+	msg, err := p.NewEventMessage(key, eventType, schemaVersion, payload)
+	if err != nil {
+		return err
+	}
+	return p.WriteMessages(ctx, msg)
+}
+
+func (p *Producer) Close() error {
+	return nil
+}
+
+// Consumer is the in-memory counterpart of kafka.Consumer
+type Consumer struct {
+	broker *Broker
+	topic  string
+
+	mu        sync.Mutex
+	next      int64
+	committed int64
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// FetchMessage blocks until the next message is available, the context is
+// done or the consumer is closed (io.EOF, like kafka-go)
+func (c *Consumer) FetchMessage(ctx context.Context) (segkafka.Message, error) {
+	for {
+		c.broker.mu.Lock()
+		msgs := c.broker.topics[c.topic]
+		written := c.broker.written
+		c.broker.mu.Unlock()
+
+		c.mu.Lock()
+		if c.next < int64(len(msgs)) {
+			msg := msgs[c.next]
+			c.next++
+			c.mu.Unlock()
+			return msg, nil
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-written:
+		case <-c.closed:
+			return segkafka.Message{}, io.EOF
+		case <-ctx.Done():
+			return segkafka.Message{}, ctx.Err()
+		}
+	}
+}
+
+// CommitMessages records the offset after the highest committed message
+func (c *Consumer) CommitMessages(ctx context.Context, msgs ...segkafka.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, msg := range msgs {
+		if msg.Offset+1 > c.committed {
+			c.committed = msg.Offset + 1
+		}
+	}
+	return nil
+}
+
+// Committed returns the offset of the next message to be committed
+func (c *Consumer) Committed() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.committed
+}
+
+func (c *Consumer) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// Replayer returns a replayer of topic, which has a single partition 0
+func (b *Broker) Replayer(topic string) *Replayer {
+	return &Replayer{broker: b, topic: topic}
+}
+
+// Replayer is the in-memory counterpart of kafka.Replayer
+type Replayer struct {
+	broker *Broker
+	topic  string
+}
+
+func (r *Replayer) Partitions(ctx context.Context) ([]int, error) {
+	return []int{0}, nil
+}
+
+func (r *Replayer) Offsets(ctx context.Context, partition int) (first, last int64, err error) {
+	return 0, int64(len(r.broker.Messages(r.topic))), nil
+}
+
+// OffsetAt returns the offset of the first message with a Time at or after t
+func (r *Replayer) OffsetAt(ctx context.Context, partition int, t time.Time) (int64, error) {
+	msgs := r.broker.Messages(r.topic)
+	for _, msg := range msgs {
+		if !msg.Time.Before(t) {
+			return msg.Offset, nil
+		}
+	}
+	return int64(len(msgs)), nil
+}
+
+func (r *Replayer) ReadPartition(ctx context.Context, partition int, from, to int64, fn func(segkafka.Message) error) error {
+	for _, msg := range r.broker.Messages(r.topic) {
+		if msg.Offset < from || msg.Offset >= to {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
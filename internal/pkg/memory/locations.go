@@ -0,0 +1,241 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// currentStatusWindow mirrors the current_traffic_status view
+const currentStatusWindow = 30 * time.Minute
+
+// LocationRepository is the in-memory counterpart of postgres.LocationRepository
+type LocationRepository struct {
+	store *Store
+}
+
+// NewLocationRepository creates a new instance of LocationRepository
+func NewLocationRepository(store *Store) *LocationRepository {
+	return &LocationRepository{store: store}
+}
+
+func (r *LocationRepository) Create(ctx context.Context, location *models.Location) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.locations[location.ID]; ok {
+		return fmt.Errorf("location %s: %w", location.ID, postgres.ErrDuplicate)
+	}
+	now := time.Now().UTC()
+	location.CreatedAt, location.UpdatedAt = now, now
+	r.store.locations[location.ID] = *location
+	return nil
+}
+
+func (r *LocationRepository) GetByID(ctx context.Context, id string) (*models.Location, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	location, ok := r.store.locations[id]
+	if !ok {
+		return nil, fmt.Errorf("location %s: %w", id, postgres.ErrNotFound)
+	}
+	return &location, nil
+}
+
+func (r *LocationRepository) List(ctx context.Context, filter postgres.LocationFilter) ([]*models.Location, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	locations := []*models.Location{}
+	for _, location := range r.store.sortedLocations() {
+		if filter.City != "" && !strings.EqualFold(location.City, filter.City) {
+			continue
+		}
+		if filter.IsActive != nil && location.IsActive != *filter.IsActive {
+			continue
+		}
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+func (r *LocationRepository) Update(ctx context.Context, location *models.Location) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	existing, ok := r.store.locations[location.ID]
+	if !ok {
+		return fmt.Errorf("location %s: %w", location.ID, postgres.ErrNotFound)
+	}
+	location.CreatedAt = existing.CreatedAt
+	location.UpdatedAt = time.Now().UTC()
+	r.store.locations[location.ID] = *location
+	return nil
+}
+
+func (r *LocationRepository) SetActive(ctx context.Context, id string, active bool) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	location, ok := r.store.locations[id]
+	if !ok {
+		return fmt.Errorf("location %s: %w", id, postgres.ErrNotFound)
+	}
+	location.IsActive = active
+	location.UpdatedAt = time.Now().UTC()
+	r.store.locations[id] = location
+	return nil
+}
+
+func (r *LocationRepository) BulkUpsert(ctx context.Context, locations []*models.Location) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, location := range locations {
+		location.CreatedAt = now
+		if existing, ok := r.store.locations[location.ID]; ok {
+			location.CreatedAt = existing.CreatedAt
+		}
+		location.UpdatedAt = now
+		r.store.locations[location.ID] = *location
+	}
+	return nil
+}
+
+// WithinRadius returns the locations at most radiusMeters from center, nearest first
+func (r *LocationRepository) WithinRadius(ctx context.Context, center postgres.GeoPoint, radiusMeters float64, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	box := postgres.RadiusBox(center, radiusMeters)
+	return r.search(opts, func(location *models.Location) (*float64, bool) {
+		point := postgres.GeoPoint{Lat: location.Latitude, Lon: location.Longitude}
+		distance := postgres.DistanceMeters(center, point)
+		return &distance, box.Contains(point) && distance <= radiusMeters
+	}, true)
+}
+
+// Nearest returns the k locations closest to center, nearest first
+func (r *LocationRepository) Nearest(ctx context.Context, center postgres.GeoPoint, k int, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	opts.Limit = k
+	return r.search(opts, func(location *models.Location) (*float64, bool) {
+		distance := postgres.DistanceMeters(center, postgres.GeoPoint{Lat: location.Latitude, Lon: location.Longitude})
+		return &distance, true
+	}, true)
+}
+
+// WithinBoundingBox returns the locations inside the box, ordered by ID
+func (r *LocationRepository) WithinBoundingBox(ctx context.Context, box postgres.BoundingBox, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	return r.search(opts, func(location *models.Location) (*float64, bool) {
+		return nil, box.Contains(postgres.GeoPoint{Lat: location.Latitude, Lon: location.Longitude})
+	}, false)
+}
+
+// WithinPolygon returns the locations inside the polygon, ordered by ID
+func (r *LocationRepository) WithinPolygon(ctx context.Context, ring []postgres.GeoPoint, opts postgres.GeoOptions) ([]*postgres.LocationWithTraffic, error) {
+	if len(ring) < 3 {
+		return nil, fmt.Errorf("polygon needs at least 3 points")
+	}
+	return r.search(opts, func(location *models.Location) (*float64, bool) {
+		return nil, inPolygon(ring, location.Latitude, location.Longitude)
+	}, false)
+}
+
+// CurrentStatus returns the active locations with their latest reading of
+// the last 30 minutes, ordered by ID
+func (r *LocationRepository) CurrentStatus(ctx context.Context, filter postgres.MapFilter) ([]*postgres.LocationStatus, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	since := time.Now().UTC().Add(-currentStatusWindow)
+	statuses := []*postgres.LocationStatus{}
+	for _, location := range r.store.sortedLocations() {
+		if !location.IsActive || !matchesMapFilter(*location, filter) {
+			continue
+		}
+
+		status := &postgres.LocationStatus{Location: *location}
+		if latest := r.store.latestReading(location.ID, since); latest != nil {
+			congestion := latest.CongestionLevel
+			status.LastReading = &latest.Timestamp
+			status.VehicleCount = &latest.VehicleCount
+			status.AverageSpeed = &latest.AverageSpeed
+			status.CongestionLevel = &congestion
+			status.Occupancy = latest.Occupancy
+			status.TravelTime = &latest.TravelTime
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// search applies the common geo options to the locations accepted by match.
+// Results are sorted by distance when byDistance is set, by ID otherwise.
+func (r *LocationRepository) search(opts postgres.GeoOptions, match func(*models.Location) (*float64, bool), byDistance bool) ([]*postgres.LocationWithTraffic, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	found := []*postgres.LocationWithTraffic{}
+	for _, location := range r.store.sortedLocations() {
+		if !opts.IncludeInactive && !location.IsActive {
+			continue
+		}
+		if opts.City != "" && !strings.EqualFold(location.City, opts.City) {
+			continue
+		}
+		distance, ok := match(location)
+		if !ok {
+			continue
+		}
+		found = append(found, &postgres.LocationWithTraffic{Location: *location, DistanceMeters: distance})
+	}
+
+	if byDistance {
+		sort.SliceStable(found, func(i, j int) bool { return *found[i].DistanceMeters < *found[j].DistanceMeters })
+	}
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	if opts.IncludeTraffic {
+		for _, location := range found {
+			location.LatestTraffic = r.store.latestReading(location.ID, time.Time{})
+		}
+	}
+	return found, nil
+}
+
+// sortedLocations returns copies of every location ordered by ID. The caller
+// holds the lock.
+func (s *Store) sortedLocations() []*models.Location {
+	locations := make([]*models.Location, 0, len(s.locations))
+	for _, location := range s.locations {
+		copied := location
+		locations = append(locations, &copied)
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].ID < locations[j].ID })
+	return locations
+}
+
+// inPolygon is an even-odd ray casting test treating the ring as planar lon/lat
+// coordinates, like the Postgres polygon type
+func inPolygon(ring []postgres.GeoPoint, lat, lon float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Lat > lat) != (b.Lat > lat) &&
+			lon < (b.Lon-a.Lon)*(lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// partition is a monthly partition of a table, attached (empty schema) or
+// moved to postgres.ArchiveSchema by retention
+type partition struct {
+	postgres.Partition
+	table  string
+	schema string
+}
+
+// PartitionManager is the in-memory counterpart of postgres.PartitionManager.
+// Readings stay in the shared traffic table whatever partitions exist, as if
+// they lived in the default partition, until retention drops or archives them.
+type PartitionManager struct {
+	store *Store
+}
+
+// NewPartitionManager creates a new instance of PartitionManager
+func NewPartitionManager(store *Store) *PartitionManager {
+	return &PartitionManager{store: store}
+}
+
+// List returns the attached monthly partitions of table, oldest first
+func (m *PartitionManager) List(ctx context.Context, table string) ([]postgres.Partition, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	return m.store.listPartitions(table, ""), nil
+}
+
+// ListArchived returns the monthly partitions of table that retention moved
+// to the archive schema, oldest first
+func (m *PartitionManager) ListArchived(ctx context.Context, table string) ([]postgres.Partition, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	return m.store.listPartitions(table, postgres.ArchiveSchema), nil
+}
+
+// EnsureMonthly creates the partitions of the month of now and of the
+// monthsAhead following months that do not exist yet
+func (m *PartitionManager) EnsureMonthly(ctx context.Context, table string, now time.Time, monthsAhead int) ([]string, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	var created []string
+	for _, p := range postgres.MonthlyPartitions(table, now, monthsAhead) {
+		if existing, ok := m.store.partitions[p.Name]; ok && existing.schema == "" {
+			continue
+		}
+		m.store.partitions[p.Name] = partition{Partition: p, table: table}
+		created = append(created, p.Name)
+	}
+	return created, nil
+}
+
+// Retire drops or archives the partitions that end before the start of the
+// month keepMonths months before now, along with their readings. Older readings
+// of months without a partition are retired under their month's name.
+func (m *PartitionManager) Retire(ctx context.Context, table string, now time.Time, keepMonths int, action string) ([]string, error) {
+	if err := postgres.ValidateRetention(keepMonths, action); err != nil {
+		return nil, err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	cutoff := postgres.RetentionCutoff(now, keepMonths)
+	var retired []string
+	for _, p := range m.store.listPartitions(table, "") {
+		if p.To.After(cutoff) {
+			break
+		}
+
+		var kept, moved []models.TrafficData
+		for _, row := range m.store.traffic {
+			if !row.Timestamp.Before(p.From) && row.Timestamp.Before(p.To) {
+				moved = append(moved, row)
+			} else {
+				kept = append(kept, row)
+			}
+		}
+		m.store.traffic = kept
+
+		if action == postgres.RetentionDrop {
+			delete(m.store.partitions, p.Name)
+		} else {
+			m.store.partitions[p.Name] = partition{Partition: p, table: table, schema: postgres.ArchiveSchema}
+			m.store.archived[p.Name] = moved
+		}
+		retired = append(retired, p.Name)
+	}
+
+	// What is left before the cutoff lives in the default partition
+	var kept []models.TrafficData
+	var months []string
+	for _, row := range m.store.traffic {
+		if !row.Timestamp.Before(cutoff) {
+			kept = append(kept, row)
+			continue
+		}
+		ts := row.Timestamp.UTC()
+		month := time.Date(ts.Year(), ts.Month(), 1, 0, 0, 0, 0, time.UTC)
+		name := postgres.PartitionName(table, month)
+		if action == postgres.RetentionArchive {
+			if _, ok := m.store.partitions[name]; !ok {
+				p := postgres.Partition{Name: name, From: month, To: month.AddDate(0, 1, 0)}
+				m.store.partitions[name] = partition{Partition: p, table: table, schema: postgres.ArchiveSchema}
+			}
+			m.store.archived[name] = append(m.store.archived[name], row)
+		}
+		if !slices.Contains(retired, name) && !slices.Contains(months, name) {
+			months = append(months, name)
+		}
+	}
+	m.store.traffic = kept
+
+	sort.Strings(months)
+	retired = append(retired, months...)
+	return retired, nil
+}
+
+// listPartitions returns the partitions of table in schema, oldest first. The
+// caller holds the lock.
+func (s *Store) listPartitions(table, schema string) []postgres.Partition {
+	var partitions []postgres.Partition
+	for _, p := range s.partitions {
+		if p.table == table && p.schema == schema {
+			partitions = append(partitions, p.Partition)
+		}
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].From.Before(partitions[j].From) })
+	return partitions
+}
@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/redis"
+)
+
+// RateLimiter is an in-memory counterpart of redis.RateLimiter, running the
+// same GCRA on a local clock
+type RateLimiter struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+	// Now is the clock, replaceable in tests
+	Now func() time.Time
+}
+
+// NewRateLimiter creates an empty RateLimiter
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{tats: make(map[string]time.Time), Now: time.Now}
+}
+
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit redis.RateLimit) (*redis.RateLimitResult, error) {
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		return nil, fmt.Errorf("invalid rate limit %d/%s", limit.Requests, limit.Period)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	interval := limit.Period / time.Duration(limit.Requests)
+	tat, ok := l.tats[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+
+	newTAT := tat.Add(interval)
+	allowAt := newTAT.Add(-limit.Period)
+	if now.Before(allowAt) {
+		return &redis.RateLimitResult{
+			Limit:      limit.Requests,
+			ResetAfter: tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}, nil
+	}
+
+	l.tats[key] = newTAT
+	return &redis.RateLimitResult{
+		Allowed:    true,
+		Limit:      limit.Requests,
+		Remaining:  int((limit.Period - newTAT.Sub(now)) / interval),
+		ResetAfter: newTAT.Sub(now),
+	}, nil
+}
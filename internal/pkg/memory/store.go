@@ -0,0 +1,68 @@
+// Package memory provides in-memory implementations of the repositories, the
+// cache and Kafka, so services can be exercised in-process without Postgres,
+// Redis or a broker. They mirror the behaviour of the real implementations
+// closely enough for tests (errors, ordering, pagination) but are not meant
+// for production use.
+package memory
+
+import (
+	"sync"
+
+	"api-traffic-analytics/internal/interfaces"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// Store holds the tables shared by the in-memory repositories. Repositories
+// built on the same Store see each other's writes, like tables of one database.
+type Store struct {
+	mu sync.RWMutex
+
+	locations map[string]models.Location
+	traffic   []models.TrafficData
+	results   []models.AnalyticsResult
+	alerts    []models.Alert
+
+	checkpoints map[string]models.BackfillCheckpoint
+	apiKeys     []models.APIKey
+
+	configurations map[string]string
+	partitions     map[string]partition
+	archived       map[string][]models.TrafficData
+	staging        map[string][]models.TrafficData
+
+	nextTrafficID int64
+	nextResultID  int
+	nextAlertID   int
+	nextAPIKeyID  int
+}
+
+// NewStore creates an empty Store
+func NewStore() *Store {
+	return &Store{
+		locations:      make(map[string]models.Location),
+		checkpoints:    make(map[string]models.BackfillCheckpoint),
+		configurations: make(map[string]string),
+		partitions:     make(map[string]partition),
+		archived:       make(map[string][]models.TrafficData),
+		staging:        make(map[string][]models.TrafficData),
+	}
+}
+
+// The in-memory implementations satisfy the same interfaces as the real ones
+var (
+	_ interfaces.TrafficDataRepository        = (*TrafficDataRepository)(nil)
+	_ interfaces.LocationRepository           = (*LocationRepository)(nil)
+	_ interfaces.RollupRepository             = (*RollupRepository)(nil)
+	_ interfaces.AnalyticsResultRepository    = (*AnalyticsResultRepository)(nil)
+	_ interfaces.AlertRepository              = (*AlertRepository)(nil)
+	_ interfaces.BackfillCheckpointRepository = (*BackfillCheckpointRepository)(nil)
+	_ interfaces.APIKeyRepository             = (*APIKeyRepository)(nil)
+	_ interfaces.ConfigurationRepository      = (*ConfigurationRepository)(nil)
+	_ interfaces.PartitionManager             = (*PartitionManager)(nil)
+	_ interfaces.TrafficArchiveRepository     = (*TrafficDataRepository)(nil)
+	_ interfaces.CacheRepository              = (*CacheRepository)(nil)
+	_ interfaces.RateLimiter                  = (*RateLimiter)(nil)
+	_ interfaces.EventProducer                = (*Producer)(nil)
+	_ interfaces.MessageConsumer              = (*Consumer)(nil)
+	_ interfaces.MessageReplayer              = (*Replayer)(nil)
+)
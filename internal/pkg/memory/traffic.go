@@ -0,0 +1,449 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// TrafficDataRepository is the in-memory counterpart of postgres.TrafficDataRepository
+type TrafficDataRepository struct {
+	store *Store
+}
+
+// NewTrafficDataRepository creates a new instance of TrafficDataRepository
+func NewTrafficDataRepository(store *Store) *TrafficDataRepository {
+	return &TrafficDataRepository{store: store}
+}
+
+// Create stores a copy of data, filling in the columns the database would
+func (r *TrafficDataRepository) Create(ctx context.Context, data *models.TrafficData) (*models.TrafficData, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.locations[data.LocationID]; !ok {
+		return nil, fmt.Errorf("error creating traffic data: location %s does not exist", data.LocationID)
+	}
+
+	now := time.Now().UTC()
+	r.store.nextTrafficID++
+	data.ID = r.store.nextTrafficID
+	if data.UUID == "" {
+		data.UUID = uuid.NewString()
+	}
+	if data.Timestamp.IsZero() {
+		data.Timestamp = now
+	}
+	data.CreatedAt, data.UpdatedAt = now, now
+
+	stored := *data
+	stored.Location = models.Location{}
+	r.store.traffic = append(r.store.traffic, stored)
+	return data, nil
+}
+
+// Query returns the readings matching the filter, newest first, with the
+// same keyset cursors as the Postgres implementation
+func (r *TrafficDataRepository) Query(ctx context.Context, filter postgres.TrafficDataFilter) ([]*models.TrafficData, string, error) {
+	var cursorTS time.Time
+	var cursorID int64
+	if filter.Cursor != "" {
+		var err error
+		if cursorTS, cursorID, err = postgres.DecodeCursor(filter.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	r.store.mu.RLock()
+	var data []*models.TrafficData
+	for i := range r.store.traffic {
+		row := r.store.traffic[i]
+		if filter.LocationID != "" && row.LocationID != filter.LocationID {
+			continue
+		}
+		if filter.CongestionLevel != "" && row.CongestionLevel != filter.CongestionLevel {
+			continue
+		}
+		if !filter.From.IsZero() && row.Timestamp.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && row.Timestamp.After(filter.To) {
+			continue
+		}
+		if filter.Cursor != "" && !keyBefore(row.Timestamp, row.ID, cursorTS, cursorID) {
+			continue
+		}
+		data = append(data, &row)
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(data, func(i, j int) bool {
+		return keyBefore(data[j].Timestamp, data[j].ID, data[i].Timestamp, data[i].ID)
+	})
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	var next string
+	if len(data) > limit {
+		data = data[:limit]
+		last := data[len(data)-1]
+		next = postgres.EncodeCursor(last.Timestamp, last.ID)
+	}
+	return data, next, nil
+}
+
+// GetLatestByLocation returns the most recent reading of a location
+func (r *TrafficDataRepository) GetLatestByLocation(ctx context.Context, locationID string) (*models.TrafficData, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	if latest := r.store.latestReading(locationID, time.Time{}); latest != nil {
+		return latest, nil
+	}
+	return nil, fmt.Errorf("no traffic data found for location %s: %w", locationID, postgres.ErrNotFound)
+}
+
+// ListRange returns the next page of rng in (timestamp, id) order
+func (r *TrafficDataRepository) ListRange(ctx context.Context, rng postgres.TrafficRange) ([]*models.TrafficData, error) {
+	locations := make(map[string]bool, len(rng.LocationIDs))
+	for _, id := range rng.LocationIDs {
+		locations[id] = true
+	}
+
+	r.store.mu.RLock()
+	var data []*models.TrafficData
+	for i := range r.store.traffic {
+		row := r.store.traffic[i]
+		if row.Timestamp.Before(rng.From) || !row.Timestamp.Before(rng.To) {
+			continue
+		}
+		if len(locations) > 0 && !locations[row.LocationID] {
+			continue
+		}
+		if !rng.AfterTimestamp.IsZero() && !keyBefore(rng.AfterTimestamp, rng.AfterID, row.Timestamp, row.ID) {
+			continue
+		}
+		data = append(data, &row)
+	}
+	r.store.mu.RUnlock()
+
+	sort.Slice(data, func(i, j int) bool {
+		return keyBefore(data[i].Timestamp, data[i].ID, data[j].Timestamp, data[j].ID)
+	})
+
+	limit := rng.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	if len(data) > limit {
+		data = data[:limit]
+	}
+	return data, nil
+}
+
+// Heatmap aggregates the readings of spec's time range into a lat/lon grid
+func (r *TrafficDataRepository) Heatmap(ctx context.Context, spec postgres.HeatmapSpec) ([]*postgres.HeatmapCell, error) {
+	if spec.CellSize <= 0 {
+		return nil, fmt.Errorf("cell size must be positive")
+	}
+
+	type cellKey struct{ lat, lon int64 }
+	type cellAcc struct {
+		samples, vehicles int64
+		speed, congestion float64
+		locations         map[string]bool
+	}
+
+	r.store.mu.RLock()
+	cells := make(map[cellKey]*cellAcc)
+	for _, row := range r.store.traffic {
+		if row.Timestamp.Before(spec.From) || !row.Timestamp.Before(spec.To) {
+			continue
+		}
+		location, ok := r.store.locations[row.LocationID]
+		if !ok || !matchesMapFilter(location, spec.Filter) {
+			continue
+		}
+
+		latIndex, lonIndex := spec.CellIndex(postgres.GeoPoint{Lat: location.Latitude, Lon: location.Longitude})
+		key := cellKey{latIndex, lonIndex}
+		acc := cells[key]
+		if acc == nil {
+			acc = &cellAcc{locations: make(map[string]bool)}
+			cells[key] = acc
+		}
+		acc.samples++
+		acc.vehicles += int64(row.VehicleCount)
+		acc.speed += row.AverageSpeed
+		acc.congestion += congestionScore(row.CongestionLevel)
+		acc.locations[row.LocationID] = true
+	}
+	r.store.mu.RUnlock()
+
+	keys := make([]cellKey, 0, len(cells))
+	for key := range cells {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].lat != keys[j].lat {
+			return keys[i].lat < keys[j].lat
+		}
+		return keys[i].lon < keys[j].lon
+	})
+
+	result := make([]*postgres.HeatmapCell, len(keys))
+	for i, key := range keys {
+		acc := cells[key]
+		n := float64(acc.samples)
+		cell := spec.Cell(key.lat, key.lon)
+		cell.SampleCount = acc.samples
+		cell.LocationCount = int64(len(acc.locations))
+		cell.AvgVehicleCount = float64(acc.vehicles) / n
+		cell.AvgSpeed = acc.speed / n
+		cell.CongestionScore = acc.congestion / n
+		result[i] = cell
+	}
+	return result, nil
+}
+
+// RollupRepository serves traffic series straight from the in-memory
+// readings; there are no rollups to maintain
+type RollupRepository struct {
+	store *Store
+}
+
+// NewRollupRepository creates a new instance of RollupRepository
+func NewRollupRepository(store *Store) *RollupRepository {
+	return &RollupRepository{store: store}
+}
+
+// Refresh is a no-op: series are always computed from the raw readings
+func (r *RollupRepository) Refresh(ctx context.Context, until time.Time) (int64, error) {
+	return 0, nil
+}
+
+// Series buckets the raw readings of [From, To) by Resolution. It reports the
+// source the Postgres implementation reads for Resolution; rollups aggregate
+// the same readings, so the points do not depend on it.
+func (r *RollupRepository) Series(ctx context.Context, spec postgres.SeriesSpec) ([]*postgres.TrafficSeriesPoint, string, error) {
+	type pointKey struct {
+		bucket   time.Time
+		location string
+	}
+
+	r.store.mu.RLock()
+	points := make(map[pointKey]*postgres.TrafficSeriesPoint)
+	for _, row := range r.store.traffic {
+		if row.Timestamp.Before(spec.From) || !row.Timestamp.Before(spec.To) {
+			continue
+		}
+		if spec.LocationID != "" && row.LocationID != spec.LocationID {
+			continue
+		}
+
+		bucket := postgres.SeriesBucket(row.Timestamp, spec.Resolution)
+		key := pointKey{bucket, row.LocationID}
+		point := points[key]
+		if point == nil {
+			point = &postgres.TrafficSeriesPoint{BucketStart: bucket, LocationID: row.LocationID,
+				MinSpeed: row.AverageSpeed, MaxSpeed: row.AverageSpeed}
+			points[key] = point
+		}
+		// AvgSpeed holds the sum until every reading is in
+		point.SampleCount++
+		point.VehicleTotal += int64(row.VehicleCount)
+		point.AvgSpeed += row.AverageSpeed
+		point.MinSpeed = math.Min(point.MinSpeed, row.AverageSpeed)
+		point.MaxSpeed = math.Max(point.MaxSpeed, row.AverageSpeed)
+		switch row.CongestionLevel {
+		case models.CongestionLow:
+			point.CongestionLow++
+		case models.CongestionMedium:
+			point.CongestionMedium++
+		case models.CongestionHigh:
+			point.CongestionHigh++
+		case models.CongestionSevere:
+			point.CongestionSevere++
+		}
+	}
+	r.store.mu.RUnlock()
+
+	series := make([]*postgres.TrafficSeriesPoint, 0, len(points))
+	for _, point := range points {
+		point.AvgSpeed /= float64(point.SampleCount)
+		series = append(series, point)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if !series[i].BucketStart.Equal(series[j].BucketStart) {
+			return series[i].BucketStart.Before(series[j].BucketStart)
+		}
+		return series[i].LocationID < series[j].LocationID
+	})
+	return series, postgres.SeriesSource(spec.Resolution), nil
+}
+
+// latestReading returns the newest reading of a location at or after since.
+// The caller holds the lock.
+func (s *Store) latestReading(locationID string, since time.Time) *models.TrafficData {
+	var latest *models.TrafficData
+	for i := range s.traffic {
+		row := &s.traffic[i]
+		if row.LocationID != locationID || row.Timestamp.Before(since) {
+			continue
+		}
+		if latest == nil || keyBefore(latest.Timestamp, latest.ID, row.Timestamp, row.ID) {
+			latest = row
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	copied := *latest
+	return &copied
+}
+
+// keyBefore reports whether (ts, id) sorts before (otherTS, otherID)
+func keyBefore(ts time.Time, id int64, otherTS time.Time, otherID int64) bool {
+	if !ts.Equal(otherTS) {
+		return ts.Before(otherTS)
+	}
+	return id < otherID
+}
+
+func congestionScore(level string) float64 {
+	switch level {
+	case models.CongestionMedium:
+		return 1.0 / 3
+	case models.CongestionHigh:
+		return 2.0 / 3
+	case models.CongestionSevere:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func matchesMapFilter(location models.Location, filter postgres.MapFilter) bool {
+	if filter.City != "" && !strings.EqualFold(location.City, filter.City) {
+		return false
+	}
+	return filter.Box == nil || filter.Box.Contains(postgres.GeoPoint{Lat: location.Latitude, Lon: location.Longitude})
+}
+
+// Export calls fn with the readings of src in (timestamp, id) order. src.Table
+// is traffic_data, one of its attached partitions or, with src.Schema set to
+// postgres.ArchiveSchema, an archived one.
+func (r *TrafficDataRepository) Export(ctx context.Context, src postgres.ExportSource, fn func(*models.TrafficData) error) error {
+	r.store.mu.RLock()
+	rows, err := r.store.exportRows(src)
+	r.store.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return keyBefore(rows[i].Timestamp, rows[i].ID, rows[j].Timestamp, rows[j].ID)
+	})
+	for i := range rows {
+		if !src.From.IsZero() && rows[i].Timestamp.Before(src.From) {
+			continue
+		}
+		if !src.To.IsZero() && !rows[i].Timestamp.Before(src.To) {
+			continue
+		}
+		if err := fn(&rows[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportRows copies the rows of the table src names. The caller holds the lock.
+func (s *Store) exportRows(src postgres.ExportSource) ([]models.TrafficData, error) {
+	if src.Schema == postgres.ArchiveSchema {
+		rows, ok := s.archived[src.Table]
+		if !ok {
+			return nil, fmt.Errorf("error exporting %s.%s: relation does not exist", src.Schema, src.Table)
+		}
+		return append([]models.TrafficData(nil), rows...), nil
+	}
+	if src.Schema != "" {
+		return nil, fmt.Errorf("error exporting %s.%s: relation does not exist", src.Schema, src.Table)
+	}
+
+	if src.Table == "traffic_data" {
+		return append([]models.TrafficData(nil), s.traffic...), nil
+	}
+	p, ok := s.partitions[src.Table]
+	if !ok || p.schema != "" {
+		return nil, fmt.Errorf("error exporting %s: relation does not exist", src.Table)
+	}
+	var rows []models.TrafficData
+	for _, row := range s.traffic {
+		if !row.Timestamp.Before(p.From) && row.Timestamp.Before(p.To) {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// LoadStaging creates table and fills it with the batches fill passes to
+// insert. The table is kept only if fill succeeds.
+func (r *TrafficDataRepository) LoadStaging(ctx context.Context, table string, fill func(insert func([]*models.TrafficData) error) error) error {
+	r.store.mu.RLock()
+	_, exists := r.store.staging[table]
+	_, isPartition := r.store.partitions[table]
+	r.store.mu.RUnlock()
+	if exists || isPartition || table == "traffic_data" {
+		return fmt.Errorf("error loading staging table %s: relation already exists", table)
+	}
+
+	var rows []models.TrafficData
+	err := fill(func(batch []*models.TrafficData) error {
+		for _, data := range batch {
+			row := *data
+			row.Location = models.Location{}
+			rows = append(rows, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error loading staging table %s: %w", table, err)
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if _, exists := r.store.staging[table]; exists {
+		return fmt.Errorf("error loading staging table %s: relation already exists", table)
+	}
+	r.store.staging[table] = rows
+	return nil
+}
+
+// Staging returns the rows of a table created by LoadStaging, or nil when it
+// does not exist
+func (r *TrafficDataRepository) Staging(table string) []*models.TrafficData {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	rows, ok := r.store.staging[table]
+	if !ok {
+		return nil
+	}
+	data := make([]*models.TrafficData, len(rows))
+	for i := range rows {
+		row := rows[i]
+		data[i] = &row
+	}
+	return data
+}
@@ -0,0 +1,16 @@
+-- =====================================================
+-- Drops the initial schema
+-- =====================================================
+DROP VIEW IF EXISTS analytics_summary;
+DROP VIEW IF EXISTS active_alerts;
+DROP VIEW IF EXISTS current_traffic_status;
+
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS configurations;
+DROP TABLE IF EXISTS system_metrics;
+DROP TABLE IF EXISTS alerts;
+DROP TABLE IF EXISTS analytics_results;
+DROP TABLE IF EXISTS traffic_data;
+DROP TABLE IF EXISTS locations;
+
+DROP FUNCTION IF EXISTS update_updated_at_column();
@@ -1,6 +1,6 @@
 -- =====================================================
 -- TRAFFIC ANALYTICS DATABASE SCHEMA
--- PostgreSQL Database Creation Script
+-- Initial schema (formerly scripts/create_tables.sql)
 -- =====================================================
 
 -- =====================================================
@@ -0,0 +1,80 @@
+-- =====================================================
+-- Converts traffic_data back into a single SERIAL keyed table. Partitions
+-- already moved to the archive schema are left untouched.
+-- =====================================================
+DROP VIEW IF EXISTS current_traffic_status;
+
+ALTER TABLE traffic_data RENAME TO traffic_data_partitioned;
+ALTER INDEX traffic_data_pkey RENAME TO traffic_data_partitioned_pkey;
+ALTER INDEX idx_traffic_data_timestamp RENAME TO idx_traffic_data_partitioned_timestamp;
+ALTER INDEX idx_traffic_data_location RENAME TO idx_traffic_data_partitioned_location;
+ALTER INDEX idx_traffic_data_congestion RENAME TO idx_traffic_data_partitioned_congestion;
+ALTER INDEX idx_traffic_data_location_time RENAME TO idx_traffic_data_partitioned_location_time;
+ALTER INDEX idx_traffic_data_uuid RENAME TO idx_traffic_data_partitioned_uuid;
+DROP TRIGGER IF EXISTS update_traffic_data_updated_at ON traffic_data_partitioned;
+
+CREATE TABLE traffic_data (
+    id INTEGER NOT NULL DEFAULT nextval('traffic_data_id_seq') PRIMARY KEY,
+    uuid UUID DEFAULT uuid_generate_v4(),
+    timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    location_id VARCHAR(50) NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    vehicle_count INTEGER NOT NULL CHECK (vehicle_count >= 0),
+    average_speed DECIMAL(5, 2) NOT NULL CHECK (average_speed >= 0),
+    congestion_level VARCHAR(20) NOT NULL CHECK (congestion_level IN ('low', 'medium', 'high', 'severe')),
+    max_speed DECIMAL(5, 2) CHECK (max_speed >= 0),
+    min_speed DECIMAL(5, 2) CHECK (min_speed >= 0),
+    occupancy DECIMAL(5, 2) CHECK (occupancy >= 0 AND occupancy <= 100),
+    queue_length DECIMAL(8, 2) DEFAULT 0,
+    travel_time DECIMAL(8, 2) DEFAULT 0,
+    data_source VARCHAR(50) DEFAULT 'sensor',
+    is_validated BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Keep the sequence alive when the partitioned table is dropped
+ALTER SEQUENCE traffic_data_id_seq OWNED BY traffic_data.id;
+
+INSERT INTO traffic_data (
+    id, uuid, timestamp, location_id, vehicle_count, average_speed, congestion_level,
+    max_speed, min_speed, occupancy, queue_length, travel_time, data_source,
+    is_validated, created_at, updated_at
+)
+SELECT
+    id, uuid, timestamp, location_id, vehicle_count, average_speed, congestion_level,
+    max_speed, min_speed, occupancy, queue_length, travel_time, data_source,
+    is_validated, created_at, updated_at
+FROM traffic_data_partitioned;
+
+ALTER SEQUENCE traffic_data_id_seq AS INTEGER;
+
+-- Dropping the parent drops every partition
+DROP TABLE traffic_data_partitioned;
+
+CREATE INDEX idx_traffic_data_timestamp ON traffic_data(timestamp);
+CREATE INDEX idx_traffic_data_location ON traffic_data(location_id);
+CREATE INDEX idx_traffic_data_congestion ON traffic_data(congestion_level);
+CREATE INDEX idx_traffic_data_location_time ON traffic_data(location_id, timestamp);
+CREATE INDEX idx_traffic_data_uuid ON traffic_data(uuid);
+
+CREATE TRIGGER update_traffic_data_updated_at
+    BEFORE UPDATE ON traffic_data
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE VIEW current_traffic_status AS
+SELECT
+    td.location_id,
+    l.name as location_name,
+    td.timestamp,
+    td.vehicle_count,
+    td.average_speed,
+    td.congestion_level,
+    td.occupancy,
+    td.travel_time
+FROM traffic_data td
+JOIN locations l ON td.location_id = l.id
+WHERE td.timestamp >= NOW() - INTERVAL '30 minutes'
+ORDER BY td.timestamp DESC;
+
+DELETE FROM configurations
+WHERE key IN ('retention.traffic_data_months', 'retention.traffic_data_action');
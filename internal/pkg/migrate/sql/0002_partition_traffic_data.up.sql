@@ -0,0 +1,109 @@
+-- =====================================================
+-- TRAFFIC DATA PARTITIONING
+-- Converts traffic_data into a BIGINT keyed table partitioned by month on
+-- timestamp. Existing rows are copied into their monthly partitions and ids
+-- are preserved. Later partitions are created by the maintenance command.
+-- =====================================================
+
+-- Views referencing the table are recreated at the end
+DROP VIEW IF EXISTS current_traffic_status;
+
+ALTER TABLE traffic_data RENAME TO traffic_data_legacy;
+ALTER INDEX traffic_data_pkey RENAME TO traffic_data_legacy_pkey;
+ALTER INDEX idx_traffic_data_timestamp RENAME TO idx_traffic_data_legacy_timestamp;
+ALTER INDEX idx_traffic_data_location RENAME TO idx_traffic_data_legacy_location;
+ALTER INDEX idx_traffic_data_congestion RENAME TO idx_traffic_data_legacy_congestion;
+ALTER INDEX idx_traffic_data_location_time RENAME TO idx_traffic_data_legacy_location_time;
+ALTER INDEX idx_traffic_data_uuid RENAME TO idx_traffic_data_legacy_uuid;
+DROP TRIGGER IF EXISTS update_traffic_data_updated_at ON traffic_data_legacy;
+
+-- The new table takes over the existing sequence so ids keep increasing
+ALTER SEQUENCE traffic_data_id_seq AS BIGINT;
+
+CREATE TABLE traffic_data (
+    id BIGINT NOT NULL DEFAULT nextval('traffic_data_id_seq'),
+    uuid UUID DEFAULT uuid_generate_v4(),
+    timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    location_id VARCHAR(50) NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    vehicle_count INTEGER NOT NULL CHECK (vehicle_count >= 0),
+    average_speed DECIMAL(5, 2) NOT NULL CHECK (average_speed >= 0),
+    congestion_level VARCHAR(20) NOT NULL CHECK (congestion_level IN ('low', 'medium', 'high', 'severe')),
+    max_speed DECIMAL(5, 2) CHECK (max_speed >= 0),
+    min_speed DECIMAL(5, 2) CHECK (min_speed >= 0),
+    occupancy DECIMAL(5, 2) CHECK (occupancy >= 0 AND occupancy <= 100),
+    queue_length DECIMAL(8, 2) DEFAULT 0,
+    travel_time DECIMAL(8, 2) DEFAULT 0,
+    data_source VARCHAR(50) DEFAULT 'sensor',
+    is_validated BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+ALTER SEQUENCE traffic_data_id_seq OWNED BY traffic_data.id;
+
+CREATE TABLE traffic_data_default PARTITION OF traffic_data DEFAULT;
+
+-- One partition for every month with data, plus the current and next 3 months
+DO $$
+DECLARE
+    month_start DATE;
+BEGIN
+    FOR month_start IN
+        SELECT DISTINCT date_trunc('month', timestamp)::date FROM traffic_data_legacy
+        UNION
+        SELECT (date_trunc('month', CURRENT_DATE) + make_interval(months => n))::date
+        FROM generate_series(0, 3) AS n
+    LOOP
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF traffic_data FOR VALUES FROM (%L) TO (%L)',
+            'traffic_data_y' || to_char(month_start, 'YYYY') || 'm' || to_char(month_start, 'MM'),
+            month_start,
+            (month_start + INTERVAL '1 month')::date
+        );
+    END LOOP;
+END $$;
+
+INSERT INTO traffic_data (
+    id, uuid, timestamp, location_id, vehicle_count, average_speed, congestion_level,
+    max_speed, min_speed, occupancy, queue_length, travel_time, data_source,
+    is_validated, created_at, updated_at
+)
+SELECT
+    id, uuid, timestamp, location_id, vehicle_count, average_speed, congestion_level,
+    max_speed, min_speed, occupancy, queue_length, travel_time, data_source,
+    is_validated, created_at, updated_at
+FROM traffic_data_legacy;
+
+-- Indexes are created after the copy; they cascade to every partition
+CREATE INDEX idx_traffic_data_timestamp ON traffic_data(timestamp);
+CREATE INDEX idx_traffic_data_location ON traffic_data(location_id);
+CREATE INDEX idx_traffic_data_congestion ON traffic_data(congestion_level);
+CREATE INDEX idx_traffic_data_location_time ON traffic_data(location_id, timestamp);
+CREATE INDEX idx_traffic_data_uuid ON traffic_data(uuid);
+
+CREATE TRIGGER update_traffic_data_updated_at
+    BEFORE UPDATE ON traffic_data
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TABLE traffic_data_legacy;
+
+CREATE VIEW current_traffic_status AS
+SELECT
+    td.location_id,
+    l.name as location_name,
+    td.timestamp,
+    td.vehicle_count,
+    td.average_speed,
+    td.congestion_level,
+    td.occupancy,
+    td.travel_time
+FROM traffic_data td
+JOIN locations l ON td.location_id = l.id
+WHERE td.timestamp >= NOW() - INTERVAL '30 minutes'
+ORDER BY td.timestamp DESC;
+
+INSERT INTO configurations (key, value, description, category, data_type) VALUES
+('retention.traffic_data_months', '12', 'Months of traffic data kept before a partition is retired', 'retention', 'integer'),
+('retention.traffic_data_action', 'archive', 'What to do with retired traffic data partitions: drop or archive', 'retention', 'string')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,8 @@
+-- =====================================================
+-- Drops the traffic rollup tables
+-- =====================================================
+DROP TABLE IF EXISTS rollup_watermarks;
+DROP TABLE IF EXISTS traffic_rollup_daily;
+DROP TABLE IF EXISTS traffic_rollup_hourly;
+
+DROP INDEX IF EXISTS idx_traffic_data_created_at;
@@ -0,0 +1,41 @@
+-- =====================================================
+-- TRAFFIC ROLLUP TABLES
+-- Hourly and daily aggregates of traffic_data per location, refreshed
+-- incrementally by the analytics processor. Long-range queries read these
+-- instead of the raw readings.
+-- =====================================================
+
+-- Rollup refreshes look up readings by insertion time
+CREATE INDEX idx_traffic_data_created_at ON traffic_data(created_at);
+
+CREATE TABLE traffic_rollup_hourly (
+    location_id VARCHAR(50) NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    bucket_start TIMESTAMP NOT NULL,
+    sample_count INTEGER NOT NULL,
+    vehicle_total BIGINT NOT NULL,
+    speed_sum DECIMAL(14, 2) NOT NULL,
+    speed_avg DECIMAL(5, 2) GENERATED ALWAYS AS (speed_sum / NULLIF(sample_count, 0)) STORED,
+    speed_min DECIMAL(5, 2) NOT NULL,
+    speed_max DECIMAL(5, 2) NOT NULL,
+    congestion_low INTEGER NOT NULL DEFAULT 0,
+    congestion_medium INTEGER NOT NULL DEFAULT 0,
+    congestion_high INTEGER NOT NULL DEFAULT 0,
+    congestion_severe INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (location_id, bucket_start)
+);
+
+CREATE TABLE traffic_rollup_daily (LIKE traffic_rollup_hourly INCLUDING ALL);
+ALTER TABLE traffic_rollup_daily
+    ADD FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE CASCADE;
+
+-- Indexes for rollups
+CREATE INDEX idx_traffic_rollup_hourly_bucket ON traffic_rollup_hourly(bucket_start);
+CREATE INDEX idx_traffic_rollup_daily_bucket ON traffic_rollup_daily(bucket_start);
+
+-- Tracks up to which traffic_data.created_at the rollups are up to date
+CREATE TABLE rollup_watermarks (
+    name VARCHAR(50) PRIMARY KEY,
+    processed_until TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+-- =====================================================
+-- Drops the analytics result identity index
+-- =====================================================
+DROP INDEX IF EXISTS idx_analytics_results_identity;
@@ -0,0 +1,21 @@
+-- =====================================================
+-- ANALYTICS RESULT IDENTITY
+-- A result is identified by its location, metric, period and aggregation
+-- method, so reprocessing a reading overwrites its results through
+-- INSERT ... ON CONFLICT instead of duplicating them.
+-- =====================================================
+
+-- Keep only the newest copy of results written before the index existed
+DELETE FROM analytics_results older
+USING analytics_results newer
+WHERE older.id < newer.id
+  AND older.location_id IS NOT DISTINCT FROM newer.location_id
+  AND older.metric_type = newer.metric_type
+  AND older.period_start = newer.period_start
+  AND older.period_end = newer.period_end
+  AND older.aggregation_method IS NOT DISTINCT FROM newer.aggregation_method;
+
+-- NULLS NOT DISTINCT (PostgreSQL 15+) makes system-wide results (no
+-- location) and results without an aggregation method unique as well
+CREATE UNIQUE INDEX idx_analytics_results_identity ON analytics_results
+    (location_id, metric_type, period_start, period_end, aggregation_method) NULLS NOT DISTINCT;
@@ -0,0 +1,4 @@
+-- =====================================================
+-- Drops the backfill checkpoints
+-- =====================================================
+DROP TABLE IF EXISTS backfill_checkpoints;
@@ -0,0 +1,22 @@
+-- =====================================================
+-- BACKFILL CHECKPOINTS
+-- Progress of historical reprocessing runs of the analytics processor. A run
+-- saves its position after every batch, so an interrupted backfill resumes
+-- where it stopped instead of starting over.
+-- =====================================================
+
+CREATE TABLE backfill_checkpoints (
+    name VARCHAR(100) PRIMARY KEY,
+    source VARCHAR(20) NOT NULL CHECK (source IN ('database', 'kafka')),
+    -- Parameters of the run (time range, locations, ...); resuming with
+    -- different ones is refused
+    spec JSONB NOT NULL,
+    -- Source-specific position of the last processed reading
+    position JSONB NOT NULL DEFAULT '{}',
+    processor_version VARCHAR(50) NOT NULL,
+    readings_processed BIGINT NOT NULL DEFAULT 0,
+    results_written BIGINT NOT NULL DEFAULT 0,
+    completed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+-- =====================================================
+-- Drops the API keys
+-- =====================================================
+DROP TABLE IF EXISTS api_keys;
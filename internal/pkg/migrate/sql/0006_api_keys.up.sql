@@ -0,0 +1,25 @@
+-- =====================================================
+-- API KEYS
+-- Per-consumer API keys for the api-gateway. Only a SHA-256 hash of each key
+-- is stored; key_id is the public part of the key used to look it up.
+-- =====================================================
+
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    key_id VARCHAR(32) NOT NULL UNIQUE,
+    key_hash CHAR(64) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    owner VARCHAR(100) NOT NULL,
+    -- JSON array of scopes, e.g. ["traffic:write"]
+    scopes JSONB NOT NULL DEFAULT '[]',
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    -- The key this one replaced when it was rotated
+    rotated_from INTEGER REFERENCES api_keys(id),
+    created_by VARCHAR(100),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_owner ON api_keys(owner);
@@ -0,0 +1,4 @@
+-- =====================================================
+-- Drops the API key rate limits
+-- =====================================================
+ALTER TABLE api_keys DROP COLUMN IF EXISTS rate_limit;
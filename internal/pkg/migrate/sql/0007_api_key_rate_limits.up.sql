@@ -0,0 +1,7 @@
+-- =====================================================
+-- API KEY RATE LIMITS
+-- Per-key quota for the api-gateway rate limiter, in requests per
+-- RATE_LIMIT_DURATION. Keys without one get the limit of each route class.
+-- =====================================================
+
+ALTER TABLE api_keys ADD COLUMN rate_limit INTEGER CHECK (rate_limit > 0);
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+
+	"api-traffic-analytics/internal/pkg/migrate"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+func TestMigrationsLoad(t *testing.T) {
+	migrations, err := migrate.Load()
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %04d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+type column struct {
+	Name      string `gorm:"column:column_name"`
+	DataType  string `gorm:"column:data_type"`
+	MaxLength *int   `gorm:"column:character_maximum_length"`
+	Nullable  string `gorm:"column:is_nullable"`
+}
+
+// TestModelsMatchSchema migrates the database at TEST_DATABASE_DSN and checks
+// that every gorm model agrees with its table: same columns, compatible types
+// and sizes, and nullability consistent with not null tags and pointer fields
+func TestModelsMatchSchema(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+
+	migrator, err := migrate.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+
+	modelList := []interface{}{
+		&models.Location{},
+		&models.TrafficData{},
+		&models.AnalyticsResult{},
+		&models.Alert{},
+		&models.SystemMetric{},
+		&models.Configuration{},
+		&models.AuditLog{},
+		&models.APIKey{},
+		&models.BackfillCheckpoint{},
+	}
+
+	for _, model := range modelList {
+		sch, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
+		if err != nil {
+			t.Fatalf("parsing %T: %v", model, err)
+		}
+
+		t.Run(sch.Table, func(t *testing.T) {
+			var columns []column
+			err := db.Raw(`SELECT column_name, data_type, character_maximum_length, is_nullable
+				FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = ?`, sch.Table).
+				Scan(&columns).Error
+			if err != nil {
+				t.Fatalf("reading columns: %v", err)
+			}
+			if len(columns) == 0 {
+				t.Fatalf("table %s does not exist", sch.Table)
+			}
+
+			byName := make(map[string]column, len(columns))
+			for _, c := range columns {
+				byName[c.Name] = c
+			}
+
+			for _, dbName := range sch.DBNames {
+				field := sch.FieldsByDBName[dbName]
+				c, ok := byName[dbName]
+				if !ok {
+					t.Errorf("%s.%s: column missing from the schema", sch.Table, dbName)
+					continue
+				}
+				delete(byName, dbName)
+				checkColumn(t, sch.Table, field, c)
+			}
+
+			for name := range byName {
+				t.Errorf("%s.%s: column has no field in %s", sch.Table, name, sch.Name)
+			}
+		})
+	}
+}
+
+func checkColumn(t *testing.T, table string, field *schema.Field, c column) {
+	t.Helper()
+
+	if !compatible(field.DataType, c.DataType) {
+		t.Errorf("%s.%s: field type %s does not match column type %s", table, c.Name, field.DataType, c.DataType)
+	}
+
+	if field.DataType == schema.String && field.Size > 0 && c.MaxLength != nil && *c.MaxLength != field.Size {
+		t.Errorf("%s.%s: field size %d does not match column length %d", table, c.Name, field.Size, *c.MaxLength)
+	}
+
+	if field.NotNull && c.Nullable == "YES" {
+		t.Errorf("%s.%s: field is not null but the column is nullable", table, c.Name)
+	}
+
+	if field.FieldType.Kind() == reflect.Ptr && c.Nullable == "NO" {
+		t.Errorf("%s.%s: pointer field on a NOT NULL column", table, c.Name)
+	}
+}
+
+// compatible reports whether a gorm data type can be stored in a column of
+// the given information_schema data type
+func compatible(dataType schema.DataType, columnType string) bool {
+	custom := strings.ToLower(string(dataType))
+	switch {
+	case dataType == schema.Bool:
+		return columnType == "boolean"
+	case dataType == schema.Int || dataType == schema.Uint:
+		return columnType == "integer" || columnType == "bigint" || columnType == "smallint"
+	case dataType == schema.Float, strings.HasPrefix(custom, "decimal"), strings.HasPrefix(custom, "numeric"):
+		return columnType == "numeric" || columnType == "double precision" || columnType == "real"
+	case dataType == schema.String:
+		return columnType == "character varying" || columnType == "character" || columnType == "text"
+	case dataType == schema.Time:
+		return strings.HasPrefix(columnType, "timestamp")
+	case dataType == schema.Bytes, custom == "jsonb":
+		return columnType == "bytea" || columnType == "jsonb"
+	default:
+		return custom == columnType
+	}
+}
@@ -0,0 +1,146 @@
+package postgres
+
+import (
+	"api-traffic-analytics/internal/shared/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotFound is returned (wrapped) when a requested record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// AlertFilter narrows down alert listings. Empty fields are ignored.
+type AlertFilter struct {
+	Status     string
+	Severity   string
+	AlertType  string
+	LocationID string
+	Limit      int
+}
+
+// AlertRepository handles CRUD operations for alerts using GORM
+type AlertRepository struct {
+	db *gorm.DB
+}
+
+// NewAlertRepository creates a new instance of AlertRepository
+func NewAlertRepository(db *gorm.DB) *AlertRepository {
+	return &AlertRepository{db: db}
+}
+
+// Create inserts a new alert
+func (r *AlertRepository) Create(ctx context.Context, alert *models.Alert) error {
+	if err := r.db.WithContext(ctx).Omit(clause.Associations).Create(alert).Error; err != nil {
+		return fmt.Errorf("error creating alert: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves an alert by its ID
+func (r *AlertRepository) GetByID(ctx context.Context, id int64) (*models.Alert, error) {
+	var alert models.Alert
+
+	result := r.db.WithContext(ctx).Where("id = ?", id).First(&alert)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("alert %d: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting alert by ID: %w", result.Error)
+	}
+
+	return &alert, nil
+}
+
+// List retrieves alerts matching the filter, newest first
+func (r *AlertRepository) List(ctx context.Context, filter AlertFilter) ([]*models.Alert, error) {
+	var alerts []*models.Alert
+
+	query := r.db.WithContext(ctx).Order("timestamp DESC")
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.AlertType != "" {
+		query = query.Where("alert_type = ?", filter.AlertType)
+	}
+	if filter.LocationID != "" {
+		query = query.Where("location_id = ?", filter.LocationID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	if err := query.Find(&alerts).Error; err != nil {
+		return nil, fmt.Errorf("error listing alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// FindOpen returns the unresolved alert of a given type for a location, or
+// nil if there is none
+func (r *AlertRepository) FindOpen(ctx context.Context, locationID, alertType string) (*models.Alert, error) {
+	var alert models.Alert
+
+	result := r.db.WithContext(ctx).
+		Where("location_id = ? AND alert_type = ?", locationID, alertType).
+		Where("status IN ?", []string{models.AlertStatusActive, models.AlertStatusAcknowledged}).
+		Order("timestamp DESC").
+		Limit(1).
+		Find(&alert)
+	if result.Error != nil {
+		return nil, fmt.Errorf("error finding open alert: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	return &alert, nil
+}
+
+// Transition locks an alert, lets apply mutate it and saves the result. It
+// returns the updated alert and the status it had before the change.
+func (r *AlertRepository) Transition(ctx context.Context, id int64, apply func(alert *models.Alert) error) (*models.Alert, string, error) {
+	var alert models.Alert
+	var previous string
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&alert)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("alert %d: %w", id, ErrNotFound)
+			}
+			return fmt.Errorf("error locking alert: %w", result.Error)
+		}
+
+		previous = alert.Status
+		if err := apply(&alert); err != nil {
+			return err
+		}
+
+		if err := tx.Omit(clause.Associations).Save(&alert).Error; err != nil {
+			return fmt.Errorf("error updating alert: %w", err)
+		}
+
+		// Load the location so callers can describe it (e.g. its city)
+		if alert.LocationID != nil {
+			var location models.Location
+			if err := tx.Where("id = ?", *alert.LocationID).Limit(1).Find(&location).Error; err != nil {
+				return fmt.Errorf("error loading alert location: %w", err)
+			}
+			alert.Location = &location
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &alert, previous, nil
+}
@@ -0,0 +1,327 @@
+package postgres
+
+import (
+	"api-traffic-analytics/internal/shared/models"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AnalyticsFilter narrows down analytics result queries. Zero values are
+// ignored; From/To bound the analysed period (period_start).
+type AnalyticsFilter struct {
+	MetricType string
+	LocationID string
+	From       time.Time
+	To         time.Time
+	IsAnomaly  *bool
+	Limit      int
+	Cursor     string
+}
+
+// Aggregation functions supported by Aggregate
+const (
+	AggregateAvg        = "avg"
+	AggregateMin        = "min"
+	AggregateMax        = "max"
+	AggregateSum        = "sum"
+	AggregateCount      = "count"
+	AggregatePercentile = "percentile"
+)
+
+// Grouping dimensions supported by Aggregate
+const (
+	GroupByHour     = "hour"
+	GroupByDay      = "day"
+	GroupByLocation = "location"
+)
+
+// AggregateSpec describes a server-side aggregation over analytics results
+type AggregateSpec struct {
+	Filter     AnalyticsFilter
+	GroupBy    []string
+	Function   string
+	Percentile float64
+}
+
+// AnalyticsAggregate is one group of an aggregation
+type AnalyticsAggregate struct {
+	BucketStart *time.Time `json:"bucket_start,omitempty"`
+	LocationID  *string    `json:"location_id,omitempty"`
+	Value       float64    `json:"value"`
+	SampleCount int64      `json:"sample_count"`
+}
+
+// AnalyticsResultRepository handles queries over analytics results using GORM
+type AnalyticsResultRepository struct {
+	db *gorm.DB
+}
+
+// NewAnalyticsResultRepository creates a new instance of AnalyticsResultRepository
+func NewAnalyticsResultRepository(db *gorm.DB) *AnalyticsResultRepository {
+	return &AnalyticsResultRepository{db: db}
+}
+
+// analyticsBatchSize bounds the rows of a single multi-row INSERT
+const analyticsBatchSize = 500
+
+// analyticsIdentityColumns identify a result; they are covered by the
+// idx_analytics_results_identity unique index (NULLS NOT DISTINCT)
+var analyticsIdentityColumns = []string{
+	"location_id", "metric_type", "period_start", "period_end", "aggregation_method",
+}
+
+// analyticsValueColumns are overwritten when an upsert hits an existing result
+var analyticsValueColumns = []string{
+	"analysis_timestamp", "value", "unit", "confidence_level", "trend",
+	"sample_size", "is_anomaly", "metadata", "updated_at",
+}
+
+// BulkInsert inserts results with multi-row INSERTs. A result that already
+// exists fails the whole call with ErrDuplicate.
+func (r *AnalyticsResultRepository) BulkInsert(ctx context.Context, results []*models.AnalyticsResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	err := r.db.WithContext(ctx).Omit(clause.Associations).CreateInBatches(results, analyticsBatchSize).Error
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("analytics result: %w", ErrDuplicate)
+		}
+		return fmt.Errorf("error inserting analytics results: %w", err)
+	}
+	return nil
+}
+
+// Upsert inserts results, overwriting the values of those that already exist
+// for the same location, metric, period and aggregation method. IDs are
+// filled in for both inserted and updated rows. When several results share
+// an identity only the last one is written.
+func (r *AnalyticsResultRepository) Upsert(ctx context.Context, results []*models.AnalyticsResult) error {
+	results = lastPerIdentity(results)
+	if len(results) == 0 {
+		return nil
+	}
+
+	columns := make([]clause.Column, len(analyticsIdentityColumns))
+	for i, name := range analyticsIdentityColumns {
+		columns[i] = clause.Column{Name: name}
+	}
+
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: columns, DoUpdates: clause.AssignmentColumns(analyticsValueColumns)}).
+		Omit(clause.Associations).
+		CreateInBatches(results, analyticsBatchSize).Error
+	if err != nil {
+		return fmt.Errorf("error upserting analytics results: %w", err)
+	}
+	return nil
+}
+
+// ListByPeriod retrieves the results whose period starts in [from, to),
+// optionally restricted to some metric types, ordered by period, location
+// and metric
+func (r *AnalyticsResultRepository) ListByPeriod(ctx context.Context, from, to time.Time, metricTypes ...string) ([]*models.AnalyticsResult, error) {
+	var results []*models.AnalyticsResult
+
+	query := r.db.WithContext(ctx).
+		Where("period_start >= ? AND period_start < ?", from, to).
+		Order("period_start, location_id, metric_type")
+	if len(metricTypes) > 0 {
+		query = query.Where("metric_type IN ?", metricTypes)
+	}
+
+	if err := query.Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("error listing analytics results by period: %w", err)
+	}
+	return results, nil
+}
+
+// LatestByMetric retrieves the result of a metric with the most recent period
+// for a location
+func (r *AnalyticsResultRepository) LatestByMetric(ctx context.Context, locationID, metricType string) (*models.AnalyticsResult, error) {
+	var result models.AnalyticsResult
+
+	query := r.db.WithContext(ctx).
+		Where("location_id = ? AND metric_type = ?", locationID, metricType).
+		Order("period_start DESC, id DESC").
+		Limit(1).
+		Find(&result)
+	if query.Error != nil {
+		return nil, fmt.Errorf("error getting latest analytics result: %w", query.Error)
+	}
+	if query.RowsAffected == 0 {
+		return nil, fmt.Errorf("no %s result for location %s: %w", metricType, locationID, ErrNotFound)
+	}
+	return &result, nil
+}
+
+// AnalyticsIdentity is the key of a result in idx_analytics_results_identity
+type AnalyticsIdentity struct {
+	LocationID        string
+	MetricType        string
+	PeriodStart       time.Time
+	PeriodEnd         time.Time
+	AggregationMethod string
+}
+
+// IdentityOf returns the identity of a result. A nil location is the empty
+// string; times are normalized so identities can be compared with ==.
+func IdentityOf(result *models.AnalyticsResult) AnalyticsIdentity {
+	identity := AnalyticsIdentity{
+		MetricType:        result.MetricType,
+		PeriodStart:       result.PeriodStart.UTC().Round(0),
+		PeriodEnd:         result.PeriodEnd.UTC().Round(0),
+		AggregationMethod: result.AggregationMethod,
+	}
+	if result.LocationID != nil {
+		identity.LocationID = *result.LocationID
+	}
+	return identity
+}
+
+// lastPerIdentity drops all but the last of the results sharing an identity:
+// ON CONFLICT DO UPDATE cannot touch the same row twice in one statement
+func lastPerIdentity(results []*models.AnalyticsResult) []*models.AnalyticsResult {
+	last := make(map[AnalyticsIdentity]int, len(results))
+	for i, result := range results {
+		last[IdentityOf(result)] = i
+	}
+	if len(last) == len(results) {
+		return results
+	}
+
+	unique := make([]*models.AnalyticsResult, 0, len(last))
+	for i, result := range results {
+		if last[IdentityOf(result)] == i {
+			unique = append(unique, result)
+		}
+	}
+	return unique
+}
+
+// Query retrieves analytics results matching the filter, newest period first,
+// using keyset pagination. It returns the cursor of the next page, or "".
+func (r *AnalyticsResultRepository) Query(ctx context.Context, filter AnalyticsFilter) ([]*models.AnalyticsResult, string, error) {
+	var results []*models.AnalyticsResult
+
+	query := r.applyFilter(r.db.WithContext(ctx).Model(&models.AnalyticsResult{}), filter).
+		Order("period_start DESC, id DESC")
+	if filter.Cursor != "" {
+		ts, id, err := DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("(period_start, id) < (?, ?)", ts, id)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if result := query.Limit(limit + 1).Find(&results); result.Error != nil {
+		return nil, "", fmt.Errorf("error querying analytics results: %w", result.Error)
+	}
+
+	var next string
+	if len(results) > limit {
+		results = results[:limit]
+		last := results[len(results)-1]
+		next = EncodeCursor(last.PeriodStart, int64(last.ID))
+	}
+
+	return results, next, nil
+}
+
+// Aggregate computes spec.Function over the filtered results, grouped by the
+// requested dimensions
+func (r *AnalyticsResultRepository) Aggregate(ctx context.Context, spec AggregateSpec) ([]*AnalyticsAggregate, error) {
+	var selects, groups []string
+	var args []interface{}
+
+	for _, dim := range spec.GroupBy {
+		switch dim {
+		case GroupByHour, GroupByDay:
+			// dim is whitelisted, so it is safe to inline
+			selects = append(selects, fmt.Sprintf("date_trunc('%s', period_start) AS bucket_start", dim))
+			groups = append(groups, "bucket_start")
+		case GroupByLocation:
+			selects = append(selects, "location_id")
+			groups = append(groups, "location_id")
+		default:
+			return nil, fmt.Errorf("unsupported group_by %q", dim)
+		}
+	}
+
+	switch spec.Function {
+	case AggregateAvg, AggregateMin, AggregateMax, AggregateSum:
+		selects = append(selects, fmt.Sprintf("%s(value) AS value", strings.ToUpper(spec.Function)))
+	case AggregateCount:
+		selects = append(selects, "COUNT(*) AS value")
+	case AggregatePercentile:
+		if spec.Percentile < 0 || spec.Percentile > 1 {
+			return nil, fmt.Errorf("percentile must be between 0 and 1")
+		}
+		selects = append(selects, "percentile_cont(?) WITHIN GROUP (ORDER BY value) AS value")
+		args = append(args, spec.Percentile)
+	default:
+		return nil, fmt.Errorf("unsupported aggregation %q", spec.Function)
+	}
+	selects = append(selects, "COUNT(*) AS sample_count")
+
+	var aggregates []*AnalyticsAggregate
+	query := r.applyFilter(r.db.WithContext(ctx).Model(&models.AnalyticsResult{}), spec.Filter).
+		Select(strings.Join(selects, ", "), args...)
+	if len(groups) > 0 {
+		query = query.Group(strings.Join(groups, ", ")).Order(strings.Join(groups, ", "))
+	}
+
+	if err := query.Scan(&aggregates).Error; err != nil {
+		return nil, fmt.Errorf("error aggregating analytics results: %w", err)
+	}
+
+	return aggregates, nil
+}
+
+// Summary reads the analytics_summary view (last 24 hours per location and metric)
+func (r *AnalyticsResultRepository) Summary(ctx context.Context, locationID, metricType string) ([]*models.AnalyticsSummary, error) {
+	var summary []*models.AnalyticsSummary
+
+	query := r.db.WithContext(ctx).Table("analytics_summary").Order("location_id, metric_type")
+	if locationID != "" {
+		query = query.Where("location_id = ?", locationID)
+	}
+	if metricType != "" {
+		query = query.Where("metric_type = ?", metricType)
+	}
+
+	if err := query.Find(&summary).Error; err != nil {
+		return nil, fmt.Errorf("error reading analytics summary: %w", err)
+	}
+
+	return summary, nil
+}
+
+func (r *AnalyticsResultRepository) applyFilter(query *gorm.DB, filter AnalyticsFilter) *gorm.DB {
+	if filter.MetricType != "" {
+		query = query.Where("metric_type = ?", filter.MetricType)
+	}
+	if filter.LocationID != "" {
+		query = query.Where("location_id = ?", filter.LocationID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("period_start >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("period_start <= ?", filter.To)
+	}
+	if filter.IsAnomaly != nil {
+		query = query.Where("is_anomaly = ?", *filter.IsAnomaly)
+	}
+	return query
+}
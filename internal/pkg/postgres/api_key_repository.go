@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"api-traffic-analytics/internal/shared/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// APIKeyFilter narrows down API key listings. Revoked keys are left out
+// unless IncludeRevoked is set.
+type APIKeyFilter struct {
+	Owner          string
+	IncludeRevoked bool
+}
+
+// APIKeyRepository handles CRUD operations for API keys using GORM
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates a new instance of APIKeyRepository
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// Create inserts a new API key. A key_id already in use returns ErrDuplicate.
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	if err := r.db.WithContext(ctx).Create(key).Error; err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("api key %s: %w", key.KeyID, ErrDuplicate)
+		}
+		return fmt.Errorf("error creating api key: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves an API key by its ID
+func (r *APIKeyRepository) GetByID(ctx context.Context, id int) (*models.APIKey, error) {
+	return r.get(ctx, "id = ?", id)
+}
+
+// GetByKeyID retrieves an API key by the public part of the key
+func (r *APIKeyRepository) GetByKeyID(ctx context.Context, keyID string) (*models.APIKey, error) {
+	return r.get(ctx, "key_id = ?", keyID)
+}
+
+func (r *APIKeyRepository) get(ctx context.Context, query string, arg interface{}) (*models.APIKey, error) {
+	var key models.APIKey
+	result := r.db.WithContext(ctx).Where(query, arg).First(&key)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("api key %v: %w", arg, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting api key: %w", result.Error)
+	}
+	return &key, nil
+}
+
+// List retrieves the API keys matching the filter, newest first
+func (r *APIKeyRepository) List(ctx context.Context, filter APIKeyFilter) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+
+	query := r.db.WithContext(ctx)
+	if filter.Owner != "" {
+		query = query.Where("owner = ?", filter.Owner)
+	}
+	if !filter.IncludeRevoked {
+		query = query.Where("revoked_at IS NULL")
+	}
+
+	if err := query.Order("created_at DESC, id DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("error listing api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke marks a key as revoked at the given time and returns it. Revoking
+// a key twice keeps the first revocation time.
+func (r *APIKeyRepository) Revoke(ctx context.Context, id int, at time.Time) (*models.APIKey, error) {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{"revoked_at": at, "updated_at": at})
+	if result.Error != nil {
+		return nil, fmt.Errorf("error revoking api key: %w", result.Error)
+	}
+	return r.GetByID(ctx, id)
+}
+
+// Rotate stores replacement as the successor of key id and makes the old key
+// expire at graceUntil (or earlier, if it already expired sooner). It returns
+// ErrNotFound if the old key does not exist or is revoked.
+func (r *APIKeyRepository) Rotate(ctx context.Context, id int, replacement *models.APIKey, graceUntil time.Time) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var old models.APIKey
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND revoked_at IS NULL", id).First(&old)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("api key %d: %w", id, ErrNotFound)
+			}
+			return result.Error
+		}
+
+		if old.ExpiresAt == nil || graceUntil.Before(*old.ExpiresAt) {
+			if err := tx.Model(&old).Updates(map[string]interface{}{"expires_at": graceUntil}).Error; err != nil {
+				return err
+			}
+		}
+
+		replacement.RotatedFrom = &old.ID
+		if err := tx.Create(replacement).Error; err != nil {
+			if isUniqueViolation(err) {
+				return fmt.Errorf("api key %s: %w", replacement.KeyID, ErrDuplicate)
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrDuplicate) {
+			return err
+		}
+		return fmt.Errorf("error rotating api key: %w", err)
+	}
+	return nil
+}
+
+// TouchLastUsed records that a key was used at the given time
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id int, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, at).
+		UpdateColumn("last_used_at", at)
+	if result.Error != nil {
+		return fmt.Errorf("error updating api key last use: %w", result.Error)
+	}
+	return nil
+}
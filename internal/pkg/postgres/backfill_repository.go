@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// BackfillCheckpointRepository stores backfill checkpoints using GORM
+type BackfillCheckpointRepository struct {
+	db *gorm.DB
+}
+
+// NewBackfillCheckpointRepository creates a new instance of BackfillCheckpointRepository
+func NewBackfillCheckpointRepository(db *gorm.DB) *BackfillCheckpointRepository {
+	return &BackfillCheckpointRepository{db: db}
+}
+
+// Get returns the checkpoint of a run, or ErrNotFound if it never saved one
+func (r *BackfillCheckpointRepository) Get(ctx context.Context, name string) (*models.BackfillCheckpoint, error) {
+	var checkpoint models.BackfillCheckpoint
+	result := r.db.WithContext(ctx).Where("name = ?", name).First(&checkpoint)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("backfill checkpoint %s: %w", name, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting backfill checkpoint: %w", result.Error)
+	}
+	return &checkpoint, nil
+}
+
+// Save creates or overwrites the checkpoint of a run, keeping its created_at
+func (r *BackfillCheckpointRepository) Save(ctx context.Context, checkpoint *models.BackfillCheckpoint) error {
+	checkpoint.UpdatedAt = time.Now().UTC()
+	if checkpoint.CreatedAt.IsZero() {
+		checkpoint.CreatedAt = checkpoint.UpdatedAt
+	}
+
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"source", "spec", "position", "processor_version",
+			"readings_processed", "results_written", "completed_at", "updated_at",
+		}),
+	}).Create(checkpoint)
+	if result.Error != nil {
+		return fmt.Errorf("error saving backfill checkpoint: %w", result.Error)
+	}
+	return nil
+}
+
+// Delete removes the checkpoint of a run so it can start over
+func (r *BackfillCheckpointRepository) Delete(ctx context.Context, name string) error {
+	result := r.db.WithContext(ctx).Where("name = ?", name).Delete(&models.BackfillCheckpoint{})
+	if result.Error != nil {
+		return fmt.Errorf("error deleting backfill checkpoint: %w", result.Error)
+	}
+	return nil
+}
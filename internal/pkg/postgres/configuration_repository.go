@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"api-traffic-analytics/internal/shared/models"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// ConfigurationRepository reads runtime settings from the configurations table
+type ConfigurationRepository struct {
+	db *gorm.DB
+}
+
+// NewConfigurationRepository creates a new instance of ConfigurationRepository
+func NewConfigurationRepository(db *gorm.DB) *ConfigurationRepository {
+	return &ConfigurationRepository{db: db}
+}
+
+// Get retrieves an active configuration by key
+func (r *ConfigurationRepository) Get(ctx context.Context, key string) (*models.Configuration, error) {
+	var configuration models.Configuration
+
+	result := r.db.WithContext(ctx).Where("key = ? AND is_active = ?", key, true).First(&configuration)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("configuration %s: %w", key, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting configuration: %w", result.Error)
+	}
+
+	return &configuration, nil
+}
+
+// GetString returns the value of key, or defaultValue when it is not set
+func (r *ConfigurationRepository) GetString(ctx context.Context, key, defaultValue string) (string, error) {
+	configuration, err := r.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return defaultValue, nil
+		}
+		return "", err
+	}
+	return configuration.Value, nil
+}
+
+// GetInt returns the integer value of key, or defaultValue when it is not set
+func (r *ConfigurationRepository) GetInt(ctx context.Context, key string, defaultValue int) (int, error) {
+	value, err := r.GetString(ctx, key, "")
+	if err != nil || value == "" {
+		return defaultValue, err
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("configuration %s: %q is not an integer", key, value)
+	}
+	return n, nil
+}
@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -72,3 +73,12 @@ func getEnv(key, defaultValue string) string {
 func GetDB() *gorm.DB {
 	return DB
 }
+
+// Ping checks that the database answers
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database instance: %w", err)
+	}
+	return sqlDB.PingContext(ctx)
+}
@@ -0,0 +1,231 @@
+package postgres
+
+import (
+	"api-traffic-analytics/internal/shared/models"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Mean earth radius used for great-circle distances
+const earthRadiusMeters = 6371000.0
+
+// haversineSQL computes the great-circle distance in meters (mean earth radius
+// 6371 km) between each location and the point bound to the three
+// placeholders (lat, lat, lon). DistanceMeters is its Go counterpart.
+const haversineSQL = "2 * 6371000 * asin(sqrt(" +
+	"power(sin(radians(locations.latitude::float8 - ?::float8) / 2), 2) + " +
+	"cos(radians(?::float8)) * cos(radians(locations.latitude::float8)) * " +
+	"power(sin(radians(locations.longitude::float8 - ?::float8) / 2), 2)))"
+
+// GeoPoint is a WGS84 coordinate
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// DistanceMeters returns the great-circle distance between a and b with the
+// haversine formula, as haversineSQL computes it
+func DistanceMeters(a, b GeoPoint) float64 {
+	rad := math.Pi / 180
+	dLat := (b.Lat - a.Lat) * rad
+	dLon := (b.Lon - a.Lon) * rad
+	h := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(a.Lat*rad)*math.Cos(b.Lat*rad)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+// BoundingBox is a lat/lon rectangle. MinLon > MaxLon means the box crosses
+// the antimeridian.
+type BoundingBox struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+}
+
+// Contains reports whether p is inside the box, edges included, as withinBox
+// filters it
+func (b BoundingBox) Contains(p GeoPoint) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return p.Lon >= b.MinLon && p.Lon <= b.MaxLon
+	}
+	return p.Lon >= b.MinLon || p.Lon <= b.MaxLon
+}
+
+// GeoOptions are the options shared by every spatial query
+type GeoOptions struct {
+	City            string
+	IncludeInactive bool
+	IncludeTraffic  bool
+	Limit           int
+}
+
+// LocationWithTraffic is a location returned by a spatial query, with its
+// distance to the query point and optionally its latest traffic reading
+type LocationWithTraffic struct {
+	models.Location
+	DistanceMeters *float64            `gorm:"column:distance_meters" json:"distance_meters,omitempty"`
+	LatestTraffic  *models.TrafficData `gorm:"-" json:"latest_traffic,omitempty"`
+}
+
+// WithinRadius returns the locations at most radiusMeters from center, nearest first
+func (r *LocationRepository) WithinRadius(ctx context.Context, center GeoPoint, radiusMeters float64, opts GeoOptions) ([]*LocationWithTraffic, error) {
+	// Narrow down with the bounding box first so idx_locations_coordinates is used
+	query := r.geoQuery(ctx, opts).
+		Select("locations.*, "+haversineSQL+" AS distance_meters", center.Lat, center.Lat, center.Lon).
+		Scopes(withinBox(RadiusBox(center, radiusMeters))).
+		Where(haversineSQL+" <= ?", center.Lat, center.Lat, center.Lon, radiusMeters).
+		Order("distance_meters")
+
+	return r.findGeo(ctx, query, opts)
+}
+
+// Nearest returns the k locations closest to center, nearest first
+func (r *LocationRepository) Nearest(ctx context.Context, center GeoPoint, k int, opts GeoOptions) ([]*LocationWithTraffic, error) {
+	opts.Limit = k
+	query := r.geoQuery(ctx, opts).
+		Select("locations.*, "+haversineSQL+" AS distance_meters", center.Lat, center.Lat, center.Lon).
+		Order("distance_meters")
+
+	return r.findGeo(ctx, query, opts)
+}
+
+// WithinBoundingBox returns the locations inside the box, ordered by ID
+func (r *LocationRepository) WithinBoundingBox(ctx context.Context, box BoundingBox, opts GeoOptions) ([]*LocationWithTraffic, error) {
+	query := r.geoQuery(ctx, opts).
+		Select("locations.*").
+		Scopes(withinBox(box)).
+		Order("locations.id")
+
+	return r.findGeo(ctx, query, opts)
+}
+
+// WithinPolygon returns the locations inside the polygon, ordered by ID. The
+// ring is closed implicitly; points on the boundary count as inside.
+func (r *LocationRepository) WithinPolygon(ctx context.Context, ring []GeoPoint, opts GeoOptions) ([]*LocationWithTraffic, error) {
+	if len(ring) < 3 {
+		return nil, fmt.Errorf("polygon needs at least 3 points")
+	}
+
+	// Postgres geometric types are planar, so x is the longitude and y the latitude
+	vertices := make([]string, len(ring))
+	box := BoundingBox{MinLat: ring[0].Lat, MaxLat: ring[0].Lat, MinLon: ring[0].Lon, MaxLon: ring[0].Lon}
+	for i, p := range ring {
+		vertices[i] = fmt.Sprintf("(%g,%g)", p.Lon, p.Lat)
+		box.MinLat = math.Min(box.MinLat, p.Lat)
+		box.MaxLat = math.Max(box.MaxLat, p.Lat)
+		box.MinLon = math.Min(box.MinLon, p.Lon)
+		box.MaxLon = math.Max(box.MaxLon, p.Lon)
+	}
+
+	query := r.geoQuery(ctx, opts).
+		Select("locations.*").
+		Scopes(withinBox(box)).
+		Where("point(locations.longitude::float8, locations.latitude::float8) <@ ?::polygon",
+			"("+strings.Join(vertices, ",")+")").
+		Order("locations.id")
+
+	return r.findGeo(ctx, query, opts)
+}
+
+func (r *LocationRepository) geoQuery(ctx context.Context, opts GeoOptions) *gorm.DB {
+	query := r.db.WithContext(ctx).Table("locations")
+	if !opts.IncludeInactive {
+		query = query.Where("locations.is_active = ?", true)
+	}
+	if opts.City != "" {
+		query = query.Where("LOWER(locations.city) = LOWER(?)", opts.City)
+	}
+	return query
+}
+
+func (r *LocationRepository) findGeo(ctx context.Context, query *gorm.DB, opts GeoOptions) ([]*LocationWithTraffic, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var locations []*LocationWithTraffic
+	if err := query.Limit(limit).Scan(&locations).Error; err != nil {
+		return nil, fmt.Errorf("error querying locations: %w", err)
+	}
+
+	if opts.IncludeTraffic && len(locations) > 0 {
+		if err := r.attachLatestTraffic(ctx, locations); err != nil {
+			return nil, err
+		}
+	}
+
+	return locations, nil
+}
+
+// attachLatestTraffic loads the latest reading of every location in one query
+func (r *LocationRepository) attachLatestTraffic(ctx context.Context, locations []*LocationWithTraffic) error {
+	ids := make([]string, len(locations))
+	for i, location := range locations {
+		ids[i] = location.ID
+	}
+
+	var latest []*models.TrafficData
+	result := r.db.WithContext(ctx).
+		Raw(`SELECT DISTINCT ON (location_id) * FROM traffic_data
+			WHERE location_id IN ? ORDER BY location_id, timestamp DESC`, ids).
+		Scan(&latest)
+	if result.Error != nil {
+		return fmt.Errorf("error getting latest traffic data: %w", result.Error)
+	}
+
+	byLocation := make(map[string]*models.TrafficData, len(latest))
+	for _, data := range latest {
+		byLocation[data.LocationID] = data
+	}
+	for _, location := range locations {
+		location.LatestTraffic = byLocation[location.ID]
+	}
+	return nil
+}
+
+// RadiusBox returns a box enclosing the circle around center, on the sphere
+// DistanceMeters measures. The longitude bounds are dropped when the circle
+// reaches a pole or crosses the antimeridian.
+func RadiusBox(center GeoPoint, radiusMeters float64) BoundingBox {
+	rad := math.Pi / 180
+	angle := radiusMeters / earthRadiusMeters
+	dLat := angle / rad
+	box := BoundingBox{
+		MinLat: math.Max(center.Lat-dLat, -90),
+		MaxLat: math.Min(center.Lat+dLat, 90),
+		MinLon: -180,
+		MaxLon: 180,
+	}
+
+	// Away from the poles the circle spans asin(sin(angle) / cos(lat)) of
+	// longitude either side, a bit more than angle / cos(lat)
+	if center.Lat+dLat < 90 && center.Lat-dLat > -90 {
+		if sin := math.Sin(angle) / math.Cos(center.Lat*rad); sin < 1 {
+			dLon := math.Asin(sin) / rad
+			if center.Lon-dLon >= -180 && center.Lon+dLon <= 180 {
+				box.MinLon = center.Lon - dLon
+				box.MaxLon = center.Lon + dLon
+			}
+		}
+	}
+	return box
+}
+
+func withinBox(box BoundingBox) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("locations.latitude BETWEEN ? AND ?", box.MinLat, box.MaxLat)
+		if box.MinLon <= box.MaxLon {
+			return db.Where("locations.longitude BETWEEN ? AND ?", box.MinLon, box.MaxLon)
+		}
+		return db.Where("(locations.longitude >= ? OR locations.longitude <= ?)", box.MinLon, box.MaxLon)
+	}
+}
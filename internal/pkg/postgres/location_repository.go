@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"api-traffic-analytics/internal/shared/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrDuplicate is returned (wrapped) when a record with the same key already exists
+var ErrDuplicate = errors.New("record already exists")
+
+// locationColumns are the columns a location create/update/import may write
+var locationColumns = []string{
+	"name", "description", "latitude", "longitude", "address", "city", "country", "is_active",
+}
+
+// LocationFilter narrows down location listings. Empty fields are ignored.
+type LocationFilter struct {
+	City     string
+	IsActive *bool
+}
+
+// LocationRepository handles CRUD operations for locations using GORM
+type LocationRepository struct {
+	db *gorm.DB
+}
+
+// NewLocationRepository creates a new instance of LocationRepository
+func NewLocationRepository(db *gorm.DB) *LocationRepository {
+	return &LocationRepository{db: db}
+}
+
+// Create inserts a new location
+func (r *LocationRepository) Create(ctx context.Context, location *models.Location) error {
+	// Select the columns explicitly so is_active=false is not replaced by the default
+	result := r.db.WithContext(ctx).Select(append([]string{"id"}, locationColumns...)).Create(location)
+	if result.Error != nil {
+		if isUniqueViolation(result.Error) {
+			return fmt.Errorf("location %s: %w", location.ID, ErrDuplicate)
+		}
+		return fmt.Errorf("error creating location: %w", result.Error)
+	}
+	return nil
+}
+
+// GetByID retrieves a location by its ID
+func (r *LocationRepository) GetByID(ctx context.Context, id string) (*models.Location, error) {
+	var location models.Location
+
+	result := r.db.WithContext(ctx).Where("id = ?", id).First(&location)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("location %s: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("error getting location by ID: %w", result.Error)
+	}
+
+	return &location, nil
+}
+
+// List retrieves locations matching the filter, ordered by ID
+func (r *LocationRepository) List(ctx context.Context, filter LocationFilter) ([]*models.Location, error) {
+	var locations []*models.Location
+
+	query := r.db.WithContext(ctx).Order("id")
+	if filter.City != "" {
+		query = query.Where("LOWER(city) = LOWER(?)", filter.City)
+	}
+	if filter.IsActive != nil {
+		query = query.Where("is_active = ?", *filter.IsActive)
+	}
+
+	if err := query.Find(&locations).Error; err != nil {
+		return nil, fmt.Errorf("error listing locations: %w", err)
+	}
+
+	return locations, nil
+}
+
+// Update overwrites the editable fields of an existing location
+func (r *LocationRepository) Update(ctx context.Context, location *models.Location) error {
+	result := r.db.WithContext(ctx).Model(location).Select(locationColumns).Updates(location)
+	if result.Error != nil {
+		return fmt.Errorf("error updating location: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("location %s: %w", location.ID, ErrNotFound)
+	}
+	return nil
+}
+
+// SetActive activates or deactivates a location
+func (r *LocationRepository) SetActive(ctx context.Context, id string, active bool) error {
+	result := r.db.WithContext(ctx).Model(&models.Location{}).Where("id = ?", id).Update("is_active", active)
+	if result.Error != nil {
+		return fmt.Errorf("error updating location status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("location %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// BulkUpsert inserts the locations, overwriting existing ones with the same ID
+func (r *LocationRepository) BulkUpsert(ctx context.Context, locations []*models.Location) error {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	result := r.db.WithContext(ctx).
+		Select(append([]string{"id"}, locationColumns...)).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns(locationColumns),
+		}).
+		CreateInBatches(locations, 100)
+	if result.Error != nil {
+		return fmt.Errorf("error importing locations: %w", result.Error)
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,304 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// What to do with partitions that fall out of the retention window
+const (
+	RetentionDrop    = "drop"
+	RetentionArchive = "archive"
+)
+
+// ArchiveSchema is where archived partitions are moved to
+const ArchiveSchema = "archive"
+
+// Partition is a monthly range partition covering [From, To)
+type Partition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// PartitionManager creates and retires the monthly partitions of tables
+// partitioned by RANGE (timestamp). Monthly partitions are named
+// <table>_yYYYYmMM and the catch-all partition <table>_default.
+type PartitionManager struct {
+	db *gorm.DB
+}
+
+// NewPartitionManager creates a new instance of PartitionManager
+func NewPartitionManager(db *gorm.DB) *PartitionManager {
+	return &PartitionManager{db: db}
+}
+
+// PartitionName returns the name of the partition of table holding month
+func PartitionName(table string, month time.Time) string {
+	return fmt.Sprintf("%s_y%04dm%02d", table, month.Year(), month.Month())
+}
+
+// List returns the monthly partitions of table, oldest first
+func (m *PartitionManager) List(ctx context.Context, table string) ([]Partition, error) {
+	var names []string
+	result := m.db.WithContext(ctx).Raw(`
+		SELECT child.relname
+		FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		JOIN pg_namespace ns ON ns.oid = parent.relnamespace
+		WHERE parent.relname = ? AND ns.nspname = current_schema()`, table).
+		Scan(&names)
+	if result.Error != nil {
+		return nil, fmt.Errorf("error listing partitions of %s: %w", table, result.Error)
+	}
+
+	return parsePartitions(table, names), nil
+}
+
+// ListArchived returns the monthly partitions of table that retention moved
+// to the archive schema, oldest first
+func (m *PartitionManager) ListArchived(ctx context.Context, table string) ([]Partition, error) {
+	var names []string
+	result := m.db.WithContext(ctx).Raw(`
+		SELECT c.relname
+		FROM pg_class c
+		JOIN pg_namespace ns ON ns.oid = c.relnamespace
+		WHERE ns.nspname = ? AND c.relkind = 'r' AND c.relname LIKE ?`, ArchiveSchema, table+`\_y%`).
+		Scan(&names)
+	if result.Error != nil {
+		return nil, fmt.Errorf("error listing archived partitions of %s: %w", table, result.Error)
+	}
+
+	return parsePartitions(table, names), nil
+}
+
+// parsePartitions keeps the monthly partition names of table and sorts them
+func parsePartitions(table string, names []string) []Partition {
+	var partitions []Partition
+	for _, name := range names {
+		suffix, ok := strings.CutPrefix(name, table+"_y")
+		if !ok {
+			continue
+		}
+		from, err := time.Parse("2006m01", suffix)
+		if err != nil {
+			continue
+		}
+		partitions = append(partitions, Partition{Name: name, From: from, To: from.AddDate(0, 1, 0)})
+	}
+
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].From.Before(partitions[j].From) })
+	return partitions
+}
+
+// EnsureMonthly creates the partitions of the month of now and of the
+// monthsAhead following months that do not exist yet. It returns the names of
+// the partitions it created.
+func (m *PartitionManager) EnsureMonthly(ctx context.Context, table string, now time.Time, monthsAhead int) ([]string, error) {
+	existing, err := m.List(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		exists[p.Name] = true
+	}
+
+	var created []string
+	for _, p := range MonthlyPartitions(table, now, monthsAhead) {
+		if exists[p.Name] {
+			continue
+		}
+		if err := m.create(ctx, table, p); err != nil {
+			return created, err
+		}
+		created = append(created, p.Name)
+	}
+
+	return created, nil
+}
+
+// Retire detaches the partitions that end before the start of the month
+// keepMonths months before now, then drops them or moves them to the archive
+// schema. Expired rows of months without a partition, which sit in the default
+// partition, are deleted or moved to the archive table of their month. It
+// returns the names of the retired partitions, including the monthly names of
+// the rows retired from the default partition.
+func (m *PartitionManager) Retire(ctx context.Context, table string, now time.Time, keepMonths int, action string) ([]string, error) {
+	if err := ValidateRetention(keepMonths, action); err != nil {
+		return nil, err
+	}
+
+	partitions, err := m.List(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := RetentionCutoff(now, keepMonths)
+	var retired []string
+	for _, p := range partitions {
+		if p.To.After(cutoff) {
+			break
+		}
+
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", quoteIdent(table), quoteIdent(p.Name))).Error; err != nil {
+				return err
+			}
+			if action == RetentionDrop {
+				return tx.Exec("DROP TABLE " + quoteIdent(p.Name)).Error
+			}
+			if err := tx.Exec("CREATE SCHEMA IF NOT EXISTS " + quoteIdent(ArchiveSchema)).Error; err != nil {
+				return err
+			}
+			return tx.Exec(fmt.Sprintf("ALTER TABLE %s SET SCHEMA %s", quoteIdent(p.Name), quoteIdent(ArchiveSchema))).Error
+		})
+		if err != nil {
+			return retired, fmt.Errorf("error retiring partition %s: %w", p.Name, err)
+		}
+		retired = append(retired, p.Name)
+	}
+
+	months, err := m.retireDefault(ctx, table, cutoff, action)
+	for _, name := range months {
+		if !slices.Contains(retired, name) {
+			retired = append(retired, name)
+		}
+	}
+	if err != nil {
+		return retired, err
+	}
+
+	return retired, nil
+}
+
+// retireDefault deletes the rows of the default partition of table older than
+// cutoff, one month at a time. With RetentionArchive the rows are first copied
+// to the table of their month in the archive schema, created when retention
+// has not archived that month yet. It returns the names of the months retired.
+func (m *PartitionManager) retireDefault(ctx context.Context, table string, cutoff time.Time, action string) ([]string, error) {
+	defaultPartition := quoteIdent(table + "_default")
+
+	var months []time.Time
+	query := fmt.Sprintf("SELECT DISTINCT date_trunc('month', timestamp) AS month FROM %s WHERE timestamp < ? ORDER BY month", defaultPartition)
+	if err := m.db.WithContext(ctx).Raw(query, cutoff.Format("2006-01-02 15:04:05")).Scan(&months).Error; err != nil {
+		return nil, fmt.Errorf("error listing expired rows of %s_default: %w", table, err)
+	}
+
+	var retired []string
+	for _, month := range months {
+		month = monthStart(month)
+		name := PartitionName(table, month)
+		from := month.Format("2006-01-02 15:04:05")
+		to := month.AddDate(0, 1, 0).Format("2006-01-02 15:04:05")
+
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if action == RetentionArchive {
+				archived := quoteIdent(ArchiveSchema) + "." + quoteIdent(name)
+				statements := []string{
+					"CREATE SCHEMA IF NOT EXISTS " + quoteIdent(ArchiveSchema),
+					fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", archived, quoteIdent(table)),
+					fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE timestamp >= '%s' AND timestamp < '%s'", archived, defaultPartition, from, to),
+				}
+				for _, statement := range statements {
+					if err := tx.Exec(statement).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE timestamp >= '%s' AND timestamp < '%s'", defaultPartition, from, to)).Error
+		})
+		if err != nil {
+			return retired, fmt.Errorf("error retiring the rows of %s from %s_default: %w", name, table, err)
+		}
+		retired = append(retired, name)
+	}
+
+	return retired, nil
+}
+
+// create adds a monthly partition. Rows of that month that already landed in
+// the default partition are moved into it, since Postgres refuses to create a
+// partition overlapping rows of the default one.
+func (m *PartitionManager) create(ctx context.Context, table string, p Partition) error {
+	defaultPartition := quoteIdent(table + "_default")
+	from := p.From.Format("2006-01-02 15:04:05")
+	to := p.To.Format("2006-01-02 15:04:05")
+	createSQL := fmt.Sprintf("CREATE TABLE %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		quoteIdent(p.Name), quoteIdent(table), from, to)
+
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var stray int64
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE timestamp >= ? AND timestamp < ?", defaultPartition)
+		if err := tx.Raw(query, from, to).Scan(&stray).Error; err != nil {
+			return err
+		}
+		if stray == 0 {
+			return tx.Exec(createSQL).Error
+		}
+
+		statements := []string{
+			fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", quoteIdent(table), defaultPartition),
+			createSQL,
+			fmt.Sprintf("INSERT INTO %s SELECT * FROM %s WHERE timestamp >= '%s' AND timestamp < '%s'",
+				quoteIdent(p.Name), defaultPartition, from, to),
+			fmt.Sprintf("DELETE FROM %s WHERE timestamp >= '%s' AND timestamp < '%s'", defaultPartition, from, to),
+			fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s DEFAULT", quoteIdent(table), defaultPartition),
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error creating partition %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// MonthlyPartitions returns the partitions of table for the month of now and
+// the monthsAhead following months, oldest first
+func MonthlyPartitions(table string, now time.Time, monthsAhead int) []Partition {
+	partitions := make([]Partition, 0, monthsAhead+1)
+	current := monthStart(now)
+	for i := 0; i <= monthsAhead; i++ {
+		from := current.AddDate(0, i, 0)
+		partitions = append(partitions, Partition{Name: PartitionName(table, from), From: from, To: from.AddDate(0, 1, 0)})
+	}
+	return partitions
+}
+
+// RetentionCutoff returns the start of the month keepMonths months before the
+// month of now. Retention retires the partitions that end at or before it.
+func RetentionCutoff(now time.Time, keepMonths int) time.Time {
+	return monthStart(now).AddDate(0, -keepMonths, 0)
+}
+
+// ValidateRetention checks the retention window and action given to Retire
+func ValidateRetention(keepMonths int, action string) error {
+	if keepMonths < 1 {
+		return fmt.Errorf("retention must keep at least one month, got %d", keepMonths)
+	}
+	if action != RetentionDrop && action != RetentionArchive {
+		return fmt.Errorf("unknown retention action %q", action)
+	}
+	return nil
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
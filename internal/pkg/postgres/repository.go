@@ -3,10 +3,15 @@ package postgres
 import (
 	"api-traffic-analytics/internal/shared/models"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // TrafficDataRepository handles CRUD operations for TrafficData using GORM
@@ -22,8 +27,8 @@ func NewTrafficDataRepository(db *gorm.DB) *TrafficDataRepository {
 // Create inserts a new traffic data record
 func (r *TrafficDataRepository) Create(ctx context.Context, data *models.TrafficData) (*models.TrafficData, error) {
 
-	// Use GORM to create the record
-	result := r.db.WithContext(ctx).Create(data)
+	// Use GORM to create the record (the location is never written from here)
+	result := r.db.WithContext(ctx).Omit(clause.Associations).Create(data)
 	if result.Error != nil {
 		return nil, fmt.Errorf("error creating traffic data: %w", result.Error)
 	}
@@ -56,7 +61,7 @@ func (r *TrafficDataRepository) Update(ctx context.Context, data *models.Traffic
 
 	// Check if any rows were affected
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("no traffic data found with id %d to update", data)
+		return fmt.Errorf("no traffic data found with id %d to update", data.ID)
 	}
 
 	return nil
@@ -147,6 +152,45 @@ func (r *TrafficDataRepository) GetByLocationAndTimeRange(ctx context.Context, l
 	return data, nil
 }
 
+// TrafficRange selects the readings of [From, To) of some locations (all of
+// them when LocationIDs is empty) that sort after the (AfterTimestamp,
+// AfterID) keyset position, oldest first
+type TrafficRange struct {
+	LocationIDs    []string
+	From           time.Time
+	To             time.Time
+	AfterTimestamp time.Time
+	AfterID        int64
+	Limit          int
+}
+
+// ListRange returns the next page of rng in (timestamp, id) order. Pass the
+// key of the last reading as the next AfterTimestamp/AfterID to walk a long
+// range in bounded batches.
+func (r *TrafficDataRepository) ListRange(ctx context.Context, rng TrafficRange) ([]*models.TrafficData, error) {
+	var data []*models.TrafficData
+
+	query := r.db.WithContext(ctx).
+		Where("timestamp >= ? AND timestamp < ?", rng.From, rng.To)
+	if len(rng.LocationIDs) > 0 {
+		query = query.Where("location_id IN ?", rng.LocationIDs)
+	}
+	if !rng.AfterTimestamp.IsZero() {
+		query = query.Where("(timestamp, id) > (?, ?)", rng.AfterTimestamp, rng.AfterID)
+	}
+
+	limit := rng.Limit
+	if limit <= 0 {
+		limit = 1000
+	}
+	result := query.Order("timestamp ASC, id ASC").Limit(limit).Find(&data)
+	if result.Error != nil {
+		return nil, fmt.Errorf("error listing traffic data range: %w", result.Error)
+	}
+
+	return data, nil
+}
+
 // GetLatestByLocation retrieves the most recent traffic data for a location
 func (r *TrafficDataRepository) GetLatestByLocation(ctx context.Context, locationID string) (*models.TrafficData, error) {
 	var data models.TrafficData
@@ -158,7 +202,7 @@ func (r *TrafficDataRepository) GetLatestByLocation(ctx context.Context, locatio
 
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("no traffic data found for location %s", locationID)
+			return nil, fmt.Errorf("no traffic data found for location %s: %w", locationID, ErrNotFound)
 		}
 		return nil, fmt.Errorf("error getting latest traffic data by location: %w", result.Error)
 	}
@@ -205,6 +249,89 @@ func (r *TrafficDataRepository) CountByLocation(ctx context.Context, locationID
 	return count, nil
 }
 
-func (r *TrafficDataRepository) CreateAnalyticsResult(ctx context.Context, result *models.AnalyticsResult) error {
-	return r.db.WithContext(ctx).Create(result).Error
+// TrafficDataFilter narrows down traffic data queries. Zero values are ignored.
+type TrafficDataFilter struct {
+	LocationID      string
+	CongestionLevel string
+	From            time.Time
+	To              time.Time
+	Limit           int
+	Cursor          string
+}
+
+// Query retrieves traffic data matching the filter, newest first, using keyset
+// pagination. It returns the cursor of the next page, or "" on the last page.
+func (r *TrafficDataRepository) Query(ctx context.Context, filter TrafficDataFilter) ([]*models.TrafficData, string, error) {
+	var data []*models.TrafficData
+
+	query := r.db.WithContext(ctx).Order("timestamp DESC, id DESC")
+	if filter.LocationID != "" {
+		query = query.Where("location_id = ?", filter.LocationID)
+	}
+	if filter.CongestionLevel != "" {
+		query = query.Where("congestion_level = ?", filter.CongestionLevel)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("timestamp >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("timestamp <= ?", filter.To)
+	}
+	if filter.Cursor != "" {
+		ts, id, err := DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("(timestamp, id) < (?, ?)", ts, id)
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if result := query.Limit(limit + 1).Find(&data); result.Error != nil {
+		return nil, "", fmt.Errorf("error querying traffic data: %w", result.Error)
+	}
+
+	var next string
+	if len(data) > limit {
+		data = data[:limit]
+		last := data[len(data)-1]
+		next = EncodeCursor(last.Timestamp, last.ID)
+	}
+
+	return data, next, nil
+}
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor builds an opaque pagination cursor from a row's sort key
+func EncodeCursor(ts time.Time, id int64) string {
+	raw := strconv.FormatInt(ts.UnixNano(), 10) + ":" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor extracts the sort key from a pagination cursor
+func DecodeCursor(cursor string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+
+	tsPart, idPart, found := strings.Cut(string(raw), ":")
+	if !found {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(tsPart, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+
+	return time.Unix(0, nanos).UTC(), id, nil
 }
@@ -0,0 +1,308 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sources a traffic series can be read from
+const (
+	SeriesSourceRaw    = "raw"
+	SeriesSourceHourly = "hourly"
+	SeriesSourceDaily  = "daily"
+)
+
+// rollupWatermark is the rollup_watermarks row tracking traffic_data rollups
+const rollupWatermark = "traffic_rollups"
+
+// seriesOrigin aligns series buckets, so daily and larger buckets start at midnight UTC
+var seriesOrigin = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// rollupSource is a rollup table a series can be read from
+type rollupSource struct {
+	Source      string
+	Table       string
+	Granularity time.Duration
+}
+
+// rollupSources lists the rollups from coarsest to finest
+var rollupSources = []rollupSource{
+	{SeriesSourceDaily, "traffic_rollup_daily", 24 * time.Hour},
+	{SeriesSourceHourly, "traffic_rollup_hourly", time.Hour},
+}
+
+// SeriesSpec describes a traffic time series over [From, To) with buckets of
+// Resolution. An empty LocationID returns one series per location.
+type SeriesSpec struct {
+	LocationID string
+	From       time.Time
+	To         time.Time
+	Resolution time.Duration
+}
+
+// TrafficSeriesPoint is one bucket of a traffic time series
+type TrafficSeriesPoint struct {
+	BucketStart      time.Time `json:"bucket_start"`
+	LocationID       string    `json:"location_id"`
+	SampleCount      int64     `json:"sample_count"`
+	VehicleTotal     int64     `json:"vehicle_total"`
+	AvgSpeed         float64   `json:"avg_speed"`
+	MinSpeed         float64   `json:"min_speed"`
+	MaxSpeed         float64   `json:"max_speed"`
+	CongestionLow    int64     `json:"congestion_low"`
+	CongestionMedium int64     `json:"congestion_medium"`
+	CongestionHigh   int64     `json:"congestion_high"`
+	CongestionSevere int64     `json:"congestion_severe"`
+}
+
+// RollupRepository maintains and queries the hourly and daily traffic_data rollups
+type RollupRepository struct {
+	db *gorm.DB
+}
+
+// NewRollupRepository creates a new instance of RollupRepository
+func NewRollupRepository(db *gorm.DB) *RollupRepository {
+	return &RollupRepository{db: db}
+}
+
+// Refresh recomputes every hourly and daily bucket that received readings
+// inserted (created_at) after the watermark and up to until, then advances
+// the watermark. Buckets are recomputed from scratch, so late readings are
+// folded in correctly. It returns the number of hourly buckets written.
+func (r *RollupRepository) Refresh(ctx context.Context, until time.Time) (int64, error) {
+	var written int64
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the watermark so concurrent refreshes do not overlap
+		var since time.Time
+		result := tx.Raw("SELECT processed_until FROM rollup_watermarks WHERE name = ? FOR UPDATE", rollupWatermark).
+			Scan(&since)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			since = time.Unix(0, 0).UTC()
+			if err := tx.Exec("INSERT INTO rollup_watermarks (name, processed_until) VALUES (?, ?) ON CONFLICT (name) DO NOTHING",
+				rollupWatermark, since).Error; err != nil {
+				return err
+			}
+		}
+		if !until.After(since) {
+			return nil
+		}
+
+		hourly := tx.Exec(`
+			INSERT INTO traffic_rollup_hourly (
+				location_id, bucket_start, sample_count, vehicle_total, speed_sum, speed_min, speed_max,
+				congestion_low, congestion_medium, congestion_high, congestion_severe, updated_at
+			)
+			SELECT td.location_id, date_trunc('hour', td.timestamp), COUNT(*), SUM(td.vehicle_count),
+				SUM(td.average_speed), MIN(td.average_speed), MAX(td.average_speed),
+				COUNT(*) FILTER (WHERE td.congestion_level = 'low'),
+				COUNT(*) FILTER (WHERE td.congestion_level = 'medium'),
+				COUNT(*) FILTER (WHERE td.congestion_level = 'high'),
+				COUNT(*) FILTER (WHERE td.congestion_level = 'severe'),
+				NOW()
+			FROM traffic_data td
+			JOIN (
+				SELECT DISTINCT location_id, date_trunc('hour', timestamp) AS bucket_start
+				FROM traffic_data WHERE created_at > ? AND created_at <= ?
+			) touched ON td.location_id = touched.location_id
+				AND td.timestamp >= touched.bucket_start
+				AND td.timestamp < touched.bucket_start + INTERVAL '1 hour'
+			GROUP BY td.location_id, date_trunc('hour', td.timestamp)
+			ON CONFLICT (location_id, bucket_start) DO UPDATE SET
+				sample_count = EXCLUDED.sample_count,
+				vehicle_total = EXCLUDED.vehicle_total,
+				speed_sum = EXCLUDED.speed_sum,
+				speed_min = EXCLUDED.speed_min,
+				speed_max = EXCLUDED.speed_max,
+				congestion_low = EXCLUDED.congestion_low,
+				congestion_medium = EXCLUDED.congestion_medium,
+				congestion_high = EXCLUDED.congestion_high,
+				congestion_severe = EXCLUDED.congestion_severe,
+				updated_at = EXCLUDED.updated_at`, since, until)
+		if hourly.Error != nil {
+			return hourly.Error
+		}
+		written = hourly.RowsAffected
+
+		// Days are rebuilt from their (now up to date) hours
+		daily := tx.Exec(`
+			INSERT INTO traffic_rollup_daily (
+				location_id, bucket_start, sample_count, vehicle_total, speed_sum, speed_min, speed_max,
+				congestion_low, congestion_medium, congestion_high, congestion_severe, updated_at
+			)
+			SELECT h.location_id, date_trunc('day', h.bucket_start), SUM(h.sample_count), SUM(h.vehicle_total),
+				SUM(h.speed_sum), MIN(h.speed_min), MAX(h.speed_max),
+				SUM(h.congestion_low), SUM(h.congestion_medium), SUM(h.congestion_high), SUM(h.congestion_severe),
+				NOW()
+			FROM traffic_rollup_hourly h
+			JOIN (
+				SELECT DISTINCT location_id, date_trunc('day', timestamp) AS day_start
+				FROM traffic_data WHERE created_at > ? AND created_at <= ?
+			) touched ON h.location_id = touched.location_id
+				AND h.bucket_start >= touched.day_start
+				AND h.bucket_start < touched.day_start + INTERVAL '1 day'
+			GROUP BY h.location_id, date_trunc('day', h.bucket_start)
+			ON CONFLICT (location_id, bucket_start) DO UPDATE SET
+				sample_count = EXCLUDED.sample_count,
+				vehicle_total = EXCLUDED.vehicle_total,
+				speed_sum = EXCLUDED.speed_sum,
+				speed_min = EXCLUDED.speed_min,
+				speed_max = EXCLUDED.speed_max,
+				congestion_low = EXCLUDED.congestion_low,
+				congestion_medium = EXCLUDED.congestion_medium,
+				congestion_high = EXCLUDED.congestion_high,
+				congestion_severe = EXCLUDED.congestion_severe,
+				updated_at = EXCLUDED.updated_at`, since, until)
+		if daily.Error != nil {
+			return daily.Error
+		}
+
+		return tx.Exec("UPDATE rollup_watermarks SET processed_until = ?, updated_at = NOW() WHERE name = ?",
+			until, rollupWatermark).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error refreshing traffic rollups: %w", err)
+	}
+
+	return written, nil
+}
+
+// Watermark returns how far the rollups are up to date, or the zero time if
+// they were never refreshed
+func (r *RollupRepository) Watermark(ctx context.Context) (time.Time, error) {
+	var until time.Time
+	result := r.db.WithContext(ctx).
+		Raw("SELECT processed_until FROM rollup_watermarks WHERE name = ?", rollupWatermark).
+		Scan(&until)
+	if result.Error != nil {
+		return time.Time{}, fmt.Errorf("error reading rollup watermark: %w", result.Error)
+	}
+	return until, nil
+}
+
+// Series returns the traffic series described by spec and the source it was
+// read from. The coarsest rollup whose granularity divides the resolution is
+// used; buckets not covered by the rollup yet (after the watermark) are
+// computed from the raw readings. From and To are expected to be aligned to
+// the resolution (see AlignSeriesRange).
+func (r *RollupRepository) Series(ctx context.Context, spec SeriesSpec) ([]*TrafficSeriesPoint, string, error) {
+	source, table, granularity := SeriesSourceRaw, "", time.Duration(0)
+	if rollup, ok := seriesRollup(spec.Resolution); ok {
+		source, table, granularity = rollup.Source, rollup.Table, rollup.Granularity
+	}
+
+	// Rollup buckets are complete up to the watermark, truncated to their granularity
+	boundary := spec.From
+	if table != "" {
+		watermark, err := r.Watermark(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		if !watermark.IsZero() {
+			boundary = watermark.UTC().Truncate(granularity)
+		}
+		if boundary.Before(spec.From) {
+			boundary = spec.From
+		}
+		if boundary.After(spec.To) {
+			boundary = spec.To
+		}
+	}
+
+	var parts []string
+	var args []interface{}
+	args = append(args, fmt.Sprintf("%d seconds", int64(spec.Resolution/time.Second)), seriesOrigin)
+
+	if table != "" && boundary.After(spec.From) {
+		part := "SELECT location_id, bucket_start, sample_count, vehicle_total, speed_sum, speed_min, speed_max, " +
+			"congestion_low, congestion_medium, congestion_high, congestion_severe " +
+			"FROM " + table + " WHERE bucket_start >= ? AND bucket_start < ?"
+		args = append(args, spec.From, boundary)
+		if spec.LocationID != "" {
+			part += " AND location_id = ?"
+			args = append(args, spec.LocationID)
+		}
+		parts = append(parts, part)
+	}
+	if spec.To.After(boundary) {
+		part := "SELECT location_id, timestamp, 1, vehicle_count, average_speed, average_speed, average_speed, " +
+			"(congestion_level = 'low')::int, (congestion_level = 'medium')::int, " +
+			"(congestion_level = 'high')::int, (congestion_level = 'severe')::int " +
+			"FROM traffic_data WHERE timestamp >= ? AND timestamp < ?"
+		args = append(args, boundary, spec.To)
+		if spec.LocationID != "" {
+			part += " AND location_id = ?"
+			args = append(args, spec.LocationID)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return []*TrafficSeriesPoint{}, source, nil
+	}
+
+	query := `
+		SELECT date_bin(CAST(? AS interval), s.bucket_start, ?) AS bucket_start, s.location_id,
+			SUM(s.sample_count) AS sample_count, SUM(s.vehicle_total) AS vehicle_total,
+			SUM(s.speed_sum) / SUM(s.sample_count) AS avg_speed,
+			MIN(s.speed_min) AS min_speed, MAX(s.speed_max) AS max_speed,
+			SUM(s.congestion_low) AS congestion_low, SUM(s.congestion_medium) AS congestion_medium,
+			SUM(s.congestion_high) AS congestion_high, SUM(s.congestion_severe) AS congestion_severe
+		FROM (` + strings.Join(parts, " UNION ALL ") + `) AS s (
+			location_id, bucket_start, sample_count, vehicle_total, speed_sum, speed_min, speed_max,
+			congestion_low, congestion_medium, congestion_high, congestion_severe
+		)
+		GROUP BY 1, s.location_id
+		ORDER BY 1, s.location_id`
+
+	var points []*TrafficSeriesPoint
+	if err := r.db.WithContext(ctx).Raw(query, args...).Scan(&points).Error; err != nil {
+		return nil, "", fmt.Errorf("error querying traffic series: %w", err)
+	}
+
+	return points, source, nil
+}
+
+// SeriesSource returns the source Series reads buckets of resolution from:
+// the coarsest rollup whose granularity divides it, or the raw readings
+func SeriesSource(resolution time.Duration) string {
+	if rollup, ok := seriesRollup(resolution); ok {
+		return rollup.Source
+	}
+	return SeriesSourceRaw
+}
+
+func seriesRollup(resolution time.Duration) (rollupSource, bool) {
+	for _, rollup := range rollupSources {
+		if resolution%rollup.Granularity == 0 {
+			return rollup, true
+		}
+	}
+	return rollupSource{}, false
+}
+
+// SeriesBucket returns the start of the bucket of resolution holding t
+func SeriesBucket(t time.Time, resolution time.Duration) time.Time {
+	offset := t.UTC().Sub(seriesOrigin)
+	bucket := offset / resolution * resolution
+	// Division truncates towards zero, which rounds times before the origin up
+	if bucket > offset {
+		bucket -= resolution
+	}
+	return seriesOrigin.Add(bucket)
+}
+
+// AlignSeriesRange widens [from, to) to whole buckets of resolution
+func AlignSeriesRange(from, to time.Time, resolution time.Duration) (time.Time, time.Time) {
+	aligned := SeriesBucket(to, resolution)
+	if aligned.Before(to) {
+		aligned = aligned.Add(resolution)
+	}
+	return SeriesBucket(from, resolution), aligned
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	madrid := time.FixedZone("CET", 3600)
+	tests := []struct {
+		name string
+		ts   time.Time
+		id   int64
+	}{
+		{name: "whole seconds", ts: time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC), id: 1},
+		{name: "nanoseconds", ts: time.Date(2024, 1, 10, 8, 0, 0, 123456789, time.UTC), id: 42},
+		{name: "other time zone", ts: time.Date(2024, 1, 10, 9, 0, 0, 0, madrid), id: 7},
+		{name: "large id", ts: time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC), id: 1<<62 + 3},
+		{name: "zero id", ts: time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), id: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := postgres.EncodeCursor(tt.ts, tt.id)
+			if strings.ContainsAny(cursor, "+/=") {
+				t.Errorf("cursor %q is not URL safe", cursor)
+			}
+
+			ts, id, err := postgres.DecodeCursor(cursor)
+			if err != nil {
+				t.Fatalf("DecodeCursor(%q): %v", cursor, err)
+			}
+			if !ts.Equal(tt.ts) || id != tt.id {
+				t.Errorf("decoded (%s, %d), want (%s, %d)", ts, id, tt.ts, tt.id)
+			}
+			if ts.Location() != time.UTC {
+				t.Errorf("decoded timestamp in %s, want UTC", ts.Location())
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	for name, cursor := range map[string]string{
+		"not base64":        "%%%",
+		"padded base64":     base64.URLEncoding.EncodeToString([]byte("1:12")),
+		"no separator":      encode("1704873600000000000"),
+		"non numeric time":  encode("yesterday:5"),
+		"non numeric id":    encode("1704873600000000000:five"),
+		"empty id":          encode("1704873600000000000:"),
+		"time out of range": encode("99999999999999999999:1"),
+		"extra separator":   encode("1:2:3"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := postgres.DecodeCursor(cursor); !errors.Is(err, postgres.ErrInvalidCursor) {
+				t.Errorf("DecodeCursor(%q) = %v, want ErrInvalidCursor", cursor, err)
+			}
+		})
+	}
+}
+
+func TestQueryBreaksTimestampTiesByID(t *testing.T) {
+	db := openDB(t)
+	noon := time.Date(2001, 3, 10, 12, 0, 0, 0, time.UTC)
+	seeded := seedReadings(t, db, "CURSOR_TEST", noon, noon, noon.Add(time.Minute), noon, noon, noon.Add(-time.Minute), noon)
+
+	// Newest first, equal timestamps by descending id
+	want := []int64{seeded[2].ID, seeded[6].ID, seeded[4].ID, seeded[3].ID, seeded[1].ID, seeded[0].ID, seeded[5].ID}
+
+	repo := postgres.NewTrafficDataRepository(db)
+	var got []int64
+	cursor := ""
+	for page := 0; page < len(want); page++ {
+		data, next, err := repo.Query(context.Background(), postgres.TrafficDataFilter{LocationID: "CURSOR_TEST", Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		for _, d := range data {
+			got = append(got, d.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("paged ids %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("paged ids %v, want %v", got, want)
+		}
+	}
+}
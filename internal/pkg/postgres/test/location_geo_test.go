@@ -0,0 +1,140 @@
+package test
+
+import (
+	"math"
+	"testing"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+)
+
+var (
+	madrid    = postgres.GeoPoint{Lat: 40.4168, Lon: -3.7038}
+	barcelona = postgres.GeoPoint{Lat: 41.3874, Lon: 2.1686}
+)
+
+func TestDistanceMeters(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b postgres.GeoPoint
+		want float64
+		tol  float64
+	}{
+		{name: "same point", a: madrid, b: madrid, want: 0, tol: 1e-6},
+		{name: "Madrid to Barcelona", a: madrid, b: barcelona, want: 505000, tol: 5000},
+		{name: "one degree of a meridian", a: postgres.GeoPoint{Lat: 10, Lon: 20}, b: postgres.GeoPoint{Lat: 11, Lon: 20}, want: 111194.9, tol: 0.5},
+		{name: "one degree of the equator", a: postgres.GeoPoint{Lat: 0, Lon: 0}, b: postgres.GeoPoint{Lat: 0, Lon: 1}, want: 111194.9, tol: 0.5},
+		{name: "across the antimeridian", a: postgres.GeoPoint{Lat: 0, Lon: 179.5}, b: postgres.GeoPoint{Lat: 0, Lon: -179.5}, want: 111194.9, tol: 0.5},
+		{name: "antipodes", a: postgres.GeoPoint{Lat: 0, Lon: 0}, b: postgres.GeoPoint{Lat: 0, Lon: 180}, want: math.Pi * 6371000, tol: 0.5},
+		{name: "pole to pole", a: postgres.GeoPoint{Lat: 90, Lon: 0}, b: postgres.GeoPoint{Lat: -90, Lon: 45}, want: math.Pi * 6371000, tol: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := postgres.DistanceMeters(tt.a, tt.b)
+			if math.Abs(got-tt.want) > tt.tol {
+				t.Errorf("DistanceMeters = %.1f, want %.1f ± %.1f", got, tt.want, tt.tol)
+			}
+			if back := postgres.DistanceMeters(tt.b, tt.a); math.Abs(back-got) > 1e-6 {
+				t.Errorf("distance is not symmetric: %.3f and %.3f", got, back)
+			}
+		})
+	}
+}
+
+// destination returns the point at distance meters from p along bearing
+// degrees, on the same sphere DistanceMeters uses
+func destination(p postgres.GeoPoint, bearing, meters float64) postgres.GeoPoint {
+	rad := math.Pi / 180
+	d := meters / 6371000
+	lat1, lon1, theta := p.Lat*rad, p.Lon*rad, bearing*rad
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(theta))
+	lon2 := lon1 + math.Atan2(math.Sin(theta)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+	lon := math.Mod(lon2/rad+540, 360) - 180
+	return postgres.GeoPoint{Lat: lat2 / rad, Lon: lon}
+}
+
+func TestRadiusBoxEnclosesTheCircle(t *testing.T) {
+	tests := []struct {
+		name   string
+		center postgres.GeoPoint
+		radius float64
+	}{
+		{name: "city", center: madrid, radius: 1000},
+		{name: "region", center: madrid, radius: 250000},
+		{name: "southern hemisphere", center: postgres.GeoPoint{Lat: -33.87, Lon: 151.21}, radius: 5000},
+		{name: "high latitude", center: postgres.GeoPoint{Lat: 78.22, Lon: 15.65}, radius: 20000},
+		{name: "wide circle at high latitude", center: postgres.GeoPoint{Lat: 70, Lon: 25}, radius: 500000},
+		{name: "next to the antimeridian", center: postgres.GeoPoint{Lat: -17.8, Lon: 179.99}, radius: 5000},
+		{name: "next to the pole", center: postgres.GeoPoint{Lat: 89.99, Lon: 0}, radius: 5000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box := postgres.RadiusBox(tt.center, tt.radius)
+			if !box.Contains(tt.center) {
+				t.Fatalf("box %+v does not contain its center", box)
+			}
+			for bearing := 0.0; bearing < 360; bearing += 5 {
+				edge := destination(tt.center, bearing, tt.radius*0.99999)
+				if !box.Contains(edge) {
+					t.Errorf("box %+v misses %+v, %.0f m away at bearing %.0f", box, edge, postgres.DistanceMeters(tt.center, edge), bearing)
+				}
+			}
+		})
+	}
+}
+
+func TestRadiusBoxBounds(t *testing.T) {
+	box := postgres.RadiusBox(madrid, 1000)
+	// One degree of latitude is 6371 km * pi / 180, the sphere of DistanceMeters
+	angle := 1000 / 6371000.0
+	if dLat := angle * 180 / math.Pi; math.Abs(box.MaxLat-madrid.Lat-dLat) > 1e-9 || math.Abs(madrid.Lat-box.MinLat-dLat) > 1e-9 {
+		t.Errorf("latitude bounds %.6f..%.6f, want ±%.6f", box.MinLat, box.MaxLat, dLat)
+	}
+	// The longitude span widens with the latitude
+	if dLon := math.Asin(math.Sin(angle)/math.Cos(madrid.Lat*math.Pi/180)) * 180 / math.Pi; math.Abs(box.MaxLon-madrid.Lon-dLon) > 1e-9 || math.Abs(madrid.Lon-box.MinLon-dLon) > 1e-9 {
+		t.Errorf("longitude bounds %.6f..%.6f, want ±%.6f", box.MinLon, box.MaxLon, dLon)
+	}
+
+	// Circles over a pole or across the antimeridian keep every longitude
+	for _, center := range []postgres.GeoPoint{{Lat: 89.99, Lon: 10}, {Lat: -89.99, Lon: 10}, {Lat: 0, Lon: 179.99}, {Lat: 0, Lon: -179.99}} {
+		box := postgres.RadiusBox(center, 5000)
+		if box.MinLon != -180 || box.MaxLon != 180 {
+			t.Errorf("box around %+v = %+v, want every longitude", center, box)
+		}
+		if box.MinLat < -90 || box.MaxLat > 90 {
+			t.Errorf("box around %+v = %+v, latitude out of range", center, box)
+		}
+	}
+}
+
+func TestBoundingBoxContains(t *testing.T) {
+	spain := postgres.BoundingBox{MinLat: 36, MinLon: -9.5, MaxLat: 43.8, MaxLon: 3.3}
+	pacific := postgres.BoundingBox{MinLat: -20, MinLon: 170, MaxLat: -10, MaxLon: -170}
+
+	tests := []struct {
+		name  string
+		box   postgres.BoundingBox
+		point postgres.GeoPoint
+		want  bool
+	}{
+		{name: "inside", box: spain, point: madrid, want: true},
+		{name: "south west corner", box: spain, point: postgres.GeoPoint{Lat: 36, Lon: -9.5}, want: true},
+		{name: "north east corner", box: spain, point: postgres.GeoPoint{Lat: 43.8, Lon: 3.3}, want: true},
+		{name: "north of it", box: spain, point: postgres.GeoPoint{Lat: 43.81, Lon: 0}, want: false},
+		{name: "east of it", box: spain, point: postgres.GeoPoint{Lat: 40, Lon: 3.31}, want: false},
+		{name: "antimeridian box, east side", box: pacific, point: postgres.GeoPoint{Lat: -17.8, Lon: 178.4}, want: true},
+		{name: "antimeridian box, west side", box: pacific, point: postgres.GeoPoint{Lat: -13.8, Lon: -171.8}, want: true},
+		{name: "antimeridian box, on 180", box: pacific, point: postgres.GeoPoint{Lat: -15, Lon: 180}, want: true},
+		{name: "antimeridian box, other side of the world", box: pacific, point: postgres.GeoPoint{Lat: -15, Lon: 0}, want: false},
+		{name: "antimeridian box, wrong latitude", box: pacific, point: postgres.GeoPoint{Lat: 0, Lon: 175}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.box.Contains(tt.point); got != tt.want {
+				t.Errorf("Contains(%+v) = %v, want %v", tt.point, got, tt.want)
+			}
+		})
+	}
+}
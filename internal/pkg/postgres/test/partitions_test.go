@@ -0,0 +1,242 @@
+package test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+)
+
+func TestRetentionCutoff(t *testing.T) {
+	madrid := time.FixedZone("CEST", 2*60*60)
+	tests := []struct {
+		name       string
+		now        time.Time
+		keepMonths int
+		want       time.Time
+	}{
+		{name: "mid month", now: time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC), keepMonths: 3, want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "first instant of the month", now: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), keepMonths: 1, want: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "last instant of the month", now: time.Date(2024, 5, 31, 23, 59, 59, 999999999, time.UTC), keepMonths: 1, want: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "across the year", now: time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC), keepMonths: 3, want: time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "a whole year", now: time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC), keepMonths: 12, want: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "months are UTC", now: time.Date(2024, 6, 1, 1, 0, 0, 0, madrid), keepMonths: 1, want: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postgres.RetentionCutoff(tt.now, tt.keepMonths); !got.Equal(tt.want) {
+				t.Errorf("RetentionCutoff(%s, %d) = %s, want %s", tt.now, tt.keepMonths, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonthlyPartitions(t *testing.T) {
+	// Starting on the 31st must not skip the shorter months that follow
+	got := postgres.MonthlyPartitions("traffic_data", time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC), 3)
+	want := []postgres.Partition{
+		{Name: "traffic_data_y2023m12", From: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "traffic_data_y2024m01", From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "traffic_data_y2024m02", From: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Name: "traffic_data_y2024m03", From: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MonthlyPartitions = %+v, want %+v", got, want)
+	}
+
+	if got := postgres.MonthlyPartitions("traffic_data", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), 0); len(got) != 1 || got[0].Name != "traffic_data_y2024m05" {
+		t.Errorf("MonthlyPartitions with no months ahead = %+v, want only May", got)
+	}
+}
+
+func TestValidateRetention(t *testing.T) {
+	tests := []struct {
+		keepMonths int
+		action     string
+		valid      bool
+	}{
+		{keepMonths: 1, action: postgres.RetentionDrop, valid: true},
+		{keepMonths: 24, action: postgres.RetentionArchive, valid: true},
+		{keepMonths: 0, action: postgres.RetentionDrop},
+		{keepMonths: -1, action: postgres.RetentionArchive},
+		{keepMonths: 6, action: "truncate"},
+		{keepMonths: 6, action: ""},
+	}
+
+	for _, tt := range tests {
+		err := postgres.ValidateRetention(tt.keepMonths, tt.action)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateRetention(%d, %q) = %v, want valid %v", tt.keepMonths, tt.action, err, tt.valid)
+		}
+	}
+}
+
+// dropPartitions removes the test partitions of traffic_data, attached or
+// archived, when the test ends
+func dropPartitions(t *testing.T, db *gorm.DB, names ...string) {
+	t.Cleanup(func() {
+		for _, name := range names {
+			db.Exec("DROP TABLE IF EXISTS " + name)
+			db.Exec("DROP TABLE IF EXISTS " + postgres.ArchiveSchema + "." + name)
+		}
+	})
+}
+
+func countRows(t *testing.T, db *gorm.DB, table, locationID string) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Table(table).Where("location_id = ?", locationID).Count(&count).Error; err != nil {
+		t.Fatalf("counting rows of %s: %v", table, err)
+	}
+	return count
+}
+
+func TestEnsureMonthlyMovesStrayRowsOutOfTheDefaultPartition(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	may := time.Date(1999, 5, 1, 0, 0, 0, 0, time.UTC)
+	seedReadings(t, db, "PARTITION_TEST", may.Add(-time.Second), may, may.Add(15*24*time.Hour), may.AddDate(0, 1, 0).Add(-time.Second), may.AddDate(0, 1, 0))
+	dropPartitions(t, db, "traffic_data_y1999m05")
+
+	if n := countRows(t, db, "traffic_data_default", "PARTITION_TEST"); n != 5 {
+		t.Fatalf("default partition has %d test rows before, want 5", n)
+	}
+
+	manager := postgres.NewPartitionManager(db)
+	created, err := manager.EnsureMonthly(ctx, "traffic_data", may.Add(10*24*time.Hour), 0)
+	if err != nil {
+		t.Fatalf("EnsureMonthly: %v", err)
+	}
+	if !reflect.DeepEqual(created, []string{"traffic_data_y1999m05"}) {
+		t.Fatalf("created %v, want traffic_data_y1999m05", created)
+	}
+
+	// [May 1, June 1): the rows one second either side stay behind
+	if n := countRows(t, db, "traffic_data_y1999m05", "PARTITION_TEST"); n != 3 {
+		t.Errorf("May partition has %d test rows, want 3", n)
+	}
+	if n := countRows(t, db, "traffic_data_default", "PARTITION_TEST"); n != 2 {
+		t.Errorf("default partition kept %d test rows, want 2", n)
+	}
+	if n := countRows(t, db, "traffic_data", "PARTITION_TEST"); n != 5 {
+		t.Errorf("traffic_data has %d test rows, want all 5", n)
+	}
+
+	var isDefault bool
+	if err := db.Raw(`SELECT relpartbound IS NOT NULL AND pg_get_expr(relpartbound, oid) = 'DEFAULT'
+		FROM pg_class WHERE relname = 'traffic_data_default'`).Scan(&isDefault).Error; err != nil || !isDefault {
+		t.Errorf("traffic_data_default is no longer the default partition (%v)", err)
+	}
+
+	created, err = manager.EnsureMonthly(ctx, "traffic_data", may, 0)
+	if err != nil || len(created) != 0 {
+		t.Errorf("second EnsureMonthly created %v (%v), want nothing", created, err)
+	}
+}
+
+func TestRetireStopsAtTheCutoff(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	april := time.Date(1998, 4, 1, 0, 0, 0, 0, time.UTC)
+	seedReadings(t, db, "PARTITION_TEST", april, april.AddDate(0, 1, 0), april.AddDate(0, 2, 0))
+	names := []string{"traffic_data_y1998m04", "traffic_data_y1998m05", "traffic_data_y1998m06"}
+	dropPartitions(t, db, names...)
+
+	manager := postgres.NewPartitionManager(db)
+	if _, err := manager.EnsureMonthly(ctx, "traffic_data", april, 2); err != nil {
+		t.Fatalf("EnsureMonthly: %v", err)
+	}
+
+	// The cutoff is June 1: May ends exactly on it and goes, June stays
+	retired, err := manager.Retire(ctx, "traffic_data", time.Date(1998, 7, 1, 0, 0, 0, 0, time.UTC), 1, postgres.RetentionArchive)
+	if err != nil {
+		t.Fatalf("Retire: %v", err)
+	}
+	if !reflect.DeepEqual(retired, names[:2]) {
+		t.Fatalf("retired %v, want %v", retired, names[:2])
+	}
+
+	partitions, err := manager.List(ctx, "traffic_data")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(partitions) == 0 || partitions[0].Name != names[2] {
+		t.Errorf("oldest attached partition = %+v, want %s", partitions, names[2])
+	}
+
+	archived, err := manager.ListArchived(ctx, "traffic_data")
+	if err != nil {
+		t.Fatalf("ListArchived: %v", err)
+	}
+	var archivedNames []string
+	for _, p := range archived {
+		if p.From.Year() == 1998 {
+			archivedNames = append(archivedNames, p.Name)
+		}
+	}
+	if !reflect.DeepEqual(archivedNames, names[:2]) {
+		t.Errorf("archived %v, want %v", archivedNames, names[:2])
+	}
+	if n := countRows(t, db, postgres.ArchiveSchema+"."+names[1], "PARTITION_TEST"); n != 1 {
+		t.Errorf("archived May partition has %d test rows, want 1", n)
+	}
+	if n := countRows(t, db, "traffic_data", "PARTITION_TEST"); n != 1 {
+		t.Errorf("traffic_data kept %d test rows, want only June's", n)
+	}
+
+	if _, err := manager.Retire(ctx, "traffic_data", time.Now(), 0, postgres.RetentionDrop); err == nil {
+		t.Error("Retire keeping no months succeeded")
+	}
+}
+
+func TestRetireDefaultPartitionRows(t *testing.T) {
+	for _, action := range []string{postgres.RetentionDrop, postgres.RetentionArchive} {
+		t.Run(action, func(t *testing.T) {
+			db := openDB(t)
+			ctx := context.Background()
+			february := time.Date(1997, 2, 1, 0, 0, 0, 0, time.UTC)
+			april := february.AddDate(0, 2, 0)
+			// No partitions: every reading lands in the default partition
+			seedReadings(t, db, "PARTITION_TEST", february.Add(time.Hour), april.Add(-time.Second), april.AddDate(0, -1, 0), april)
+			names := []string{"traffic_data_y1997m02", "traffic_data_y1997m03"}
+			dropPartitions(t, db, names...)
+
+			// The cutoff is April 1: February and March go, April stays
+			retired, err := postgres.NewPartitionManager(db).Retire(ctx, "traffic_data", time.Date(1997, 5, 15, 0, 0, 0, 0, time.UTC), 1, action)
+			if err != nil {
+				t.Fatalf("Retire: %v", err)
+			}
+			if !reflect.DeepEqual(retired, names) {
+				t.Fatalf("retired %v, want %v", retired, names)
+			}
+
+			if n := countRows(t, db, "traffic_data_default", "PARTITION_TEST"); n != 1 {
+				t.Errorf("default partition kept %d test rows, want only April's", n)
+			}
+
+			var archived int64
+			db.Raw("SELECT COUNT(*) FROM pg_tables WHERE schemaname = ? AND tablename IN ?", postgres.ArchiveSchema, names).Scan(&archived)
+			if action == postgres.RetentionDrop {
+				if archived != 0 {
+					t.Errorf("drop left %d archive tables", archived)
+				}
+				return
+			}
+			if archived != 2 {
+				t.Fatalf("archive has %d of the tables %v", archived, names)
+			}
+			if n := countRows(t, db, postgres.ArchiveSchema+"."+names[0], "PARTITION_TEST"); n != 1 {
+				t.Errorf("archived February has %d test rows, want 1", n)
+			}
+			if n := countRows(t, db, postgres.ArchiveSchema+"."+names[1], "PARTITION_TEST"); n != 2 {
+				t.Errorf("archived March has %d test rows, want 2", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+)
+
+const day = 24 * time.Hour
+
+func TestSeriesSource(t *testing.T) {
+	tests := []struct {
+		resolution time.Duration
+		want       string
+	}{
+		{resolution: time.Minute, want: postgres.SeriesSourceRaw},
+		{resolution: 15 * time.Minute, want: postgres.SeriesSourceRaw},
+		{resolution: 90 * time.Minute, want: postgres.SeriesSourceRaw},
+		{resolution: time.Hour, want: postgres.SeriesSourceHourly},
+		{resolution: 6 * time.Hour, want: postgres.SeriesSourceHourly},
+		{resolution: 36 * time.Hour, want: postgres.SeriesSourceHourly},
+		{resolution: day, want: postgres.SeriesSourceDaily},
+		{resolution: 7 * day, want: postgres.SeriesSourceDaily},
+		{resolution: 365 * day, want: postgres.SeriesSourceDaily},
+	}
+
+	for _, tt := range tests {
+		if got := postgres.SeriesSource(tt.resolution); got != tt.want {
+			t.Errorf("SeriesSource(%s) = %s, want %s", tt.resolution, got, tt.want)
+		}
+	}
+}
+
+func TestSeriesBucket(t *testing.T) {
+	tests := []struct {
+		name       string
+		at         time.Time
+		resolution time.Duration
+		want       time.Time
+	}{
+		{name: "inside an hour", at: time.Date(2024, 5, 15, 10, 42, 0, 0, time.UTC), resolution: time.Hour, want: time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)},
+		{name: "on a bucket start", at: time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC), resolution: day, want: time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)},
+		{name: "days start at midnight UTC", at: time.Date(2024, 5, 15, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60)), resolution: day, want: time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)},
+		// 2000-01-01, the origin, is a Saturday
+		{name: "weeks start on Saturday", at: time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC), resolution: 7 * day, want: time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC)},
+		{name: "before the origin", at: time.Date(1999, 12, 31, 12, 0, 0, 0, time.UTC), resolution: day, want: time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{name: "week before the origin", at: time.Date(1999, 12, 30, 0, 0, 0, 0, time.UTC), resolution: 7 * day, want: time.Date(1999, 12, 25, 0, 0, 0, 0, time.UTC)},
+		{name: "just before the origin", at: time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), resolution: time.Hour, want: time.Date(1999, 12, 31, 23, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := postgres.SeriesBucket(tt.at, tt.resolution); !got.Equal(tt.want) {
+				t.Errorf("SeriesBucket(%s, %s) = %s, want %s", tt.at, tt.resolution, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlignSeriesRangeWidensToWholeBuckets(t *testing.T) {
+	tests := []struct {
+		name             string
+		from, to         time.Time
+		resolution       time.Duration
+		wantFrom, wantTo time.Time
+	}{
+		{
+			name:       "already aligned",
+			from:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:         time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			resolution: day,
+			wantFrom:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantTo:     time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "a year in weeks",
+			from:       time.Date(2023, 3, 15, 8, 0, 0, 0, time.UTC),
+			to:         time.Date(2024, 3, 15, 8, 0, 0, 0, time.UTC),
+			resolution: 7 * day,
+			wantFrom:   time.Date(2023, 3, 11, 0, 0, 0, 0, time.UTC),
+			wantTo:     time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "across the origin",
+			from:       time.Date(1999, 12, 31, 18, 0, 0, 0, time.UTC),
+			to:         time.Date(2000, 1, 2, 6, 0, 0, 0, time.UTC),
+			resolution: day,
+			wantFrom:   time.Date(1999, 12, 31, 0, 0, 0, 0, time.UTC),
+			wantTo:     time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "decade before the origin",
+			from:       time.Date(1990, 6, 1, 12, 0, 0, 0, time.UTC),
+			to:         time.Date(1999, 6, 1, 12, 0, 0, 0, time.UTC),
+			resolution: day,
+			wantFrom:   time.Date(1990, 6, 1, 0, 0, 0, 0, time.UTC),
+			wantTo:     time.Date(1999, 6, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := postgres.AlignSeriesRange(tt.from, tt.to, tt.resolution)
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Errorf("AlignSeriesRange = [%s, %s), want [%s, %s)", from, to, tt.wantFrom, tt.wantTo)
+			}
+			if from.After(tt.from) || to.Before(tt.to) {
+				t.Errorf("[%s, %s) does not cover [%s, %s)", from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+// A long range in weeks is read from the daily rollup and adds up to the raw
+// readings
+func TestSeriesReadsLongRangesFromTheDailyRollup(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	start := time.Date(2002, 1, 5, 0, 0, 0, 0, time.UTC) // a Saturday
+	var timestamps []time.Time
+	for d := 0; d < 70; d += 3 {
+		timestamps = append(timestamps, start.Add(time.Duration(d)*day+10*time.Hour))
+	}
+	seeded := seedReadings(t, db, "SERIES_TEST", timestamps...)
+
+	repo := postgres.NewRollupRepository(db)
+	if _, err := repo.Refresh(ctx, time.Now()); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	spec := postgres.SeriesSpec{LocationID: "SERIES_TEST", Resolution: 7 * day}
+	spec.From, spec.To = postgres.AlignSeriesRange(start, start.AddDate(0, 6, 0), spec.Resolution)
+	points, source, err := repo.Series(ctx, spec)
+	if err != nil {
+		t.Fatalf("Series: %v", err)
+	}
+	if source != postgres.SeriesSourceDaily {
+		t.Errorf("source = %s, want %s", source, postgres.SeriesSourceDaily)
+	}
+
+	want := make(map[time.Time]int64)
+	for _, data := range seeded {
+		want[postgres.SeriesBucket(data.Timestamp, spec.Resolution)] += int64(data.VehicleCount)
+	}
+	if len(points) != len(want) {
+		t.Fatalf("got %d weekly points, want %d", len(points), len(want))
+	}
+	for _, point := range points {
+		if point.VehicleTotal != want[point.BucketStart.UTC()] {
+			t.Errorf("week of %s has %d vehicles, want %d", point.BucketStart, point.VehicleTotal, want[point.BucketStart.UTC()])
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+// seedReadings stores readings of a test location at each of timestamps. They
+// are removed with the location when the test ends.
+func seedReadings(t *testing.T, db *gorm.DB, locationID string, timestamps ...time.Time) []*models.TrafficData {
+	t.Helper()
+	ctx := context.Background()
+
+	location := &models.Location{ID: locationID, Name: "Export test", City: "Madrid", Latitude: 40.4, Longitude: -3.7, IsActive: true}
+	if err := postgres.NewLocationRepository(db).Create(ctx, location); err != nil {
+		t.Fatalf("creating location: %v", err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM locations WHERE id = ?", locationID) })
+
+	repo := postgres.NewTrafficDataRepository(db)
+	var stored []*models.TrafficData
+	for i, ts := range timestamps {
+		data, err := repo.Create(ctx, &models.TrafficData{LocationID: locationID, Timestamp: ts, VehicleCount: i, AverageSpeed: 40, CongestionLevel: models.CongestionLow})
+		if err != nil {
+			t.Fatalf("creating reading: %v", err)
+		}
+		stored = append(stored, data)
+	}
+	return stored
+}
+
+func TestExportStreamsTheRangeInKeyOrder(t *testing.T) {
+	db := openDB(t)
+	march := time.Date(2001, 3, 1, 0, 0, 0, 0, time.UTC)
+	noon := march.Add(12 * time.Hour)
+	seeded := seedReadings(t, db, "EXPORT_TEST", noon, march.Add(-time.Second), march, noon, march.AddDate(0, 1, 0))
+
+	repo := postgres.NewTrafficDataRepository(db)
+	for _, table := range []string{"traffic_data", "traffic_data_default"} {
+		t.Run(table, func(t *testing.T) {
+			var ids []int64
+			src := postgres.ExportSource{Table: table, From: march, To: march.AddDate(0, 1, 0)}
+			err := repo.Export(context.Background(), src, func(data *models.TrafficData) error {
+				if data.LocationID == "EXPORT_TEST" {
+					ids = append(ids, data.ID)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Export: %v", err)
+			}
+
+			// [From, To) by timestamp, ties broken by id
+			want := []int64{seeded[2].ID, seeded[0].ID, seeded[3].ID}
+			if len(ids) != len(want) {
+				t.Fatalf("exported ids %v, want %v", ids, want)
+			}
+			for i := range want {
+				if ids[i] != want[i] {
+					t.Fatalf("exported ids %v, want %v", ids, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExportStopsAtTheFirstCallbackError(t *testing.T) {
+	db := openDB(t)
+	march := time.Date(2001, 3, 1, 0, 0, 0, 0, time.UTC)
+	seedReadings(t, db, "EXPORT_TEST", march, march.Add(time.Hour))
+
+	stop := errors.New("stop")
+	calls := 0
+	src := postgres.ExportSource{Table: "traffic_data", From: march, To: march.AddDate(0, 1, 0)}
+	err := postgres.NewTrafficDataRepository(db).Export(context.Background(), src, func(*models.TrafficData) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Export returned %v after %d calls, want the callback error after 1", err, calls)
+	}
+}
+
+func TestLoadStagingKeepsTheTableOnlyOnSuccess(t *testing.T) {
+	db := openDB(t)
+	march := time.Date(2001, 3, 1, 0, 0, 0, 0, time.UTC)
+	seeded := seedReadings(t, db, "EXPORT_TEST", march, march.Add(time.Hour), march.Add(2*time.Hour))
+	repo := postgres.NewTrafficDataRepository(db)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS restore_export_test")
+		db.Exec("DROP TABLE IF EXISTS restore_export_failed")
+	})
+
+	err := repo.LoadStaging(ctx, "restore_export_test", func(insert func([]*models.TrafficData) error) error {
+		if err := insert(seeded[:2]); err != nil {
+			return err
+		}
+		return insert(seeded[2:])
+	})
+	if err != nil {
+		t.Fatalf("LoadStaging: %v", err)
+	}
+	var count int64
+	if err := db.Table("restore_export_test").Count(&count).Error; err != nil || count != 3 {
+		t.Errorf("staging table has %d rows (%v), want 3", count, err)
+	}
+
+	if err := repo.LoadStaging(ctx, "restore_export_test", func(func([]*models.TrafficData) error) error { return nil }); err == nil {
+		t.Error("LoadStaging into an existing table succeeded")
+	}
+
+	failure := errors.New("checksum mismatch")
+	err = repo.LoadStaging(ctx, "restore_export_failed", func(insert func([]*models.TrafficData) error) error {
+		if err := insert(seeded); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("LoadStaging returned %v, want the fill error", err)
+	}
+	if db.Migrator().HasTable("restore_export_failed") {
+		t.Error("a failed load left its staging table behind")
+	}
+}
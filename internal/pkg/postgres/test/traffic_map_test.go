@@ -0,0 +1,129 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"api-traffic-analytics/internal/pkg/postgres"
+	"api-traffic-analytics/internal/shared/models"
+)
+
+func TestHeatmapCellIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		cellSize float64
+		point    postgres.GeoPoint
+		lat, lon int64
+	}{
+		{name: "inside a cell", cellSize: 0.01, point: postgres.GeoPoint{Lat: 40.4168, Lon: -3.7038}, lat: 4041, lon: -371},
+		{name: "on the lower edges", cellSize: 0.5, point: postgres.GeoPoint{Lat: 40.5, Lon: 3}, lat: 81, lon: 6},
+		{name: "just below an edge", cellSize: 0.5, point: postgres.GeoPoint{Lat: 40.4999, Lon: 2.9999}, lat: 80, lon: 5},
+		{name: "negative coordinates round down", cellSize: 0.01, point: postgres.GeoPoint{Lat: -0.005, Lon: -0.015}, lat: -1, lon: -2},
+		{name: "origin", cellSize: 1, point: postgres.GeoPoint{Lat: 0, Lon: 0}, lat: 0, lon: 0},
+		{name: "south pole and antimeridian at -180", cellSize: 1, point: postgres.GeoPoint{Lat: -90, Lon: -180}, lat: -90, lon: -180},
+		{name: "north pole goes to the last cell", cellSize: 1, point: postgres.GeoPoint{Lat: 90, Lon: 0}, lat: 89, lon: 0},
+		{name: "antimeridian at 180 goes to the last cell", cellSize: 1, point: postgres.GeoPoint{Lat: 0, Lon: 180}, lat: 0, lon: 179},
+		{name: "uneven cell size at the pole", cellSize: 0.7, point: postgres.GeoPoint{Lat: 90, Lon: 180}, lat: 128, lon: 257},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := postgres.HeatmapSpec{CellSize: tt.cellSize}
+			lat, lon := spec.CellIndex(tt.point)
+			if lat != tt.lat || lon != tt.lon {
+				t.Errorf("CellIndex(%+v) = (%d, %d), want (%d, %d)", tt.point, lat, lon, tt.lat, tt.lon)
+			}
+		})
+	}
+}
+
+func TestHeatmapCellBounds(t *testing.T) {
+	spec := postgres.HeatmapSpec{CellSize: 0.7}
+
+	cell := spec.Cell(57, -6)
+	if !near(cell.MinLat, 39.9) || !near(cell.MaxLat, 40.6) || !near(cell.MinLon, -4.2) || !near(cell.MaxLon, -3.5) {
+		t.Errorf("cell (57, -6) = %+v", cell)
+	}
+	if cell.SampleCount != 0 || cell.LocationCount != 0 {
+		t.Errorf("empty cell has readings: %+v", cell)
+	}
+
+	// The last cells are clamped to the map
+	last := spec.Cell(128, 257)
+	if !near(last.MinLat, 89.6) || last.MaxLat != 90 || !near(last.MinLon, 179.9) || last.MaxLon != 180 {
+		t.Errorf("last cell = %+v, want it clamped to 90 and 180", last)
+	}
+}
+
+// Every point lies within the bounds of the cell it is binned into, whatever
+// the cell size and however the division rounds
+func TestHeatmapPointsFallInsideTheirCell(t *testing.T) {
+	for _, size := range []float64{0.001, 0.01, 0.1, 0.3, 0.7, 1} {
+		spec := postgres.HeatmapSpec{CellSize: size}
+		for lat := -90.0; lat <= 90; lat += 0.1 {
+			for _, lon := range []float64{-180, -3.7038, -0.1, 0, 0.3, 2.1686, 179.9, 180} {
+				p := postgres.GeoPoint{Lat: lat, Lon: lon}
+				cell := spec.Cell(spec.CellIndex(p))
+				if p.Lat < cell.MinLat || p.Lat > cell.MaxLat || p.Lon < cell.MinLon || p.Lon > cell.MaxLon {
+					t.Fatalf("cell size %g: %+v binned into %+v", size, p, cell)
+				}
+				if cell.MaxLat <= cell.MinLat || cell.MaxLon <= cell.MinLon {
+					t.Fatalf("cell size %g: %+v binned into the empty cell %+v", size, p, cell)
+				}
+			}
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+// The Heatmap query bins like CellIndex, poles and antimeridian included
+func TestHeatmapQueryMatchesCellIndex(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	at := time.Date(2001, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	points := map[string]postgres.GeoPoint{
+		"HEATMAP_SOL":   {Lat: 40.4168, Lon: -3.7038},
+		"HEATMAP_NEG":   {Lat: -0.005, Lon: -0.015},
+		"HEATMAP_POLE":  {Lat: 90, Lon: 180},
+		"HEATMAP_SOUTH": {Lat: -90, Lon: -180},
+	}
+	locations := postgres.NewLocationRepository(db)
+	readings := postgres.NewTrafficDataRepository(db)
+	for id, p := range points {
+		id := id
+		location := &models.Location{ID: id, Name: id, City: "Heatmap test", Latitude: p.Lat, Longitude: p.Lon, IsActive: true}
+		if err := locations.Create(ctx, location); err != nil {
+			t.Fatalf("creating %s: %v", id, err)
+		}
+		t.Cleanup(func() { db.Exec("DELETE FROM locations WHERE id = ?", id) })
+		if _, err := readings.Create(ctx, &models.TrafficData{LocationID: id, Timestamp: at, VehicleCount: 1, CongestionLevel: models.CongestionLow}); err != nil {
+			t.Fatalf("creating reading: %v", err)
+		}
+	}
+
+	spec := postgres.HeatmapSpec{Filter: postgres.MapFilter{City: "Heatmap test"}, From: at, To: at.Add(time.Hour), CellSize: 0.7}
+	cells, err := readings.Heatmap(ctx, spec)
+	if err != nil {
+		t.Fatalf("Heatmap: %v", err)
+	}
+	if len(cells) != len(points) {
+		t.Fatalf("got %d cells, want %d", len(cells), len(points))
+	}
+
+	want := make(map[postgres.HeatmapCell]bool)
+	for _, p := range points {
+		want[*spec.Cell(spec.CellIndex(p))] = true
+	}
+	for _, cell := range cells {
+		bounds := postgres.HeatmapCell{MinLat: cell.MinLat, MinLon: cell.MinLon, MaxLat: cell.MaxLat, MaxLon: cell.MaxLon}
+		if !want[bounds] || cell.SampleCount != 1 {
+			t.Errorf("unexpected cell %+v", cell)
+		}
+	}
+}
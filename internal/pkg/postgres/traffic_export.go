@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"api-traffic-analytics/internal/shared/models"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExportSource is a set of traffic readings to export: a table (traffic_data
+// or a single partition, optionally in another schema) narrowed down to
+// [From, To). Zero bounds are ignored.
+type ExportSource struct {
+	Schema string
+	Table  string
+	From   time.Time
+	To     time.Time
+}
+
+// Export streams the readings of src in (timestamp, id) order, calling fn for
+// each of them without loading the whole set in memory
+func (r *TrafficDataRepository) Export(ctx context.Context, src ExportSource, fn func(*models.TrafficData) error) error {
+	table := quoteIdent(src.Table)
+	if src.Schema != "" {
+		table = quoteIdent(src.Schema) + "." + table
+	}
+
+	var conditions []string
+	var args []interface{}
+	if !src.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, src.From)
+	}
+	if !src.To.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, src.To)
+	}
+
+	query := "SELECT * FROM " + table
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY timestamp, id"
+
+	rows, err := r.db.WithContext(ctx).Raw(query, args...).Rows()
+	if err != nil {
+		return fmt.Errorf("error exporting %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data models.TrafficData
+		if err := r.db.ScanRows(rows, &data); err != nil {
+			return fmt.Errorf("error exporting %s: %w", table, err)
+		}
+		if err := fn(&data); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error exporting %s: %w", table, err)
+	}
+	return nil
+}
+
+// LoadStaging creates table with the columns of traffic_data and fills it with
+// the batches fill passes to insert. It all happens in one transaction, so the
+// table is left behind only if fill succeeds.
+func (r *TrafficDataRepository) LoadStaging(ctx context.Context, table string, fill func(insert func([]*models.TrafficData) error) error) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE traffic_data)", quoteIdent(table))).Error; err != nil {
+			return err
+		}
+		return fill(func(batch []*models.TrafficData) error {
+			return tx.Table(table).Omit(clause.Associations).Create(batch).Error
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("error loading staging table %s: %w", table, err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package postgres
+
+import (
+	"api-traffic-analytics/internal/shared/models"
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// LocationStatus is a location with its most recent reading from the
+// current_traffic_status view (last 30 minutes). The reading fields are nil
+// when the location reported nothing in that window.
+type LocationStatus struct {
+	models.Location
+	LastReading     *time.Time `gorm:"column:last_reading" json:"last_reading,omitempty"`
+	VehicleCount    *int       `gorm:"column:vehicle_count" json:"vehicle_count,omitempty"`
+	AverageSpeed    *float64   `gorm:"column:average_speed" json:"average_speed,omitempty"`
+	CongestionLevel *string    `gorm:"column:congestion_level" json:"congestion_level,omitempty"`
+	Occupancy       *float64   `gorm:"column:occupancy" json:"occupancy,omitempty"`
+	TravelTime      *float64   `gorm:"column:travel_time" json:"travel_time,omitempty"`
+}
+
+// MapFilter narrows down map queries. A nil Box means the whole map.
+type MapFilter struct {
+	City string
+	Box  *BoundingBox
+}
+
+// HeatmapSpec describes a gridded aggregation of traffic readings. Cells are
+// CellSize degrees wide on both axes.
+type HeatmapSpec struct {
+	Filter   MapFilter
+	From     time.Time
+	To       time.Time
+	CellSize float64
+}
+
+// CellIndex returns the grid indexes of the heatmap cell holding p,
+// floor(coordinate / CellSize) on each axis as the Heatmap query bins
+// locations. Points on the north pole or the antimeridian at +180 go to the
+// last cell of their axis instead of a zero-width one.
+func (s HeatmapSpec) CellIndex(p GeoPoint) (latIndex, lonIndex int64) {
+	maxLat, maxLon := s.maxIndexes()
+	latIndex = int64(math.Min(math.Floor(p.Lat/s.CellSize), float64(maxLat)))
+	lonIndex = int64(math.Min(math.Floor(p.Lon/s.CellSize), float64(maxLon)))
+	return latIndex, lonIndex
+}
+
+// Cell returns the cell at the given grid indexes, with no readings and its
+// bounds clamped to the map
+func (s HeatmapSpec) Cell(latIndex, lonIndex int64) *HeatmapCell {
+	minLat := float64(latIndex) * s.CellSize
+	minLon := float64(lonIndex) * s.CellSize
+	return &HeatmapCell{
+		MinLat: minLat,
+		MinLon: minLon,
+		MaxLat: math.Min(minLat+s.CellSize, 90),
+		MaxLon: math.Min(minLon+s.CellSize, 180),
+	}
+}
+
+// maxIndexes returns the indexes of the last cells below 90 and 180 degrees
+func (s HeatmapSpec) maxIndexes() (maxLat, maxLon int64) {
+	return int64(math.Ceil(90/s.CellSize)) - 1, int64(math.Ceil(180/s.CellSize)) - 1
+}
+
+// HeatmapCell is one grid cell of a heatmap
+type HeatmapCell struct {
+	MinLat          float64 `json:"min_lat"`
+	MinLon          float64 `json:"min_lon"`
+	MaxLat          float64 `json:"max_lat"`
+	MaxLon          float64 `json:"max_lon"`
+	SampleCount     int64   `json:"sample_count"`
+	LocationCount   int64   `json:"location_count"`
+	AvgVehicleCount float64 `json:"avg_vehicle_count"`
+	AvgSpeed        float64 `json:"avg_speed"`
+	CongestionScore float64 `json:"congestion_score"`
+}
+
+// congestionScoreSQL maps congestion levels to 0 (low) .. 1 (severe)
+const congestionScoreSQL = "(CASE td.congestion_level WHEN 'low' THEN 0 WHEN 'medium' THEN 1 " +
+	"WHEN 'high' THEN 2 WHEN 'severe' THEN 3 END) / 3.0"
+
+// CurrentStatus returns the active locations with their latest reading from
+// the current_traffic_status view, ordered by ID
+func (r *LocationRepository) CurrentStatus(ctx context.Context, filter MapFilter) ([]*LocationStatus, error) {
+	var statuses []*LocationStatus
+
+	query := r.db.WithContext(ctx).Table("locations").
+		Select("locations.*, cts.timestamp AS last_reading, cts.vehicle_count, cts.average_speed, "+
+			"cts.congestion_level, cts.occupancy, cts.travel_time").
+		Joins("LEFT JOIN (SELECT DISTINCT ON (location_id) * FROM current_traffic_status "+
+			"ORDER BY location_id, timestamp DESC) cts ON cts.location_id = locations.id").
+		Where("locations.is_active = ?", true).
+		Order("locations.id")
+	if filter.City != "" {
+		query = query.Where("LOWER(locations.city) = LOWER(?)", filter.City)
+	}
+	if filter.Box != nil {
+		query = query.Scopes(withinBox(*filter.Box))
+	}
+
+	if err := query.Scan(&statuses).Error; err != nil {
+		return nil, fmt.Errorf("error getting current traffic status: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// Heatmap aggregates the readings of spec's time range into a lat/lon grid.
+// Only cells with at least one reading are returned.
+func (r *TrafficDataRepository) Heatmap(ctx context.Context, spec HeatmapSpec) ([]*HeatmapCell, error) {
+	if spec.CellSize <= 0 {
+		return nil, fmt.Errorf("cell size must be positive")
+	}
+
+	var rows []struct {
+		LatIndex        int64
+		LonIndex        int64
+		SampleCount     int64
+		LocationCount   int64
+		AvgVehicleCount float64
+		AvgSpeed        float64
+		CongestionScore float64
+	}
+
+	maxLat, maxLon := spec.maxIndexes()
+	query := r.db.WithContext(ctx).Table("traffic_data td").
+		Select("LEAST(floor(locations.latitude::float8 / ?), ?) AS lat_index, "+
+			"LEAST(floor(locations.longitude::float8 / ?), ?) AS lon_index, "+
+			"COUNT(*) AS sample_count, "+
+			"COUNT(DISTINCT td.location_id) AS location_count, "+
+			"AVG(td.vehicle_count) AS avg_vehicle_count, "+
+			"AVG(td.average_speed) AS avg_speed, "+
+			"AVG("+congestionScoreSQL+") AS congestion_score",
+			spec.CellSize, maxLat, spec.CellSize, maxLon).
+		Joins("JOIN locations ON locations.id = td.location_id").
+		Where("td.timestamp >= ? AND td.timestamp < ?", spec.From, spec.To).
+		Group("lat_index, lon_index").
+		Order("lat_index, lon_index")
+	if spec.Filter.City != "" {
+		query = query.Where("LOWER(locations.city) = LOWER(?)", spec.Filter.City)
+	}
+	if spec.Filter.Box != nil {
+		query = query.Scopes(withinBox(*spec.Filter.Box))
+	}
+
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error computing heatmap: %w", err)
+	}
+
+	cells := make([]*HeatmapCell, len(rows))
+	for i, row := range rows {
+		cell := spec.Cell(row.LatIndex, row.LonIndex)
+		cell.SampleCount = row.SampleCount
+		cell.LocationCount = row.LocationCount
+		cell.AvgVehicleCount = row.AvgVehicleCount
+		cell.AvgSpeed = row.AvgSpeed
+		cell.CongestionScore = row.CongestionScore
+		cells[i] = cell
+	}
+
+	return cells, nil
+}
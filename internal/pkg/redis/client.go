@@ -48,3 +48,8 @@ func GetRedisClient() (*redis.Client, error) {
 
 	return client, nil
 }
+
+// Ping checks that Redis answers
+func Ping(ctx context.Context, client *redis.Client) error {
+	return client.Ping(ctx).Err()
+}
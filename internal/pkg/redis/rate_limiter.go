@@ -0,0 +1,88 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RateLimit allows Requests per Period, in bursts of up to Requests
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// RateLimitResult is the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is how long until the full limit is available again
+	ResetAfter time.Duration
+	// RetryAfter is how long until the next request is allowed, zero when
+	// the request was allowed
+	RetryAfter time.Duration
+}
+
+// gcraScript implements the generic cell rate algorithm. The key holds the
+// theoretical arrival time (TAT) in microseconds, taken from the Redis clock
+// so that every replica agrees on it.
+var gcraScript = redis.NewScript(`
+local period = tonumber(ARGV[1])
+local interval = period / tonumber(ARGV[2])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - period
+if now < allow_at then
+	return {0, 0, math.ceil(tat - now), math.ceil(allow_at - now)}
+end
+
+redis.call('SET', KEYS[1], string.format('%d', new_tat), 'PX', math.ceil((new_tat - now) / 1000))
+return {1, math.floor((period - (new_tat - now)) / interval), math.ceil(new_tat - now), 0}
+`)
+
+// RateLimiter is a GCRA rate limiter whose state lives in Redis, so the
+// limits hold across replicas
+type RateLimiter struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRateLimiter creates a RateLimiter storing its keys under prefix
+func NewRateLimiter(client *redis.Client, prefix string) *RateLimiter {
+	return &RateLimiter{client: client, prefix: prefix}
+}
+
+// Allow counts a request for key against limit
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit RateLimit) (*RateLimitResult, error) {
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		return nil, fmt.Errorf("invalid rate limit %d/%s", limit.Requests, limit.Period)
+	}
+
+	values, err := gcraScript.Run(ctx, l.client, []string{l.prefix + key},
+		limit.Period.Microseconds(), limit.Requests).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("error checking rate limit: %w", err)
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit reply %v", values)
+	}
+
+	return &RateLimitResult{
+		Allowed:    values[0] == 1,
+		Limit:      limit.Requests,
+		Remaining:  int(values[1]),
+		ResetAfter: time.Duration(values[2]) * time.Microsecond,
+		RetryAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
@@ -26,6 +26,12 @@ func (r *CacheRepository) SetCache(ctx context.Context, key string, value interf
 	return r.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetCacheIfAbsent sets a value only if the key does not exist. It reports
+// whether the value was set.
+func (r *CacheRepository) SetCacheIfAbsent(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, expiration).Result()
+}
+
 // GetCache gets a value from the cache.
 func (r *CacheRepository) GetCache(ctx context.Context, key string) (string, error) {
 	val, err := r.client.Get(ctx, key).Result()
@@ -35,7 +41,10 @@ func (r *CacheRepository) GetCache(ctx context.Context, key string) (string, err
 	return val, err
 }
 
-// DeleteCache deletes a value from the cache.
-func (r *CacheRepository) DeleteCache(ctx context.Context, key string) error {
-	return r.client.Del(ctx, key).Err()
+// DeleteCache deletes one or more values from the cache.
+func (r *CacheRepository) DeleteCache(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(ctx, keys...).Err()
 }
@@ -0,0 +1,16 @@
+package shared
+
+// Identity headers the api-gateway sets on the requests it forwards to the
+// internal services once it has authenticated the caller. The gateway drops
+// them from incoming requests, so clients cannot forge them.
+const (
+	HeaderUserID     = "X-User-ID"
+	HeaderUserRoles  = "X-User-Roles"
+	HeaderUserScopes = "X-User-Scopes"
+	HeaderAuthMethod = "X-Auth-Method"
+)
+
+// HeaderRequestID identifies a request across the api-gateway and the
+// internal services. The gateway keeps a well-formed client value and
+// generates one otherwise.
+const HeaderRequestID = "X-Request-ID"
@@ -18,6 +18,8 @@ type ErrorResponse struct {
     Code    int    `json:"code,omitempty"`
     Message string `json:"message"`
     Details interface{} `json:"details,omitempty"`
+    // RequestID identifica la request en los logs del gateway
+    RequestID string `json:"request_id,omitempty"`
 }
 
 // Helper function para crear timestamps consistentes
@@ -32,6 +34,13 @@ type SuccessResponse struct {
     Data    interface{} `json:"data,omitempty"`
 }
 
+// PageResponse representa una página de resultados con paginación por cursor
+type PageResponse struct {
+    Data       interface{} `json:"data"`
+    Count      int         `json:"count"`
+    NextCursor string      `json:"next_cursor,omitempty"`
+}
+
 // =====================================================
 // LOCATIONS
 // =====================================================
@@ -53,7 +62,7 @@ type Location struct {
 // TRAFFIC DATA
 // =====================================================
 type TrafficData struct {
-	ID              int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ID              int64     `gorm:"primaryKey;autoIncrement" json:"id"`
 	UUID            string    `gorm:"type:uuid;default:uuid_generate_v4()" json:"uuid"`
 	Timestamp       time.Time `gorm:"autoCreateTime" json:"timestamp"`
 	LocationID      string    `gorm:"size:50;not null" json:"location_id" validate:"required"`
@@ -98,6 +107,18 @@ type AnalyticsResult struct {
 	Location *Location `gorm:"foreignKey:LocationID;references:ID" json:"location,omitempty"`
 }
 
+// AnalyticsSummary es una fila de la vista analytics_summary (últimas 24 horas)
+type AnalyticsSummary struct {
+	LocationID   string    `json:"location_id"`
+	LocationName string    `json:"location_name"`
+	MetricType   string    `json:"metric_type"`
+	AvgValue     float64   `json:"avg_value"`
+	MaxValue     float64   `json:"max_value"`
+	MinValue     float64   `json:"min_value"`
+	SampleCount  int64     `json:"sample_count"`
+	LastAnalysis time.Time `json:"last_analysis"`
+}
+
 const (
 	// Congestion Levels
 	CongestionLow    = "low"
@@ -226,3 +247,68 @@ type AuditLog struct {
 	Timestamp time.Time `gorm:"autoCreateTime" json:"timestamp"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
+
+// =====================================================
+// GEOJSON
+// =====================================================
+type GeoJSONFeatureCollection struct {
+	Type     string            `json:"type"`
+	Features []*GeoJSONFeature `json:"features"`
+}
+
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// =====================================================
+// API KEYS
+// =====================================================
+type APIKey struct {
+	ID          int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	KeyID       string     `gorm:"size:32;not null;unique" json:"key_id"`
+	KeyHash     string     `gorm:"size:64;not null" json:"-"`
+	Name        string     `gorm:"size:100;not null" json:"name"`
+	Owner       string     `gorm:"size:100;not null" json:"owner"`
+	Scopes      []string   `gorm:"serializer:json;type:jsonb;not null" json:"scopes"`
+	RateLimit   *int       `json:"rate_limit,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RotatedFrom *int       `json:"rotated_from,omitempty"`
+	CreatedBy   string     `gorm:"size:100" json:"created_by,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// =====================================================
+// BACKFILL CHECKPOINTS
+// =====================================================
+
+// Sources a backfill can read readings from
+const (
+	BackfillSourceDatabase = "database"
+	BackfillSourceKafka    = "kafka"
+)
+
+// BackfillCheckpoint is the saved progress of a named backfill run. Spec and
+// Position are JSON documents owned by the backfill itself.
+type BackfillCheckpoint struct {
+	Name              string     `gorm:"primaryKey;size:100" json:"name"`
+	Source            string     `gorm:"size:20;not null" json:"source"`
+	Spec              []byte     `gorm:"type:jsonb;not null" json:"spec"`
+	Position          []byte     `gorm:"type:jsonb;not null" json:"position"`
+	ProcessorVersion  string     `gorm:"size:50;not null" json:"processor_version"`
+	ReadingsProcessed int64      `gorm:"not null" json:"readings_processed"`
+	ResultsWritten    int64      `gorm:"not null" json:"results_written"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+	CreatedAt         time.Time  `gorm:"not null" json:"created_at"`
+	UpdatedAt         time.Time  `gorm:"not null" json:"updated_at"`
+}
@@ -0,0 +1,6 @@
+package shared
+
+// Version is the version of the running service. Builds set it with
+//
+//	-ldflags "-X api-traffic-analytics/internal/shared.Version=<version>"
+var Version = "dev"